@@ -0,0 +1,203 @@
+// Package acl authenticates users and checks their access to commands and keys.
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+var (
+	ErrAuthFailed   = errors.New("WRONGPASS invalid username-password pair")
+	ErrNoAuth       = errors.New("NOAUTH authentication required")
+	ErrNoPermission = errors.New("NOPERM no permission")
+)
+
+// AllCommands allows a user to run every command.
+const AllCommands = "*"
+
+// User is allowed to run Commands and to read and write
+// keys matching glob patterns of ReadKeys and WriteKeys.
+type User struct {
+	Name string
+	// Password is a hash created by HashPassword.
+	Password  string
+	Commands  []string
+	ReadKeys  []string
+	WriteKeys []string
+}
+
+type user struct {
+	User
+	hash     passwordHash
+	commands map[string]bool
+}
+
+// ACL holds the users. An ACL without users allows everything.
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*user
+}
+
+func New(users ...User) (*ACL, error) {
+	a := &ACL{users: make(map[string]*user, len(users))}
+	for _, u := range users {
+		if u.Name == "" {
+			return nil, errors.New("user name is required")
+		}
+		if _, ok := a.users[u.Name]; ok {
+			return nil, fmt.Errorf("duplicated user %q", u.Name)
+		}
+		hash, err := parseHash(u.Password)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %w", u.Name, err)
+		}
+		for _, pattern := range slices.Concat(u.ReadKeys, u.WriteKeys) {
+			if err = validPattern(pattern); err != nil {
+				return nil, fmt.Errorf("user %q: %w", u.Name, err)
+			}
+		}
+
+		commands := make(map[string]bool, len(u.Commands))
+		for _, cmd := range u.Commands {
+			commands[strings.ToUpper(cmd)] = true
+		}
+		a.users[u.Name] = &user{User: u, hash: hash, commands: commands}
+	}
+	return a, nil
+}
+
+func FromConfig(cfg config.ACL) (*ACL, error) {
+	users := make([]User, 0, len(cfg.Users))
+	for _, u := range cfg.Users {
+		users = append(users, User{
+			Name:      u.Name,
+			Password:  u.Password,
+			Commands:  u.Commands,
+			ReadKeys:  u.ReadKeys,
+			WriteKeys: u.WriteKeys,
+		})
+	}
+	return New(users...)
+}
+
+// Replace replaces the users by users of other. Sessions of removed
+// users lose access, removing all users disables authentication.
+func (a *ACL) Replace(other *ACL) {
+	other.mu.RLock()
+	users := other.users
+	other.mu.RUnlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users = users
+}
+
+// Enabled reports whether sessions have to authenticate.
+func (a *ACL) Enabled() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.users) > 0
+}
+
+// Authenticate checks the password of the user.
+func (a *ACL) Authenticate(name, password string) error {
+	a.mu.RLock()
+	u, ok := a.users[name]
+	a.mu.RUnlock()
+	if !ok {
+		// spend the same time as for a known user, so user names can't be guessed
+		_ = dummyHash.verify(password)
+		return ErrAuthFailed
+	}
+	if !u.hash.verify(password) {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// Exists reports whether the user is known.
+func (a *ACL) Exists(name string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.users[name]
+	return ok
+}
+
+// Access describes what a command does with its keys.
+type Access struct {
+	Command string
+	Keys    []string
+	Read    bool
+	Write   bool
+}
+
+// Authorize checks that the user can run the command and access its keys.
+func (a *ACL) Authorize(name string, access Access) error {
+	if !a.Enabled() {
+		return nil
+	}
+	a.mu.RLock()
+	u, ok := a.users[name]
+	a.mu.RUnlock()
+	if !ok {
+		return ErrNoAuth
+	}
+
+	cmd := strings.ToUpper(access.Command)
+	if !u.commands[AllCommands] && !u.commands[cmd] {
+		return fmt.Errorf("%w: user %q can't run the %s command", ErrNoPermission, name, cmd)
+	}
+	for _, key := range access.Keys {
+		if access.Read && !matchAny(u.ReadKeys, key) {
+			return fmt.Errorf("%w: user %q can't read the key %q", ErrNoPermission, name, key)
+		}
+		if access.Write && !matchAny(u.WriteKeys, key) {
+			return fmt.Errorf("%w: user %q can't write the key %q", ErrNoPermission, name, key)
+		}
+	}
+	return nil
+}
+
+// List describes the rules of every user, ordered by name. Passwords are omitted.
+func (a *ACL) List() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		u := a.users[name]
+		lines = append(lines, fmt.Sprintf("user %s commands=%s read=%s write=%s",
+			name, list(u.Commands), list(u.ReadKeys), list(u.WriteKeys)))
+	}
+	return lines
+}
+
+func list(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ",")
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package acl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+func testACL(t *testing.T) *ACL {
+	t.Helper()
+	a, err := FromConfig(config.ACL{Users: []config.ACLUser{
+		{Name: "admin", Password: HashPassword("root"), Commands: []string{"*"}, ReadKeys: []string{"*"}, WriteKeys: []string{"*"}},
+		{Name: "app", Password: HashPassword("secret"), Commands: []string{"get", "SET"}, ReadKeys: []string{"app:*", "shared:*"}, WriteKeys: []string{"app:*"}},
+	}})
+	require.NoError(t, err)
+	return a
+}
+
+func TestNew(t *testing.T) {
+	hash := HashPassword("secret")
+	tests := []struct {
+		name    string
+		users   []User
+		wantErr string
+	}{
+		{name: "empty"},
+		{name: "valid", users: []User{{Name: "a", Password: hash}, {Name: "b", Password: hash}}},
+		{name: "no name", users: []User{{Password: hash}}, wantErr: "user name is required"},
+		{name: "duplicated", users: []User{{Name: "a", Password: hash}, {Name: "a", Password: hash}}, wantErr: `duplicated user "a"`},
+		{name: "plain password", users: []User{{Name: "a", Password: "secret"}}, wantErr: ErrInvalidHash.Error()},
+		{name: "short hash", users: []User{{Name: "a", Password: "sha256$00$0011"}}, wantErr: ErrInvalidHash.Error()},
+		{
+			name:    "invalid pattern",
+			users:   []User{{Name: "a", Password: hash, ReadKeys: []string{"app:[a-"}}},
+			wantErr: ErrInvalidPattern.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.users...)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestACL_Authenticate(t *testing.T) {
+	a := testACL(t)
+	require.NoError(t, a.Authenticate("app", "secret"))
+	require.ErrorIs(t, a.Authenticate("app", "root"), ErrAuthFailed)
+	require.ErrorIs(t, a.Authenticate("nobody", "secret"), ErrAuthFailed)
+	assert.True(t, a.Exists("admin"))
+	assert.False(t, a.Exists("nobody"))
+}
+
+func TestACL_Authorize(t *testing.T) {
+	a := testACL(t)
+	tests := []struct {
+		name    string
+		user    string
+		access  Access
+		wantErr error
+	}{
+		{name: "all commands", user: "admin", access: Access{Command: "FLUSHALL"}},
+		{name: "allowed command", user: "app", access: Access{Command: "GET", Keys: []string{"app:1"}, Read: true}},
+		{name: "denied command", user: "app", access: Access{Command: "DEL", Keys: []string{"app:1"}, Write: true}, wantErr: ErrNoPermission},
+		{name: "read shared", user: "app", access: Access{Command: "GET", Keys: []string{"shared:1"}, Read: true}},
+		{name: "write shared", user: "app", access: Access{Command: "SET", Keys: []string{"shared:1"}, Write: true}, wantErr: ErrNoPermission},
+		{name: "read other", user: "app", access: Access{Command: "GET", Keys: []string{"other"}, Read: true}, wantErr: ErrNoPermission},
+		{name: "unknown user", user: "nobody", access: Access{Command: "GET"}, wantErr: ErrNoAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Authorize(tt.user, tt.access)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	disabled, err := New()
+	require.NoError(t, err)
+	assert.False(t, disabled.Enabled())
+	require.NoError(t, disabled.Authorize("", Access{Command: "FLUSHALL"}))
+}
+
+func TestACL_List(t *testing.T) {
+	assert.Equal(t, []string{
+		"user admin commands=* read=* write=*",
+		"user app commands=get,SET read=app:*,shared:* write=app:*",
+	}, testACL(t).List())
+}
+
+func TestACL_Replace(t *testing.T) {
+	a := testACL(t)
+	b, err := New(User{Name: "app", Password: HashPassword("new"), Commands: []string{"GET"}, ReadKeys: []string{"*"}})
+	require.NoError(t, err)
+
+	a.Replace(b)
+	require.ErrorIs(t, a.Authenticate("app", "secret"), ErrAuthFailed)
+	require.NoError(t, a.Authenticate("app", "new"))
+	require.ErrorIs(t, a.Authorize("admin", Access{Command: "GET"}), ErrNoAuth, "removed users lose access")
+	require.ErrorIs(t, a.Authorize("app", Access{Command: "SET"}), ErrNoPermission)
+
+	empty, err := New()
+	require.NoError(t, err)
+	a.Replace(empty)
+	assert.False(t, a.Enabled())
+	require.NoError(t, a.Authorize("", Access{Command: "SET"}))
+}
+
+func TestHashPassword(t *testing.T) {
+	first, second := HashPassword("secret"), HashPassword("secret")
+	assert.NotEqual(t, first, second, "hashes are salted")
+	assert.True(t, strings.HasPrefix(first, "$argon2id$v=19$m=19456,t=2,p=1$"), first)
+
+	h, err := parseHash(first)
+	require.NoError(t, err)
+	assert.True(t, h.verify("secret"))
+	assert.False(t, h.verify("Secret"))
+
+	// costs are read from the hash
+	cheap := passwordHash{params: hashParams{memory: 64, iterations: 1, threads: 1}, salt: []byte("salt")}
+	cheap.sum = cheap.derive("secret")
+	h, err = parseHash(cheap.String())
+	require.NoError(t, err)
+	assert.Equal(t, cheap.params, h.params)
+	assert.True(t, h.verify("secret"))
+}
+
+func TestParseHash_Errors(t *testing.T) {
+	for _, s := range []string{
+		"sha256$00$11",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$c3Vt",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$c3Vt",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$c3Vt",
+		"$argon2id$v=19$m=2097152,t=1,p=1$c2FsdA$c3Vt",
+		"$argon2id$v=19$m=64,t=1,p=1$$c3Vt",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!",
+	} {
+		_, err := parseHash(s)
+		assert.ErrorIs(t, err, ErrInvalidHash, s)
+	}
+}
@@ -0,0 +1,106 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidPattern = errors.New("invalid key pattern")
+
+// Match reports whether the key matches the glob pattern.
+// The pattern supports * for any sequence of bytes, ? for a single byte,
+// [abc], [a-z] and [^a] for byte classes and \ to escape special bytes.
+// Unlike path.Match, * matches slashes too.
+func Match(pattern, key string) bool {
+	p, k := 0, 0
+	// position after the last star and the key position it matched up to
+	star, starKey := -1, 0
+	for k < len(key) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, starKey = p+1, k
+				p++
+				continue
+			case '?':
+				p++
+				k++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(pattern, p, key[k]); ok && matched {
+					p = next
+					k++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == key[k] {
+					p += 2
+					k++
+					continue
+				}
+			default:
+				if pattern[p] == key[k] {
+					p++
+					k++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// let the last star match one more byte
+		starKey++
+		p, k = star, starKey
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches the byte against the class starting at pattern[start]
+// and returns the position after the class.
+func matchClass(pattern string, start int, c byte) (matched bool, next int, ok bool) {
+	i := start + 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		i++
+	}
+	return false, 0, false
+}
+
+func validPattern(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			if _, next, ok := matchClass(pattern, i, 0); ok {
+				i = next - 1
+				continue
+			}
+			return fmt.Errorf("%w %q: unterminated class", ErrInvalidPattern, pattern)
+		}
+	}
+	return nil
+}
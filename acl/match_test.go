@@ -0,0 +1,42 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "any/key", true},
+		{"app:*", "app:1", true},
+		{"app:*", "app:", true},
+		{"app:*", "ap", false},
+		{"*:cache", "users:1:cache", true},
+		{"*:cache", "users:1:cache:x", false},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"user:?", "user:1", true},
+		{"user:?", "user:12", false},
+		{"user:[0-9]", "user:7", true},
+		{"user:[0-9]", "user:x", false},
+		{"user:[^0-9]", "user:x", true},
+		{"user:[abc]", "user:b", true},
+		{"user:[]]", "user:]", true},
+		{`user:\*`, "user:*", true},
+		{`user:\*`, "user:1", false},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, Match(tt.pattern, tt.key))
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package acl
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Password hashes are argon2id hashes in the PHC string format:
+//
+//	$argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<hash>
+//
+// with unpadded base64 salt and hash. The costs are kept in the hash,
+// so hashes created with other costs stay valid when defaults change.
+const (
+	hashScheme = "argon2id"
+	saltSize   = 16
+	keySize    = 32
+)
+
+// defaultParams are the costs recommended by OWASP for argon2id.
+var defaultParams = hashParams{memory: 19 * 1024, iterations: 2, threads: 1}
+
+// maxMemory limits the memory cost of hashes from the config, 1 GiB.
+const maxMemory = 1 << 20
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type hashParams struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+}
+
+type passwordHash struct {
+	params hashParams
+	salt   []byte
+	sum    []byte
+}
+
+// dummyHash is verified for unknown users, so they take as long as known ones.
+var dummyHash = passwordHash{params: defaultParams, salt: make([]byte, saltSize), sum: make([]byte, keySize)}
+
+// HashPassword returns the hash of the password with a random salt for the config.
+func HashPassword(password string) string {
+	salt := make([]byte, saltSize)
+	_, _ = rand.Read(salt)
+	h := passwordHash{params: defaultParams, salt: salt}
+	h.sum = h.derive(password)
+	return h.String()
+}
+
+func (h passwordHash) String() string {
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", hashScheme, argon2.Version,
+		h.params.memory, h.params.iterations, h.params.threads,
+		b64.EncodeToString(h.salt), b64.EncodeToString(h.sum))
+}
+
+func parseHash(s string) (passwordHash, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != hashScheme {
+		return passwordHash{}, fmt.Errorf("%w: expected $%s$v=%d$m=<memory>,t=<iterations>,p=<threads>$<salt>$<hash>",
+			ErrInvalidHash, hashScheme, argon2.Version)
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return passwordHash{}, fmt.Errorf("%w: unsupported version %q", ErrInvalidHash, parts[2])
+	}
+	var p hashParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.threads); err != nil {
+		return passwordHash{}, fmt.Errorf("%w: parameters: %w", ErrInvalidHash, err)
+	}
+	if p.memory == 0 || p.memory > maxMemory || p.iterations == 0 || p.threads == 0 {
+		return passwordHash{}, fmt.Errorf("%w: parameters out of range %q", ErrInvalidHash, parts[3])
+	}
+
+	b64 := base64.RawStdEncoding
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return passwordHash{}, fmt.Errorf("%w: invalid salt", ErrInvalidHash)
+	}
+	sum, err := b64.DecodeString(parts[5])
+	if err != nil || len(sum) == 0 {
+		return passwordHash{}, fmt.Errorf("%w: invalid hash", ErrInvalidHash)
+	}
+	return passwordHash{params: p, salt: salt, sum: sum}, nil
+}
+
+func (h passwordHash) verify(password string) bool {
+	return subtle.ConstantTimeCompare(h.sum, h.derive(password)) == 1
+}
+
+func (h passwordHash) derive(password string) []byte {
+	size := uint32(len(h.sum))
+	if size == 0 {
+		size = keySize
+	}
+	return argon2.IDKey([]byte(password), h.salt, h.params.iterations, h.params.memory, h.params.threads, size)
+}
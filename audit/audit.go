@@ -0,0 +1,270 @@
+// Package audit appends commands to a tamper-evident trail. Entries are
+// JSON lines, every entry holds the hash of the previous one and its own
+// hash, so a changed, removed or inserted entry breaks the chain.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/queue"
+)
+
+// DefaultQueueSize is the number of entries waiting for the write.
+const DefaultQueueSize = 1024
+
+// redacted replaces values of redacted entries.
+const redacted = "(redacted)"
+
+// Overflow selects what happens to entries recorded while the queue is full.
+type Overflow int
+
+const (
+	// Block waits for space in the queue, slowing down commands.
+	Block Overflow = iota
+	// Drop drops the entry and counts it.
+	Drop
+)
+
+func (o Overflow) String() string {
+	switch o {
+	case Block:
+		return "block"
+	case Drop:
+		return "drop"
+	}
+	return "unknown"
+}
+
+// ParseOverflow parses the name of the overflow behavior.
+func ParseOverflow(s string) (Overflow, error) {
+	for _, o := range []Overflow{Block, Drop} {
+		if s == o.String() {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow %q, expected %s or %s", s, Block, Drop)
+}
+
+// Entry is a command of the trail. Value is written only when values are
+// not redacted. Prev and Hash are set by the log.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Client  string    `json:"client"`
+	Command string    `json:"command"`
+	Key     string    `json:"key,omitempty"`
+	Args    []string  `json:"args,omitempty"`
+	Value   string    `json:"value,omitempty"`
+	Outcome string    `json:"outcome"`
+	Prev    string    `json:"prev"`
+	Hash    string    `json:"hash"`
+}
+
+// hash returns the hash of the entry with its Prev and without its Hash.
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Options configures the log. QueueSize is DefaultQueueSize when zero.
+type Options struct {
+	QueueSize    int
+	Overflow     Overflow
+	RedactValues bool
+}
+
+// Log writes entries asynchronously. Methods of a nil Log do nothing.
+type Log struct {
+	logger *slog.Logger
+	opts   Options
+	f      *os.File
+	w      *bufio.Writer
+	prev   string
+	queue  *queue.Queue[Entry]
+	once   sync.Once
+}
+
+// Open appends entries to the file, continuing the chain of its last entry.
+func Open(l *slog.Logger, path string, opts Options) (*Log, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := lastHash(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read audit log %s: %w", path, err)
+	}
+
+	a := &Log{
+		logger: l.With("module", "audit"),
+		opts:   opts,
+		f:      f,
+		w:      bufio.NewWriter(f),
+		prev:   prev,
+	}
+	a.queue = queue.New(opts.QueueSize, opts.Overflow == Block, a.run)
+	return a, nil
+}
+
+// lastHashWindow is the tail of the file searched for the last entry.
+const lastHashWindow = 64 << 10
+
+// lastHash returns the hash of the last entry of the file, empty for an empty file.
+func lastHash(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+	if size == 0 {
+		return "", nil
+	}
+	window := min(size, lastHashWindow)
+	buf := make([]byte, window)
+	if _, err = f.ReadAt(buf, size-window); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	buf = bytes.TrimRight(buf, "\n")
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	} else if window < size {
+		return "", errors.New("last entry is too long")
+	}
+	var e Entry
+	if err = json.Unmarshal(buf, &e); err != nil {
+		return "", fmt.Errorf("last entry: %w", err)
+	}
+	return e.Hash, nil
+}
+
+// Redacts reports whether values are omitted from entries.
+func (a *Log) Redacts() bool {
+	return a == nil || a.opts.RedactValues
+}
+
+// Dropped returns the number of entries dropped by the full queue.
+func (a *Log) Dropped() uint64 {
+	if a == nil {
+		return 0
+	}
+	return a.queue.Dropped()
+}
+
+// Record queues the entry. Entries recorded after Close are dropped.
+func (a *Log) Record(e Entry) {
+	if a == nil {
+		return
+	}
+	if a.opts.RedactValues && e.Value != "" {
+		e.Value = redacted
+	}
+	a.queue.Send(e)
+}
+
+func (a *Log) run(entries <-chan Entry) {
+	for e := range entries {
+		if err := a.write(e); err != nil {
+			a.logger.Error("failed to write audit entry", slog.Any("error", err))
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err := a.w.Flush(); err != nil {
+			a.logger.Error("failed to flush audit log", slog.Any("error", err))
+		}
+	}
+}
+
+func (a *Log) write(e Entry) error {
+	e.Prev = a.prev
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err = a.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	a.prev = hash
+	return nil
+}
+
+// Close writes the queued entries and closes the file.
+func (a *Log) Close() error {
+	if a == nil {
+		return nil
+	}
+	var err error
+	a.once.Do(func() {
+		a.queue.Close()
+		err = errors.Join(a.w.Flush(), a.f.Sync(), a.f.Close())
+	})
+	return err
+}
+
+// Collect implements metrics.Collector.
+func (a *Log) Collect() []metrics.Family {
+	return []metrics.Family{{
+		Name:    "bcdb_audit_dropped_total",
+		Help:    "Audit entries dropped by the full queue.",
+		Type:    metrics.TypeCounter,
+		Samples: []metrics.Sample{{Value: float64(a.Dropped())}},
+	}}
+}
+
+// Verify checks the chain of entries read from r. It returns the number
+// of verified entries and an error describing the first broken entry.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	prev := ""
+	n := 0
+	for scanner.Scan() {
+		line := n + 1
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return n, fmt.Errorf("entry %d: %w", line, err)
+		}
+		if e.Prev != prev {
+			return n, fmt.Errorf("entry %d: previous hash mismatch, entries are removed or reordered", line)
+		}
+		hash, err := e.hash()
+		if err != nil {
+			return n, fmt.Errorf("entry %d: %w", line, err)
+		}
+		if e.Hash != hash {
+			return n, fmt.Errorf("entry %d: hash mismatch, the entry is changed", line)
+		}
+		prev = e.Hash
+		n++
+	}
+	return n, scanner.Err()
+}
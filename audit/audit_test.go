@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func writeEntries(t *testing.T, path string, opts Options, entries ...Entry) {
+	t.Helper()
+	a, err := Open(noopLogger, path, opts)
+	require.NoError(t, err)
+	for _, e := range entries {
+		a.Record(e)
+	}
+	require.NoError(t, a.Close())
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeEntries(t, path, Options{RedactValues: true},
+		Entry{Time: now, User: "app", Client: "127.0.0.1:5000", Command: "SET", Key: "k", Value: "secret", Outcome: "ok"},
+		Entry{Time: now, User: "app", Client: "127.0.0.1:5000", Command: "DEL", Key: "k", Outcome: "not found"},
+	)
+	// the chain continues after reopening
+	writeEntries(t, path, Options{}, Entry{Time: now, Command: "SET", Key: "k", Value: "visible", Outcome: "ok"})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"value":"(redacted)"`)
+	assert.NotContains(t, lines[0], "secret")
+	assert.Contains(t, lines[0], `"prev":""`)
+	assert.Contains(t, lines[2], `"value":"visible"`)
+
+	n, err := Verify(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestVerify_Tampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var entries []Entry
+	for _, key := range []string{"a", "b", "c"} {
+		entries = append(entries, Entry{Command: "SET", Key: key, Outcome: "ok"})
+	}
+	writeEntries(t, path, Options{}, entries...)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	tests := []struct {
+		name    string
+		lines   []string
+		want    int
+		wantErr string
+	}{
+		{name: "changed", lines: []string{lines[0], strings.Replace(lines[1], `"key":"b"`, `"key":"x"`, 1), lines[2]}, want: 1, wantErr: "entry 2: hash mismatch"},
+		{name: "removed", lines: []string{lines[0], lines[2]}, want: 1, wantErr: "entry 2: previous hash mismatch"},
+		{name: "reordered", lines: []string{lines[1], lines[0]}, want: 0, wantErr: "entry 1: previous hash mismatch"},
+		{name: "garbage", lines: []string{lines[0], "{"}, want: 1, wantErr: "entry 2:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, vErr := Verify(strings.NewReader(strings.Join(tt.lines, "\n")))
+			require.ErrorContains(t, vErr, tt.wantErr)
+			assert.Equal(t, tt.want, n)
+		})
+	}
+}
+
+func TestLog_Drop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := Open(noopLogger, path, Options{QueueSize: 1, Overflow: Drop})
+	require.NoError(t, err)
+	// entries are dropped when the writer falls behind and after Close
+	for range 100 {
+		a.Record(Entry{Command: "SET", Outcome: "ok"})
+	}
+	require.NoError(t, a.Close())
+	a.Record(Entry{Command: "SET", Outcome: "ok"})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	written := strings.Count(string(data), "\n")
+	assert.Equal(t, uint64(101-written), a.Dropped())
+	_, err = Verify(bytes.NewReader(data))
+	require.NoError(t, err)
+}
+
+func TestOpen_CorruptedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"), 0o600))
+	_, err := Open(noopLogger, path, Options{})
+	require.ErrorContains(t, err, "last entry")
+}
+
+func TestParseOverflow(t *testing.T) {
+	o, err := ParseOverflow("drop")
+	require.NoError(t, err)
+	assert.Equal(t, Drop, o)
+	_, err = ParseOverflow("wait")
+	require.EqualError(t, err, `unknown overflow "wait", expected block or drop`)
+}
+
+func TestNilLog(t *testing.T) {
+	var a *Log
+	a.Record(Entry{})
+	assert.True(t, a.Redacts())
+	assert.Zero(t, a.Dropped())
+	require.NoError(t, a.Close())
+}
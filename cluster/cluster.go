@@ -0,0 +1,319 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/membership"
+)
+
+var (
+	ErrInvalidSlot  = errors.New("invalid slot")
+	ErrUnknownNode  = errors.New("unknown node")
+	ErrClusterDown  = errors.New("CLUSTERDOWN hash slot not served")
+	ErrNotOwner     = errors.New("slot is not owned by this node")
+	ErrAlreadyOwner = errors.New("slot is already owned by this node")
+)
+
+// Redirect kinds sent to clients.
+const (
+	RedirectMoved = "MOVED"
+	RedirectAsk   = "ASK"
+)
+
+// RedirectError tells a client which node serves the slot.
+// MOVED is permanent and clients should update their slot map,
+// ASK is valid for the next command only and must be preceded by ASKING.
+type RedirectError struct {
+	Kind string
+	Slot int
+	Addr string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%s %d %s", e.Kind, e.Slot, e.Addr)
+}
+
+// Node is a member of the cluster.
+type Node struct {
+	ID    string
+	Addr  string
+	Slots []SlotRange
+}
+
+// Cluster holds the slot map as seen by the current node.
+type Cluster struct {
+	mu    sync.RWMutex
+	self  string
+	nodes map[string]Node
+	// owners maps a slot to the id of the node serving it, empty when unassigned.
+	owners [SlotCount]string
+	// migrating maps a slot owned by this node to the node it is moved to.
+	migrating map[int]string
+	// importing maps a slot moved to this node to the node it is moved from.
+	importing map[int]string
+	// flags maps ids of nodes reported by membership as failing to "pfail" or "fail".
+	flags map[string]string
+}
+
+func New(self string, nodes ...Node) (*Cluster, error) {
+	c := &Cluster{
+		self:      self,
+		nodes:     make(map[string]Node, len(nodes)),
+		migrating: make(map[int]string),
+		importing: make(map[int]string),
+		flags:     make(map[string]string),
+	}
+
+	for _, n := range nodes {
+		if n.ID == "" || n.Addr == "" {
+			return nil, fmt.Errorf("node id and address are required: %q %q", n.ID, n.Addr)
+		}
+		if _, ok := c.nodes[n.ID]; ok {
+			return nil, fmt.Errorf("duplicated node %q", n.ID)
+		}
+		c.nodes[n.ID] = Node{ID: n.ID, Addr: n.Addr}
+		for _, r := range n.Slots {
+			for slot := r.Start; slot <= r.End; slot++ {
+				if owner := c.owners[slot]; owner != "" {
+					return nil, fmt.Errorf("slot %d is assigned to %q and %q", slot, owner, n.ID)
+				}
+				c.owners[slot] = n.ID
+			}
+		}
+	}
+
+	if _, ok := c.nodes[self]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNode, self)
+	}
+
+	return c, nil
+}
+
+// FromConfig builds the cluster from the static topology in config.
+func FromConfig(cfg config.Cluster) (*Cluster, error) {
+	nodes := make([]Node, 0, len(cfg.Nodes))
+	for _, cn := range cfg.Nodes {
+		n := Node{ID: cn.ID, Addr: cn.Addr}
+		for _, s := range cn.Slots {
+			r, err := ParseSlotRange(s)
+			if err != nil {
+				return nil, fmt.Errorf("node %q: %w", cn.ID, err)
+			}
+			n.Slots = append(n.Slots, r)
+		}
+		nodes = append(nodes, n)
+	}
+	return New(cfg.NodeID, nodes...)
+}
+
+// Self returns the id of the current node.
+func (c *Cluster) Self() string {
+	return c.self
+}
+
+// Route checks whether the current node can serve a key in the slot.
+// exists reports whether the key is stored locally and is called only
+// for slots migrating away, where missing keys are redirected with ASK.
+func (c *Cluster) Route(slot int, asking bool, exists func() (bool, error)) error {
+	c.mu.RLock()
+	owner := c.owners[slot]
+	target, migrating := c.migrating[slot]
+	_, importing := c.importing[slot]
+	c.mu.RUnlock()
+
+	switch {
+	case owner == "":
+		return ErrClusterDown
+	case owner == c.self && migrating:
+		ok, err := exists()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return c.redirect(RedirectAsk, slot, target)
+		}
+		return nil
+	case owner == c.self:
+		return nil
+	case importing && asking:
+		return nil
+	}
+	return c.redirect(RedirectMoved, slot, owner)
+}
+
+func (c *Cluster) redirect(kind string, slot int, id string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, ok := c.nodes[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownNode, id)
+	}
+	return &RedirectError{Kind: kind, Slot: slot, Addr: n.Addr}
+}
+
+// SetSlotMigrating marks a slot owned by this node as moving to the target node.
+func (c *Cluster) SetSlotMigrating(slot int, target string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkNode(target); err != nil {
+		return err
+	}
+	if c.owners[slot] != c.self {
+		return ErrNotOwner
+	}
+	c.migrating[slot] = target
+	return nil
+}
+
+// SetSlotImporting marks a slot owned by the source node as moving to this node.
+func (c *Cluster) SetSlotImporting(slot int, source string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkNode(source); err != nil {
+		return err
+	}
+	if c.owners[slot] == c.self {
+		return ErrAlreadyOwner
+	}
+	c.importing[slot] = source
+	return nil
+}
+
+// SetSlotNode assigns the slot to the node and finishes any migration of it.
+// It has to be sent to every node of the cluster to update their slot maps.
+func (c *Cluster) SetSlotNode(slot int, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkNode(id); err != nil {
+		return err
+	}
+	c.owners[slot] = id
+	delete(c.migrating, slot)
+	delete(c.importing, slot)
+	return nil
+}
+
+// SetSlotStable cancels the migration of the slot.
+func (c *Cluster) SetSlotStable(slot int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.migrating, slot)
+	delete(c.importing, slot)
+}
+
+func (c *Cluster) checkNode(id string) error {
+	if _, ok := c.nodes[id]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownNode, id)
+	}
+	return nil
+}
+
+// Watch marks nodes suspected by membership as "pfail" and dead or left
+// ones as "fail" until the events are closed. Nodes are cleared when they
+// refute the suspicion or rejoin. Members unknown to the slot map are ignored.
+func (c *Cluster) Watch(events <-chan membership.Event) {
+	for e := range events {
+		c.mu.Lock()
+		if _, ok := c.nodes[e.Member.ID]; ok {
+			switch e.Type {
+			case membership.EventSuspect:
+				c.flags[e.Member.ID] = "pfail"
+			case membership.EventDead, membership.EventLeave:
+				c.flags[e.Member.ID] = "fail"
+			case membership.EventJoin, membership.EventAlive:
+				delete(c.flags, e.Member.ID)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Slots returns the slot ranges of every node, one range per line:
+// "start-end id addr".
+func (c *Cluster) Slots() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var lines []string
+	for _, r := range c.ranges() {
+		n := c.nodes[r.owner]
+		lines = append(lines, fmt.Sprintf("%d-%d %s %s", r.Start, r.End, n.ID, n.Addr))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Nodes returns the description of every node, one node per line:
+// "id addr [myself] [pfail|fail] slots... [slot->-target] [slot-<-source]".
+func (c *Cluster) Nodes() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	slots := make(map[string][]string, len(c.nodes))
+	for _, r := range c.ranges() {
+		slots[r.owner] = append(slots[r.owner], r.String())
+	}
+
+	ids := make([]string, 0, len(c.nodes))
+	for id := range c.nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		fields := []string{id, c.nodes[id].Addr}
+		if id == c.self {
+			fields = append(fields, "myself")
+		}
+		if flag, ok := c.flags[id]; ok {
+			fields = append(fields, flag)
+		}
+		fields = append(fields, slots[id]...)
+		if id == c.self {
+			for _, slot := range sortedSlots(c.migrating) {
+				fields = append(fields, fmt.Sprintf("[%d->-%s]", slot, c.migrating[slot]))
+			}
+			for _, slot := range sortedSlots(c.importing) {
+				fields = append(fields, fmt.Sprintf("[%d-<-%s]", slot, c.importing[slot]))
+			}
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type ownedRange struct {
+	SlotRange
+	owner string
+}
+
+// ranges groups contiguous slots of the same owner. Caller must hold the lock.
+func (c *Cluster) ranges() []ownedRange {
+	var res []ownedRange
+	for slot := 0; slot < SlotCount; slot++ {
+		owner := c.owners[slot]
+		if owner == "" {
+			continue
+		}
+		if last := len(res) - 1; last >= 0 && res[last].owner == owner && res[last].End == slot-1 {
+			res[last].End = slot
+			continue
+		}
+		res = append(res, ownedRange{SlotRange: SlotRange{Start: slot, End: slot}, owner: owner})
+	}
+	return res
+}
+
+func sortedSlots(m map[int]string) []int {
+	slots := make([]int, 0, len(m))
+	for slot := range m {
+		slots = append(slots, slot)
+	}
+	slices.Sort(slots)
+	return slots
+}
@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/membership"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCluster(t *testing.T, self string) *Cluster {
+	t.Helper()
+	c, err := FromConfig(config.Cluster{
+		Enabled: true,
+		NodeID:  self,
+		Nodes: []config.ClusterNode{
+			{ID: "a", Addr: "127.0.0.1:7000", Slots: []string{"0-8191"}},
+			{ID: "b", Addr: "127.0.0.1:7001", Slots: []string{"8192-16382"}},
+			{ID: "c", Addr: "127.0.0.1:7002"},
+		},
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func exists(ok bool) func() (bool, error) {
+	return func() (bool, error) {
+		return ok, nil
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		self  string
+		nodes []Node
+	}{
+		{"Unknown self", "x", []Node{{ID: "a", Addr: "a:1"}}},
+		{"Duplicated node", "a", []Node{{ID: "a", Addr: "a:1"}, {ID: "a", Addr: "a:2"}}},
+		{"Missing address", "a", []Node{{ID: "a"}}},
+		{"Overlapping slots", "a", []Node{
+			{ID: "a", Addr: "a:1", Slots: []SlotRange{{Start: 0, End: 10}}},
+			{ID: "b", Addr: "b:1", Slots: []SlotRange{{Start: 10, End: 20}}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.self, tt.nodes...)
+			require.Error(t, err)
+			assert.Nil(t, c)
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	c := testCluster(t, "a")
+
+	require.NoError(t, c.Route(100, false, exists(false)), "own slot should be served")
+
+	err := c.Route(9000, false, exists(false))
+	var redirect *RedirectError
+	require.ErrorAs(t, err, &redirect)
+	assert.Equal(t, "MOVED 9000 127.0.0.1:7001", err.Error())
+
+	require.ErrorIs(t, c.Route(16383, false, exists(true)), ErrClusterDown, "unassigned slot")
+}
+
+func TestRouteMigration(t *testing.T) {
+	source := testCluster(t, "a")
+	target := testCluster(t, "c")
+
+	require.NoError(t, source.SetSlotMigrating(100, "c"))
+	require.NoError(t, target.SetSlotImporting(100, "a"))
+
+	// existing keys are still served by the source
+	require.NoError(t, source.Route(100, false, exists(true)))
+
+	// missing keys are redirected to the target with ASK
+	err := source.Route(100, false, exists(false))
+	assert.EqualError(t, err, "ASK 100 127.0.0.1:7002")
+
+	// the target serves the slot only after ASKING
+	assert.EqualError(t, target.Route(100, false, exists(false)), "MOVED 100 127.0.0.1:7000")
+	require.NoError(t, target.Route(100, true, exists(false)))
+
+	// finish migration on both nodes
+	require.NoError(t, source.SetSlotNode(100, "c"))
+	require.NoError(t, target.SetSlotNode(100, "c"))
+	assert.EqualError(t, source.Route(100, false, exists(true)), "MOVED 100 127.0.0.1:7002")
+	require.NoError(t, target.Route(100, false, exists(false)))
+}
+
+func TestRouteExistsError(t *testing.T) {
+	c := testCluster(t, "a")
+	require.NoError(t, c.SetSlotMigrating(1, "b"))
+
+	failure := errors.New("failure")
+	err := c.Route(1, false, func() (bool, error) { return false, failure })
+	require.ErrorIs(t, err, failure)
+}
+
+func TestSetSlotErrors(t *testing.T) {
+	c := testCluster(t, "a")
+
+	require.ErrorIs(t, c.SetSlotMigrating(9000, "b"), ErrNotOwner)
+	require.ErrorIs(t, c.SetSlotImporting(1, "b"), ErrAlreadyOwner)
+	require.ErrorIs(t, c.SetSlotNode(1, "x"), ErrUnknownNode)
+	require.ErrorIs(t, c.SetSlotMigrating(1, "x"), ErrUnknownNode)
+}
+
+func TestSlotsAndNodes(t *testing.T) {
+	c := testCluster(t, "a")
+	require.NoError(t, c.SetSlotMigrating(5, "c"))
+
+	assert.Equal(t, "0-8191 a 127.0.0.1:7000\n8192-16382 b 127.0.0.1:7001", c.Slots())
+	assert.Equal(t,
+		"a 127.0.0.1:7000 myself 0-8191 [5->-c]\n"+
+			"b 127.0.0.1:7001 8192-16382\n"+
+			"c 127.0.0.1:7002",
+		c.Nodes())
+}
+
+func TestWatch(t *testing.T) {
+	c := testCluster(t, "a")
+	events := make(chan membership.Event, 4)
+	events <- membership.Event{Type: membership.EventSuspect, Member: membership.Member{ID: "b"}}
+	events <- membership.Event{Type: membership.EventDead, Member: membership.Member{ID: "c"}}
+	events <- membership.Event{Type: membership.EventDead, Member: membership.Member{ID: "unknown"}}
+	close(events)
+	c.Watch(events)
+
+	assert.Equal(t,
+		"a 127.0.0.1:7000 myself 0-8191\n"+
+			"b 127.0.0.1:7001 pfail 8192-16382\n"+
+			"c 127.0.0.1:7002 fail",
+		c.Nodes())
+
+	events = make(chan membership.Event, 2)
+	events <- membership.Event{Type: membership.EventAlive, Member: membership.Member{ID: "b"}}
+	events <- membership.Event{Type: membership.EventJoin, Member: membership.Member{ID: "c"}}
+	close(events)
+	c.Watch(events)
+
+	assert.Equal(t,
+		"a 127.0.0.1:7000 myself 0-8191\n"+
+			"b 127.0.0.1:7001 8192-16382\n"+
+			"c 127.0.0.1:7002",
+		c.Nodes())
+}
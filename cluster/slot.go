@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SlotCount is the number of hash slots the keyspace is split into.
+const SlotCount = 16384
+
+// KeySlot returns the hash slot of the key.
+// If the key contains a non-empty hash tag like "{user1}.name"
+// only the tag is hashed, so related keys land in the same slot.
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % SlotCount
+}
+
+// crc16 implements CRC16-CCITT (XMODEM).
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// SlotRange is an inclusive range of hash slots.
+type SlotRange struct {
+	Start int
+	End   int
+}
+
+func (r SlotRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// ParseSlotRange parses a single slot "42" or a range "0-5460".
+func ParseSlotRange(s string) (SlotRange, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	start, err := ParseSlot(first)
+	if err != nil {
+		return SlotRange{}, err
+	}
+	if !isRange {
+		return SlotRange{Start: start, End: start}, nil
+	}
+	end, err := ParseSlot(last)
+	if err != nil {
+		return SlotRange{}, err
+	}
+	if end < start {
+		return SlotRange{}, fmt.Errorf("%w: %q", ErrInvalidSlot, s)
+	}
+	return SlotRange{Start: start, End: end}, nil
+}
+
+// ParseSlot parses a slot number and checks its bounds.
+func ParseSlot(s string) (int, error) {
+	slot, err := strconv.Atoi(s)
+	if err != nil || slot < 0 || slot >= SlotCount {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSlot, s)
+	}
+	return slot, nil
+}
@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		slot int
+	}{
+		{"Check value", "123456789", 12739},
+		{"Simple key foo", "foo", 12182},
+		{"Simple key bar", "bar", 5061},
+		{"Hash tag", "{foo}.bar", 12182},
+		{"Only first hash tag", "{bar}{foo}", 5061},
+		{"Empty key", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.slot, KeySlot(tt.key))
+		})
+	}
+
+	assert.NotEqual(t, KeySlot("{}.foo"), KeySlot("foo"), "empty hash tag should be ignored")
+}
+
+func TestParseSlotRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected SlotRange
+		wantErr  bool
+	}{
+		{"Single slot", "42", SlotRange{Start: 42, End: 42}, false},
+		{"Range", "0-5460", SlotRange{Start: 0, End: 5460}, false},
+		{"Last slot", "16383", SlotRange{Start: 16383, End: 16383}, false},
+		{"Out of bounds", "16384", SlotRange{}, true},
+		{"Negative", "-1", SlotRange{}, true},
+		{"Reversed range", "10-5", SlotRange{}, true},
+		{"Not a number", "abc", SlotRange{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseSlotRange(tt.input)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidSlot)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, r)
+		})
+	}
+}
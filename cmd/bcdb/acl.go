@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sattellite/bcdb/acl"
+)
+
+// aclCommand runs "bcdb acl hash-password", which reads a password from
+// the first line of stdin and writes its hash for acl.users.password.
+// The password is not an argument, so it doesn't stay in the shell history.
+func aclCommand(args []string, stdin io.Reader, stdout io.Writer) int {
+	if len(args) != 1 || args[0] != "hash-password" {
+		fmt.Fprintln(os.Stderr, "usage: bcdb acl hash-password < password")
+		return 2
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "password is empty")
+		return 1
+	}
+	fmt.Fprintln(stdout, acl.HashPassword(password))
+	return 0
+}
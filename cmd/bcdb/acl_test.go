@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/acl"
+)
+
+func TestACLHashPassword(t *testing.T) {
+	var out bytes.Buffer
+	require.Equal(t, 0, aclCommand([]string{"hash-password"}, strings.NewReader("secret\n"), &out))
+
+	a, err := acl.New(acl.User{Name: "app", Password: strings.TrimSpace(out.String())})
+	require.NoError(t, err)
+	assert.NoError(t, a.Authenticate("app", "secret"))
+	assert.ErrorIs(t, a.Authenticate("app", "secret\n"), acl.ErrAuthFailed)
+
+	assert.Equal(t, 1, aclCommand([]string{"hash-password"}, strings.NewReader(""), &out))
+	assert.Equal(t, 2, aclCommand(nil, strings.NewReader("secret"), &out))
+}
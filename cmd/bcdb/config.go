@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+// configCommand runs "bcdb config print [flags]", which writes the config
+// merged from defaults, the file, variables and flags with sources of values.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: bcdb config print [flags]")
+		return 2
+	}
+	cfg, err := config.Load(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := config.Print(os.Stdout, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -2,58 +2,496 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
+	"time"
 
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/audit"
+	"github.com/sattellite/bcdb/cluster"
 	"github.com/sattellite/bcdb/compute"
+	"github.com/sattellite/bcdb/compute/session"
 
 	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/health"
+	"github.com/sattellite/bcdb/httpserver"
+	"github.com/sattellite/bcdb/limits"
+	"github.com/sattellite/bcdb/lockstat"
 	"github.com/sattellite/bcdb/logger"
+	"github.com/sattellite/bcdb/membership"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/network"
 	"github.com/sattellite/bcdb/storage"
+	"github.com/sattellite/bcdb/storage/engine"
+	"github.com/sattellite/bcdb/trace"
 )
 
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(configCommand(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "acl" {
+		os.Exit(aclCommand(args[1:], os.Stdin, os.Stdout))
+	}
+
 	log := logger.Default()
 
 	// load app config
-	cfg, cfgErr := config.Load()
+	cfg, cfgErr := config.Load(args)
+	if errors.Is(cfgErr, flag.ErrHelp) {
+		return
+	}
 	if cfgErr != nil {
 		log.Error("failed to load config", slog.Any("error", cfgErr))
+		os.Exit(1)
 	}
 
-	// set logger config
-	log = logger.SetDefault(logger.WithConfig(cfg))
+	// set logger config, the default logger is kept when it fails
+	cl, logFile, lErr := logger.WithConfig(cfg)
+	if lErr != nil {
+		log.Error("failed to configure logger", slog.Any("error", lErr))
+	} else {
+		log = logger.SetDefault(cl)
+		// deferred first, so the log file is closed after the last record
+		defer func() {
+			if fErr := logFile.Close(); fErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to close log file: %v\n", fErr)
+			}
+		}()
+	}
 
 	log.Info("starting bcdb")
 	log.Debug("loaded config ", slog.Any("cfg", cfg))
 
 	ctx, cancel := context.WithCancel(context.Background())
+	// started parts are stopped on every return, the engine
+	// is closed before the logs its commands are written to
+	var (
+		eng         storage.Engine
+		tracer      *trace.Tracer
+		auditLog    *audit.Log
+		unixStopped chan struct{}
+	)
+	defer func() {
+		cancel()
+		if unixStopped != nil {
+			<-unixStopped
+		}
+		if eng != nil {
+			<-eng.Done()
+		}
+		if aErr := auditLog.Close(); aErr != nil {
+			log.Error("failed to close audit log", slog.Any("error", aErr))
+		}
+		if tracer != nil {
+			if tErr := tracer.Close(); tErr != nil {
+				log.Error("failed to close tracing", slog.Any("error", tErr))
+			}
+		}
+	}()
+
+	// lock wait times are measured from the start, so engines are covered
+	if cfg.DebugHTTP.Enabled {
+		if dErr := serveDebug(ctx, cfg.DebugHTTP); dErr != nil {
+			log.Error("failed to serve debug http", slog.Any("error", dErr))
+			return
+		}
+	}
+
+	// metrics are collected only when they are served
+	var reg *metrics.Registry
+	var engMws []storage.Middleware
+	if cfg.Metrics.Address != "" {
+		reg = metrics.NewRegistry()
+		engMws = append(engMws, storage.WithMetrics(storage.NewMetrics()))
+	}
 
+	if cfg.Tracing.File != "" {
+		t, tErr := newTracer(cfg.Tracing)
+		if tErr != nil {
+			log.Error("failed to start tracing", slog.Any("error", tErr))
+			return
+		}
+		tracer = t
+		engMws = append(engMws, storage.WithTracing())
+	}
+
+	// HTTP endpoints are served before the engine is loaded,
+	// so the node is live and not ready while it replays logs
+	hl := health.New()
+	if hErr := serveHTTP(ctx, cfg, reg, hl); hErr != nil {
+		log.Error("failed to serve http", slog.Any("error", hErr))
+		return
+	}
 	// create storage engine
-	eng, engineErr := storage.NewEngine(ctx, storage.EngineTypeMemory)
+	var engineErr error
+	eng, engineErr = storage.NewEngine(ctx, cfg.Storage, engMws...)
 	if engineErr != nil {
 		log.Error("failed to create storage engine", slog.Any("error", engineErr))
-		cancel()
 		return
 	}
+	dbs, dbsErr := storage.NewNamespaces(ctx, eng, cfg.Storage.Databases)
+	if dbsErr != nil {
+		log.Error("failed to open databases", slog.Any("error", dbsErr))
+		return
+	}
+	// sessions of all network listeners
+	sessions := session.NewRegistry()
+	rl := newReloader(args, cfg)
+	opts := []compute.Option{
+		compute.WithDatabases(dbs),
+		compute.WithSessions(sessions),
+		compute.WithParam("loglevel", rl.logLevelParam()),
+		compute.WithRewrite(rl.rewrite),
+	}
+	// certificates of the listener, MIGRATE uses them to connect to other nodes
+	var certs *network.TLS
+	if cfg.Network.TLS.Enabled() {
+		t, tErr := network.NewTLS(logger.WithScope("network"), cfg.Network.TLS)
+		if tErr != nil {
+			log.Error("failed to load certificates", slog.Any("error", tErr))
+			return
+		}
+		go t.Watch(ctx)
+		certs = t
+	}
+
+	var slots *cluster.Cluster
+	if cfg.Cluster.Enabled {
+		cl, clErr := cluster.FromConfig(cfg.Cluster)
+		if clErr != nil {
+			log.Error("failed to create cluster", slog.Any("error", clErr))
+			return
+		}
+		slots = cl
+		var migOpts []network.MigratorOption
+		if cfg.Cluster.MigrateUser != "" {
+			migOpts = append(migOpts, network.WithMigratorAuth(cfg.Cluster.MigrateUser, cfg.Cluster.MigratePassword))
+		}
+		if certs != nil {
+			migOpts = append(migOpts, network.WithMigratorTLS(certs))
+		}
+		opts = append(opts, compute.WithCluster(cl), compute.WithMigrator(network.NewMigrator(migOpts...)))
+	}
+
+	// users, limits and quotas are set even when disabled, so they can be enabled by reload
+	a, aErr := acl.FromConfig(cfg.ACL)
+	if aErr != nil {
+		log.Error("failed to load users", slog.Any("error", aErr))
+		return
+	}
+	lim, lErr := limits.FromConfig(cfg.Limits, cfg.ACL)
+	if lErr != nil {
+		log.Error("failed to create rate limits", slog.Any("error", lErr))
+		return
+	}
+	quotas := limits.QuotasFromConfig(cfg.ACL)
+	rl.acl, rl.limiter, rl.quotas = a, lim, quotas
+	opts = append(opts,
+		compute.WithACL(a),
+		compute.WithLimiter(lim),
+		compute.WithQuotas(quotas),
+		compute.WithSlowlog(cfg.Slowlog.Threshold, cfg.Slowlog.MaxLen))
+
+	if cfg.Audit.File != "" {
+		a, aErr := openAudit(cfg.Audit)
+		if aErr != nil {
+			log.Error("failed to open audit log", slog.Any("error", aErr))
+			return
+		}
+		auditLog = a
+		opts = append(opts, compute.WithAudit(a))
+	}
+
+	var members *membership.Memberlist
+	if cfg.Membership.Enabled {
+		list, mErr := startMembership(ctx, cfg.Membership)
+		if mErr != nil {
+			log.Error("failed to start membership", slog.Any("error", mErr))
+			return
+		}
+		members = list
+		// failures detected by gossip are shown by CLUSTER NODES
+		if slots != nil {
+			events, _ := members.Subscribe(membershipEvents)
+			go slots.Watch(events)
+		}
+	}
+
 	// create computer for user requests
-	comp := compute.New(eng)
+	comp := compute.New(eng, opts...)
+	rl.comp = comp
 	go comp.Run(ctx)
 
-	// wait for signals
+	var netMetrics *network.Metrics
+	if reg != nil {
+		netMetrics = network.NewMetrics()
+		storage.RegisterMetrics(reg, eng)
+		compute.RegisterMetrics(reg, comp)
+		reg.Register(netMetrics)
+		if tracer != nil {
+			reg.Register(tracer)
+		}
+		if auditLog != nil {
+			reg.Register(auditLog)
+		}
+	}
+
+	// serve network clients
+	if cfg.Network.Address != "" {
+		srvOpts := []network.ServerOption{
+			network.WithPipeline(cfg.Network.Pipeline),
+			network.WithMaxLineSize(cfg.Network.MaxLineSize),
+			network.WithSessions(sessions),
+			network.WithMetrics(netMetrics),
+			network.WithTracer(tracer),
+		}
+		if certs != nil {
+			srvOpts = append(srvOpts, network.WithTLS(certs.ServerConfig()))
+		}
+		srv := network.NewServer(logger.WithScope("network"), cfg.Network.Address, comp, srvOpts...)
+		go func() {
+			if err := srv.Run(ctx); err != nil {
+				log.Error("failed to run network server", slog.Any("error", err))
+			}
+		}()
+	}
+
+	if cfg.Network.Socket != "" {
+		// closed when the socket file is removed
+		stopped := make(chan struct{})
+		if sErr := serveUnix(ctx, cfg.Network, comp, stopped,
+			network.WithSessions(sessions),
+			network.WithMetrics(netMetrics),
+			network.WithTracer(tracer)); sErr != nil {
+			log.Error("failed to listen on unix socket", slog.Any("error", sErr))
+			return
+		}
+		unixStopped = stopped
+	}
+
+	hl.AddCheck("engine", func(context.Context) error {
+		select {
+		case <-eng.Done():
+			return engine.ErrClosed
+		default:
+			return nil
+		}
+	})
+	if cfg.Health.MaxReplicationLag > 0 {
+		// replicas are not supported yet, every node is a primary without lag
+		hl.AddCheck("replication", health.LagCheck(func() time.Duration { return 0 }, cfg.Health.MaxReplicationLag))
+	}
+	hl.Started()
+
+	// wait for signals, SIGHUP reloads the config
 	wait := make(chan os.Signal, 1)
 	signal.Notify(
 		wait,
 		syscall.SIGINT,
 		syscall.SIGTERM,
-		syscall.SIGQUIT,
-		syscall.SIGHUP)
+		syscall.SIGQUIT)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-	<-wait
-	// send cancel signal
-	cancel()
+	reloadUntil(wait, hup, rl)
 	log.Info("stopping bcdb")
-	<-eng.Done()
+	// load balancers stop sending new clients before listeners close
+	hl.Drain()
+	if cfg.Health.Address != "" && cfg.Health.DrainDelay > 0 {
+		log.Info("draining", slog.Duration("delay", cfg.Health.DrainDelay))
+		select {
+		case <-time.After(cfg.Health.DrainDelay):
+		case <-wait:
+		}
+	}
+	// peers mark the node left instead of dead
+	if members != nil {
+		lctx, lCancel := context.WithTimeout(context.Background(), leaveTimeout)
+		members.Leave(lctx)
+		lCancel()
+	}
+}
+
+// reloadUntil reloads the config on every signal of hup until a signal of stop.
+func reloadUntil(stop, hup <-chan os.Signal, rl *reloader) {
+	l := logger.WithScope("config")
+	for {
+		select {
+		case <-hup:
+			l.Info("reloading config")
+			if err := rl.reload(); err != nil {
+				l.Error("failed to reload config", slog.Any("error", err))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// serveUnix serves clients on the Unix socket with the same handler as the TCP listener.
+// stopped is closed when the server stops and the socket file is removed.
+func serveUnix(ctx context.Context, cfg config.Network, h network.Handler, stopped chan struct{}, opts ...network.ServerOption) error {
+	perm, err := network.ParseSocketPerm(cfg.SocketPerm)
+	if err != nil {
+		return err
+	}
+	ln, err := network.ListenUnix(ctx, cfg.Socket, perm)
+	if err != nil {
+		return err
+	}
+
+	l := logger.WithScope("network")
+	opts = append(opts, network.WithPipeline(cfg.Pipeline), network.WithMaxLineSize(cfg.MaxLineSize))
+	srv := network.NewServer(l, cfg.Socket, h, opts...)
+	go func() {
+		defer close(stopped)
+		if sErr := srv.Serve(ctx, ln); sErr != nil {
+			l.Error("failed to serve unix socket", slog.Any("error", sErr))
+		}
+	}()
+	return nil
+}
+
+// serveHTTP serves metrics of the registry at /metrics and health checks
+// at /healthz and /readyz. They share the listener of the same address.
+func serveHTTP(ctx context.Context, cfg *config.Config, reg *metrics.Registry, hl *health.Health) error {
+	l := logger.WithScope("http")
+	var metricsMux *http.ServeMux
+	if reg != nil {
+		opts, err := httpTLS(ctx, l, cfg.Metrics.TLS)
+		if err != nil {
+			return err
+		}
+		metricsMux = http.NewServeMux()
+		metricsMux.Handle("GET /metrics", reg.Handler())
+		runHTTP(ctx, l, httpserver.New(l, cfg.Metrics.Address, metricsMux, opts...))
+	}
+
+	if cfg.Health.Address == "" {
+		return nil
+	}
+	if metricsMux != nil && cfg.Health.Address == cfg.Metrics.Address {
+		hl.Register(metricsMux)
+		return nil
+	}
+	opts, err := httpTLS(ctx, l, cfg.Health.TLS)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	hl.Register(mux)
+	runHTTP(ctx, l, httpserver.New(l, cfg.Health.Address, mux, opts...))
+	return nil
+}
+
+// httpTLS returns options of an HTTP listener serving TLS when it is enabled.
+// Certificates are reloaded until ctx is done.
+func httpTLS(ctx context.Context, l *slog.Logger, cfg config.TLS) ([]httpserver.Option, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	t, err := network.NewTLS(l, cfg)
+	if err != nil {
+		return nil, err
+	}
+	go t.Watch(ctx)
+	return []httpserver.Option{httpserver.WithTLS(t.ServerConfig())}, nil
+}
+
+func runHTTP(ctx context.Context, l *slog.Logger, srv *httpserver.Server) {
+	go func() {
+		if err := srv.Run(ctx); err != nil {
+			l.Error("failed to run http server", slog.Any("error", err))
+		}
+	}()
+}
+
+func openAudit(cfg config.Audit) (*audit.Log, error) {
+	overflow, err := audit.ParseOverflow(cfg.Overflow)
+	if err != nil {
+		return nil, err
+	}
+	return audit.Open(logger.WithScope("audit"), cfg.File, audit.Options{
+		QueueSize:    cfg.QueueSize,
+		Overflow:     overflow,
+		RedactValues: cfg.RedactValues,
+	})
+}
+
+func newTracer(cfg config.Tracing) (*trace.Tracer, error) {
+	exp, err := trace.NewFileExporter(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	t, err := trace.New(logger.WithScope("trace"), exp, trace.Options{SampleRatio: cfg.SampleRatio, QueueSize: cfg.QueueSize})
+	if err != nil {
+		_ = exp.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// serveDebug serves runtime introspection and enables measuring of lock wait times.
+func serveDebug(ctx context.Context, cfg config.DebugHTTP) error {
+	l := logger.WithScope("debug")
+	opts, err := httpTLS(ctx, l, cfg.TLS)
+	if err != nil {
+		return err
+	}
+	lockstat.Enable(true)
+	if cfg.MutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+	}
+	if cfg.BlockProfileRate > 0 {
+		runtime.SetBlockProfileRate(cfg.BlockProfileRate)
+	}
+
+	runHTTP(ctx, l, httpserver.New(l, cfg.Address, httpserver.DebugHandler(), opts...))
+	return nil
+}
+
+// membershipEvents is the buffer of membership events of the cluster.
+const membershipEvents = 64
+
+// leaveTimeout limits gossiping of the leave on shutdown.
+const leaveTimeout = 5 * time.Second
+
+// startMembership runs the member list and joins the seeds in background.
+func startMembership(ctx context.Context, cfg config.Membership) (*membership.Memberlist, error) {
+	l := logger.WithScope("membership")
+	t, err := membership.NewUDPTransport(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := membership.New(l, membership.Config{
+		ID:               cfg.NodeID,
+		AdvertiseAddr:    cfg.AdvertiseAddress,
+		ProbeInterval:    cfg.ProbeInterval,
+		ProbeTimeout:     cfg.ProbeTimeout,
+		SuspicionTimeout: cfg.SuspicionTimeout,
+	}, t)
+	if err != nil {
+		_ = t.Close()
+		return nil, err
+	}
+
+	go list.Run(ctx)
+	if len(cfg.Seeds) > 0 {
+		go func() {
+			if jErr := list.Join(ctx, cfg.Seeds...); jErr != nil {
+				l.Error("failed to join cluster", slog.Any("error", jErr))
+			}
+		}()
+	}
+	return list, nil
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/compute"
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/limits"
+	"github.com/sattellite/bcdb/logger"
+)
+
+var (
+	errNoConfigFile = errors.New("the server is running without a config file")
+	errNoUsers      = errors.New("the config removes all ACL users, which disables authentication, restart to apply")
+)
+
+// reloader applies changes of the config on SIGHUP and persists
+// the config changed at runtime by CONFIG REWRITE.
+type reloader struct {
+	// args are command-line flags, they are applied again on reload
+	args    []string
+	comp    compute.Computer
+	acl     *acl.ACL
+	limiter *limits.Limiter
+	quotas  *limits.Quotas
+
+	mu sync.Mutex
+	// cfg is the running config, changes waiting for a restart are not in it
+	cfg *config.Config
+	// loaded is the last loaded config with changes made at runtime,
+	// it is written by CONFIG REWRITE, so changes waiting for a restart are kept
+	loaded *config.Config
+}
+
+func newReloader(args []string, cfg *config.Config) *reloader {
+	running, loaded := *cfg, *cfg
+	return &reloader{args: args, cfg: &running, loaded: &loaded}
+}
+
+// reload loads the config again and applies changed log levels, rate limits,
+// ACL users and the slow log. Other changes need a restart and are logged
+// on every reload until then, the running config keeps their old values.
+// An invalid config is rejected as a whole and the running one is kept, so is
+// a config removing all users, because it would open the server to everyone.
+// There is no eviction policy to reload: the memory engine never evicts and
+// the size of the tiered cache needs a restart.
+func (r *reloader) reload() error {
+	next, err := config.Load(r.args)
+	if err != nil {
+		return err
+	}
+	levels, err := logger.LevelsFromConfig(next)
+	if err != nil {
+		return err
+	}
+	users, err := acl.FromConfig(next.ACL)
+	if err != nil {
+		return err
+	}
+	lim, err := limits.FromConfig(next.Limits, next.ACL)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cfg.ACL.Users) > 0 && len(next.ACL.Users) == 0 {
+		return errNoUsers
+	}
+	var applied, restart []string
+	for _, key := range config.Diff(r.cfg, next) {
+		switch {
+		case key == "debug" || key == "log.level" || key == "log.levels":
+			logger.SetLevels(levels)
+		case key == "acl.users":
+			// rates and quotas of users are set in users too
+			r.acl.Replace(users)
+			r.limiter.Replace(lim)
+			r.quotas.Replace(limits.QuotasFromConfig(next.ACL))
+		case strings.HasPrefix(key, "limits."):
+			r.limiter.Replace(lim)
+		case strings.HasPrefix(key, "slowlog."):
+			compute.SetSlowlog(r.comp, next.Slowlog.Threshold, next.Slowlog.MaxLen)
+		default:
+			restart = append(restart, key)
+			continue
+		}
+		applied = append(applied, key)
+	}
+	running := *next
+	running.Copy(r.cfg, restart...)
+	r.cfg, r.loaded = &running, next
+
+	l := logger.WithScope("config")
+	l.Info("config reloaded", slog.String("file", next.File()), slog.Any("applied", applied))
+	if len(restart) > 0 {
+		l.Warn("restart to apply changed settings", slog.Any("keys", restart))
+	}
+	return nil
+}
+
+// rewrite writes values of the loaded file and changes made at runtime
+// to the file. Flags, variables and defaults are not written.
+func (r *reloader) rewrite() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loaded.File() == "" {
+		return errNoConfigFile
+	}
+	return config.WriteFile(r.loaded.File(), r.loaded)
+}
+
+// logLevelParam changes levels of loggers by CONFIG SET loglevel "info,storage=debug".
+func (r *reloader) logLevelParam() compute.Param {
+	return compute.Param{
+		Get: func() string {
+			return logger.CurrentLevels().String()
+		},
+		Set: func(value string) error {
+			levels, err := logger.ParseLevels(value)
+			if err != nil {
+				return err
+			}
+			logger.SetLevels(levels)
+
+			// the running config is rewritten with the new levels
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			level, scopes, _ := strings.Cut(levels.String(), ",")
+			for _, cfg := range []*config.Config{r.cfg, r.loaded} {
+				cfg.Debug = false
+				cfg.Log.Level, cfg.Log.Levels = level, nil
+				if scopes != "" {
+					cfg.Log.Levels = strings.Split(scopes, ",")
+				}
+				cfg.SetRuntime("debug", "log.level", "log.levels")
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/compute"
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/limits"
+	"github.com/sattellite/bcdb/logger"
+)
+
+// slowlogComputer records the slow log settings applied by reload.
+type slowlogComputer struct {
+	compute.Computer
+	threshold time.Duration
+	size      int
+}
+
+func (c *slowlogComputer) SetSlowlog(threshold time.Duration, size int) {
+	c.threshold, c.size = threshold, size
+}
+
+// newTestReloader starts a reloader of the config file with the content
+// and the flag --listen.
+func newTestReloader(t *testing.T, content string) (*reloader, string) {
+	t.Helper()
+	prev := logger.CurrentLevels()
+	t.Cleanup(func() { logger.SetLevels(prev) })
+
+	path := filepath.Join(t.TempDir(), "bcdb.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	args := []string{"--config=" + path, "--listen=127.0.0.1:7100"}
+	cfg, err := config.Load(args)
+	require.NoError(t, err)
+
+	r := newReloader(args, cfg)
+	r.comp = &slowlogComputer{}
+	r.acl, err = acl.FromConfig(cfg.ACL)
+	require.NoError(t, err)
+	r.limiter, err = limits.FromConfig(cfg.Limits, cfg.ACL)
+	require.NoError(t, err)
+	r.quotas = limits.QuotasFromConfig(cfg.ACL)
+	return r, path
+}
+
+func TestReload(t *testing.T) {
+	password := acl.HashPassword("secret")
+	r, path := newTestReloader(t, `
+[[acl.users]]
+name = "app"
+password = "`+password+`"
+`)
+	require.Len(t, r.acl.List(), 1)
+	require.False(t, r.limiter.Enabled())
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+[log]
+level = "debug"
+
+[storage]
+databases = 8
+
+[slowlog]
+threshold = "1s"
+max_len = 16
+
+[limits]
+commands_per_second = 100
+
+[[acl.users]]
+name = "app"
+password = "`+password+`"
+
+[[acl.users]]
+name = "ops"
+password = "`+password+`"
+max_keys = 10
+`), 0o600))
+	require.NoError(t, r.reload())
+	assert.Equal(t, "debug", logger.CurrentLevels().String())
+	assert.Len(t, r.acl.List(), 2)
+	assert.NoError(t, r.acl.Authenticate("ops", "secret"))
+	assert.True(t, r.limiter.Enabled())
+	assert.True(t, r.quotas.Enabled())
+	comp := r.comp.(*slowlogComputer)
+	assert.Equal(t, time.Second, comp.threshold)
+	assert.Equal(t, 16, comp.size)
+	// storage.databases needs a restart, the running config keeps the old value
+	assert.Equal(t, 16, r.cfg.Storage.Databases)
+	assert.Equal(t, 8, r.loaded.Storage.Databases)
+	assert.Equal(t, "debug", r.cfg.Log.Level)
+	require.NoError(t, r.reload())
+	assert.Equal(t, []string{"storage.databases"}, config.Diff(r.cfg, r.loaded), "restart is still needed")
+
+	// the file keeps the value waiting for a restart
+	require.NoError(t, r.rewrite())
+	rewritten, err := config.Load(r.args)
+	require.NoError(t, err)
+	assert.Equal(t, 8, rewritten.Storage.Databases)
+
+	// removing all users is rejected, the running users are kept
+	require.NoError(t, os.WriteFile(path, []byte("[storage]\ndatabases = 8\n"), 0o600))
+	require.ErrorIs(t, r.reload(), errNoUsers)
+	assert.Len(t, r.acl.List(), 2)
+	assert.Len(t, r.cfg.ACL.Users, 2)
+
+	// an invalid config is rejected as a whole
+	require.NoError(t, os.WriteFile(path, []byte("[log]\nlevel = \"loud\"\n"), 0o600))
+	require.Error(t, r.reload())
+	assert.Equal(t, "debug", logger.CurrentLevels().String())
+}
+
+func TestRewrite(t *testing.T) {
+	r, path := newTestReloader(t, "[storage]\nengine = \"lsm\"\n")
+	param := r.logLevelParam()
+	require.NoError(t, param.Set("warn,storage=debug"))
+	assert.Equal(t, "warn,storage=debug", param.Get())
+	require.Error(t, param.Set("loud"))
+
+	require.NoError(t, r.rewrite())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `debug = false
+
+[log]
+level = "warn"
+levels = ["storage=debug"]
+
+[storage]
+engine = "lsm"
+`, string(data), "the flag --listen and defaults are not written")
+
+	rewritten, err := config.Load(r.args)
+	require.NoError(t, err)
+	assert.Empty(t, config.Diff(r.cfg, rewritten))
+
+	r.loaded = &config.Config{}
+	require.ErrorIs(t, r.rewrite(), errNoConfigFile)
+}
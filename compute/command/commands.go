@@ -21,6 +21,40 @@ func (t *Method) String() string {
 		return "GET"
 	case MethodDel:
 		return "DEL"
+	case MethodCluster:
+		return "CLUSTER"
+	case MethodAsking:
+		return "ASKING"
+	case MethodMigrate:
+		return "MIGRATE"
+	case MethodSelect:
+		return "SELECT"
+	case MethodFlushDB:
+		return "FLUSHDB"
+	case MethodFlushAll:
+		return "FLUSHALL"
+	case MethodDBSize:
+		return "DBSIZE"
+	case MethodMove:
+		return "MOVE"
+	case MethodSwapDB:
+		return "SWAPDB"
+	case MethodAuth:
+		return "AUTH"
+	case MethodACL:
+		return "ACL"
+	case MethodPing:
+		return "PING"
+	case MethodClient:
+		return "CLIENT"
+	case MethodMonitor:
+		return "MONITOR"
+	case MethodSlowlog:
+		return "SLOWLOG"
+	case MethodInfo:
+		return "INFO"
+	case MethodConfig:
+		return "CONFIG"
 	}
 	return "unknown"
 }
@@ -30,13 +64,38 @@ const (
 	MethodSet Method = iota
 	MethodGet
 	MethodDel
+	MethodCluster
+	MethodAsking
+	MethodMigrate
+	MethodSelect
+	MethodFlushDB
+	MethodFlushAll
+	MethodDBSize
+	MethodMove
+	MethodSwapDB
+	MethodAuth
+	MethodACL
+	MethodPing
+	MethodClient
+	MethodMonitor
+	MethodSlowlog
+	MethodInfo
+	MethodConfig
+
+	// methodCount is the number of methods, it stays the last.
+	methodCount
 )
 
-func ParseMethod(input string) (*Method, error) {
-	if len(input) != 3 {
-		return nil, ErrInvalidCommand
+// Methods returns all the methods ordered by their values.
+func Methods() []Method {
+	methods := make([]Method, 0, methodCount)
+	for m := range methodCount {
+		methods = append(methods, m)
 	}
+	return methods
+}
 
+func ParseMethod(input string) (*Method, error) {
 	var cmd Method
 	switch strings.ToUpper(input) {
 	case "SET":
@@ -45,10 +104,43 @@ func ParseMethod(input string) (*Method, error) {
 		cmd = MethodGet
 	case "DEL":
 		cmd = MethodDel
+	case "CLUSTER":
+		cmd = MethodCluster
+	case "ASKING":
+		cmd = MethodAsking
+	case "MIGRATE":
+		cmd = MethodMigrate
+	case "SELECT":
+		cmd = MethodSelect
+	case "FLUSHDB":
+		cmd = MethodFlushDB
+	case "FLUSHALL":
+		cmd = MethodFlushAll
+	case "DBSIZE":
+		cmd = MethodDBSize
+	case "MOVE":
+		cmd = MethodMove
+	case "SWAPDB":
+		cmd = MethodSwapDB
+	case "AUTH":
+		cmd = MethodAuth
+	case "ACL":
+		cmd = MethodACL
+	case "PING":
+		cmd = MethodPing
+	case "CLIENT":
+		cmd = MethodClient
+	case "MONITOR":
+		cmd = MethodMonitor
+	case "SLOWLOG":
+		cmd = MethodSlowlog
+	case "INFO":
+		cmd = MethodInfo
+	case "CONFIG":
+		cmd = MethodConfig
 	default:
 		return nil, ErrInvalidCommand
 	}
-
 	return &cmd, nil
 }
 
@@ -61,15 +153,68 @@ func ParseArguments(cmd *Method, args ...string) ([]string, error) {
 	}
 
 	switch *cmd {
-	case MethodSet:
+	case MethodSet, MethodMigrate, MethodMove, MethodSwapDB, MethodAuth:
 		if len(cleared) != 2 {
 			return nil, ErrInvalidArguments
 		}
-	case MethodGet, MethodDel:
+	case MethodGet, MethodDel, MethodSelect:
 		if len(cleared) != 1 {
 			return nil, ErrInvalidArguments
 		}
+	case MethodCluster, MethodACL, MethodClient, MethodSlowlog, MethodConfig:
+		if len(cleared) == 0 {
+			return nil, ErrInvalidArguments
+		}
+	case MethodInfo, MethodPing:
+		if len(cleared) > 1 {
+			return nil, ErrInvalidArguments
+		}
+	case MethodAsking, MethodFlushDB, MethodFlushAll, MethodDBSize, MethodMonitor:
+		if len(cleared) != 0 {
+			return nil, ErrInvalidArguments
+		}
 	}
 
 	return cleared, nil
 }
+
+// Keys returns the positions of key arguments of the command.
+// Commands without keys return nil.
+func (t *Method) Keys() []int {
+	switch *t {
+	case MethodSet, MethodGet, MethodDel, MethodMove:
+		return []int{0}
+	case MethodMigrate:
+		return []int{1}
+	}
+	return nil
+}
+
+// Reads reports whether the command reads values of its keys.
+func (t *Method) Reads() bool {
+	switch *t {
+	case MethodGet, MethodMove, MethodMigrate:
+		return true
+	}
+	return false
+}
+
+// Writes reports whether the command changes its keys or whole databases.
+func (t *Method) Writes() bool {
+	switch *t {
+	case MethodSet, MethodDel, MethodMove, MethodMigrate,
+		MethodFlushDB, MethodFlushAll, MethodSwapDB:
+		return true
+	}
+	return false
+}
+
+// Admin reports whether the command manages the server, its users or clients.
+func (t *Method) Admin() bool {
+	switch *t {
+	case MethodCluster, MethodAuth, MethodACL, MethodClient,
+		MethodMonitor, MethodSlowlog, MethodConfig:
+		return true
+	}
+	return false
+}
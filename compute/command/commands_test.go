@@ -21,6 +21,23 @@ func TestParseMethod(t *testing.T) {
 		{"Valid SET command", "SET", methodRef(MethodSet), nil},
 		{"Valid GET command", "GET", methodRef(MethodGet), nil},
 		{"Valid DEL command", "DEL", methodRef(MethodDel), nil},
+		{"Valid CLUSTER command", "CLUSTER", methodRef(MethodCluster), nil},
+		{"Valid ASKING command", "asking", methodRef(MethodAsking), nil},
+		{"Valid MIGRATE command", "MIGRATE", methodRef(MethodMigrate), nil},
+		{"Valid SELECT command", "select", methodRef(MethodSelect), nil},
+		{"Valid FLUSHDB command", "FLUSHDB", methodRef(MethodFlushDB), nil},
+		{"Valid FLUSHALL command", "FLUSHALL", methodRef(MethodFlushAll), nil},
+		{"Valid DBSIZE command", "DBSIZE", methodRef(MethodDBSize), nil},
+		{"Valid MOVE command", "MOVE", methodRef(MethodMove), nil},
+		{"Valid SWAPDB command", "SWAPDB", methodRef(MethodSwapDB), nil},
+		{"Valid AUTH command", "auth", methodRef(MethodAuth), nil},
+		{"Valid ACL command", "ACL", methodRef(MethodACL), nil},
+		{"Valid PING command", "PING", methodRef(MethodPing), nil},
+		{"Valid CLIENT command", "client", methodRef(MethodClient), nil},
+		{"Valid MONITOR command", "MONITOR", methodRef(MethodMonitor), nil},
+		{"Valid SLOWLOG command", "slowlog", methodRef(MethodSlowlog), nil},
+		{"Valid INFO command", "INFO", methodRef(MethodInfo), nil},
+		{"Valid CONFIG command", "config", methodRef(MethodConfig), nil},
 		{"Invalid command", "ABC", nil, ErrInvalidCommand},
 		{"Empty command", "", nil, ErrInvalidCommand},
 		{"Lowercase command", "set", methodRef(MethodSet), nil},
@@ -59,6 +76,35 @@ func TestParseArguments(t *testing.T) {
 		{"SET command with empty arguments", MethodSet, []string{"", "value"}, []string{"value"}, ErrInvalidArguments},
 		{"GET command with empty argument", MethodGet, []string{""}, nil, ErrInvalidArguments},
 		{"DEL command with empty argument", MethodDel, []string{""}, nil, ErrInvalidArguments},
+		{"Valid CLUSTER command with subcommand", MethodCluster, []string{"SLOTS"}, []string{"SLOTS"}, nil},
+		{"CLUSTER command without subcommand", MethodCluster, []string{""}, nil, ErrInvalidArguments},
+		{"Valid ASKING command", MethodAsking, []string{""}, []string{}, nil},
+		{"ASKING command with arguments", MethodAsking, []string{"key"}, nil, ErrInvalidArguments},
+		{"Valid MIGRATE command", MethodMigrate, []string{"host:1", "key"}, []string{"host:1", "key"}, nil},
+		{"MIGRATE command with missing arguments", MethodMigrate, []string{"host:1"}, nil, ErrInvalidArguments},
+		{"Valid SELECT command", MethodSelect, []string{"1"}, []string{"1"}, nil},
+		{"SELECT command without database", MethodSelect, []string{}, nil, ErrInvalidArguments},
+		{"Valid FLUSHDB command", MethodFlushDB, []string{}, []string{}, nil},
+		{"FLUSHALL command with arguments", MethodFlushAll, []string{"1"}, nil, ErrInvalidArguments},
+		{"Valid DBSIZE command", MethodDBSize, []string{}, []string{}, nil},
+		{"Valid MOVE command", MethodMove, []string{"key", "1"}, []string{"key", "1"}, nil},
+		{"MOVE command without database", MethodMove, []string{"key"}, nil, ErrInvalidArguments},
+		{"Valid SWAPDB command", MethodSwapDB, []string{"0", "1"}, []string{"0", "1"}, nil},
+		{"Valid AUTH command", MethodAuth, []string{"user", "secret"}, []string{"user", "secret"}, nil},
+		{"AUTH command without user", MethodAuth, []string{"secret"}, nil, ErrInvalidArguments},
+		{"ACL command without subcommand", MethodACL, []string{}, nil, ErrInvalidArguments},
+		{"Valid PING command", MethodPing, []string{}, []string{}, nil},
+		{"Valid PING command with message", MethodPing, []string{"hello"}, []string{"hello"}, nil},
+		{"PING command with two messages", MethodPing, []string{"a", "b"}, nil, ErrInvalidArguments},
+		{"Valid CLIENT command", MethodClient, []string{"KILL", "1"}, []string{"KILL", "1"}, nil},
+		{"CLIENT command without subcommand", MethodClient, []string{}, nil, ErrInvalidArguments},
+		{"MONITOR command with arguments", MethodMonitor, []string{"all"}, nil, ErrInvalidArguments},
+		{"SLOWLOG command without subcommand", MethodSlowlog, []string{}, nil, ErrInvalidArguments},
+		{"Valid INFO command", MethodInfo, []string{}, []string{}, nil},
+		{"Valid INFO command with section", MethodInfo, []string{"stats"}, []string{"stats"}, nil},
+		{"INFO command with two sections", MethodInfo, []string{"stats", "server"}, nil, ErrInvalidArguments},
+		{"Valid CONFIG command", MethodConfig, []string{"GET", "*"}, []string{"GET", "*"}, nil},
+		{"CONFIG command without subcommand", MethodConfig, []string{}, nil, ErrInvalidArguments},
 	}
 
 	for _, tt := range tests {
@@ -74,3 +120,12 @@ func TestParseArguments(t *testing.T) {
 		})
 	}
 }
+
+func TestMethods(t *testing.T) {
+	methods := Methods()
+	assert.Equal(t, MethodSet, methods[0])
+	assert.Equal(t, MethodConfig, methods[len(methods)-1])
+	for _, m := range methods {
+		assert.NotEqual(t, "unknown", m.String(), "method %d has no name", m)
+	}
+}
@@ -2,11 +2,18 @@ package compute
 
 import (
 	"context"
+	"time"
 
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/audit"
+	"github.com/sattellite/bcdb/cluster"
 	"github.com/sattellite/bcdb/compute/impl/repl"
 	"github.com/sattellite/bcdb/compute/query"
 	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/limits"
 	"github.com/sattellite/bcdb/logger"
+	"github.com/sattellite/bcdb/metrics"
 	"github.com/sattellite/bcdb/storage"
 )
 
@@ -17,6 +24,84 @@ type Computer interface {
 	Print(r result.Result) error
 }
 
-func New(eng storage.Engine) Computer {
-	return repl.New(logger.WithScope("compute"), eng)
+// Option configures optional dependencies of the computer.
+type Option = repl.Option
+
+// WithCluster enables cluster mode with the given slot map.
+func WithCluster(c *cluster.Cluster) Option {
+	return repl.WithCluster(c)
+}
+
+// Migrator writes keys of migrating slots to other nodes.
+type Migrator = repl.Migrator
+
+// WithMigrator enables MIGRATE with the migrator.
+func WithMigrator(m Migrator) Option {
+	return repl.WithMigrator(m)
+}
+
+// WithDatabases enables numbered databases selected with SELECT.
+func WithDatabases(dbs *storage.Namespaces) Option {
+	return repl.WithDatabases(dbs)
+}
+
+// WithACL requires sessions to authenticate with AUTH.
+func WithACL(a *acl.ACL) Option {
+	return repl.WithACL(a)
+}
+
+// WithLimiter limits the rate of commands.
+func WithLimiter(l *limits.Limiter) Option {
+	return repl.WithLimiter(l)
+}
+
+// WithQuotas limits keys and memory written by users.
+func WithQuotas(q *limits.Quotas) Option {
+	return repl.WithQuotas(q)
+}
+
+// WithSessions enables CLIENT commands for sessions tracked by network servers.
+func WithSessions(reg *session.Registry) Option {
+	return repl.WithSessions(reg)
+}
+
+// WithSlowlog records commands executed longer than the threshold.
+func WithSlowlog(threshold time.Duration, size int) Option {
+	return repl.WithSlowlog(threshold, size)
+}
+
+// WithAudit records write and admin commands in the audit log.
+func WithAudit(a *audit.Log) Option {
+	return repl.WithAudit(a)
+}
+
+// Param is a setting changed at runtime by CONFIG SET.
+type Param = repl.Param
+
+// WithParam adds the setting to CONFIG GET and CONFIG SET.
+func WithParam(name string, p Param) Option {
+	return repl.WithParam(name, p)
+}
+
+// WithRewrite enables CONFIG REWRITE, which persists the config with fn.
+func WithRewrite(fn func() error) Option {
+	return repl.WithRewrite(fn)
+}
+
+func New(eng storage.Engine, opts ...Option) Computer {
+	return repl.New(logger.WithScope("compute"), eng, opts...)
+}
+
+// RegisterMetrics registers metrics of commands when the computer collects them.
+func RegisterMetrics(reg *metrics.Registry, c Computer) {
+	if m, ok := c.(metrics.Collector); ok {
+		reg.Register(m)
+	}
+}
+
+// SetSlowlog changes the threshold and the size of the slow log of the computer.
+func SetSlowlog(c Computer, threshold time.Duration, size int) {
+	if s, ok := c.(interface{ SetSlowlog(time.Duration, int) }); ok {
+		s.SetSlowlog(threshold, size)
+	}
 }
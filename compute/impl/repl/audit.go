@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"slices"
+	"time"
+
+	"github.com/sattellite/bcdb/audit"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+// WithAudit records write and admin commands in the audit log.
+func WithAudit(a *audit.Log) Option {
+	return func(r *REPL) {
+		r.audit = a
+	}
+}
+
+// auditCommand records the write or admin command with its outcome.
+// Passwords of AUTH are never recorded.
+func (r *REPL) auditCommand(sess *session.Session, q query.Query, err error) {
+	method := q.Command()
+	if r.audit == nil || !(method.Writes() || method.Admin()) {
+		return
+	}
+
+	info := sess.Info()
+	e := audit.Entry{
+		Time:    time.Now().UTC(),
+		User:    info.User,
+		Client:  info.RemoteAddr,
+		Command: method.String(),
+		Outcome: "ok",
+	}
+	if err != nil {
+		e.Outcome = err.Error()
+	}
+
+	args := q.Arguments()
+	switch {
+	case method == command.MethodAuth:
+		e.Args = args[:min(len(args), 1)]
+	case method == command.MethodSet && len(args) == 2:
+		e.Key, e.Value = args[0], args[1]
+	default:
+		keys := method.Keys()
+		for i, arg := range args {
+			if e.Key == "" && slices.Contains(keys, i) {
+				e.Key = arg
+				continue
+			}
+			e.Args = append(e.Args, arg)
+		}
+	}
+	r.audit.Record(e)
+}
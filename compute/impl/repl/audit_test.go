@@ -0,0 +1,69 @@
+package repl
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/audit"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+func TestAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := audit.Open(noopLogger, path, audit.Options{RedactValues: true})
+	require.NoError(t, err)
+	a, err := acl.New(acl.User{
+		Name:      "app",
+		Password:  acl.HashPassword("secret"),
+		Commands:  []string{"*"},
+		ReadKeys:  []string{"*"},
+		WriteKeys: []string{"app:*"},
+	})
+	require.NoError(t, err)
+	r := newTestREPL(t, WithACL(a), WithAudit(log))
+	ctx := session.NewContext(context.Background(), session.New("127.0.0.1:5000"))
+
+	for _, q := range []*query.Query{
+		query.New(command.MethodAuth, "app", "secret"),
+		query.New(command.MethodSet, "app:1", "value"),
+		query.New(command.MethodGet, "app:1"),
+		query.New(command.MethodSet, "other", "value"),
+		query.New(command.MethodDel, "app:2"),
+		query.New(command.MethodSlowlog, "RESET"),
+	} {
+		_, _ = r.Handle(ctx, *q)
+	}
+	require.NoError(t, log.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	var entries []audit.Entry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e audit.Entry
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		assert.Equal(t, "127.0.0.1:5000", e.Client)
+		assert.False(t, e.Time.IsZero())
+		e.Time, e.Client, e.Prev, e.Hash = time.Time{}, "", "", ""
+		entries = append(entries, e)
+	}
+	assert.Equal(t, []audit.Entry{
+		{User: "app", Command: "AUTH", Args: []string{"app"}, Outcome: "ok"},
+		{User: "app", Command: "SET", Key: "app:1", Value: "(redacted)", Outcome: "ok"},
+		{User: "app", Command: "SET", Key: "other", Value: "(redacted)", Outcome: `NOPERM no permission: user "app" can't write the key "other"`},
+		{User: "app", Command: "DEL", Key: "app:2", Outcome: engine.ErrNotFound.Error()},
+		{User: "app", Command: "SLOWLOG", Args: []string{"RESET"}, Outcome: "ok"},
+	}, entries)
+}
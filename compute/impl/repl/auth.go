@@ -0,0 +1,81 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+var ErrAuthDisabled = errors.New("AUTH called without any users configured")
+
+// defaultUser is reported by ACL WHOAMI when authentication is disabled.
+const defaultUser = "default"
+
+// authorize checks that the session user can run the query.
+// AUTH and PING are allowed before authentication, ACL WHOAMI for every user.
+func (r *REPL) authorize(sess *session.Session, q query.Query) error {
+	if !r.acl.Enabled() {
+		return nil
+	}
+
+	method := q.Command()
+	args := q.Arguments()
+	switch method {
+	case command.MethodAuth, command.MethodPing:
+		return nil
+	}
+	if sess.User() == "" {
+		return acl.ErrNoAuth
+	}
+	if method == command.MethodACL && len(args) > 0 && strings.EqualFold(args[0], "WHOAMI") {
+		return nil
+	}
+
+	access := acl.Access{Command: method.String(), Read: method.Reads(), Write: method.Writes()}
+	for _, i := range method.Keys() {
+		if i < len(args) {
+			access.Keys = append(access.Keys, args[i])
+		}
+	}
+	return r.acl.Authorize(sess.User(), access)
+}
+
+func (r *REPL) handleAuth(ctx context.Context, name, password string) (result.Result, error) {
+	if !r.acl.Enabled() {
+		return result.Result{}, ErrAuthDisabled
+	}
+	sess := session.FromContext(ctx)
+	if err := r.acl.Authenticate(name, password); err != nil {
+		r.logger.Warn("authentication failed",
+			slog.Uint64("session", sess.ID),
+			slog.String("remote", sess.RemoteAddr),
+			slog.String("user", name))
+		return result.Result{}, err
+	}
+	sess.SetUser(name)
+	return result.Result{Value: "OK"}, nil
+}
+
+func (r *REPL) handleACL(ctx context.Context, args []string) (result.Result, error) {
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "WHOAMI" && len(args) == 1:
+		if !r.acl.Enabled() {
+			return result.Result{Value: defaultUser}, nil
+		}
+		return result.Result{Value: session.FromContext(ctx).User()}, nil
+	case sub == "LIST" && len(args) == 1:
+		if !r.acl.Enabled() {
+			return result.Result{Value: "user " + defaultUser + " commands=* read=* write=*"}, nil
+		}
+		return result.Result{Value: strings.Join(r.acl.List(), "\n")}, nil
+	}
+	return result.Result{}, command.ErrInvalidArguments
+}
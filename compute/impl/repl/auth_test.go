@@ -0,0 +1,74 @@
+package repl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+func TestHandleAuth(t *testing.T) {
+	a, err := acl.New(acl.User{
+		Name:      "app",
+		Password:  acl.HashPassword("secret"),
+		Commands:  []string{"GET", "SET", "ACL"},
+		ReadKeys:  []string{"*"},
+		WriteKeys: []string{"app:*"},
+	})
+	require.NoError(t, err)
+	r := newTestREPL(t, WithACL(a))
+	ctx := session.NewContext(context.Background(), session.New("test"))
+
+	handle := func(method command.Method, args ...string) (string, error) {
+		res, hErr := r.Handle(ctx, *query.New(method, args...))
+		return res.Value, hErr
+	}
+
+	// only AUTH and PING before authentication
+	_, err = handle(command.MethodGet, "app:1")
+	require.ErrorIs(t, err, acl.ErrNoAuth)
+	_, err = handle(command.MethodACL, "WHOAMI")
+	require.ErrorIs(t, err, acl.ErrNoAuth)
+	value, err := handle(command.MethodPing)
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", value)
+	_, err = handle(command.MethodAuth, "app", "wrong")
+	require.ErrorIs(t, err, acl.ErrAuthFailed)
+
+	value, err = handle(command.MethodAuth, "app", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", value)
+	value, err = handle(command.MethodACL, "whoami")
+	require.NoError(t, err)
+	assert.Equal(t, "app", value)
+	value, err = handle(command.MethodACL, "LIST")
+	require.NoError(t, err)
+	assert.Equal(t, "user app commands=GET,SET,ACL read=* write=app:*", value)
+
+	_, err = handle(command.MethodSet, "app:1", "value")
+	require.NoError(t, err)
+	_, err = handle(command.MethodSet, "other", "value")
+	require.ErrorIs(t, err, acl.ErrNoPermission)
+	_, err = handle(command.MethodDel, "app:1")
+	require.ErrorIs(t, err, acl.ErrNoPermission)
+	value, err = handle(command.MethodGet, "app:1")
+	require.NoError(t, err)
+	assert.Equal(t, "value: value", value)
+}
+
+func TestHandleAuth_Disabled(t *testing.T) {
+	r := New(noopLogger, nil)
+	ctx := context.Background()
+
+	_, err := r.Handle(ctx, *query.New(command.MethodAuth, "app", "secret"))
+	require.ErrorIs(t, err, ErrAuthDisabled)
+	res, err := r.Handle(ctx, *query.New(command.MethodACL, "WHOAMI"))
+	require.NoError(t, err)
+	assert.Equal(t, "default", res.Value)
+}
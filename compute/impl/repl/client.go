@@ -0,0 +1,89 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+var (
+	ErrSessionsDisabled = errors.New("sessions are not tracked")
+	ErrNoSuchClient     = errors.New("no such client")
+)
+
+// handleClient handles CLIENT LIST, KILL, SETNAME and PAUSE.
+func (r *REPL) handleClient(ctx context.Context, args []string) (result.Result, error) {
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "LIST" && len(args) == 1:
+		if r.sessions == nil {
+			return result.Result{}, ErrSessionsDisabled
+		}
+		now := time.Now()
+		infos := r.sessions.List()
+		lines := make([]string, 0, len(infos))
+		for _, info := range infos {
+			lines = append(lines, formatClient(info, now))
+		}
+		return result.Result{Value: strings.Join(lines, "\n")}, nil
+	case sub == "KILL" && len(args) == 2:
+		if r.sessions == nil {
+			return result.Result{}, ErrSessionsDisabled
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return result.Result{}, command.ErrInvalidArguments
+		}
+		if !r.sessions.Kill(id) {
+			return result.Result{}, fmt.Errorf("%w: %d", ErrNoSuchClient, id)
+		}
+		return result.Result{Value: "OK"}, nil
+	case sub == "SETNAME" && len(args) == 2:
+		session.FromContext(ctx).SetName(args[1])
+		return result.Result{Value: "OK"}, nil
+	case sub == "PAUSE" && len(args) == 2:
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || ms < 0 {
+			return result.Result{}, command.ErrInvalidArguments
+		}
+		r.pausedUntil.Store(time.Now().Add(time.Duration(ms) * time.Millisecond).UnixNano())
+		return result.Result{Value: "OK"}, nil
+	}
+	return result.Result{}, command.ErrInvalidArguments
+}
+
+// formatClient describes the session in a line of CLIENT LIST,
+// age and idle are in seconds.
+func formatClient(info session.Info, now time.Time) string {
+	return fmt.Sprintf("id=%d addr=%s name=%s user=%s db=%d age=%d idle=%d cmd=%s",
+		info.ID, info.RemoteAddr, info.Name, info.User, info.DB,
+		int(now.Sub(info.Connected).Seconds()), int(now.Sub(info.LastActive).Seconds()),
+		info.LastCommand)
+}
+
+// waitPause blocks writes while clients are paused by CLIENT PAUSE.
+func (r *REPL) waitPause(ctx context.Context, method command.Method) error {
+	if !method.Writes() {
+		return nil
+	}
+	for {
+		wait := time.Until(time.Unix(0, r.pausedUntil.Load()))
+		if wait <= 0 {
+			return nil
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
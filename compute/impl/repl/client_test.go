@@ -0,0 +1,93 @@
+package repl
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+func TestHandleClient(t *testing.T) {
+	sessions := session.NewRegistry()
+	r := newTestREPL(t, WithSessions(sessions))
+	first, second := session.New("127.0.0.1:1000"), session.New("127.0.0.1:2000")
+	firstCtx, cancelFirst := context.WithCancel(session.NewContext(context.Background(), first))
+	defer cancelFirst()
+	sessions.Add(first, cancelFirst)
+	sessions.Add(second, func() {})
+	secondCtx := session.NewContext(context.Background(), second)
+
+	handle := func(ctx context.Context, args ...string) (string, error) {
+		res, err := r.Handle(ctx, *query.New(command.MethodClient, args...))
+		return res.Value, err
+	}
+
+	value, err := handle(firstCtx, "SETNAME", "worker")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", value)
+	_, err = r.Handle(secondCtx, *query.New(command.MethodSet, "key", "value"))
+	require.NoError(t, err)
+
+	value, err = handle(firstCtx, "list")
+	require.NoError(t, err)
+	lines := strings.Split(value, "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, `^id=\d+ addr=127.0.0.1:1000 name=worker user= db=0 age=\d+ idle=\d+ cmd=CLIENT$`, lines[0])
+	assert.Regexp(t, `^id=\d+ addr=127.0.0.1:2000 name= user= db=0 age=\d+ idle=\d+ cmd=SET$`, lines[1])
+
+	_, err = handle(secondCtx, "KILL", "0")
+	require.ErrorIs(t, err, ErrNoSuchClient)
+	_, err = handle(secondCtx, "KILL", "first")
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+	value, err = handle(secondCtx, "KILL", strconv.FormatUint(first.ID, 10))
+	require.NoError(t, err)
+	assert.Equal(t, "OK", value)
+	require.ErrorIs(t, firstCtx.Err(), context.Canceled)
+}
+
+func TestHandleClient_Pause(t *testing.T) {
+	r := newTestREPL(t, WithSessions(session.NewRegistry()))
+	ctx := session.NewContext(context.Background(), session.New("test"))
+
+	_, err := r.Handle(ctx, *query.New(command.MethodClient, "PAUSE", "100"))
+	require.NoError(t, err)
+
+	// reads are not paused
+	start := time.Now()
+	_, err = r.Handle(ctx, *query.New(command.MethodGet, "key"))
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	_, err = r.Handle(ctx, *query.New(command.MethodSet, "key", "value"))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	// paused writes return when the session is killed
+	_, err = r.Handle(ctx, *query.New(command.MethodClient, "PAUSE", "10000"))
+	require.NoError(t, err)
+	killed, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = r.Handle(killed, *query.New(command.MethodDel, "key"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = r.Handle(ctx, *query.New(command.MethodClient, "PAUSE", "-1"))
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+}
+
+func TestHandleClient_Disabled(t *testing.T) {
+	r := newTestREPL(t)
+
+	_, err := r.Handle(context.Background(), *query.New(command.MethodClient, "LIST"))
+	require.ErrorIs(t, err, ErrSessionsDisabled)
+	_, err = r.Handle(context.Background(), *query.New(command.MethodClient, "UNKNOWN"))
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+}
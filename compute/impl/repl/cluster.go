@@ -0,0 +1,180 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sattellite/bcdb/cluster"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var (
+	ErrClusterDisabled = errors.New("cluster support disabled")
+	ErrNoMigrator      = errors.New("migration is not configured")
+)
+
+// Migrator writes keys of migrating slots to other nodes.
+type Migrator interface {
+	// Migrate writes the key to the database db of the node at address,
+	// which accepts it while the slot of the key is importing.
+	Migrate(ctx context.Context, address string, db int, key, value string) error
+}
+
+const migrateTimeout = 5 * time.Second
+
+// route checks that every key of the query belongs to a slot served by this node.
+func (r *REPL) route(ctx context.Context, q query.Query, asking bool) error {
+	if r.cluster == nil {
+		return nil
+	}
+
+	eng, err := r.db(ctx)
+	if err != nil {
+		return err
+	}
+	method := q.Command()
+	args := q.Arguments()
+	for _, i := range method.Keys() {
+		if i >= len(args) {
+			continue
+		}
+		key := args[i]
+		err := r.cluster.Route(cluster.KeySlot(key), asking, func() (bool, error) {
+			_, err := eng.Get(ctx, key)
+			if errors.Is(err, engine.ErrNotFound) {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *REPL) handleCluster(ctx context.Context, args []string) (result.Result, error) {
+	if r.cluster == nil {
+		return result.Result{}, ErrClusterDisabled
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+	switch {
+	case sub == "SLOTS" && len(args) == 0:
+		return result.Result{Value: r.cluster.Slots()}, nil
+	case sub == "NODES" && len(args) == 0:
+		return result.Result{Value: r.cluster.Nodes()}, nil
+	case sub == "MYID" && len(args) == 0:
+		return result.Result{Value: r.cluster.Self()}, nil
+	case sub == "KEYSLOT" && len(args) == 1:
+		return result.Result{Value: strconv.Itoa(cluster.KeySlot(args[0]))}, nil
+	case sub == "SETSLOT" && len(args) >= 2:
+		return r.clusterSetSlot(args)
+	case sub == "COUNTKEYSINSLOT" && len(args) == 1:
+		keys, err := r.keysInSlot(ctx, args[0], -1)
+		if err != nil {
+			return result.Result{}, err
+		}
+		return result.Result{Value: strconv.Itoa(len(keys))}, nil
+	case sub == "GETKEYSINSLOT" && len(args) == 2:
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return result.Result{}, command.ErrInvalidArguments
+		}
+		keys, kErr := r.keysInSlot(ctx, args[0], count)
+		if kErr != nil {
+			return result.Result{}, kErr
+		}
+		return result.Result{Value: strings.Join(keys, "\n")}, nil
+	}
+	return result.Result{}, command.ErrInvalidArguments
+}
+
+// clusterSetSlot handles CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE id and CLUSTER SETSLOT slot STABLE.
+func (r *REPL) clusterSetSlot(args []string) (result.Result, error) {
+	slot, err := cluster.ParseSlot(args[0])
+	if err != nil {
+		return result.Result{}, err
+	}
+
+	state := strings.ToUpper(args[1])
+	switch {
+	case state == "STABLE" && len(args) == 2:
+		r.cluster.SetSlotStable(slot)
+	case state == "MIGRATING" && len(args) == 3:
+		err = r.cluster.SetSlotMigrating(slot, args[2])
+	case state == "IMPORTING" && len(args) == 3:
+		err = r.cluster.SetSlotImporting(slot, args[2])
+	case state == "NODE" && len(args) == 3:
+		err = r.cluster.SetSlotNode(slot, args[2])
+	default:
+		return result.Result{}, command.ErrInvalidArguments
+	}
+	if err != nil {
+		return result.Result{}, err
+	}
+	return result.Result{Value: "OK"}, nil
+}
+
+// keysInSlot returns up to count keys stored in the slot, negative count means all keys.
+func (r *REPL) keysInSlot(ctx context.Context, arg string, count int) ([]string, error) {
+	slot, err := cluster.ParseSlot(arg)
+	if err != nil {
+		return nil, err
+	}
+	eng, err := r.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, kErr := eng.Keys(ctx)
+	if kErr != nil {
+		return nil, kErr
+	}
+
+	var keys []string
+	for _, key := range all {
+		if count >= 0 && len(keys) == count {
+			break
+		}
+		if cluster.KeySlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// handleMigrate moves the key to the same database of the node at address and removes it locally.
+func (r *REPL) handleMigrate(ctx context.Context, address, key string) (result.Result, error) {
+	if r.migrator == nil {
+		return result.Result{}, ErrNoMigrator
+	}
+	eng, err := r.db(ctx)
+	if err != nil {
+		return result.Result{}, err
+	}
+	value, err := eng.Get(ctx, key)
+	if err != nil {
+		return result.Result{}, err
+	}
+
+	db := session.FromContext(ctx).DB()
+	tctx, cancel := context.WithTimeout(ctx, migrateTimeout)
+	defer cancel()
+	if mErr := r.migrator.Migrate(tctx, address, db, key, fmt.Sprint(value)); mErr != nil {
+		return result.Result{}, fmt.Errorf("migrate %q: %w", key, mErr)
+	}
+
+	if delErr := eng.Del(ctx, key); delErr != nil {
+		return result.Result{}, delErr
+	}
+	r.quotas.Del(db, key)
+	return result.Result{Value: fmt.Sprintf("migrated key %q", key)}, nil
+}
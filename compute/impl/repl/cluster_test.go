@@ -0,0 +1,268 @@
+package repl
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/cluster"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/network"
+	"github.com/sattellite/bcdb/storage/engine"
+	storage "github.com/sattellite/bcdb/storage/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// keyA and keyB are stored in the slots of nodes "a" and "b" of testCluster.
+const (
+	keyA = "bar" // slot 5061
+	keyB = "foo" // slot 12182
+)
+
+func testCluster(t *testing.T, self, addrA, addrB string) *cluster.Cluster {
+	t.Helper()
+	c, err := cluster.FromConfig(config.Cluster{
+		Enabled: true,
+		NodeID:  self,
+		Nodes: []config.ClusterNode{
+			{ID: "a", Addr: addrA, Slots: []string{"0-8191"}},
+			{ID: "b", Addr: addrB, Slots: []string{"8192-16383"}},
+		},
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestHandleClusterRedirect(t *testing.T) {
+	mockEngine := storage.NewEngine(t)
+	mockEngine.On("Get", mock.Anything, keyA).Return("value", nil)
+	r := New(noopLogger, mockEngine, WithCluster(testCluster(t, "a", "a:1", "b:1")))
+	ctx := context.Background()
+
+	res, err := r.Handle(ctx, *query.New(command.MethodGet, keyA))
+	require.NoError(t, err)
+	assert.Equal(t, "value: value", res.Value)
+
+	_, err = r.Handle(ctx, *query.New(command.MethodSet, keyB, "value"))
+	var redirect *cluster.RedirectError
+	require.ErrorAs(t, err, &redirect)
+	assert.Equal(t, "MOVED 12182 b:1", err.Error())
+}
+
+func TestHandleClusterAsking(t *testing.T) {
+	mockEngine := storage.NewEngine(t)
+	mockEngine.On("Set", mock.Anything, keyB, "value").Return(nil).Once()
+	c := testCluster(t, "a", "a:1", "b:1")
+	require.NoError(t, c.SetSlotImporting(cluster.KeySlot(keyB), "b"))
+	r := New(noopLogger, mockEngine, WithCluster(c))
+	ctx := session.NewContext(context.Background(), session.New("test"))
+
+	_, err := r.Handle(ctx, *query.New(command.MethodSet, keyB, "value"))
+	require.EqualError(t, err, "MOVED 12182 b:1", "importing slot requires ASKING")
+
+	_, err = r.Handle(ctx, *query.New(command.MethodAsking))
+	require.NoError(t, err)
+	_, err = r.Handle(ctx, *query.New(command.MethodSet, keyB, "value"))
+	require.NoError(t, err)
+
+	_, err = r.Handle(ctx, *query.New(command.MethodSet, keyB, "value"))
+	require.EqualError(t, err, "MOVED 12182 b:1", "ASKING is valid for a single command")
+}
+
+func TestHandleClusterCommands(t *testing.T) {
+	mockEngine := storage.NewEngine(t)
+	mockEngine.On("Keys", mock.Anything).Return([]string{keyA, keyB, "{bar}.1"}, nil)
+	r := New(noopLogger, mockEngine, WithCluster(testCluster(t, "a", "a:1", "b:1")))
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		wantErr  bool
+	}{
+		{"Slots", []string{"SLOTS"}, "0-8191 a a:1\n8192-16383 b b:1", false},
+		{"Nodes", []string{"nodes"}, "a a:1 myself 0-8191\nb b:1 8192-16383", false},
+		{"My id", []string{"MYID"}, "a", false},
+		{"Key slot", []string{"KEYSLOT", keyB}, "12182", false},
+		{"Count keys in slot", []string{"COUNTKEYSINSLOT", "5061"}, "2", false},
+		{"Get keys in slot", []string{"GETKEYSINSLOT", "5061", "1"}, keyA, false},
+		{"Set slot migrating", []string{"SETSLOT", "5061", "MIGRATING", "b"}, "OK", false},
+		{"Set slot stable", []string{"SETSLOT", "5061", "STABLE"}, "OK", false},
+		{"Set slot to unknown node", []string{"SETSLOT", "5061", "NODE", "x"}, "", true},
+		{"Invalid slot", []string{"SETSLOT", "16384", "STABLE"}, "", true},
+		{"Unknown subcommand", []string{"UNKNOWN"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := r.Handle(ctx, *query.New(command.MethodCluster, tt.args...))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res.Value)
+		})
+	}
+}
+
+func TestHandleClusterDisabled(t *testing.T) {
+	r := New(noopLogger, storage.NewEngine(t))
+	_, err := r.Handle(context.Background(), *query.New(command.MethodCluster, "SLOTS"))
+	require.ErrorIs(t, err, ErrClusterDisabled)
+}
+
+func newNode(t *testing.T, self string, ln net.Listener, addrA, addrB string) *REPL {
+	t.Helper()
+	r := newTestREPL(t, WithCluster(testCluster(t, self, addrA, addrB)), WithMigrator(network.NewMigrator()))
+	serve(t, r, ln)
+	return r
+}
+
+// serve serves clients of the listener by the REPL until the test ends.
+func serve(t *testing.T, r *REPL, ln net.Listener) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = network.NewServer(noopLogger, "", r).Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func TestSlotMigration(t *testing.T) {
+	lnA, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lnB, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addrA, addrB := lnA.Addr().String(), lnB.Addr().String()
+	nodeA := newNode(t, "a", lnA, addrA, addrB)
+	newNode(t, "b", lnB, addrA, addrB)
+
+	ctx := context.Background()
+	do := func(addr, cmd string) (string, error) {
+		c, cErr := network.Dial(ctx, addr)
+		require.NoError(t, cErr)
+		defer c.Close()
+		return c.Do(ctx, cmd)
+	}
+
+	_, err = do(addrA, "SET bar 1")
+	require.NoError(t, err)
+	_, err = do(addrA, network.FormatCommand("SET", "{bar}.2", "two words"))
+	require.NoError(t, err)
+
+	// start migration of slot 5061 from a to b
+	_, err = do(addrB, "CLUSTER SETSLOT 5061 IMPORTING a")
+	require.NoError(t, err)
+	_, err = do(addrA, "CLUSTER SETSLOT 5061 MIGRATING b")
+	require.NoError(t, err)
+
+	_, err = do(addrA, "MIGRATE "+addrB+" bar")
+	require.NoError(t, err)
+
+	// moved key is redirected with ASK, the rest is still served by a
+	_, err = do(addrA, "GET bar")
+	require.EqualError(t, err, "ASK 5061 "+addrB)
+	res, gErr := do(addrA, "GET {bar}.2")
+	require.NoError(t, gErr)
+	assert.Equal(t, "value: two words", res)
+
+	_, err = do(addrB, "GET bar")
+	require.EqualError(t, err, "MOVED 5061 "+addrA, "b requires ASKING until the slot is assigned")
+
+	// finish migration
+	_, err = do(addrA, "MIGRATE "+addrB+" {bar}.2")
+	require.NoError(t, err)
+	for _, addr := range []string{addrA, addrB} {
+		_, err = do(addr, "CLUSTER SETSLOT 5061 NODE b")
+		require.NoError(t, err)
+	}
+
+	_, err = do(addrA, "GET bar")
+	require.EqualError(t, err, "MOVED 5061 "+addrB)
+	res, gErr = do(addrB, "GET bar")
+	require.NoError(t, gErr)
+	assert.Equal(t, "value: 1", res)
+	res, gErr = do(addrB, "GET {bar}.2")
+	require.NoError(t, gErr)
+	assert.Equal(t, "value: two words", res)
+
+	keys, kErr := nodeA.engine.Keys(ctx)
+	require.NoError(t, kErr)
+	assert.Empty(t, keys)
+}
+
+func TestMigrateSelectedDB(t *testing.T) {
+	// numbered databases are not available in cluster mode,
+	// but MIGRATE moves keys between standalone nodes too
+	var addrs []string
+	for range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		serve(t, newTestREPL(t, WithMigrator(network.NewMigrator()), withTestDatabases(t)), ln)
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	ctx := context.Background()
+	pipeline := func(addr string, cmds ...string) []network.Reply {
+		c, cErr := network.Dial(ctx, addr)
+		require.NoError(t, cErr)
+		defer c.Close()
+		replies, pErr := c.Pipeline(ctx, cmds...)
+		require.NoError(t, pErr)
+		return replies
+	}
+
+	for _, r := range pipeline(addrs[0], "SELECT 3", "SET bar 1", "MIGRATE "+addrs[1]+" bar") {
+		require.NoError(t, r.Err)
+	}
+
+	// the key keeps its database on the target
+	replies := pipeline(addrs[1], "SELECT 3", "GET bar", "SELECT 0", "GET bar")
+	require.NoError(t, replies[1].Err)
+	assert.Equal(t, "value: 1", replies[1].Value)
+	assert.EqualError(t, replies[3].Err, engine.ErrNotFound.Error())
+}
+
+func TestMigrateAuth(t *testing.T) {
+	lnTarget, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	users, err := acl.New(acl.User{
+		Name:      "migrate",
+		Password:  acl.HashPassword("secret key"),
+		Commands:  []string{"*"},
+		ReadKeys:  []string{"*"},
+		WriteKeys: []string{"*"},
+	})
+	require.NoError(t, err)
+	target := newTestEngine(t)
+	serve(t, New(noopLogger, target, WithACL(users)), lnTarget)
+
+	ctx := session.NewContext(context.Background(), session.New("test"))
+	migrate := func(m Migrator) error {
+		eng := newTestEngine(t)
+		require.NoError(t, eng.Set(ctx, "foo", "bar"))
+		_, mErr := New(noopLogger, eng, WithMigrator(m)).Handle(ctx, *query.New(command.MethodMigrate, lnTarget.Addr().String(), "foo"))
+		return mErr
+	}
+
+	// targets with users refuse anonymous migrations
+	require.ErrorContains(t, migrate(network.NewMigrator()), acl.ErrNoAuth.Error())
+	require.NoError(t, migrate(network.NewMigrator(network.WithMigratorAuth("migrate", "secret key"))))
+	value, err := target.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", value)
+}
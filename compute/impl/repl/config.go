@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/result"
+)
+
+var (
+	ErrUnknownParam = errors.New("unknown config parameter")
+	ErrNoRewrite    = errors.New("config rewrite is not available")
+)
+
+// Param is a setting changed at runtime by CONFIG SET.
+type Param struct {
+	Get func() string
+	Set func(value string) error
+}
+
+// WithParam adds the setting to CONFIG GET and CONFIG SET under the name.
+func WithParam(name string, p Param) Option {
+	return func(r *REPL) {
+		if r.params == nil {
+			r.params = make(map[string]Param)
+		}
+		r.params[strings.ToLower(name)] = p
+	}
+}
+
+// WithRewrite enables CONFIG REWRITE, which persists the config changed
+// at runtime with fn.
+func WithRewrite(fn func() error) Option {
+	return func(r *REPL) {
+		r.rewrite = fn
+	}
+}
+
+// handleConfig runs CONFIG GET pattern, CONFIG SET name value and CONFIG REWRITE.
+func (r *REPL) handleConfig(args []string) (result.Result, error) {
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "GET" && len(args) == 2:
+		pattern := strings.ToLower(args[1])
+		var lines []string
+		for _, name := range slices.Sorted(maps.Keys(r.params)) {
+			if ok, _ := path.Match(pattern, name); ok {
+				lines = append(lines, name+":"+r.params[name].Get())
+			}
+		}
+		return result.Result{Value: strings.Join(lines, "\n")}, nil
+	case sub == "SET" && len(args) == 3:
+		name := strings.ToLower(args[1])
+		p, ok := r.params[name]
+		if !ok {
+			return result.Result{}, fmt.Errorf("%w %q", ErrUnknownParam, name)
+		}
+		if err := p.Set(args[2]); err != nil {
+			return result.Result{}, err
+		}
+		r.logger.Info("config changed", slog.String("param", name), slog.String("value", args[2]))
+		return result.Result{Value: "OK"}, nil
+	case sub == "REWRITE" && len(args) == 1:
+		if r.rewrite == nil {
+			return result.Result{}, ErrNoRewrite
+		}
+		if err := r.rewrite(); err != nil {
+			return result.Result{}, err
+		}
+		r.logger.Info("config rewritten")
+		return result.Result{Value: "OK"}, nil
+	}
+	return result.Result{}, command.ErrInvalidArguments
+}
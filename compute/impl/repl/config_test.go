@@ -0,0 +1,77 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+)
+
+func TestHandleConfig(t *testing.T) {
+	level := "info"
+	r := newTestREPL(t, withTestDatabases(t))
+	WithParam("loglevel", Param{
+		Get: func() string { return level },
+		Set: func(value string) error {
+			if value == "loud" {
+				return errors.New("invalid log level")
+			}
+			level = value
+			return nil
+		},
+	})(r)
+	WithParam("maxmemory", Param{Get: func() string { return "0" }})(r)
+
+	do := func(args ...string) (string, error) {
+		res, err := r.Handle(context.Background(), *query.New(command.MethodConfig, args...))
+		return res.Value, err
+	}
+
+	value, err := do("GET", "*")
+	require.NoError(t, err)
+	assert.Equal(t, "loglevel:info\nmaxmemory:0", value)
+
+	value, err = do("set", "LogLevel", "debug")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", value)
+	value, err = do("GET", "log*")
+	require.NoError(t, err)
+	assert.Equal(t, "loglevel:debug", value)
+
+	_, err = do("SET", "loglevel", "loud")
+	require.EqualError(t, err, "invalid log level")
+	_, err = do("SET", "missing", "1")
+	require.ErrorIs(t, err, ErrUnknownParam)
+	_, err = do("SET", "loglevel")
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+}
+
+func TestHandleConfig_Rewrite(t *testing.T) {
+	r := newTestREPL(t, withTestDatabases(t))
+	rewrite := func() (string, error) {
+		res, err := r.Handle(context.Background(), *query.New(command.MethodConfig, "REWRITE"))
+		return res.Value, err
+	}
+
+	_, err := rewrite()
+	require.ErrorIs(t, err, ErrNoRewrite)
+
+	rewrites := 0
+	WithRewrite(func() error {
+		rewrites++
+		if rewrites > 1 {
+			return errors.New("read-only file system")
+		}
+		return nil
+	})(r)
+	value, err := rewrite()
+	require.NoError(t, err)
+	assert.Equal(t, "OK", value)
+	_, err = rewrite()
+	require.EqualError(t, err, "read-only file system")
+}
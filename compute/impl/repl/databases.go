@@ -0,0 +1,98 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/storage"
+)
+
+var (
+	ErrDatabasesDisabled = errors.New("databases support disabled")
+	ErrClusterDB         = errors.New("only database 0 is available in cluster mode")
+)
+
+// db returns the engine of the database selected by the session.
+func (r *REPL) db(ctx context.Context) (storage.Engine, error) {
+	if r.dbs == nil {
+		return r.engine, nil
+	}
+	return r.dbs.DB(session.FromContext(ctx).DB())
+}
+
+// handleDatabases handles commands of numbered databases.
+func (r *REPL) handleDatabases(ctx context.Context, q query.Query) (result.Result, error) {
+	if r.dbs == nil {
+		return result.Result{}, ErrDatabasesDisabled
+	}
+	sess := session.FromContext(ctx)
+	args := q.Arguments()
+
+	switch q.Command() {
+	case command.MethodSelect:
+		db, err := r.dbs.ParseDB(args[0])
+		if err != nil {
+			return result.Result{}, err
+		}
+		if r.cluster != nil && db != 0 {
+			return result.Result{}, ErrClusterDB
+		}
+		sess.Select(db)
+		return result.Result{Value: "OK"}, nil
+	case command.MethodDBSize:
+		size, err := r.dbs.Size(ctx, sess.DB())
+		if err != nil {
+			return result.Result{}, err
+		}
+		return result.Result{Value: strconv.Itoa(size)}, nil
+	case command.MethodFlushDB:
+		if err := r.dbs.Flush(ctx, sess.DB()); err != nil {
+			return result.Result{}, err
+		}
+		r.quotas.Flush(sess.DB())
+		return result.Result{Value: "OK"}, nil
+	case command.MethodFlushAll:
+		if err := r.dbs.FlushAll(ctx); err != nil {
+			return result.Result{}, err
+		}
+		r.quotas.FlushAll()
+		return result.Result{Value: "OK"}, nil
+	case command.MethodMove:
+		if r.cluster != nil {
+			return result.Result{}, ErrClusterDB
+		}
+		db, err := r.dbs.ParseDB(args[1])
+		if err != nil {
+			return result.Result{}, err
+		}
+		if mErr := r.dbs.Move(ctx, args[0], sess.DB(), db); mErr != nil {
+			return result.Result{}, mErr
+		}
+		r.quotas.Move(args[0], sess.DB(), db)
+		return result.Result{Value: fmt.Sprintf("moved key %q to db %d", args[0], db)}, nil
+	case command.MethodSwapDB:
+		if r.cluster != nil {
+			return result.Result{}, ErrClusterDB
+		}
+		a, err := r.dbs.ParseDB(args[0])
+		if err != nil {
+			return result.Result{}, err
+		}
+		b, err := r.dbs.ParseDB(args[1])
+		if err != nil {
+			return result.Result{}, err
+		}
+		if sErr := r.dbs.Swap(ctx, a, b); sErr != nil {
+			return result.Result{}, sErr
+		}
+		r.quotas.Swap(a, b)
+		return result.Result{Value: "OK"}, nil
+	}
+	return result.Result{}, errors.New("unknown command")
+}
@@ -0,0 +1,60 @@
+package repl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/storage"
+)
+
+func TestHandleDatabases(t *testing.T) {
+	r := newTestREPL(t, withTestDatabases(t))
+	first := session.NewContext(context.Background(), session.New("first"))
+	second := session.NewContext(context.Background(), session.New("second"))
+
+	do := func(ctx context.Context, method command.Method, args ...string) string {
+		t.Helper()
+		res, err := r.Handle(ctx, *query.New(method, args...))
+		require.NoError(t, err)
+		return res.Value
+	}
+
+	assert.Equal(t, "OK", do(second, command.MethodSelect, "1"))
+	do(first, command.MethodSet, "key", "zero")
+	do(second, command.MethodSet, "key", "one")
+	do(second, command.MethodSet, "other", "one")
+
+	assert.Equal(t, "value: zero", do(first, command.MethodGet, "key"))
+	assert.Equal(t, "value: one", do(second, command.MethodGet, "key"))
+	assert.Equal(t, "1", do(first, command.MethodDBSize))
+	assert.Equal(t, "2", do(second, command.MethodDBSize))
+
+	assert.Equal(t, `moved key "other" to db 2`, do(second, command.MethodMove, "other", "2"))
+	_, err := r.Handle(second, *query.New(command.MethodMove, "key", "0"))
+	require.ErrorIs(t, err, storage.ErrKeyExists)
+
+	assert.Equal(t, "OK", do(first, command.MethodSwapDB, "0", "1"))
+	assert.Equal(t, "value: one", do(first, command.MethodGet, "key"))
+	assert.Equal(t, "value: zero", do(second, command.MethodGet, "key"))
+
+	assert.Equal(t, "OK", do(first, command.MethodFlushDB))
+	assert.Equal(t, "0", do(first, command.MethodDBSize))
+	assert.Equal(t, "1", do(second, command.MethodDBSize))
+	assert.Equal(t, "OK", do(first, command.MethodFlushAll))
+	assert.Equal(t, "0", do(second, command.MethodDBSize))
+
+	_, err = r.Handle(first, *query.New(command.MethodSelect, "4"))
+	require.ErrorIs(t, err, storage.ErrInvalidDB)
+}
+
+func TestHandleDatabases_Disabled(t *testing.T) {
+	r := &REPL{}
+	_, err := r.Handle(context.Background(), *query.New(command.MethodSelect, "1"))
+	require.ErrorIs(t, err, ErrDatabasesDisabled)
+}
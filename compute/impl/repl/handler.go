@@ -4,32 +4,120 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/sattellite/bcdb/compute/command"
 	"github.com/sattellite/bcdb/compute/query"
 	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/trace"
 )
 
 func (r *REPL) Handle(ctx context.Context, q query.Query) (result.Result, error) {
+	method := q.Command()
+	ctx, span := trace.Start(ctx, "compute.handle", slog.String("command", method.String()))
+	defer span.End()
+	start := time.Now()
+	res, err := r.handle(ctx, q)
+	elapsed := time.Since(start)
+	span.SetError(err)
+	sess := session.FromContext(ctx)
+	r.stats.observe(method, elapsed)
+	r.slowlog.add(start, elapsed, sess, q)
+	r.auditCommand(sess, q, err)
+	return res, err
+}
+
+func (r *REPL) handle(ctx context.Context, q query.Query) (result.Result, error) {
+	sess := session.FromContext(ctx)
+	method := q.Command()
+	sess.Touch(method.String())
+	// rejected commands don't use the rate of the user
+	if err := r.authorize(sess, q); err != nil {
+		return result.Result{}, err
+	}
+	if err := r.limiter.Wait(ctx, sess.User(), q.Size()); err != nil {
+		return result.Result{}, err
+	}
+	r.monitors.publish(sess, q)
+	res, err := r.execute(ctx, sess, q)
+	r.countCommand(method, err)
+	return res, err
+}
+
+// execute runs the authorized command.
+func (r *REPL) execute(ctx context.Context, sess *session.Session, q query.Query) (result.Result, error) {
+	switch q.Command() {
+	case command.MethodAuth:
+		return r.handleAuth(ctx, q.Arguments()[0], q.Arguments()[1])
+	case command.MethodACL:
+		return r.handleACL(ctx, q.Arguments())
+	case command.MethodPing:
+		// PING with a message echoes it
+		if args := q.Arguments(); len(args) == 1 {
+			return result.Result{Value: args[0]}, nil
+		}
+		return result.Result{Value: "PONG"}, nil
+	case command.MethodClient:
+		return r.handleClient(ctx, q.Arguments())
+	case command.MethodMonitor:
+		return r.handleMonitor(ctx)
+	case command.MethodSlowlog:
+		return r.handleSlowlog(q.Arguments())
+	case command.MethodInfo:
+		return r.handleInfo(ctx, q.Arguments())
+	case command.MethodConfig:
+		return r.handleConfig(q.Arguments())
+	}
+	if err := r.waitPause(ctx, q.Command()); err != nil {
+		return result.Result{}, err
+	}
+	if q.Command() == command.MethodAsking {
+		sess.SetAsking()
+		return result.Result{Value: "OK"}, nil
+	}
+	if err := r.route(ctx, q, sess.TakeAsking()); err != nil {
+		return result.Result{}, err
+	}
+	eng, dbErr := r.db(ctx)
+	if dbErr != nil {
+		return result.Result{}, dbErr
+	}
+
 	switch q.Command() {
 	case command.MethodSet:
-		err := r.engine.Set(ctx, q.Arguments()[0], q.Arguments()[1])
+		key, value := q.Arguments()[0], q.Arguments()[1]
+		undo, qErr := r.quotas.Set(sess.User(), sess.DB(), key, len(key)+len(value))
+		if qErr != nil {
+			return result.Result{}, qErr
+		}
+		err := eng.Set(ctx, key, value)
 		if err != nil {
+			undo()
 			return result.Result{}, err
 		}
 		return result.Result{Value: fmt.Sprintf("saved key %q", q.Arguments()[0])}, err
 	case command.MethodGet:
-		v, err := r.engine.Get(ctx, q.Arguments()[0])
+		v, err := eng.Get(ctx, q.Arguments()[0])
 		if err != nil {
 			return result.Result{}, err
 		}
 		return result.Result{Value: fmt.Sprintf("value: %v", v)}, err
 	case command.MethodDel:
-		err := r.engine.Del(ctx, q.Arguments()[0])
+		err := eng.Del(ctx, q.Arguments()[0])
 		if err != nil {
 			return result.Result{}, err
 		}
+		r.quotas.Del(sess.DB(), q.Arguments()[0])
 		return result.Result{Value: fmt.Sprintf("deleted key %q", q.Arguments()[0])}, err
+	case command.MethodCluster:
+		return r.handleCluster(ctx, q.Arguments())
+	case command.MethodMigrate:
+		return r.handleMigrate(ctx, q.Arguments()[0], q.Arguments()[1])
+	case command.MethodSelect, command.MethodDBSize, command.MethodFlushDB,
+		command.MethodFlushAll, command.MethodMove, command.MethodSwapDB:
+		return r.handleDatabases(ctx, q)
 	}
 	return result.Result{}, errors.New("unknown command")
 }
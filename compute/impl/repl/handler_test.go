@@ -50,6 +50,18 @@ func TestHandle(t *testing.T) {
 			expectedRes: result.Result{Value: `deleted key "key"`},
 			expectError: false,
 		},
+		{
+			name:        "Handle PING command",
+			query:       query.New(command.MethodPing),
+			setupMock:   func(m *storage.Engine) {},
+			expectedRes: result.Result{Value: "PONG"},
+		},
+		{
+			name:        "Handle PING command with message",
+			query:       query.New(command.MethodPing, "hello"),
+			setupMock:   func(m *storage.Engine) {},
+			expectedRes: result.Result{Value: "hello"},
+		},
 		{
 			name:        "Handle unknown command",
 			query:       query.New(command.Method(-1), "key"),
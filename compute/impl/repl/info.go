@@ -0,0 +1,296 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+// infoSections are the sections of INFO in the order of the output.
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "commands", "replication", "keyspace"}
+
+// defaultInfoSections are reported by INFO without a section. Keyspace
+// counts keys by scanning every database, so it is reported only by name.
+var defaultInfoSections = infoSections[:len(infoSections)-1]
+
+// stats counts executed commands.
+type stats struct {
+	// commands and errors are indexed by the method
+	commands []atomic.Uint64
+	errors   []atomic.Uint64
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+	latency  *metrics.HistogramVec
+}
+
+// observe records the latency of the command.
+func (s *stats) observe(method command.Method, d time.Duration) {
+	if s.latency != nil {
+		s.latency.With(strings.ToLower(method.String())).Observe(d.Seconds())
+	}
+}
+
+func newStats() stats {
+	n := len(command.Methods())
+	return stats{
+		commands: make([]atomic.Uint64, n),
+		errors:   make([]atomic.Uint64, n),
+		latency:  metrics.NewHistogramVec("bcdb_command_duration_seconds", "Latency of commands.", nil, "command"),
+	}
+}
+
+// Info is the structured output of INFO.
+type Info []InfoSection
+
+// InfoSection is a section of INFO with fields in the order of the output.
+type InfoSection struct {
+	Name   string
+	Fields []InfoField
+}
+
+type InfoField struct {
+	Name  string
+	Value any
+}
+
+// Map returns the fields by sections.
+func (info Info) Map() map[string]map[string]any {
+	m := make(map[string]map[string]any, len(info))
+	for _, section := range info {
+		fields := make(map[string]any, len(section.Fields))
+		for _, f := range section.Fields {
+			fields[f.Name] = f.Value
+		}
+		m[section.Name] = fields
+	}
+	return m
+}
+
+// String formats the sections as text, a "# Section" header followed by "name:value" lines.
+func (info Info) String() string {
+	var b strings.Builder
+	for i, section := range info {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s%s\n", strings.ToUpper(section.Name[:1]), section.Name[1:])
+		for _, f := range section.Fields {
+			fmt.Fprintf(&b, "%s:%v\n", f.Name, f.Value)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Info collects the section of INFO, the default sections for an empty section or "all".
+func (r *REPL) Info(ctx context.Context, section string) (Info, error) {
+	section = strings.ToLower(section)
+	sections := defaultInfoSections
+	if section != "" && section != "all" {
+		sections = []string{section}
+	}
+
+	info := make(Info, 0, len(sections))
+	for _, name := range sections {
+		var fields []InfoField
+		var err error
+		switch name {
+		case "server":
+			fields = r.serverInfo()
+		case "clients":
+			fields = r.clientsInfo()
+		case "memory":
+			fields = memoryInfo()
+		case "persistence":
+			fields = r.persistenceInfo()
+		case "stats":
+			fields = r.statsInfo()
+		case "commands":
+			fields = r.commandsInfo()
+		case "replication":
+			fields = r.replicationInfo()
+		case "keyspace":
+			fields, err = r.keyspaceInfo(ctx)
+		default:
+			return nil, fmt.Errorf("%w: unknown section %q", command.ErrInvalidArguments, section)
+		}
+		if err != nil {
+			return nil, err
+		}
+		info = append(info, InfoSection{Name: name, Fields: fields})
+	}
+	return info, nil
+}
+
+func (r *REPL) handleInfo(ctx context.Context, args []string) (result.Result, error) {
+	var section string
+	if len(args) > 0 {
+		section = args[0]
+	}
+	info, err := r.Info(ctx, section)
+	if err != nil {
+		return result.Result{}, err
+	}
+	return result.Result{Value: info.String()}, nil
+}
+
+// countCommand counts the executed command, GET commands by their outcome.
+func (r *REPL) countCommand(method command.Method, err error) {
+	if method < 0 || int(method) >= len(r.stats.commands) {
+		return
+	}
+	r.stats.commands[method].Add(1)
+	notFound := errors.Is(err, engine.ErrNotFound)
+	if err != nil && !notFound {
+		r.stats.errors[method].Add(1)
+	}
+	if method != command.MethodGet {
+		return
+	}
+	switch {
+	case err == nil:
+		r.stats.hits.Add(1)
+	case notFound:
+		r.stats.misses.Add(1)
+	}
+}
+
+func (r *REPL) serverInfo() []InfoField {
+	version := "unknown"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		version = bi.Main.Version
+	}
+	return []InfoField{
+		{Name: "version", Value: version},
+		{Name: "go_version", Value: runtime.Version()},
+		{Name: "os", Value: runtime.GOOS + "/" + runtime.GOARCH},
+		{Name: "process_id", Value: os.Getpid()},
+		{Name: "started", Value: r.started.Unix()},
+		{Name: "uptime_in_seconds", Value: int64(time.Since(r.started).Seconds())},
+	}
+}
+
+func (r *REPL) clientsInfo() []InfoField {
+	connected := 0
+	if r.sessions != nil {
+		connected = r.sessions.Len()
+	}
+	paused := time.Until(time.Unix(0, r.pausedUntil.Load())) > 0
+	return []InfoField{
+		{Name: "connected_clients", Value: connected},
+		{Name: "monitors", Value: int(r.monitors.count.Load())},
+		{Name: "paused", Value: boolInfo(paused)},
+	}
+}
+
+// memoryInfo reports the memory of the process, which approximates the memory of the data.
+func memoryInfo() []InfoField {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return []InfoField{
+		{Name: "used_memory", Value: ms.HeapAlloc},
+		{Name: "used_memory_sys", Value: ms.Sys},
+		{Name: "heap_objects", Value: ms.HeapObjects},
+		{Name: "gc_cycles", Value: ms.NumGC},
+	}
+}
+
+func (r *REPL) persistenceInfo() []InfoField {
+	p, ok := storage.PersistenceOf(r.engine)
+	var lastSave int64
+	if !p.LastSave.IsZero() {
+		lastSave = p.LastSave.Unix()
+	}
+	return []InfoField{
+		{Name: "persistence_enabled", Value: boolInfo(ok)},
+		{Name: "last_save_time", Value: lastSave},
+		{Name: "log_size", Value: p.LogSize},
+	}
+}
+
+func (r *REPL) statsInfo() []InfoField {
+	var total uint64
+	for i := range r.stats.commands {
+		total += r.stats.commands[i].Load()
+	}
+	hits, misses := r.stats.hits.Load(), r.stats.misses.Load()
+	var ratio float64
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	return []InfoField{
+		{Name: "total_commands_processed", Value: total},
+		{Name: "keyspace_hits", Value: hits},
+		{Name: "keyspace_misses", Value: misses},
+		{Name: "keyspace_hit_ratio", Value: ratio},
+		{Name: "slowlog_len", Value: r.slowlog.len()},
+	}
+}
+
+// commandsInfo reports the number of calls of every command.
+func (r *REPL) commandsInfo() []InfoField {
+	methods := command.Methods()
+	fields := make([]InfoField, 0, len(methods))
+	for _, m := range methods {
+		fields = append(fields, InfoField{Name: "cmd_" + strings.ToLower(m.String()), Value: r.stats.commands[m].Load()})
+	}
+	return fields
+}
+
+// replicationInfo reports the role of the node, which is always
+// the primary, because replicas are not supported.
+func (r *REPL) replicationInfo() []InfoField {
+	fields := []InfoField{
+		{Name: "role", Value: "primary"},
+		{Name: "connected_replicas", Value: 0},
+		{Name: "cluster_enabled", Value: boolInfo(r.cluster != nil)},
+	}
+	if r.cluster != nil {
+		fields = append(fields, InfoField{Name: "cluster_node_id", Value: r.cluster.Self()})
+	}
+	return fields
+}
+
+// keyspaceInfo reports the number of keys of every non-empty database.
+func (r *REPL) keyspaceInfo(ctx context.Context) ([]InfoField, error) {
+	if r.dbs == nil {
+		keys, err := r.engine.Keys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, nil
+		}
+		return []InfoField{{Name: "db0", Value: len(keys)}}, nil
+	}
+
+	var fields []InfoField
+	for db := range r.dbs.Count() {
+		size, err := r.dbs.Size(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		if size > 0 {
+			fields = append(fields, InfoField{Name: fmt.Sprintf("db%d", db), Value: size})
+		}
+	}
+	return fields, nil
+}
+
+func boolInfo(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
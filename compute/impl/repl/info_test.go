@@ -0,0 +1,78 @@
+package repl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+func TestInfo(t *testing.T) {
+	r := newTestREPL(t, withTestDatabases(t))
+	sessions := session.NewRegistry()
+	WithSessions(sessions)(r)
+	sess := session.New("client")
+	sessions.Add(sess, func() {})
+	ctx := session.NewContext(context.Background(), sess)
+
+	for _, q := range []*query.Query{
+		query.New(command.MethodSet, "a", "1"),
+		query.New(command.MethodSet, "b", "1"),
+		query.New(command.MethodGet, "a"),
+		query.New(command.MethodGet, "missing"),
+		query.New(command.MethodSelect, "2"),
+		query.New(command.MethodSet, "c", "1"),
+	} {
+		_, _ = r.Handle(ctx, *q)
+	}
+
+	info, err := r.Info(ctx, "")
+	require.NoError(t, err)
+	m := info.Map()
+	require.Len(t, m, len(infoSections)-1)
+	assert.NotContains(t, m, "keyspace", "keyspace scans databases, it is reported by name only")
+
+	assert.Equal(t, 1, m["clients"]["connected_clients"])
+	assert.Equal(t, uint64(6), m["stats"]["total_commands_processed"])
+	assert.Equal(t, uint64(1), m["stats"]["keyspace_hits"])
+	assert.Equal(t, uint64(1), m["stats"]["keyspace_misses"])
+	assert.InDelta(t, 0.5, m["stats"]["keyspace_hit_ratio"], 0.001)
+	assert.Equal(t, uint64(3), m["commands"]["cmd_set"])
+	assert.Equal(t, uint64(0), m["commands"]["cmd_del"])
+	assert.Equal(t, 0, m["persistence"]["persistence_enabled"], "memory engine is not durable")
+	assert.Equal(t, "primary", m["replication"]["role"])
+	assert.Positive(t, m["memory"]["used_memory"])
+
+	info, err = r.Info(ctx, "keyspace")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"db0": 2, "db2": 1}, info.Map()["keyspace"])
+}
+
+func TestHandleInfo(t *testing.T) {
+	r := newTestREPL(t, withTestDatabases(t))
+	ctx := session.NewContext(context.Background(), session.New("client"))
+
+	res, err := r.Handle(ctx, *query.New(command.MethodInfo, "Keyspace"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Keyspace", res.Value)
+
+	_, err = r.Handle(ctx, *query.New(command.MethodSet, "a", "1"))
+	require.NoError(t, err)
+	res, err = r.Handle(ctx, *query.New(command.MethodInfo, "keyspace"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Keyspace\ndb0:1", res.Value)
+
+	res, err = r.Handle(ctx, *query.New(command.MethodInfo))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.Value, "# Server\nversion:"))
+	assert.Contains(t, res.Value, "\n\n# Clients\nconnected_clients:0\n")
+
+	_, err = r.Handle(ctx, *query.New(command.MethodInfo, "unknown"))
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+}
@@ -0,0 +1,72 @@
+package repl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/limits"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+func TestHandle_RateLimited(t *testing.T) {
+	r := newTestREPL(t, WithLimiter(limits.NewLimiter(limits.Reject, limits.Rate{CommandsPerSecond: 2}, nil)))
+	ctx := session.NewContext(context.Background(), session.New("test"))
+
+	for range 2 {
+		_, err := r.Handle(ctx, *query.New(command.MethodPing))
+		require.NoError(t, err)
+	}
+	_, err := r.Handle(ctx, *query.New(command.MethodPing))
+	require.ErrorIs(t, err, limits.ErrRateLimited)
+	assert.ErrorContains(t, err, "RATELIMITED")
+}
+
+func TestHandle_RateLimitedAfterAuthorize(t *testing.T) {
+	a, err := acl.New(acl.User{Name: "app", Password: acl.HashPassword("secret"), Commands: []string{"*"}})
+	require.NoError(t, err)
+	r := newTestREPL(t, WithACL(a), WithLimiter(limits.NewLimiter(limits.Reject, limits.Rate{CommandsPerSecond: 2}, nil)))
+	ctx := session.NewContext(context.Background(), session.New("test"))
+
+	// commands rejected before authentication don't use the rate
+	for range 3 {
+		_, err = r.Handle(ctx, *query.New(command.MethodGet, "key"))
+		require.ErrorIs(t, err, acl.ErrNoAuth)
+	}
+	for range 2 {
+		_, err = r.Handle(ctx, *query.New(command.MethodPing))
+		require.NoError(t, err)
+	}
+	_, err = r.Handle(ctx, *query.New(command.MethodPing))
+	require.ErrorIs(t, err, limits.ErrRateLimited)
+}
+
+func TestHandle_Quotas(t *testing.T) {
+	quotas := limits.NewQuotas(map[string]limits.Quota{"app": {MaxKeys: 2}})
+	r := newTestREPL(t, withTestDatabases(t), WithQuotas(quotas))
+	sess := session.New("test")
+	sess.SetUser("app")
+	ctx := session.NewContext(context.Background(), sess)
+
+	handle := func(method command.Method, args ...string) error {
+		_, hErr := r.Handle(ctx, *query.New(method, args...))
+		return hErr
+	}
+
+	require.NoError(t, handle(command.MethodSet, "a", "1"))
+	require.NoError(t, handle(command.MethodSet, "b", "1"))
+	require.ErrorIs(t, handle(command.MethodSet, "c", "1"), limits.ErrQuotaExceeded)
+	_, err := r.Handle(ctx, *query.New(command.MethodGet, "c"))
+	require.ErrorIs(t, err, engine.ErrNotFound)
+
+	require.NoError(t, handle(command.MethodDel, "a"))
+	require.NoError(t, handle(command.MethodSet, "c", "1"))
+	require.NoError(t, handle(command.MethodFlushDB))
+	assert.Equal(t, limits.Usage{}, quotas.Usage("app"))
+}
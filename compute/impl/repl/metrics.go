@@ -0,0 +1,41 @@
+package repl
+
+import (
+	"strings"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/metrics"
+)
+
+// Collect exposes counters of commands and sessions, so the REPL
+// can be registered in a metrics registry.
+func (r *REPL) Collect() []metrics.Family {
+	calls := metrics.Family{Name: "bcdb_commands_total", Help: "Executed commands.", Type: metrics.TypeCounter}
+	errs := metrics.Family{Name: "bcdb_command_errors_total", Help: "Failed commands.", Type: metrics.TypeCounter}
+	for _, m := range command.Methods()[:len(r.stats.commands)] {
+		labels := []metrics.Label{{Name: "command", Value: strings.ToLower(m.String())}}
+		calls.Samples = append(calls.Samples, metrics.Sample{Labels: labels, Value: float64(r.stats.commands[m].Load())})
+		errs.Samples = append(errs.Samples, metrics.Sample{Labels: labels, Value: float64(r.stats.errors[m].Load())})
+	}
+
+	connected := 0
+	if r.sessions != nil {
+		connected = r.sessions.Len()
+	}
+	single := func(name, help string, typ metrics.Type, v float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: typ, Samples: []metrics.Sample{{Value: v}}}
+	}
+	families := []metrics.Family{
+		calls,
+		errs,
+		single("bcdb_keyspace_hits_total", "GET commands of existing keys.", metrics.TypeCounter, float64(r.stats.hits.Load())),
+		single("bcdb_keyspace_misses_total", "GET commands of missing keys.", metrics.TypeCounter, float64(r.stats.misses.Load())),
+		single("bcdb_connected_clients", "Connected network sessions.", metrics.TypeGauge, float64(connected)),
+		single("bcdb_monitors", "Sessions running MONITOR.", metrics.TypeGauge, float64(r.monitors.count.Load())),
+		single("bcdb_slowlog_length", "Entries of the slow log.", metrics.TypeGauge, float64(r.slowlog.len())),
+	}
+	if r.stats.latency != nil {
+		families = append(families, r.stats.latency.Collect()...)
+	}
+	return families
+}
@@ -0,0 +1,43 @@
+package repl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/metrics"
+)
+
+func TestCollect(t *testing.T) {
+	r := newTestREPL(t, withTestDatabases(t))
+	ctx := context.Background()
+	for _, q := range []*query.Query{
+		query.New(command.MethodSet, "a", "1"),
+		query.New(command.MethodGet, "a"),
+		query.New(command.MethodGet, "missing"),
+		query.New(command.MethodSelect, "100"),
+	} {
+		_, _ = r.Handle(ctx, *q)
+	}
+
+	reg := metrics.NewRegistry()
+	reg.Register(r)
+	var b strings.Builder
+	require.NoError(t, metrics.WriteText(&b, reg.Gather()))
+	out := b.String()
+
+	assert.Contains(t, out, `bcdb_commands_total{command="get"} 2`)
+	assert.Contains(t, out, `bcdb_commands_total{command="del"} 0`)
+	// missing keys are not errors
+	assert.Contains(t, out, `bcdb_command_errors_total{command="get"} 0`)
+	assert.Contains(t, out, `bcdb_command_errors_total{command="select"} 1`)
+	assert.Contains(t, out, `bcdb_command_duration_seconds_count{command="set"} 1`)
+	assert.Contains(t, out, "bcdb_keyspace_hits_total 1\n")
+	assert.Contains(t, out, "bcdb_keyspace_misses_total 1\n")
+	assert.Contains(t, out, "bcdb_connected_clients 0\n")
+}
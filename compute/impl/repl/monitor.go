@@ -0,0 +1,104 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+// monitorBuffer is the number of commands queued for a monitor,
+// monitors falling behind are dropped.
+const monitorBuffer = 1024
+
+// redacted replaces secret arguments of commands.
+const redacted = "(redacted)"
+
+// monitors streams executed commands to MONITOR sessions.
+type monitors struct {
+	logger *slog.Logger
+	// count makes publishing free without monitors
+	count atomic.Int32
+
+	mu   sync.Mutex
+	subs map[chan string]uint64
+}
+
+// handleMonitor subscribes the session to executed commands until its context is done.
+func (r *REPL) handleMonitor(ctx context.Context) (result.Result, error) {
+	ch := make(chan string, monitorBuffer)
+	id := session.FromContext(ctx).ID
+
+	m := &r.monitors
+	m.mu.Lock()
+	if m.subs == nil {
+		m.subs = make(map[chan string]uint64)
+	}
+	m.subs[ch] = id
+	m.count.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.remove(ch)
+	}()
+	return result.Result{Value: "OK", Stream: ch}, nil
+}
+
+// publish sends the command to monitors. Monitors with a full queue are dropped,
+// so a slow monitor doesn't stall commands of other sessions.
+func (m *monitors) publish(sess *session.Session, q query.Query) {
+	if m.count.Load() == 0 {
+		return
+	}
+	line := formatMonitor(time.Now(), sess, q)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch, id := range m.subs {
+		select {
+		case ch <- line:
+		default:
+			m.logger.Warn("monitor dropped, it's too slow", slog.Uint64("session", id))
+			m.remove(ch)
+		}
+	}
+}
+
+// remove closes the monitor channel, m.mu must be held.
+func (m *monitors) remove(ch chan string) {
+	if _, ok := m.subs[ch]; !ok {
+		return
+	}
+	delete(m.subs, ch)
+	m.count.Add(-1)
+	close(ch)
+}
+
+// formatMonitor describes the command like
+// 1700000000.000001 [id=3 db=0 127.0.0.1:5000] "SET" "key" "value".
+func formatMonitor(now time.Time, sess *session.Session, q query.Query) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [id=%d db=%d %s]", now.Unix(), now.Nanosecond()/1000, sess.ID, sess.DB(), sess.RemoteAddr)
+
+	method := q.Command()
+	b.WriteString(" " + strconv.Quote(method.String()))
+	for i, arg := range q.Arguments() {
+		if method == command.MethodAuth && i == 1 {
+			arg = redacted
+		}
+		b.WriteString(" " + strconv.Quote(arg))
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package repl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+func TestHandleMonitor(t *testing.T) {
+	r := newTestREPL(t)
+	monitorCtx, stop := context.WithCancel(session.NewContext(context.Background(), session.New("monitor")))
+	res, err := r.Handle(monitorCtx, *query.New(command.MethodMonitor))
+	require.NoError(t, err)
+	assert.Equal(t, "OK", res.Value)
+	require.NotNil(t, res.Stream)
+
+	client := session.New("127.0.0.1:5000")
+	ctx := session.NewContext(context.Background(), client)
+	_, err = r.Handle(ctx, *query.New(command.MethodSet, "key", "two words"))
+	require.NoError(t, err)
+
+	line := <-res.Stream
+	assert.Regexp(t, `^\d+\.\d{6} \[id=\d+ db=0 127.0.0.1:5000\] "SET" "key" "two words"$`, line)
+
+	stop()
+	_, ok := <-res.Stream
+	assert.False(t, ok, "the stream is closed with the session")
+	assert.Zero(t, r.monitors.count.Load())
+}
+
+func TestHandleMonitor_DropSlow(t *testing.T) {
+	r := newTestREPL(t)
+	monitorCtx, stop := context.WithCancel(session.NewContext(context.Background(), session.New("monitor")))
+	defer stop()
+	res, err := r.Handle(monitorCtx, *query.New(command.MethodMonitor))
+	require.NoError(t, err)
+
+	ctx := session.NewContext(context.Background(), session.New("client"))
+	for range monitorBuffer + 1 {
+		_, err = r.Handle(ctx, *query.New(command.MethodPing))
+		require.NoError(t, err)
+	}
+
+	received := 0
+	for range res.Stream {
+		received++
+	}
+	assert.Equal(t, monitorBuffer, received)
+	assert.Zero(t, r.monitors.count.Load())
+}
+
+func TestFormatMonitor(t *testing.T) {
+	sess := session.New("127.0.0.1:5000")
+	now := time.Unix(1700000000, 1500)
+	line := formatMonitor(now, sess, *query.New(command.MethodAuth, "app", "secret"))
+	assert.Contains(t, line, `1700000000.000001 [id=`)
+	assert.Contains(t, line, `"AUTH" "app" "(redacted)"`)
+	assert.NotContains(t, line, "secret")
+}
+
+func TestMonitors_NoAllocationsWithoutMonitors(t *testing.T) {
+	r := newTestREPL(t)
+	sess := session.New("client")
+	q := *query.New(command.MethodGet, "key")
+	allocs := testing.AllocsPerRun(100, func() {
+		r.monitors.publish(sess, q)
+	})
+	assert.Zero(t, allocs)
+}
@@ -2,6 +2,8 @@ package repl
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/sattellite/bcdb/compute/command"
@@ -11,10 +13,13 @@ import (
 var ErrInvalidQuery = errors.New("invalid query")
 
 func (r *REPL) Parse(input string) (*query.Query, error) {
-	parts := strings.Split(input, " ")
-	if len(parts) < 2 {
+	if input == "" || input[0] == ' ' {
 		return nil, ErrInvalidQuery
 	}
+	parts, err := splitArgs(input)
+	if err != nil {
+		return nil, err
+	}
 
 	cmd, err := command.ParseMethod(parts[0])
 	if err != nil {
@@ -28,3 +33,33 @@ func (r *REPL) Parse(input string) (*query.Query, error) {
 
 	return query.New(*cmd, args...), nil
 }
+
+// splitArgs splits the input by spaces. Arguments starting with a double
+// quote are unquoted like Go strings, so they may contain spaces and escapes.
+func splitArgs(input string) ([]string, error) {
+	var parts []string
+	for input != "" {
+		if input[0] == ' ' {
+			input = input[1:]
+			continue
+		}
+		if input[0] != '"' {
+			part, rest, _ := strings.Cut(input, " ")
+			parts = append(parts, part)
+			input = rest
+			continue
+		}
+
+		quoted, err := strconv.QuotedPrefix(input)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unterminated quoted argument", ErrInvalidQuery)
+		}
+		input = input[len(quoted):]
+		if input != "" && input[0] != ' ' {
+			return nil, fmt.Errorf("%w: quoted argument must be followed by a space", ErrInvalidQuery)
+		}
+		part, _ := strconv.Unquote(quoted)
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
@@ -20,6 +20,11 @@ func TestParse(t *testing.T) {
 	}{
 		{name: "Valid SET command", input: "SET key value", expectedMethod: command.MethodSet, expectedArgs: []string{"key", "value"}, expectError: false},
 		{name: "Valid GET command", input: "GET key", expectedMethod: command.MethodGet, expectedArgs: []string{"key"}, expectError: false},
+		{name: "Valid command without arguments", input: "ASKING", expectedMethod: command.MethodAsking, expectedArgs: []string{}, expectError: false},
+		{name: "Quoted arguments", input: `SET "a key" "line\n\"quoted\""`, expectedMethod: command.MethodSet, expectedArgs: []string{"a key", "line\n\"quoted\""}, expectError: false},
+		{name: "Quote inside argument", input: `SET a"b c`, expectedMethod: command.MethodSet, expectedArgs: []string{`a"b`, "c"}, expectError: false},
+		{name: "Unterminated quote", input: `SET key "value`, expectError: true, wantedError: ErrInvalidQuery},
+		{name: "Text after quote", input: `SET key "val"ue`, expectError: true, wantedError: ErrInvalidQuery},
 		{name: "Invalid command", input: "INVALID key", expectError: true, wantedError: command.ErrInvalidCommand},
 		{name: "Empty input", input: "", expectError: true, wantedError: ErrInvalidQuery},
 		{name: "SET command with missing arguments", input: "SET key", expectError: true, wantedError: command.ErrInvalidArguments},
@@ -20,3 +20,10 @@ func (r *REPL) prompt(p []byte) error {
 	_, err := r.out.Write(p)
 	return err
 }
+
+// printStream prints values of MONITOR until the stream is closed.
+func (r *REPL) printStream(stream <-chan string) {
+	for value := range stream {
+		_ = r.Print(result.Result{Value: value})
+	}
+}
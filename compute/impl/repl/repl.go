@@ -7,25 +7,121 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/sattellite/bcdb/acl"
+	"github.com/sattellite/bcdb/audit"
+	"github.com/sattellite/bcdb/cluster"
 	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/limits"
 	"github.com/sattellite/bcdb/storage"
 )
 
-func New(logger *slog.Logger, engine storage.Engine) *REPL {
-	return &REPL{
-		logger: logger.With("module", "repl"),
-		engine: engine,
-		in:     make(chan string),
-		out:    log.New(os.Stdout, "", 0).Writer(),
+// Option configures optional REPL dependencies.
+type Option func(*REPL)
+
+// WithCluster enables cluster mode: keys of slots served
+// by other nodes are redirected with MOVED or ASK errors.
+func WithCluster(c *cluster.Cluster) Option {
+	return func(r *REPL) {
+		r.cluster = c
+	}
+}
+
+// WithMigrator enables MIGRATE, which writes keys to other nodes with m.
+func WithMigrator(m Migrator) Option {
+	return func(r *REPL) {
+		r.migrator = m
+	}
+}
+
+// WithDatabases enables SELECT and other commands of numbered databases.
+// Without it every session works with the whole engine.
+func WithDatabases(dbs *storage.Namespaces) Option {
+	return func(r *REPL) {
+		r.dbs = dbs
 	}
 }
 
+// WithACL requires sessions to authenticate and checks
+// access of users to commands and keys.
+func WithACL(a *acl.ACL) Option {
+	return func(r *REPL) {
+		r.acl = a
+	}
+}
+
+// WithLimiter limits the rate of commands of all sessions and of every user.
+func WithLimiter(l *limits.Limiter) Option {
+	return func(r *REPL) {
+		r.limiter = l
+	}
+}
+
+// WithQuotas limits keys and memory written by users.
+func WithQuotas(q *limits.Quotas) Option {
+	return func(r *REPL) {
+		r.quotas = q
+	}
+}
+
+// WithSessions enables CLIENT LIST and CLIENT KILL of sessions tracked in the registry.
+func WithSessions(reg *session.Registry) Option {
+	return func(r *REPL) {
+		r.sessions = reg
+	}
+}
+
+// WithSlowlog records commands executed longer than the threshold, keeping
+// the latest size of them. Zero threshold records every command, negative
+// disables the slow log.
+func WithSlowlog(threshold time.Duration, size int) Option {
+	return func(r *REPL) {
+		r.slowlog = newSlowlog(threshold, size)
+	}
+}
+
+func New(logger *slog.Logger, engine storage.Engine, opts ...Option) *REPL {
+	r := &REPL{
+		logger:  logger.With("module", "repl"),
+		started: time.Now(),
+		engine:  engine,
+		in:      make(chan string),
+		out:     log.New(os.Stdout, "", 0).Writer(),
+	}
+	r.monitors.logger = r.logger
+	r.stats = newStats()
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
 type REPL struct {
-	logger *slog.Logger
-	engine storage.Engine
-	in     chan string
-	out    io.Writer
+	logger  *slog.Logger
+	engine  storage.Engine
+	cluster *cluster.Cluster
+	// migrator writes keys moved by MIGRATE to other nodes
+	migrator Migrator
+	dbs      *storage.Namespaces
+	acl      *acl.ACL
+	limiter  *limits.Limiter
+	quotas   *limits.Quotas
+	// sessions are tracked by network servers
+	sessions *session.Registry
+	// writes wait until the time in unix nanoseconds set by CLIENT PAUSE
+	pausedUntil atomic.Int64
+	monitors    monitors
+	slowlog     *slowlog
+	params      map[string]Param
+	rewrite     func() error
+	audit       *audit.Log
+	stats       stats
+	started     time.Time
+	in          chan string
+	out         io.Writer
 }
 
 func (r *REPL) Run(ctx context.Context) {
@@ -34,6 +130,7 @@ func (r *REPL) Run(ctx context.Context) {
 		r.logger.Info("compute stopped")
 	}()
 
+	ctx = session.NewContext(ctx, session.New("stdin"))
 	scanner := bufio.NewScanner(os.Stdin)
 
 	_ = r.prompt(prefixIn)
@@ -57,6 +154,9 @@ func (r *REPL) Run(ctx context.Context) {
 		}
 		// write result to stdout
 		_ = r.Print(res)
+		if res.Stream != nil {
+			go r.printStream(res.Stream)
+		}
 		_ = r.prompt(prefixIn)
 	}
 }
@@ -0,0 +1,40 @@
+package repl
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/storage"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestREPL returns a REPL over a new memory engine.
+func newTestREPL(t *testing.T, opts ...Option) *REPL {
+	t.Helper()
+	return New(noopLogger, newTestEngine(t), opts...)
+}
+
+// newTestEngine returns a memory engine stopped when the test ends.
+func newTestEngine(t *testing.T) *engine.Memory {
+	t.Helper()
+	done := make(chan struct{})
+	eng, err := engine.NewMemory(noopLogger, done)
+	require.NoError(t, err)
+	t.Cleanup(func() { close(done) })
+	return eng
+}
+
+// withTestDatabases enables 4 databases stored in the engine of the REPL.
+func withTestDatabases(t *testing.T) Option {
+	return func(r *REPL) {
+		dbs, err := storage.NewNamespaces(context.Background(), r.engine, 4)
+		require.NoError(t, err)
+		WithDatabases(dbs)(r)
+	}
+}
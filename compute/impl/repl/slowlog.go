@@ -0,0 +1,210 @@
+package repl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+const (
+	// slowlogMaxArgs and slowlogMaxArgLen truncate commands stored in the slow log.
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+	// slowlogDefaultGet is the number of entries returned by SLOWLOG GET without a count.
+	slowlogDefaultGet = 10
+)
+
+// slowlogEntry is a command executed longer than the threshold of the slow log.
+type slowlogEntry struct {
+	ID       uint64
+	Time     time.Time
+	Duration time.Duration
+	// Command is the method and arguments, long arguments are truncated.
+	Command []string
+	Client  string
+	Name    string
+}
+
+// slowlog keeps the latest slow commands in a ring buffer.
+type slowlog struct {
+	// threshold is a time.Duration, it is checked before locking
+	threshold atomic.Int64
+
+	mu      sync.Mutex
+	entries []slowlogEntry
+	next    int
+	lastID  uint64
+}
+
+func newSlowlog(threshold time.Duration, size int) *slowlog {
+	s := &slowlog{entries: make([]slowlogEntry, 0, max(size, 0))}
+	s.threshold.Store(int64(threshold))
+	return s
+}
+
+// set changes the threshold and the size, keeping the latest entries which fit.
+func (s *slowlog) set(threshold time.Duration, size int) {
+	if s == nil {
+		return
+	}
+	s.threshold.Store(int64(threshold))
+	size = max(size, 0)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size == cap(s.entries) {
+		return
+	}
+	latest := s.latest(size)
+	entries := make([]slowlogEntry, 0, size)
+	for i := len(latest) - 1; i >= 0; i-- {
+		entries = append(entries, latest[i])
+	}
+	s.entries, s.next = entries, 0
+}
+
+// add records the command when it is slow.
+func (s *slowlog) add(start time.Time, elapsed time.Duration, sess *session.Session, q query.Query) {
+	if s == nil {
+		return
+	}
+	if threshold := time.Duration(s.threshold.Load()); threshold < 0 || elapsed < threshold {
+		return
+	}
+	info := sess.Info()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cap(s.entries) == 0 {
+		return
+	}
+	s.lastID++
+	e := slowlogEntry{
+		ID:       s.lastID,
+		Time:     start,
+		Duration: elapsed,
+		Command:  truncateCommand(q),
+		Client:   info.RemoteAddr,
+		Name:     info.Name,
+	}
+	if len(s.entries) < cap(s.entries) {
+		s.entries = append(s.entries, e)
+		return
+	}
+	s.entries[s.next] = e
+	s.next = (s.next + 1) % len(s.entries)
+}
+
+// get returns up to n latest entries, the newest first.
+func (s *slowlog) get(n int) []slowlogEntry {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest(n)
+}
+
+// latest returns up to n latest entries, the newest first. s.mu must be held.
+func (s *slowlog) latest(n int) []slowlogEntry {
+	n = min(n, len(s.entries))
+	entries := make([]slowlogEntry, 0, n)
+	for i := range n {
+		// the newest entry is before next
+		idx := (s.next - 1 - i + 2*len(s.entries)) % len(s.entries)
+		entries = append(entries, s.entries[idx])
+	}
+	return entries
+}
+
+func (s *slowlog) len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *slowlog) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = s.entries[:0]
+	s.next = 0
+}
+
+func truncateCommand(q query.Query) []string {
+	method := q.Command()
+	args := q.Arguments()
+	cmd := make([]string, 0, min(len(args), slowlogMaxArgs)+1)
+	cmd = append(cmd, method.String())
+	for i, arg := range args {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			cmd = append(cmd, fmt.Sprintf("... (%d more arguments)", len(args)-i))
+			break
+		}
+		if method == command.MethodAuth && i == 1 {
+			arg = redacted
+		}
+		if len(arg) > slowlogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		}
+		cmd = append(cmd, arg)
+	}
+	return cmd
+}
+
+// SetSlowlog changes the threshold and the size of the slow log enabled by WithSlowlog.
+// The latest entries which fit the new size are kept.
+func (r *REPL) SetSlowlog(threshold time.Duration, size int) {
+	r.slowlog.set(threshold, size)
+}
+
+// handleSlowlog handles SLOWLOG GET [count], LEN and RESET.
+func (r *REPL) handleSlowlog(args []string) (result.Result, error) {
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "GET" && len(args) <= 2:
+		count := slowlogDefaultGet
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 0 {
+				return result.Result{}, command.ErrInvalidArguments
+			}
+			count = n
+		}
+		entries := r.slowlog.get(count)
+		lines := make([]string, 0, len(entries))
+		for _, e := range entries {
+			lines = append(lines, formatSlowlog(e))
+		}
+		return result.Result{Value: strings.Join(lines, "\n")}, nil
+	case sub == "LEN" && len(args) == 1:
+		return result.Result{Value: strconv.Itoa(r.slowlog.len())}, nil
+	case sub == "RESET" && len(args) == 1:
+		r.slowlog.reset()
+		return result.Result{Value: "OK"}, nil
+	}
+	return result.Result{}, command.ErrInvalidArguments
+}
+
+// formatSlowlog describes the entry in a line, the duration is in microseconds.
+func formatSlowlog(e slowlogEntry) string {
+	quoted := make([]string, 0, len(e.Command))
+	for _, arg := range e.Command {
+		quoted = append(quoted, strconv.Quote(arg))
+	}
+	return fmt.Sprintf("id=%d time=%d duration=%d client=%s name=%s cmd=%s",
+		e.ID, e.Time.Unix(), e.Duration.Microseconds(), e.Client, e.Name, strings.Join(quoted, " "))
+}
@@ -0,0 +1,122 @@
+package repl
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+func TestSlowlog_Ring(t *testing.T) {
+	s := newSlowlog(0, 3)
+	sess := session.New("client")
+	for i := range 5 {
+		s.add(time.Now(), time.Millisecond, sess, *query.New(command.MethodGet, strconv.Itoa(i)))
+	}
+
+	assert.Equal(t, 3, s.len())
+	entries := s.get(10)
+	require.Len(t, entries, 3)
+	for i, want := range []uint64{5, 4, 3} {
+		assert.Equal(t, want, entries[i].ID, "the newest entries first")
+	}
+	assert.Equal(t, []string{"GET", "4"}, entries[0].Command)
+	assert.Len(t, s.get(1), 1)
+
+	s.reset()
+	assert.Zero(t, s.len())
+	s.add(time.Now(), time.Millisecond, sess, *query.New(command.MethodGet, "key"))
+	assert.Equal(t, uint64(6), s.get(1)[0].ID, "ids continue after reset")
+}
+
+func TestSlowlog_Threshold(t *testing.T) {
+	sess := session.New("client")
+	q := *query.New(command.MethodPing)
+
+	s := newSlowlog(10*time.Millisecond, 3)
+	s.add(time.Now(), time.Millisecond, sess, q)
+	s.add(time.Now(), 10*time.Millisecond, sess, q)
+	assert.Equal(t, 1, s.len())
+
+	disabled := newSlowlog(-1, 3)
+	disabled.add(time.Now(), time.Hour, sess, q)
+	assert.Zero(t, disabled.len())
+}
+
+func TestSlowlog_Set(t *testing.T) {
+	sess := session.New("client")
+	s := newSlowlog(-1, 4)
+	for i := range 6 {
+		s.add(time.Now(), time.Millisecond, sess, *query.New(command.MethodGet, strconv.Itoa(i)))
+	}
+	assert.Zero(t, s.len())
+
+	s.set(0, 4)
+	for i := range 6 {
+		s.add(time.Now(), time.Millisecond, sess, *query.New(command.MethodGet, strconv.Itoa(i)))
+	}
+	s.set(0, 2)
+	entries := s.get(10)
+	require.Len(t, entries, 2, "the latest entries are kept")
+	assert.Equal(t, []uint64{6, 5}, []uint64{entries[0].ID, entries[1].ID})
+
+	s.set(0, 3)
+	s.add(time.Now(), time.Millisecond, sess, *query.New(command.MethodGet, "7"))
+	s.add(time.Now(), time.Millisecond, sess, *query.New(command.MethodGet, "8"))
+	entries = s.get(10)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []uint64{8, 7, 6}, []uint64{entries[0].ID, entries[1].ID, entries[2].ID})
+}
+
+func TestTruncateCommand(t *testing.T) {
+	long := strings.Repeat("v", slowlogMaxArgLen+10)
+	assert.Equal(t,
+		[]string{"SET", "key", strings.Repeat("v", slowlogMaxArgLen) + "... (10 more bytes)"},
+		truncateCommand(*query.New(command.MethodSet, "key", long)))
+	assert.Equal(t, []string{"AUTH", "app", redacted}, truncateCommand(*query.New(command.MethodAuth, "app", "secret")))
+
+	args := make([]string, slowlogMaxArgs+5)
+	for i := range args {
+		args[i] = strconv.Itoa(i)
+	}
+	cmd := truncateCommand(*query.New(command.MethodClient, args...))
+	require.Len(t, cmd, slowlogMaxArgs+1)
+	assert.Equal(t, "... (6 more arguments)", cmd[slowlogMaxArgs])
+}
+
+func TestHandleSlowlog(t *testing.T) {
+	r := newTestREPL(t, WithSlowlog(0, 10))
+	sess := session.New("127.0.0.1:5000")
+	sess.SetName("worker")
+	ctx := session.NewContext(context.Background(), sess)
+
+	handle := func(args ...string) string {
+		t.Helper()
+		res, hErr := r.Handle(ctx, *query.New(command.MethodSlowlog, args...))
+		require.NoError(t, hErr)
+		return res.Value
+	}
+
+	_, err := r.Handle(ctx, *query.New(command.MethodSet, "key", "value"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", handle("LEN"))
+	lines := strings.Split(handle("get", "2"), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, `cmd="SLOWLOG" "LEN"`, lines[0][strings.Index(lines[0], "cmd="):])
+	assert.Regexp(t, `^id=1 time=\d+ duration=\d+ client=127.0.0.1:5000 name=worker cmd="SET" "key" "value"$`, lines[1])
+	assert.Equal(t, "OK", handle("RESET"))
+	assert.Equal(t, "1", handle("LEN"), "only the reset is logged")
+
+	_, err = r.Handle(ctx, *query.New(command.MethodSlowlog, "GET", "-1"))
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+	_, err = r.Handle(ctx, *query.New(command.MethodSlowlog, "LEN", "1"))
+	require.ErrorIs(t, err, command.ErrInvalidArguments)
+}
@@ -23,3 +23,12 @@ func New(method command.Method, arguments ...string) *Query {
 		arguments: arguments,
 	}
 }
+
+// Size returns the number of bytes of the command and its arguments.
+func (q *Query) Size() int {
+	size := len(q.method.String())
+	for _, arg := range q.arguments {
+		size += len(arg)
+	}
+	return size
+}
@@ -47,3 +47,8 @@ func TestNilMethod(t *testing.T) {
 	assert.Equal(t, method, query.Command(), "Method should match")
 	assert.Equal(t, args, query.Arguments(), "Arguments should match")
 }
+
+func TestSize(t *testing.T) {
+	assert.Equal(t, len("SET")+len("key")+len("value"), New(command.MethodSet, "key", "value").Size())
+	assert.Equal(t, len("PING"), New(command.MethodPing).Size())
+}
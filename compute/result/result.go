@@ -2,6 +2,8 @@ package result
 
 type Result struct {
 	Value string
+	// Stream sends values following the reply until it is closed, as MONITOR does.
+	Stream <-chan string
 }
 
 func (r *Result) Bytes() []byte {
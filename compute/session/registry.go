@@ -0,0 +1,74 @@
+package session
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+// Registry tracks connected sessions, so they can be listed and killed.
+type Registry struct {
+	mu       sync.Mutex
+	sessions map[uint64]entry
+}
+
+type entry struct {
+	session *Session
+	cancel  context.CancelFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{sessions: make(map[uint64]entry)}
+}
+
+// Add tracks the session, cancel stops serving it.
+func (r *Registry) Add(s *Session, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s.ID] = entry{session: s, cancel: cancel}
+}
+
+// Remove stops tracking the closed session.
+func (r *Registry) Remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+}
+
+// Kill cancels the context of the session. It reports whether the session exists.
+func (r *Registry) Kill(id uint64) bool {
+	r.mu.Lock()
+	e, ok := r.sessions[id]
+	r.mu.Unlock()
+	if ok {
+		e.cancel()
+	}
+	return ok
+}
+
+// Len returns the number of sessions.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+// List returns the sessions ordered by id.
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, e := range r.sessions {
+		sessions = append(sessions, e.session)
+	}
+	r.mu.Unlock()
+
+	infos := make([]Info, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.Info())
+	}
+	slices.SortFunc(infos, func(a, b Info) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return infos
+}
@@ -0,0 +1,29 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	first, second := New("first"), New("second")
+	killed := false
+	r.Add(second, func() {})
+	r.Add(first, func() { killed = true })
+
+	second.SetName("worker")
+	second.Touch("GET")
+	list := r.List()
+	assert.Len(t, list, 2)
+	assert.Equal(t, first.ID, list[0].ID, "sessions are ordered by id")
+	assert.Equal(t, "worker", list[1].Name)
+	assert.Equal(t, "GET", list[1].LastCommand)
+
+	assert.True(t, r.Kill(first.ID))
+	assert.True(t, killed)
+	r.Remove(first.ID)
+	assert.False(t, r.Kill(first.ID))
+	assert.Len(t, r.List(), 1)
+}
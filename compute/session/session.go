@@ -0,0 +1,139 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var lastID atomic.Uint64
+
+// Session holds the state of a single client connection.
+type Session struct {
+	ID         uint64
+	RemoteAddr string
+	Connected  time.Time
+
+	// the session is read by CLIENT LIST of other sessions
+	mu          sync.Mutex
+	asking      bool
+	db          int
+	user        string
+	name        string
+	lastCommand string
+	lastActive  time.Time
+}
+
+func New(remoteAddr string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:         lastID.Add(1),
+		RemoteAddr: remoteAddr,
+		Connected:  now,
+		lastActive: now,
+	}
+}
+
+// SetAsking allows the next command to access a slot imported by this node.
+func (s *Session) SetAsking() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.asking = true
+}
+
+// TakeAsking returns the ASKING flag and resets it,
+// because it is valid for a single command only.
+func (s *Session) TakeAsking() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	asking := s.asking
+	s.asking = false
+	return asking
+}
+
+// DB returns the selected database.
+func (s *Session) DB() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
+}
+
+// Select selects the database for the next commands.
+func (s *Session) Select(db int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+// User returns the name of the authenticated user, empty before authentication.
+func (s *Session) User() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+// SetUser marks the session as authenticated by the user.
+func (s *Session) SetUser(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = name
+}
+
+// SetName sets the name of the client shown by CLIENT LIST.
+func (s *Session) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// Touch records the command the session runs.
+func (s *Session) Touch(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCommand = command
+	s.lastActive = time.Now()
+}
+
+// Info describes the session at a moment.
+type Info struct {
+	ID          uint64
+	RemoteAddr  string
+	Name        string
+	User        string
+	DB          int
+	Connected   time.Time
+	LastCommand string
+	LastActive  time.Time
+}
+
+// Info returns the current state of the session.
+func (s *Session) Info() Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Info{
+		ID:          s.ID,
+		RemoteAddr:  s.RemoteAddr,
+		Name:        s.name,
+		User:        s.user,
+		DB:          s.db,
+		Connected:   s.Connected,
+		LastCommand: s.lastCommand,
+		LastActive:  s.lastActive,
+	}
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns the session of the request.
+// Requests without a session get a new detached one.
+func FromContext(ctx context.Context) *Session {
+	if s, ok := ctx.Value(ctxKey{}).(*Session); ok {
+		return s
+	}
+	return &Session{}
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/cristalhq/aconfig"
 )
@@ -12,11 +15,165 @@ import (
 const project = "bcdb"
 
 type Config struct {
-	Debug bool
+	Debug      bool
+	Log        Log
+	Network    Network
+	Storage    Storage
+	Cluster    Cluster
+	Membership Membership
+	ACL        ACL
+	Limits     Limits
+	Slowlog    Slowlog
+	Metrics    Metrics
+	Health     Health
+	Tracing    Tracing
+	Audit      Audit
+	DebugHTTP  DebugHTTP `toml:"debug_http"`
+
+	// sources of values by keys and the loaded file, set by Load
+	sources map[string]string
+	file    string
 }
 
-func Load() (*Config, error) {
-	var c Config
+// File returns the path of the loaded file, it is empty without a file.
+func (c *Config) File() string {
+	return c.file
+}
+
+// Log configures the logger. Format is text or json. Level is the default
+// level like "info" and Levels are levels of scopes like "storage=debug".
+// Output is stdout, stderr or a file path. The file is rotated when it
+// exceeds MaxSize bytes or MaxAge, keeping MaxFiles rotated files.
+type Log struct {
+	Format   string `default:"text"`
+	Level    string `default:"info"`
+	Levels   []string
+	Output   string `default:"stdout"`
+	MaxSize  int64
+	MaxAge   time.Duration
+	MaxFiles int `default:"5"`
+}
+
+// Network configures the TCP listener and the Unix socket listener.
+// Empty address or socket path disables the listener. SocketPerm is
+// the octal permissions of the socket file, 0600 by default. Pipeline
+// is the number of commands of a connection read ahead of execution.
+// MaxLineSize limits the length of a command in bytes.
+type Network struct {
+	Address     string
+	TLS         TLS
+	Socket      string
+	SocketPerm  string `default:"0600"`
+	Pipeline    int    `default:"128"`
+	MaxLineSize int    `default:"1048576"`
+}
+
+// TLS enables TLS of a listener when the certificate is set.
+// ClientCAFile enables verification of client certificates (mTLS),
+// ClientAuth is "require" (default) or "optional". CAFile verifies
+// nodes the server connects to, system roots are used when it is empty.
+// Files are checked for changes and reloaded every ReloadInterval.
+type TLS struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientAuth     string
+	CAFile         string
+	ReloadInterval time.Duration
+}
+
+// Enabled reports whether the listener uses TLS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Storage selects the storage engine by its name.
+// Only the section of the selected engine is used.
+type Storage struct {
+	Engine string `default:"memory"`
+	// Databases is the number of databases selected with SELECT.
+	Databases int `default:"16"`
+	// ReadOnly rejects writes.
+	ReadOnly bool
+	// MaxKeySize and MaxValueSize limit sizes of keys and values in bytes, 0 disables the limit.
+	MaxKeySize   int
+	MaxValueSize int
+
+	LSM     LSM
+	Bitcask Bitcask
+	Tiered  Tiered
+}
+
+// LSM configures the LSM-tree engine. Zero values use the defaults of the engine.
+type LSM struct {
+	Dir                 string `default:"data/lsm"`
+	MemtableSize        int
+	BlockSize           int
+	TableSize           int
+	L0CompactionTrigger int `toml:"l0_compaction_trigger" env:"L0_COMPACTION_TRIGGER" flag:"l0_compaction_trigger"`
+	LevelSizeBase       int64
+	LevelSizeMultiplier int
+	BloomBitsPerKey     int
+	SyncWrites          bool
+}
+
+// Bitcask configures the Bitcask engine. Zero values use the defaults of the engine.
+type Bitcask struct {
+	Dir           string `default:"data/bitcask"`
+	MaxFileSize   int64
+	MergeInterval time.Duration
+	MergeRatio    float64
+	SyncWrites    bool
+}
+
+// Tiered configures the memory cache in front of the durable backend engine.
+// Mode is write-through or write-back. CacheSize is the maximum number of
+// keys in the cache, zero uses the default of the engine.
+type Tiered struct {
+	Backend   string `default:"lsm"`
+	Mode      string `default:"write-through"`
+	QueueSize int
+	CacheSize int
+}
+
+// Cluster describes the static topology of the cluster.
+// Every node lists all the nodes, NodeID selects the current one.
+// MigrateUser and MigratePassword authenticate MIGRATE on nodes with
+// ACL users, the password is in plain text.
+type Cluster struct {
+	Enabled         bool
+	NodeID          string
+	Nodes           []ClusterNode `env:"-" flag:"-"`
+	MigrateUser     string
+	MigratePassword string `secret:"true"`
+}
+
+type ClusterNode struct {
+	ID    string
+	Addr  string
+	Slots []string
+}
+
+// Membership configures gossip based discovery and failure detection of nodes.
+// Zero durations use the defaults of the membership package.
+type Membership struct {
+	Enabled          bool
+	NodeID           string
+	Address          string
+	AdvertiseAddress string
+	Seeds            []string
+	ProbeInterval    time.Duration
+	ProbeTimeout     time.Duration
+	SuspicionTimeout time.Duration
+}
+
+// Load loads the config from the first found file, BCDB_* environment
+// variables and command-line flags, each overriding the previous ones.
+// --config or BCDB_CONFIG selects the file. Every field has a flag and a
+// variable named by its key, like --storage.engine and BCDB_STORAGE_ENGINE,
+// --listen and --engine are shortcuts of the TCP address and the engine.
+// Boolean flags require values like --debug=true.
+func Load(args []string) (*Config, error) {
 	// get config directory
 	cfgPath, err := os.UserConfigDir()
 	if err != nil {
@@ -46,15 +203,180 @@ func Load() (*Config, error) {
 	// remove duplicates
 	files = slices.Compact(files)
 
+	return load(files, args, os.Environ())
+}
+
+const (
+	envPrefix = "BCDB"
+	// envFile selects the config file like the flag --config.
+	envFile = envPrefix + "_CONFIG"
+
+	flagFile   = "config"
+	flagListen = "listen"
+	flagEngine = "engine"
+)
+
+func load(files, args, env []string) (*Config, error) {
+	if args == nil {
+		args = []string{}
+	}
+	// the file variable is not a field, aconfig rejects unknown variables
+	vars := make([]string, 0, len(env))
+	explicit := false
+	for _, kv := range env {
+		if path, ok := strings.CutPrefix(kv, envFile+"="); ok {
+			files, explicit = []string{path}, true
+			continue
+		}
+		vars = append(vars, kv)
+	}
+
+	var c Config
 	loader := aconfig.LoaderFor(&c, aconfig.Config{
-		SkipFlags: true,
+		EnvPrefix: envPrefix,
+		Envs:      vars,
+		Args:      args,
+		FileFlag:  flagFile,
 		Files:     files,
+		FileDecoders: map[string]aconfig.FileDecoder{
+			".toml": tomlDecoder{target: reflect.TypeOf(c)},
+		},
 	})
+	flags := loader.Flags()
+	listen := flags.String(flagListen, "", "address of the TCP listener, same as --network.address")
+	engine := flags.String(flagEngine, "", "storage engine, same as --storage.engine")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if path, ok := flagValue(flags, flagFile); ok {
+		files, explicit = []string{path}, true
+	}
+
+	// aconfig loads the first existing file and skips missing ones,
+	// a file set by the flag or the variable must exist
+	file := ""
+	for _, f := range files {
+		_, err := os.Stat(f)
+		if err == nil {
+			file = f
+			break
+		}
+		if explicit {
+			return nil, err
+		}
+	}
 
 	cfgErr := loader.Load()
 	if cfgErr != nil {
 		return nil, cfgErr
 	}
+	if _, ok := flagValue(flags, flagListen); ok {
+		c.Network.Address = *listen
+	}
+	if _, ok := flagValue(flags, flagEngine); ok {
+		c.Storage.Engine = *engine
+	}
 
+	sources, err := loadSources(loader, file, vars)
+	if err != nil {
+		return nil, err
+	}
+	c.sources, c.file = sources, file
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
 	return &c, nil
 }
+
+// ACL configures users. Without users authentication is disabled
+// and every session can run all commands.
+type ACL struct {
+	Users []ACLUser `env:"-" flag:"-"`
+}
+
+// ACLUser can run Commands, "*" allows all commands, and read and write
+// keys matching glob patterns of ReadKeys and WriteKeys. Password is an argon2id
+// hash printed by "bcdb acl hash-password". Rates limit commands of the user, MaxKeys
+// and MaxMemory limit keys written by the user, zero disables a limit. Usage of
+// quotas is not persisted, so they are allowed with the memory engine only.
+type ACLUser struct {
+	Name              string
+	Password          string
+	Commands          []string
+	ReadKeys          []string
+	WriteKeys         []string
+	CommandsPerSecond float64
+	BytesPerSecond    float64
+	MaxKeys           int
+	MaxMemory         int64
+}
+
+// Limits limits the rate of commands of all sessions together.
+// Mode is reject or delay, zero rates disable the limits.
+type Limits struct {
+	Mode              string `default:"reject"`
+	CommandsPerSecond float64
+	BytesPerSecond    float64
+}
+
+// Slowlog records commands executed longer than Threshold, keeping the latest
+// MaxLen of them. Zero threshold records every command, negative disables the log.
+type Slowlog struct {
+	Threshold time.Duration `default:"10ms"`
+	MaxLen    int           `default:"128"`
+}
+
+// Metrics serves metrics in the Prometheus text format at /metrics
+// of the HTTP listener. Empty address disables the listener.
+type Metrics struct {
+	Address string
+	TLS     TLS
+}
+
+// Health serves /healthz and /readyz on the HTTP listener, which is shared
+// with metrics on the same address. Empty address disables the listener.
+// TLS applies to a separate listener, a shared one uses the metrics TLS.
+// On shutdown the node reports not ready for DrainDelay before listeners close.
+// The node is not ready while replication lags more than MaxReplicationLag,
+// zero disables the check. Replicas are not supported yet, so every node is
+// a primary without lag.
+type Health struct {
+	Address           string
+	DrainDelay        time.Duration `default:"5s"`
+	MaxReplicationLag time.Duration
+	TLS               TLS
+}
+
+// Tracing writes spans of sampled requests to File as JSON lines.
+// Empty file disables tracing. SampleRatio is the share of traced
+// requests from 0 to 1. QueueSize bounds spans waiting for export,
+// spans are dropped when it is full.
+type Tracing struct {
+	File        string
+	SampleRatio float64 `default:"1"`
+	QueueSize   int
+}
+
+// Audit appends write and admin commands to File as JSON lines chained by
+// hashes. Empty file disables the log. QueueSize bounds entries waiting
+// for the write, Overflow is block or drop when the queue is full. Values
+// of SET are written only when RedactValues is false, passwords never.
+type Audit struct {
+	File         string
+	QueueSize    int    `default:"1024"`
+	Overflow     string `default:"block"`
+	RedactValues bool   `default:"true"`
+}
+
+// DebugHTTP serves pprof profiles, goroutine stacks, GC stats and lock wait
+// times on the HTTP listener. It exposes internals of the process, keep it
+// disabled or bound to a loopback address. MutexProfileFraction and
+// BlockProfileRate enable the mutex and block profiles, see runtime.
+type DebugHTTP struct {
+	Enabled              bool
+	Address              string `default:"127.0.0.1:6060"`
+	MutexProfileFraction int
+	BlockProfileRate     int
+	TLS                  TLS
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	c, err := load([]string{filepath.Join(t.TempDir(), "missing.toml")}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "memory", c.Storage.Engine)
+	assert.Equal(t, Log{Format: "text", Level: "info", Output: "stdout", MaxFiles: 5}, c.Log)
+	assert.Equal(t, "data/lsm", c.Storage.LSM.Dir)
+	assert.Equal(t, "lsm", c.Storage.Tiered.Backend)
+	assert.Equal(t, "write-through", c.Storage.Tiered.Mode)
+	assert.Equal(t, "reject", c.Limits.Mode)
+	assert.Equal(t, Slowlog{Threshold: 10 * time.Millisecond, MaxLen: 128}, c.Slowlog)
+	assert.False(t, c.DebugHTTP.Enabled)
+	assert.Equal(t, Health{DrainDelay: 5 * time.Second}, c.Health)
+	assert.Equal(t, Tracing{SampleRatio: 1}, c.Tracing)
+	assert.Equal(t, Audit{QueueSize: 1024, Overflow: "block", RedactValues: true}, c.Audit)
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+debug = true
+
+[log]
+format = "json"
+levels = ["storage=debug"]
+output = "/var/log/bcdb.log"
+max_size = 1048576
+max_age = "24h"
+
+[network]
+address = "127.0.0.1:7000"
+
+[network.tls]
+cert_file = "server.crt"
+key_file = "server.key"
+client_ca_file = "ca.crt"
+reload_interval = "1m"
+
+[storage]
+engine = "tiered"
+
+[storage.lsm]
+dir = "/var/lib/bcdb"
+l0_compaction_trigger = 8
+sync_writes = true
+
+[storage.bitcask]
+merge_interval = "30s"
+merge_ratio = 0.25
+
+[storage.tiered]
+backend = "bitcask"
+mode = "write-back"
+queue_size = 64
+
+[cluster]
+enabled = true
+node_id = "a"
+
+[[cluster.nodes]]
+id = "a"
+addr = "127.0.0.1:7000"
+slots = ["0-16383"]
+
+[membership]
+seeds = ["127.0.0.1:7946"]
+probe_interval = "1s"
+
+[[acl.users]]
+name = "app"
+password = "$argon2id$v=19$m=19456,t=2,p=1$AA$EQ"
+commands = ["GET", "SET"]
+read_keys = ["app:*"]
+write_keys = ["app:*"]
+commands_per_second = 100
+bytes_per_second = 1024.5
+
+[limits]
+mode = "delay"
+commands_per_second = 10000
+
+[metrics]
+address = "127.0.0.1:9100"
+
+[health]
+address = "127.0.0.1:9100"
+drain_delay = "10s"
+
+[tracing]
+file = "spans.jsonl"
+sample_ratio = 0.1
+
+[audit]
+file = "audit.jsonl"
+overflow = "drop"
+redact_values = false
+
+[debug_http]
+enabled = true
+mutex_profile_fraction = 5
+`)
+
+	c, err := load([]string{path}, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, c.Debug)
+	assert.Equal(t, Log{
+		Format:   "json",
+		Level:    "info",
+		Levels:   []string{"storage=debug"},
+		Output:   "/var/log/bcdb.log",
+		MaxSize:  1 << 20,
+		MaxAge:   24 * time.Hour,
+		MaxFiles: 5,
+	}, c.Log)
+	assert.Equal(t, "127.0.0.1:7000", c.Network.Address)
+	assert.Equal(t, TLS{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "ca.crt", ReloadInterval: time.Minute}, c.Network.TLS)
+	assert.Equal(t, Storage{
+		Engine:    "tiered",
+		Databases: 16,
+		LSM:       LSM{Dir: "/var/lib/bcdb", L0CompactionTrigger: 8, SyncWrites: true},
+		Bitcask: Bitcask{
+			Dir:           "data/bitcask",
+			MergeInterval: 30 * time.Second,
+			MergeRatio:    0.25,
+		},
+		Tiered: Tiered{Backend: "bitcask", Mode: "write-back", QueueSize: 64},
+	}, c.Storage)
+	assert.Equal(t, Cluster{
+		Enabled: true,
+		NodeID:  "a",
+		Nodes:   []ClusterNode{{ID: "a", Addr: "127.0.0.1:7000", Slots: []string{"0-16383"}}},
+	}, c.Cluster)
+	assert.Equal(t, []string{"127.0.0.1:7946"}, c.Membership.Seeds)
+	assert.Equal(t, time.Second, c.Membership.ProbeInterval)
+	assert.Equal(t, []ACLUser{{
+		Name:      "app",
+		Password:  "$argon2id$v=19$m=19456,t=2,p=1$AA$EQ",
+		Commands:  []string{"GET", "SET"},
+		ReadKeys:  []string{"app:*"},
+		WriteKeys: []string{"app:*"},
+
+		CommandsPerSecond: 100,
+		BytesPerSecond:    1024.5,
+	}}, c.ACL.Users)
+	assert.Equal(t, Limits{Mode: "delay", CommandsPerSecond: 10000}, c.Limits)
+	assert.Equal(t, Metrics{Address: "127.0.0.1:9100"}, c.Metrics)
+	assert.Equal(t, Health{Address: "127.0.0.1:9100", DrainDelay: 10 * time.Second}, c.Health)
+	assert.Equal(t, Tracing{File: "spans.jsonl", SampleRatio: 0.1}, c.Tracing)
+	assert.Equal(t, Audit{File: "audit.jsonl", QueueSize: 1024, Overflow: "drop"}, c.Audit)
+	assert.Equal(t, DebugHTTP{Enabled: true, Address: "127.0.0.1:6060", MutexProfileFraction: 5}, c.DebugHTTP)
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := writeConfig(t, "[storage]\nengines = \"lsm\"\n")
+	_, err := load([]string{path}, nil, nil)
+	require.ErrorContains(t, err, "storage.engines")
+}
+
+func TestLoad_TableArrayErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "unknown field", src: "[[acl.users]]\nname = \"a\"\nmax_key = 1\n", wantErr: `no such field "Max_key"`},
+		{name: "fraction for integer", src: "[[acl.users]]\nmax_keys = 1.5\n", wantErr: "users[0]: max_keys: expected integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load([]string{writeConfig(t, tt.src)}, nil, nil)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `
+[log]
+level = "warn"
+
+[network]
+address = "127.0.0.1:7000"
+
+[storage]
+engine = "lsm"
+`)
+	env := []string{
+		"HOME=/root",
+		"BCDB_STORAGE_ENGINE=bitcask",
+		"BCDB_LOG_LEVEL=debug",
+		"BCDB_LIMITS_COMMANDS_PER_SECOND=5",
+		"BCDB_STORAGE_LSM_L0_COMPACTION_TRIGGER=6",
+	}
+	args := []string{"--engine", "tiered", "--log.level=error", "--slowlog.max_len=8"}
+
+	c, err := load([]string{path}, args, env)
+	require.NoError(t, err)
+	assert.Equal(t, "tiered", c.Storage.Engine)
+	assert.Equal(t, "error", c.Log.Level)
+	assert.Equal(t, "127.0.0.1:7000", c.Network.Address)
+	assert.Equal(t, 5.0, c.Limits.CommandsPerSecond)
+	assert.Equal(t, 6, c.Storage.LSM.L0CompactionTrigger)
+	assert.Equal(t, 8, c.Slowlog.MaxLen)
+
+	assert.Equal(t, "flag --engine", c.Source("storage.engine"))
+	assert.Equal(t, "flag --log.level", c.Source("log.level"))
+	assert.Equal(t, "file "+path, c.Source("network.address"))
+	assert.Equal(t, "env BCDB_LIMITS_COMMANDS_PER_SECOND", c.Source("limits.commands_per_second"))
+	assert.Equal(t, "env BCDB_STORAGE_LSM_L0_COMPACTION_TRIGGER", c.Source("storage.lsm.l0_compaction_trigger"))
+	assert.Equal(t, "flag --slowlog.max_len", c.Source("slowlog.max_len"))
+	assert.Equal(t, SourceDefault, c.Source("slowlog.threshold"))
+}
+
+func TestLoad_File(t *testing.T) {
+	first := writeConfig(t, "[storage]\nengine = \"lsm\"\n")
+	selected := writeConfig(t, "[storage]\nengine = \"bitcask\"\n")
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+
+	t.Run("first found", func(t *testing.T) {
+		c, err := load([]string{missing, first, selected}, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "lsm", c.Storage.Engine)
+	})
+	t.Run("flag", func(t *testing.T) {
+		c, err := load([]string{first}, []string{"--config", selected}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bitcask", c.Storage.Engine)
+		assert.Equal(t, "file "+selected, c.Source("storage.engine"))
+	})
+	t.Run("env", func(t *testing.T) {
+		c, err := load([]string{first}, nil, []string{"BCDB_CONFIG=" + selected})
+		require.NoError(t, err)
+		assert.Equal(t, "bitcask", c.Storage.Engine)
+	})
+	t.Run("selected file is missing", func(t *testing.T) {
+		_, err := load([]string{first}, []string{"--config=" + missing}, nil)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     []string
+		wantErr string
+	}{
+		{name: "unknown flag", args: []string{"--storage.engines=lsm"}, wantErr: "flag provided but not defined: -storage.engines"},
+		{name: "unknown env", env: []string{"BCDB_STORAGE_ENGINES=lsm"}, wantErr: "unknown environment var BCDB_STORAGE_ENGINES"},
+		{name: "invalid value", args: []string{"--storage.databases=many"}, wantErr: "invalid syntax"},
+		{name: "invalid field", args: []string{"--listen=localhost"}, wantErr: `network.address: invalid address "localhost"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(nil, tt.args, tt.env)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// Diff returns keys of values which differ between the configs, like
+// "limits.mode". Arrays of tables like "acl.users" are compared as a whole.
+func Diff(a, b *Config) []string {
+	var keys []string
+	diff(nil, reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), &keys)
+	return keys
+}
+
+func diff(path []string, a, b reflect.Value, keys *[]string) {
+	t := a.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := append(path[:len(path):len(path)], tomlKey(f))
+		if isTable(f.Type) {
+			diff(name, a.Field(i), b.Field(i), keys)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			*keys = append(*keys, strings.Join(name, "."))
+		}
+	}
+}
+
+// Copy sets values of the keys returned by Diff and their sources from the other config.
+func (c *Config) Copy(from *Config, keys ...string) {
+	sources := maps.Clone(c.sources)
+	if sources == nil {
+		sources = make(map[string]string, len(keys))
+	}
+	for _, key := range keys {
+		lookup(reflect.ValueOf(c).Elem(), key).Set(lookup(reflect.ValueOf(from).Elem(), key))
+		if s, ok := from.sources[key]; ok {
+			sources[key] = s
+		} else {
+			delete(sources, key)
+		}
+	}
+	c.sources = sources
+}
+
+// lookup returns the field of the dotted key in the struct.
+func lookup(v reflect.Value, key string) reflect.Value {
+next:
+	for _, name := range strings.Split(key, ".") {
+		t := v.Type()
+		for i := range t.NumField() {
+			if f := t.Field(i); f.IsExported() && tomlKey(f) == name {
+				v = v.Field(i)
+				continue next
+			}
+		}
+		panic(fmt.Sprintf("config: unknown key %q", key))
+	}
+	return v
+}
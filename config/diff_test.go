@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := load(nil, nil, nil)
+	require.NoError(t, err)
+	b := *a
+	assert.Empty(t, Diff(a, &b))
+
+	b.Debug = true
+	b.Slowlog.Threshold = time.Second
+	b.Network.TLS.CertFile = "server.crt"
+	b.Log.Levels = []string{"storage=debug"}
+	b.ACL.Users = []ACLUser{{Name: "app"}}
+	assert.Equal(t, []string{
+		"debug",
+		"log.levels",
+		"network.tls.cert_file",
+		"acl.users",
+		"slowlog.threshold",
+	}, Diff(a, &b))
+}
+
+func TestConfig_Copy(t *testing.T) {
+	a, err := load(nil, nil, nil)
+	require.NoError(t, err)
+	b, err := load(nil, []string{"--listen=127.0.0.1:7100", "--debug=true"}, nil)
+	require.NoError(t, err)
+	b.ACL.Users = []ACLUser{{Name: "app"}}
+	b.SetRuntime("acl.users")
+
+	a.Copy(b, "network.address", "acl.users")
+	assert.Equal(t, []string{"debug"}, Diff(a, b))
+	assert.Equal(t, "flag --listen", a.Source("network.address"))
+	assert.Equal(t, SourceRuntime, a.Source("acl.users"))
+
+	// sources of b are not shared
+	a.SetRuntime("network.address")
+	assert.Equal(t, "flag --listen", b.Source("network.address"))
+
+	a.Copy(&Config{}, "acl.users")
+	assert.Empty(t, a.ACL.Users)
+	assert.Equal(t, SourceDefault, a.Source("acl.users"))
+	assert.Panics(t, func() { a.Copy(b, "network.unknown") })
+}
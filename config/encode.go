@@ -0,0 +1,284 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Print writes the config as TOML with the source of every value in comments.
+// Secrets are redacted.
+func Print(w io.Writer, c *Config) error {
+	e := encoder{source: c.Source, redact: true}
+	e.table(nil, reflect.ValueOf(c).Elem())
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// LogValue logs the config as groups of its tables. Secrets are redacted.
+func (c *Config) LogValue() slog.Value {
+	return logValue(reflect.ValueOf(c).Elem())
+}
+
+// logValue returns the struct as a group, tables in arrays are groups keyed by index.
+func logValue(v reflect.Value) slog.Value {
+	t := v.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, field := tomlKey(f), v.Field(i)
+		switch {
+		case isTable(f.Type):
+			attrs = append(attrs, slog.Attr{Key: key, Value: logValue(field)})
+		case isTableArray(f.Type):
+			items := make([]slog.Attr, field.Len())
+			for j := range items {
+				items[j] = slog.Attr{Key: strconv.Itoa(j), Value: logValue(field.Index(j))}
+			}
+			attrs = append(attrs, slog.Attr{Key: key, Value: slog.GroupValue(items...)})
+		case f.Tag.Get("secret") == "true" && !field.IsZero():
+			attrs = append(attrs, slog.String(key, redacted))
+		default:
+			attrs = append(attrs, slog.Any(key, field.Interface()))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// WriteFile writes values of the config read from the file or changed at
+// runtime to the file as TOML. Flags, variables and defaults are not
+// written, so they keep applying. The file is replaced atomically, so its
+// comments and formatting are lost.
+func WriteFile(path string, c *Config) (err error) {
+	e := encoder{keep: c.persisted}
+	e.table(nil, reflect.ValueOf(c).Elem())
+
+	perm := fs.FileMode(0o644)
+	if info, sErr := os.Stat(path); sErr == nil {
+		perm = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(e.buf.Bytes()); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// encoder writes structs as TOML tables, the output is decoded by tomlDecoder.
+type encoder struct {
+	buf bytes.Buffer
+	// source returns the comment of the key, nil disables comments
+	source func(key string) string
+	// redact hides values of fields tagged secret
+	redact bool
+	// keep selects keys to write, nil writes all keys and tables
+	keep func(key string) bool
+}
+
+// keeps reports whether the key of a value in the table at path is written.
+// Values of arrays of tables are written with the array.
+func (e *encoder) keeps(path []string, key string) bool {
+	return e.keep == nil || inArray(path) || e.keep(strings.Join(append(path, key), "."))
+}
+
+// table writes values of the struct and then its nested tables.
+func (e *encoder) table(path []string, v reflect.Value) {
+	t := v.Type()
+	var tables []int
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if isTable(f.Type) || isTableArray(f.Type) {
+			tables = append(tables, i)
+			continue
+		}
+		// aconfig decodes empty arrays as arrays of an empty string
+		if f.Type.Kind() == reflect.Slice && v.Field(i).Len() == 0 {
+			continue
+		}
+		key := tomlKey(f)
+		if !e.keeps(path, key) {
+			continue
+		}
+		value := formatValue(v.Field(i))
+		if e.redact && f.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+			value = quote(redacted)
+		}
+		fmt.Fprintf(&e.buf, "%s = %s", key, value)
+		// values of arrays of tables have the source of the array
+		if e.source != nil && !inArray(path) {
+			fmt.Fprintf(&e.buf, " # %s", e.source(strings.Join(append(path, key), ".")))
+		}
+		e.buf.WriteByte('\n')
+	}
+
+	for _, i := range tables {
+		f := t.Field(i)
+		name := append(path[:len(path):len(path)], tomlKey(f))
+		key := strings.Join(name, ".")
+		if isTable(f.Type) {
+			sub := encoder{source: e.source, redact: e.redact, keep: e.keep}
+			sub.table(name, v.Field(i))
+			// tables without written keys are omitted
+			if e.keep != nil && sub.buf.Len() == 0 {
+				continue
+			}
+			fmt.Fprintf(&e.buf, "\n[%s]\n", key)
+			e.buf.Write(sub.buf.Bytes())
+			continue
+		}
+		if !e.keeps(path, tomlKey(f)) {
+			continue
+		}
+		items := v.Field(i)
+		for j := range items.Len() {
+			fmt.Fprintf(&e.buf, "\n[[%s]]", key)
+			if e.source != nil {
+				fmt.Fprintf(&e.buf, " # %s", e.source(key))
+			}
+			e.buf.WriteByte('\n')
+			e.table(append(name[:len(name):len(name)], arrayItem), items.Index(j))
+		}
+	}
+}
+
+// redacted replaces secrets in the printed and logged config.
+const redacted = "<redacted>"
+
+// arrayItem marks paths of tables in arrays.
+const arrayItem = "[]"
+
+func inArray(path []string) bool {
+	return len(path) > 0 && path[len(path)-1] == arrayItem
+}
+
+func isTable(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct
+}
+
+func isTableArray(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return strconv.Quote(time.Duration(v.Int()).String())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return quote(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	panic(fmt.Sprintf("config: unsupported type %s", v.Type()))
+}
+
+// quote writes a TOML basic string.
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&sb, `\u%04x`, r)
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// tomlKey returns the key of the field like aconfig does: the toml tag
+// or words of the name in snake case.
+func tomlKey(f reflect.StructField) string {
+	if tag := f.Tag.Get("toml"); tag != "" {
+		return tag
+	}
+	var words []string
+	name := []rune(f.Name)
+	start := 0
+	for i := 1; i <= len(name); i++ {
+		if i == len(name) || boundary(name, i) {
+			words = append(words, strings.ToLower(string(name[start:i])))
+			start = i
+		}
+	}
+	return strings.Join(words, "_")
+}
+
+// boundary reports whether a new word starts at i, like Key|Size and
+// CA|File, so acronyms are kept together and digits are separate words.
+func boundary(name []rune, i int) bool {
+	prev, cur := name[i-1], name[i]
+	switch {
+	case unicode.IsDigit(prev) != unicode.IsDigit(cur):
+		return true
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return true
+	case unicode.IsUpper(prev) && unicode.IsUpper(cur):
+		// the last capital of an acronym starts the next word
+		return i+1 < len(name) && unicode.IsLower(name[i+1])
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrint(t *testing.T) {
+	path := writeConfig(t, `
+[log]
+levels = ["storage=debug", "network=warn"]
+
+[storage]
+engine = "lsm"
+
+[storage.lsm]
+l0_compaction_trigger = 8
+
+[network.tls]
+cert_file = "server \"a\".crt"
+key_file = "server.key"
+
+[cluster]
+enabled = true
+node_id = "a"
+
+[[cluster.nodes]]
+id = "a"
+addr = "127.0.0.1:7000"
+slots = ["0-8191"]
+
+[[cluster.nodes]]
+id = "b"
+addr = "127.0.0.1:7001"
+
+[[acl.users]]
+name = "app"
+commands = ["*"]
+bytes_per_second = 1.5
+`)
+	c, err := load([]string{path}, []string{"--listen=127.0.0.1:7100"}, []string{"BCDB_SLOWLOG_THRESHOLD=1s"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Print(&buf, c))
+	out := buf.String()
+	for _, want := range []string{
+		"debug = false # default\n",
+		"\n[storage]\nengine = \"lsm\" # file " + path + "\n",
+		"\n[storage.lsm]\ndir = \"data/lsm\" # default\n",
+		"l0_compaction_trigger = 8 # file " + path + "\n",
+		"\n[network]\naddress = \"127.0.0.1:7100\" # flag --listen\n",
+		"cert_file = \"server \\\"a\\\".crt\" # file " + path + "\n",
+		"threshold = \"1s\" # env BCDB_SLOWLOG_THRESHOLD\n",
+		"levels = [\"storage=debug\", \"network=warn\"] # file " + path + "\n",
+		"\n[[cluster.nodes]] # file " + path + "\nid = \"b\"\naddr = \"127.0.0.1:7001\"\n",
+		"\n[[acl.users]] # file " + path + "\nname = \"app\"\n",
+		"\n[debug_http]\n",
+	} {
+		assert.Contains(t, out, want)
+	}
+
+	// the printed config is loaded as is
+	printed := filepath.Join(t.TempDir(), "printed.toml")
+	require.NoError(t, os.WriteFile(printed, buf.Bytes(), 0o644))
+	loaded, err := load([]string{printed}, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, Diff(c, loaded))
+}
+
+func TestPrint_Redacted(t *testing.T) {
+	c, err := load(nil, nil, []string{"BCDB_CLUSTER_MIGRATE_PASSWORD=secret"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Print(&buf, c))
+	assert.Contains(t, buf.String(), "migrate_password = \"<redacted>\" # env BCDB_CLUSTER_MIGRATE_PASSWORD\n")
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestConfig_LogValue(t *testing.T) {
+	c, err := load(nil, nil, []string{"BCDB_CLUSTER_MIGRATE_PASSWORD=secret"})
+	require.NoError(t, err)
+	c.ACL.Users = []ACLUser{{Name: "app", Commands: []string{"GET"}}}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("loaded config", slog.Any("cfg", c))
+	out := buf.String()
+	assert.Contains(t, out, "cfg.cluster.migrate_password=<redacted>")
+	assert.Contains(t, out, "cfg.storage.engine=memory")
+	assert.Contains(t, out, "cfg.health.drain_delay=5s")
+	assert.Contains(t, out, "cfg.acl.users.0.name=app")
+	assert.NotContains(t, out, "secret")
+}
+
+func TestWriteFile(t *testing.T) {
+	path := writeConfig(t, "# comment\n[storage]\nengine = \"lsm\"\n")
+	require.NoError(t, os.Chmod(path, 0o600))
+	c, err := load([]string{path}, []string{"--listen=127.0.0.1:7100"}, []string{"BCDB_SLOWLOG_THRESHOLD=1s"})
+	require.NoError(t, err)
+
+	c.Log.Level = "debug"
+	c.ACL.Users = []ACLUser{{Name: "app", Commands: []string{"GET"}}}
+	c.SetRuntime("log.level", "acl.users")
+	require.NoError(t, WriteFile(path, c))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `
+[log]
+level = "debug"
+
+[storage]
+engine = "lsm"
+
+[acl]
+
+[[acl.users]]
+name = "app"
+password = ""
+commands = ["GET"]
+commands_per_second = 0
+bytes_per_second = 0
+max_keys = 0
+max_memory = 0
+`, string(data), "flags, variables and defaults are not written")
+
+	// flags and variables keep applying to the rewritten file
+	rewritten, err := load([]string{path}, []string{"--listen=127.0.0.1:7100"}, []string{"BCDB_SLOWLOG_THRESHOLD=1s"})
+	require.NoError(t, err)
+	assert.Empty(t, Diff(c, rewritten))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are removed")
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"flag"
+	"maps"
+	"strings"
+
+	"github.com/cristalhq/aconfig"
+)
+
+// SourceDefault is the source of values which are not set.
+const SourceDefault = "default"
+
+// SourceRuntime is the source of values changed by CONFIG SET.
+const SourceRuntime = "runtime"
+
+// sourceFile prefixes the path of the file setting a value.
+const sourceFile = "file "
+
+// Source returns where the value of the key like "storage.engine" comes from:
+// "default", "file <path>", "env BCDB_<NAME>", "flag --<name>" or "runtime".
+// Keys of arrays of tables like "acl.users" have the source of the whole array.
+func (c *Config) Source(key string) string {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+// SetRuntime marks values of the keys as changed at runtime. Copies of
+// the config keep their sources.
+func (c *Config) SetRuntime(keys ...string) {
+	sources := maps.Clone(c.sources)
+	if sources == nil {
+		sources = make(map[string]string, len(keys))
+	}
+	for _, key := range keys {
+		sources[key] = SourceRuntime
+	}
+	c.sources = sources
+}
+
+// persisted reports whether the value of the key belongs in the file,
+// because it was read from the file or changed at runtime.
+func (c *Config) persisted(key string) bool {
+	s := c.Source(key)
+	return strings.HasPrefix(s, sourceFile) || s == SourceRuntime
+}
+
+// loadSources finds sources of fields set by the file, variables and flags of the loader.
+func loadSources(loader *aconfig.Loader, file string, env []string) (map[string]string, error) {
+	var values map[string]interface{}
+	if file != "" {
+		var err error
+		if values, err = (tomlDecoder{}).DecodeFile(file); err != nil {
+			return nil, err
+		}
+	}
+	vars := make(map[string]bool, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		vars[name] = true
+	}
+	flags := make(map[string]bool)
+	loader.Flags().Visit(func(f *flag.Flag) {
+		flags[f.Name] = true
+	})
+
+	sources := make(map[string]string)
+	loader.WalkFields(func(f aconfig.Field) bool {
+		key := fullName(f, "toml", ".")
+		if hasKey(values, key) {
+			sources[key] = sourceFile + file
+		}
+		if env := fullName(f, "env", "_"); env != "" && vars[envPrefix+"_"+env] {
+			sources[key] = "env " + envPrefix + "_" + env
+		}
+		if name := fullName(f, "flag", "."); name != "" && flags[name] {
+			sources[key] = "flag --" + name
+		}
+		return true
+	})
+	if flags[flagListen] {
+		sources["network.address"] = "flag --" + flagListen
+	}
+	if flags[flagEngine] {
+		sources["storage.engine"] = "flag --" + flagEngine
+	}
+	return sources, nil
+}
+
+// fullName joins the tag of the field with tags of its parents,
+// it is empty when the field is excluded by "-".
+func fullName(f aconfig.Field, tag, sep string) string {
+	name := f.Tag(tag)
+	if name == "-" {
+		return ""
+	}
+	for p, ok := f.Parent(); ok; p, ok = p.Parent() {
+		name = p.Tag(tag) + sep + name
+	}
+	return name
+}
+
+// hasKey reports whether the dotted key is set in decoded tables.
+func hasKey(table map[string]interface{}, key string) bool {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := table[part].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		table = next
+	}
+	_, ok := table[parts[len(parts)-1]]
+	return ok
+}
+
+// flagValue returns the value of the flag when it is set.
+func flagValue(flags *flag.FlagSet, name string) (string, bool) {
+	var value string
+	var ok bool
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			value, ok = f.Value.String(), true
+		}
+	})
+	return value, ok
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlDecoder decodes TOML config files for aconfig with BurntSushi/toml,
+// the parser wrapped by aconfigtoml. aconfigtoml itself is not used: its
+// release for this aconfig flattens arrays of tables into strings.
+type tomlDecoder struct {
+	// target is the type of the config, tables in arrays are converted to its fields.
+	target reflect.Type
+}
+
+func (tomlDecoder) Format() string {
+	return "toml"
+}
+
+func (d tomlDecoder) DecodeFile(filename string) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if _, err := toml.DecodeFile(filename, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if d.target != nil {
+		if nErr := normalizeTables(m, d.target); nErr != nil {
+			return nil, fmt.Errorf("%s: %w", filename, nErr)
+		}
+	}
+	return m, nil
+}
+
+// normalizeTables prepares arrays of tables for aconfig. It sets struct
+// fields of slice items by Go field names and requires values of the exact
+// field types, so node_id must become NodeID and integers of float fields
+// must become floats.
+func normalizeTables(table map[string]interface{}, t reflect.Type) error {
+	for key, value := range table {
+		field, ok := findField(t, key)
+		if !ok {
+			// aconfig reports unknown fields
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if field.Type.Kind() == reflect.Struct {
+				if err := normalizeTables(v, field.Type); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			if isTableArray(field.Type) {
+				if err := convertTables(key, v, field.Type.Elem()); err != nil {
+					return err
+				}
+			}
+		case []map[string]interface{}:
+			// arrays of tables, aconfig expects them as []interface{}
+			if !isTableArray(field.Type) {
+				continue
+			}
+			items := make([]interface{}, len(v))
+			for i, item := range v {
+				items[i] = item
+			}
+			if err := convertTables(key, items, field.Type.Elem()); err != nil {
+				return err
+			}
+			table[key] = items
+		}
+	}
+	return nil
+}
+
+// convertTables converts tables of the array to the struct in place.
+func convertTables(key string, items []interface{}, t reflect.Type) error {
+	for i, item := range items {
+		table, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		converted, err := convertTable(table, t)
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", key, i, err)
+		}
+		items[i] = converted
+	}
+	return nil
+}
+
+// convertTable renames keys of the table to field names of the struct
+// and converts values to field types.
+func convertTable(table map[string]interface{}, t reflect.Type) (map[string]interface{}, error) {
+	converted := make(map[string]interface{}, len(table))
+	for key, value := range table {
+		field, ok := findField(t, key)
+		if !ok {
+			// keep the key, so aconfig reports the unknown field
+			converted[key] = value
+			continue
+		}
+		v, err := convertValue(value, field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		converted[field.Name] = v
+	}
+	return converted, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func convertValue(value interface{}, t reflect.Type) (interface{}, error) {
+	if s, ok := value.(string); ok && t == durationType {
+		return time.ParseDuration(s)
+	}
+	v := reflect.ValueOf(value)
+	if v.Type() == t || !isNumber(v.Kind()) || !isNumber(t.Kind()) {
+		return value, nil
+	}
+	if f, ok := value.(float64); ok && t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64 && f != float64(int64(f)) {
+		return nil, fmt.Errorf("expected integer, got %v", f)
+	}
+	return v.Convert(t).Interface(), nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// findField finds the struct field by its toml tag or by the snake case name.
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	name := strings.ReplaceAll(strings.ToLower(key), "_", "")
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if tag := f.Tag.Get("toml"); tag != "" {
+			if tag == key {
+				return f, true
+			}
+			continue
+		}
+		if strings.ToLower(f.Name) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOMLDecoder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[storage]
+engine = "lsm" # comment
+
+[[cluster.nodes]]
+id = "a"
+slots = ["0-100"]
+
+[[cluster.nodes]]
+id = "b"
+`), 0o600))
+
+	m, err := tomlDecoder{target: reflect.TypeOf(Config{})}.DecodeFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"storage": map[string]interface{}{"engine": "lsm"},
+		"cluster": map[string]interface{}{
+			"nodes": []interface{}{
+				map[string]interface{}{"ID": "a", "Slots": []interface{}{"0-100"}},
+				map[string]interface{}{"ID": "b"},
+			},
+		},
+	}, m)
+}
+
+func TestTOMLDecoder_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "no value", src: "key =", wantErr: "expected value"},
+		{name: "duplicate key", src: "a = 1\na = 2", wantErr: `Key 'a' has already been defined`},
+		{name: "redefined table", src: "[a]\nb = 1\n[a]\nc = 2", wantErr: `Key 'a' has already been defined`},
+		{name: "leading zero", src: "a = 0777", wantErr: "cannot have leading zeroes"},
+		{name: "unterminated string", src: `a = "value`, wantErr: "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.src), 0o600))
+			_, err := tomlDecoder{}.DecodeFile(path)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNormalizeTables(t *testing.T) {
+	type item struct {
+		NodeID   string
+		Weight   float64
+		Count    int
+		Interval time.Duration
+	}
+	type target struct {
+		Group struct {
+			Items []item
+		}
+	}
+
+	m := map[string]interface{}{
+		"group": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"node_id": "a", "weight": int64(2), "count": int64(3), "interval": "1s"},
+				map[string]interface{}{"unknown": true},
+			},
+		},
+	}
+	require.NoError(t, normalizeTables(m, reflect.TypeOf(target{})))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"NodeID": "a", "Weight": 2.0, "Count": 3, "Interval": time.Second},
+		map[string]interface{}{"unknown": true},
+	}, m["group"].(map[string]interface{})["items"])
+}
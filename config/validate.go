@@ -0,0 +1,226 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Validate checks values of all fields and reports every invalid one.
+// Errors are prefixed by keys like "storage.tiered.mode". Names of engines
+// are checked by the storage registry on creation.
+func (c *Config) Validate() error {
+	var v validator
+
+	v.oneOf("log.format", c.Log.Format, "text", "json")
+	v.levels("log.level", c.Log.Level)
+	for i, spec := range c.Log.Levels {
+		v.levels(fmt.Sprintf("log.levels[%d]", i), spec)
+	}
+	v.required("log.output", c.Log.Output)
+	nonNegative(&v, "log.max_size", c.Log.MaxSize)
+	nonNegative(&v, "log.max_age", c.Log.MaxAge)
+	nonNegative(&v, "log.max_files", c.Log.MaxFiles)
+
+	v.address("network.address", c.Network.Address)
+	v.tls("network.tls", c.Network.TLS)
+	if perm, err := strconv.ParseUint(c.Network.SocketPerm, 8, 32); c.Network.SocketPerm != "" && (err != nil || perm > 0o777) {
+		v.add("network.socket_perm", "invalid permissions %q, expected octal like 0660", c.Network.SocketPerm)
+	}
+	nonNegative(&v, "network.pipeline", c.Network.Pipeline)
+	nonNegative(&v, "network.max_line_size", c.Network.MaxLineSize)
+
+	v.required("storage.engine", c.Storage.Engine)
+	if c.Storage.Databases < 1 {
+		v.add("storage.databases", "must be at least 1, got %d", c.Storage.Databases)
+	}
+	nonNegative(&v, "storage.max_key_size", c.Storage.MaxKeySize)
+	nonNegative(&v, "storage.max_value_size", c.Storage.MaxValueSize)
+	nonNegative(&v, "storage.lsm.memtable_size", c.Storage.LSM.MemtableSize)
+	nonNegative(&v, "storage.lsm.block_size", c.Storage.LSM.BlockSize)
+	nonNegative(&v, "storage.lsm.table_size", c.Storage.LSM.TableSize)
+	nonNegative(&v, "storage.lsm.l0_compaction_trigger", c.Storage.LSM.L0CompactionTrigger)
+	nonNegative(&v, "storage.lsm.level_size_base", c.Storage.LSM.LevelSizeBase)
+	nonNegative(&v, "storage.lsm.level_size_multiplier", c.Storage.LSM.LevelSizeMultiplier)
+	nonNegative(&v, "storage.lsm.bloom_bits_per_key", c.Storage.LSM.BloomBitsPerKey)
+	nonNegative(&v, "storage.bitcask.max_file_size", c.Storage.Bitcask.MaxFileSize)
+	nonNegative(&v, "storage.bitcask.merge_interval", c.Storage.Bitcask.MergeInterval)
+	v.ratio("storage.bitcask.merge_ratio", c.Storage.Bitcask.MergeRatio)
+	v.oneOf("storage.tiered.mode", c.Storage.Tiered.Mode, "write-through", "write-back")
+	nonNegative(&v, "storage.tiered.queue_size", c.Storage.Tiered.QueueSize)
+	nonNegative(&v, "storage.tiered.cache_size", c.Storage.Tiered.CacheSize)
+
+	v.cluster(c.Cluster)
+
+	if c.Membership.Enabled {
+		v.required("membership.node_id", c.Membership.NodeID)
+	}
+	v.address("membership.address", c.Membership.Address)
+	v.address("membership.advertise_address", c.Membership.AdvertiseAddress)
+	for i, seed := range c.Membership.Seeds {
+		v.address(fmt.Sprintf("membership.seeds[%d]", i), seed)
+	}
+	nonNegative(&v, "membership.probe_interval", c.Membership.ProbeInterval)
+	nonNegative(&v, "membership.probe_timeout", c.Membership.ProbeTimeout)
+	nonNegative(&v, "membership.suspicion_timeout", c.Membership.SuspicionTimeout)
+
+	names := make(map[string]bool, len(c.ACL.Users))
+	for i, u := range c.ACL.Users {
+		key := fmt.Sprintf("acl.users[%d]", i)
+		v.required(key+".name", u.Name)
+		if names[u.Name] {
+			v.add(key+".name", "duplicate user %q", u.Name)
+		}
+		names[u.Name] = true
+		nonNegative(&v, key+".commands_per_second", u.CommandsPerSecond)
+		nonNegative(&v, key+".bytes_per_second", u.BytesPerSecond)
+		nonNegative(&v, key+".max_keys", u.MaxKeys)
+		nonNegative(&v, key+".max_memory", u.MaxMemory)
+		// usage of quotas is counted in memory and starts from zero on restart,
+		// keys kept by durable engines would not be counted
+		if (u.MaxKeys > 0 || u.MaxMemory > 0) && c.Storage.Engine != "memory" {
+			v.add(key, "quotas require the memory engine, got %q", c.Storage.Engine)
+		}
+	}
+
+	v.oneOf("limits.mode", c.Limits.Mode, "reject", "delay")
+	nonNegative(&v, "limits.commands_per_second", c.Limits.CommandsPerSecond)
+	nonNegative(&v, "limits.bytes_per_second", c.Limits.BytesPerSecond)
+
+	nonNegative(&v, "slowlog.max_len", c.Slowlog.MaxLen)
+
+	v.address("metrics.address", c.Metrics.Address)
+	v.tls("metrics.tls", c.Metrics.TLS)
+
+	v.address("health.address", c.Health.Address)
+	nonNegative(&v, "health.drain_delay", c.Health.DrainDelay)
+	nonNegative(&v, "health.max_replication_lag", c.Health.MaxReplicationLag)
+	v.tls("health.tls", c.Health.TLS)
+	if c.Health.TLS.Enabled() && c.Health.Address != "" && c.Health.Address == c.Metrics.Address {
+		v.add("health.tls", "the listener is shared with metrics, set metrics.tls")
+	}
+
+	v.ratio("tracing.sample_ratio", c.Tracing.SampleRatio)
+	nonNegative(&v, "tracing.queue_size", c.Tracing.QueueSize)
+
+	v.oneOf("audit.overflow", c.Audit.Overflow, "block", "drop")
+	nonNegative(&v, "audit.queue_size", c.Audit.QueueSize)
+
+	if c.DebugHTTP.Enabled {
+		v.required("debug_http.address", c.DebugHTTP.Address)
+	}
+	v.address("debug_http.address", c.DebugHTTP.Address)
+	nonNegative(&v, "debug_http.mutex_profile_fraction", c.DebugHTTP.MutexProfileFraction)
+	nonNegative(&v, "debug_http.block_profile_rate", c.DebugHTTP.BlockProfileRate)
+	v.tls("debug_http.tls", c.DebugHTTP.TLS)
+
+	return errors.Join(v.errs...)
+}
+
+// validator collects errors of fields.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(key, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.add(key, "is required")
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.add(key, "unknown value %q, expected %s", value, strings.Join(allowed, " or "))
+	}
+}
+
+func (v *validator) ratio(key string, value float64) {
+	if math.IsNaN(value) || value < 0 || value > 1 {
+		v.add(key, "%v is out of range [0, 1]", value)
+	}
+}
+
+// address checks a host:port address, empty address disables a listener.
+func (v *validator) address(key, addr string) {
+	if addr == "" {
+		return
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		v.add(key, "invalid address %q, expected host:port", addr)
+		return
+	}
+	if p, pErr := strconv.ParseUint(port, 10, 16); pErr != nil || p > 65535 {
+		v.add(key, "invalid port %q", port)
+	}
+}
+
+// levels checks levels like "info,storage=debug".
+func (v *validator) levels(key, spec string) {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		_, name, ok := strings.Cut(part, "=")
+		if !ok {
+			name = part
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			v.add(key, "invalid log level %q", part)
+		}
+	}
+}
+
+func (v *validator) tls(key string, t TLS) {
+	if t.CertFile != "" && t.KeyFile == "" {
+		v.add(key+".key_file", "is required with cert_file")
+	}
+	if t.CertFile == "" && (t.KeyFile != "" || t.ClientCAFile != "" || t.CAFile != "") {
+		v.add(key+".cert_file", "is required with key_file, client_ca_file and ca_file")
+	}
+	v.oneOf(key+".client_auth", t.ClientAuth, "", "require", "optional")
+	nonNegative(v, key+".reload_interval", t.ReloadInterval)
+}
+
+func (v *validator) cluster(c Cluster) {
+	ids := make(map[string]bool, len(c.Nodes))
+	for i, n := range c.Nodes {
+		key := fmt.Sprintf("cluster.nodes[%d]", i)
+		v.required(key+".id", n.ID)
+		if ids[n.ID] {
+			v.add(key+".id", "duplicate node %q", n.ID)
+		}
+		ids[n.ID] = true
+		v.required(key+".addr", n.Addr)
+		v.address(key+".addr", n.Addr)
+	}
+	if c.MigrateUser != "" {
+		v.required("cluster.migrate_password", c.MigratePassword)
+	}
+	if !c.Enabled {
+		return
+	}
+	v.required("cluster.node_id", c.NodeID)
+	if c.NodeID != "" && !ids[c.NodeID] {
+		v.add("cluster.node_id", "node %q is not in cluster.nodes", c.NodeID)
+	}
+}
+
+func nonNegative[T cmp.Ordered](v *validator, key string, value T) {
+	var zero T
+	if value < zero {
+		v.add(key, "must not be negative, got %v", value)
+	}
+}
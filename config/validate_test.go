@@ -0,0 +1,72 @@
+package config
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	c, err := load(nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.Validate())
+
+	c.Log.Format = "xml"
+	c.Log.Levels = []string{"storage=loud"}
+	c.Network.Address = "7000"
+	c.Network.TLS.KeyFile = "server.key"
+	c.Network.SocketPerm = "0999"
+	c.Storage.Databases = 0
+	c.Storage.Bitcask.MergeRatio = 2
+	c.Cluster = Cluster{Enabled: true, NodeID: "c", Nodes: []ClusterNode{
+		{ID: "a", Addr: "127.0.0.1:7000"},
+		{ID: "a", Addr: "127.0.0.1:7001"},
+	}, MigrateUser: "migrate"}
+	c.ACL.Users = []ACLUser{{Name: "app", MaxKeys: -1}, {Name: "app"}}
+	c.Limits.Mode = "wait"
+	c.Tracing.SampleRatio = -0.5
+	c.Audit.Overflow = "skip"
+	c.Metrics.Address = "127.0.0.1:9100"
+	c.Health.Address = "127.0.0.1:9100"
+	c.Health.TLS.CertFile = "health.crt"
+	c.DebugHTTP.TLS.KeyFile = "debug.key"
+
+	err = c.Validate()
+	require.Error(t, err)
+	for _, want := range []string{
+		`log.format: unknown value "xml", expected text or json`,
+		`log.levels[0]: invalid log level "storage=loud"`,
+		`network.address: invalid address "7000", expected host:port`,
+		`network.tls.cert_file: is required with key_file, client_ca_file and ca_file`,
+		`network.socket_perm: invalid permissions "0999"`,
+		`storage.databases: must be at least 1, got 0`,
+		`storage.bitcask.merge_ratio: 2 is out of range [0, 1]`,
+		`cluster.nodes[1].id: duplicate node "a"`,
+		`cluster.node_id: node "c" is not in cluster.nodes`,
+		`cluster.migrate_password: is required`,
+		`acl.users[0].max_keys: must not be negative, got -1`,
+		`acl.users[1].name: duplicate user "app"`,
+		`limits.mode: unknown value "wait", expected reject or delay`,
+		`tracing.sample_ratio: -0.5 is out of range [0, 1]`,
+		`audit.overflow: unknown value "skip", expected block or drop`,
+		`health.tls.key_file: is required with cert_file`,
+		`health.tls: the listener is shared with metrics, set metrics.tls`,
+		`debug_http.tls.cert_file: is required with key_file, client_ca_file and ca_file`,
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+
+	// usage of quotas is lost on restart, durable engines would keep uncounted keys
+	c, err = load(nil, []string{"--engine=lsm"}, nil)
+	require.NoError(t, err)
+	c.ACL.Users = []ACLUser{{Name: "app", MaxMemory: 1 << 20}}
+	require.EqualError(t, c.Validate(), `acl.users[0]: quotas require the memory engine, got "lsm"`)
+
+	// TOML allows nan and inf floats
+	c, err = load(nil, nil, nil)
+	require.NoError(t, err)
+	c.Tracing.SampleRatio = math.NaN()
+	require.EqualError(t, c.Validate(), "tracing.sample_ratio: NaN is out of range [0, 1]")
+}
@@ -3,13 +3,16 @@ module github.com/sattellite/bcdb
 go 1.23.1
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/cristalhq/aconfig v0.18.5
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.31.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,127 @@
+// Package health reports liveness and readiness of the node over HTTP.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrStarting = errors.New("starting")
+	ErrDraining = errors.New("shutting down")
+)
+
+// checkTimeout limits the time of all checks of a readiness probe.
+const checkTimeout = time.Second
+
+// Check reports why a component is not ready to serve clients.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// LagCheck reports not ready while the replication lag exceeds max.
+func LagCheck(lag func() time.Duration, max time.Duration) Check {
+	return func(context.Context) error {
+		if l := lag(); l > max {
+			return fmt.Errorf("replication lag %s exceeds %s", l, max)
+		}
+		return nil
+	}
+}
+
+// Result is the outcome of a readiness check, Err is nil for a ready component.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Health tracks the state of the node. The node is live as long as the
+// process serves requests, and ready once started and all checks pass,
+// until the shutdown begins.
+type Health struct {
+	// state is ErrStarting, nil when started or ErrDraining
+	state atomic.Pointer[error]
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+func New() *Health {
+	h := &Health{}
+	h.setState(ErrStarting)
+	return h
+}
+
+func (h *Health) setState(err error) {
+	h.state.Store(&err)
+}
+
+// AddCheck adds a check of a component required to serve clients.
+func (h *Health) AddCheck(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, namedCheck{name: name, check: c})
+}
+
+// Started marks the node started, it is ready when checks pass.
+func (h *Health) Started() {
+	h.setState(nil)
+}
+
+// Drain marks the node not ready, so load balancers stop sending new
+// clients before listeners are closed.
+func (h *Health) Drain() {
+	h.setState(ErrDraining)
+}
+
+// Ready runs the checks and reports whether the node is ready.
+func (h *Health) Ready(ctx context.Context) (bool, []Result) {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	results := make([]Result, 0, len(checks)+1)
+	results = append(results, Result{Name: "state", Err: *h.state.Load()})
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	for _, c := range checks {
+		results = append(results, Result{Name: c.name, Err: c.check(ctx)})
+	}
+
+	ready := true
+	for _, r := range results {
+		ready = ready && r.Err == nil
+	}
+	return ready, results
+}
+
+// Register adds /healthz and /readyz to the mux. Both reply 200 when
+// healthy and 503 otherwise, with a line of every readiness check.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready, results := h.Ready(r.Context())
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		for _, res := range results {
+			status := "ok"
+			if res.Err != nil {
+				status = res.Err.Error()
+			}
+			fmt.Fprintf(w, "%s: %s\n", res.Name, status)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(h *Health, path string) (int, string) {
+	mux := http.NewServeMux()
+	h.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealth(t *testing.T) {
+	h := New()
+	var engineErr error
+	h.AddCheck("engine", func(context.Context) error { return engineErr })
+
+	code, body := get(h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	tests := []struct {
+		name     string
+		setup    func()
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "starting",
+			setup:    func() {},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "state: starting\nengine: ok\n",
+		},
+		{
+			name:     "started",
+			setup:    h.Started,
+			wantCode: http.StatusOK,
+			wantBody: "state: ok\nengine: ok\n",
+		},
+		{
+			name:     "failed check",
+			setup:    func() { engineErr = errors.New("engine closed") },
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "state: ok\nengine: engine closed\n",
+		},
+		{
+			name:     "draining",
+			setup:    func() { engineErr = nil; h.Drain() },
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "state: shutting down\nengine: ok\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			code, body := get(h, "/readyz")
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantBody, body)
+		})
+	}
+
+	// the process is live while draining
+	code, _ = get(h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestLagCheck(t *testing.T) {
+	lag := time.Second
+	check := LagCheck(func() time.Duration { return lag }, time.Second)
+	assert.NoError(t, check(context.Background()))
+
+	lag = 2 * time.Second
+	assert.EqualError(t, check(context.Background()), "replication lag 2s exceeds 1s")
+}
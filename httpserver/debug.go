@@ -0,0 +1,96 @@
+package httpserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/sattellite/bcdb/lockstat"
+)
+
+// DebugHandler serves runtime introspection of the process:
+//
+//	/debug/pprof/      profiles of net/http/pprof
+//	/debug/goroutines  stacks of all goroutines
+//	/debug/gc          memory and garbage collector stats
+//	/debug/locks       wait times of locks tracked by lockstat
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/goroutines", goroutines)
+	mux.HandleFunc("GET /debug/gc", gcStats)
+	mux.HandleFunc("GET /debug/locks", locks)
+	return mux
+}
+
+func goroutines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			_, _ = w.Write(buf[:n])
+			return
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func gcStats(w http.ResponseWriter, _ *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	var lastPause time.Duration
+	if len(gc.Pause) > 0 {
+		lastPause = gc.Pause[0]
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, f := range []struct {
+		name  string
+		value any
+	}{
+		{"goroutines", runtime.NumGoroutine()},
+		{"gomaxprocs", runtime.GOMAXPROCS(0)},
+		{"num_gc", gc.NumGC},
+		{"last_gc", gc.LastGC.Format(time.RFC3339Nano)},
+		{"pause_total", gc.PauseTotal},
+		{"pause_last", lastPause},
+		{"gc_cpu_fraction", mem.GCCPUFraction},
+		{"heap_alloc", mem.HeapAlloc},
+		{"heap_inuse", mem.HeapInuse},
+		{"heap_sys", mem.HeapSys},
+		{"heap_objects", mem.HeapObjects},
+		{"next_gc", mem.NextGC},
+		{"total_alloc", mem.TotalAlloc},
+		{"mallocs", mem.Mallocs},
+		{"frees", mem.Frees},
+		{"sys", mem.Sys},
+	} {
+		fmt.Fprintf(w, "%s:%v\n", f.name, f.value)
+	}
+}
+
+func locks(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeLocks(w, lockstat.Enabled(), lockstat.Snapshot())
+}
+
+func writeLocks(w io.Writer, enabled bool, stats []lockstat.Stats) {
+	if !enabled {
+		fmt.Fprintln(w, "# lock measuring is disabled")
+	}
+	for _, s := range stats {
+		fmt.Fprintf(w, "name=%s reads=%d writes=%d contended=%d wait=%s max_wait=%s\n",
+			s.Name, s.Reads, s.Writes, s.Contended, s.Wait, s.MaxWait)
+	}
+}
@@ -0,0 +1,42 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sattellite/bcdb/lockstat"
+)
+
+func TestDebugHandler(t *testing.T) {
+	h := DebugHandler()
+	tests := []struct {
+		path     string
+		contains string
+	}{
+		{path: "/debug/pprof/", contains: "goroutine"},
+		{path: "/debug/goroutines", contains: "TestDebugHandler"},
+		{path: "/debug/gc", contains: "num_gc:"},
+		{path: "/debug/locks", contains: "# lock measuring is disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.contains)
+		})
+	}
+}
+
+func TestWriteLocks(t *testing.T) {
+	var b strings.Builder
+	writeLocks(&b, true, []lockstat.Stats{
+		{Name: "lsm", Reads: 10, Writes: 2, Contended: 1, Wait: time.Millisecond, MaxWait: time.Millisecond},
+	})
+	assert.Equal(t, "name=lsm reads=10 writes=2 contended=1 wait=1ms max_wait=1ms\n", b.String())
+}
@@ -0,0 +1,93 @@
+// Package httpserver serves HTTP endpoints of the node, like metrics,
+// next to the client protocol listeners.
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout limits waiting for in-flight requests on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// readHeaderTimeout limits reading headers of requests.
+const readHeaderTimeout = 10 * time.Second
+
+// Option configures optional server features.
+type Option func(*Server)
+
+// WithTLS serves requests over TLS.
+func WithTLS(cfg *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = cfg
+	}
+}
+
+type Server struct {
+	logger  *slog.Logger
+	address string
+	handler http.Handler
+	tls     *tls.Config
+}
+
+func New(l *slog.Logger, address string, h http.Handler, opts ...Option) *Server {
+	s := &Server{
+		logger:  l.With("module", "http"),
+		address: address,
+		handler: h,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run serves requests until the context is canceled.
+func (s *Server) Run(ctx context.Context) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves requests on the listener until the context is canceled.
+// In-flight requests are given shutdownTimeout to complete.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.tls != nil {
+		ln = tls.NewListener(ln, s.tls)
+	}
+	srv := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelDebug),
+	}
+	s.logger.Info("listening", slog.String("address", ln.Addr().String()), slog.Bool("tls", s.tls != nil))
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			s.logger.Debug("failed to shutdown gracefully", slog.Any("error", err))
+			_ = srv.Close()
+		}
+	}()
+
+	err := srv.Serve(ln)
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = ln.Close()
+		return err
+	}
+	<-stopped
+	s.logger.Info("stopped")
+	return nil
+}
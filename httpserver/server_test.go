@@ -0,0 +1,63 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// the request is in flight when the server stops
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- New(noopLogger, "", mux).Serve(ctx, ln)
+	}()
+
+	body := make(chan string)
+	go func() {
+		resp, gErr := http.Get("http://" + ln.Addr().String() + "/slow")
+		if gErr != nil {
+			body <- gErr.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+	close(release)
+	assert.Equal(t, "done", <-body)
+	select {
+	case sErr := <-stopped:
+		require.NoError(t, sErr)
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	_, err = http.Get("http://" + ln.Addr().String() + "/slow")
+	require.Error(t, err, "listener should be closed")
+}
@@ -0,0 +1,84 @@
+package limits
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket. Tokens are added at the rate per second
+// up to the burst. A nil bucket is unlimited.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewBucket returns a full bucket. The burst is one second of the rate,
+// but at least one token. A bucket without a positive rate is unlimited
+// and NewBucket returns nil.
+func NewBucket(rate float64) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := &Bucket{
+		rate:  rate,
+		burst: max(rate, 1),
+		now:   time.Now,
+	}
+	b.tokens = b.burst
+	b.last = b.now()
+	return b
+}
+
+// Allow takes n tokens if the bucket has them. A request larger than the
+// burst is allowed when the bucket is full and leaves the bucket in debt.
+func (b *Bucket) Allow(n float64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < min(n, b.burst) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Reserve takes n tokens and returns the time to wait until the bucket pays the debt.
+func (b *Bucket) Reserve(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Refund returns tokens taken by a canceled request.
+func (b *Bucket) Refund(n float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+n, b.burst)
+}
+
+func (b *Bucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	if elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed*b.rate, b.burst)
+	}
+}
@@ -0,0 +1,63 @@
+package limits
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBucket returns a bucket with a clock moved by the returned function.
+func newTestBucket(rate float64) (*Bucket, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	b := NewBucket(rate)
+	b.now = func() time.Time { return now }
+	b.last = now
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBucket_Allow(t *testing.T) {
+	b, advance := newTestBucket(2)
+
+	assert.True(t, b.Allow(1))
+	assert.True(t, b.Allow(1))
+	assert.False(t, b.Allow(1), "burst is one second of the rate")
+
+	advance(500 * time.Millisecond)
+	assert.True(t, b.Allow(1))
+	assert.False(t, b.Allow(1))
+
+	advance(time.Hour)
+	assert.True(t, b.Allow(2))
+	assert.False(t, b.Allow(1), "tokens don't grow over the burst")
+}
+
+func TestBucket_AllowOverBurst(t *testing.T) {
+	b, advance := newTestBucket(10)
+
+	assert.True(t, b.Allow(25), "a large request is allowed on the full bucket")
+	advance(time.Second)
+	assert.False(t, b.Allow(1), "the debt is paid first")
+	advance(time.Second)
+	assert.True(t, b.Allow(1))
+}
+
+func TestBucket_Reserve(t *testing.T) {
+	b, advance := newTestBucket(10)
+
+	assert.Zero(t, b.Reserve(10))
+	assert.Equal(t, 500*time.Millisecond, b.Reserve(5))
+	advance(500 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, b.Reserve(1))
+
+	b.Refund(1)
+	assert.Zero(t, b.Reserve(0))
+}
+
+func TestBucket_Unlimited(t *testing.T) {
+	b := NewBucket(0)
+	assert.Nil(t, b)
+	assert.True(t, b.Allow(1e9))
+	assert.Zero(t, b.Reserve(1e9))
+	b.Refund(1)
+}
@@ -0,0 +1,190 @@
+// Package limits limits rates of commands and quotas of users.
+package limits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+var ErrRateLimited = errors.New("RATELIMITED rate limit exceeded")
+
+// Mode selects what happens to commands over the limit.
+type Mode int
+
+const (
+	// Reject fails commands over the limit with ErrRateLimited.
+	Reject Mode = iota
+	// Delay waits until the limit allows the command.
+	Delay
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Reject:
+		return "reject"
+	case Delay:
+		return "delay"
+	}
+	return "unknown"
+}
+
+// ParseMode parses the name of the mode.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range []Mode{Reject, Delay} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mode %q, expected %s or %s", s, Reject, Delay)
+}
+
+// Rate limits commands and bytes of commands per second, zero disables a limit.
+type Rate struct {
+	CommandsPerSecond float64
+	BytesPerSecond    float64
+}
+
+func (r Rate) enabled() bool {
+	return r.CommandsPerSecond > 0 || r.BytesPerSecond > 0
+}
+
+type buckets struct {
+	name     string
+	commands *Bucket
+	bytes    *Bucket
+}
+
+func newBuckets(name string, r Rate) *buckets {
+	return &buckets{name: name, commands: NewBucket(r.CommandsPerSecond), bytes: NewBucket(r.BytesPerSecond)}
+}
+
+// Limiter limits the rate of commands of all sessions together
+// and of every user separately.
+type Limiter struct {
+	mu     sync.RWMutex
+	mode   Mode
+	global *buckets
+	users  map[string]*buckets
+}
+
+func NewLimiter(mode Mode, global Rate, users map[string]Rate) *Limiter {
+	l := &Limiter{
+		mode:   mode,
+		global: newBuckets("global", global),
+		users:  make(map[string]*buckets, len(users)),
+	}
+	for name, r := range users {
+		if r.enabled() {
+			l.users[name] = newBuckets(fmt.Sprintf("user %q", name), r)
+		}
+	}
+	return l
+}
+
+// FromConfig creates the limiter of the global limits and limits of ACL users.
+func FromConfig(cfg config.Limits, a config.ACL) (*Limiter, error) {
+	mode, err := ParseMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]Rate, len(a.Users))
+	for _, u := range a.Users {
+		users[u.Name] = Rate{CommandsPerSecond: u.CommandsPerSecond, BytesPerSecond: u.BytesPerSecond}
+	}
+	global := Rate{CommandsPerSecond: cfg.CommandsPerSecond, BytesPerSecond: cfg.BytesPerSecond}
+	return NewLimiter(mode, global, users), nil
+}
+
+// Replace replaces the mode and the limits by those of other.
+// The buckets of other are used, so the new limits start full.
+func (l *Limiter) Replace(other *Limiter) {
+	other.mu.RLock()
+	mode, global, users := other.mode, other.global, other.users
+	other.mu.RUnlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mode, l.global, l.users = mode, global, users
+}
+
+// Enabled reports whether any limit is set.
+func (l *Limiter) Enabled() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.global.commands != nil || l.global.bytes != nil || len(l.users) > 0
+}
+
+// limitsOf returns the mode and the buckets limiting the user.
+func (l *Limiter) limitsOf(user string) (Mode, []*buckets) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	all := []*buckets{l.global}
+	if u, ok := l.users[user]; ok {
+		all = append(all, u)
+	}
+	return l.mode, all
+}
+
+// Wait accounts a command of the user of the given size. In the reject mode it fails
+// with ErrRateLimited over the limit, in the delay mode it waits for the limit
+// or for the context.
+func (l *Limiter) Wait(ctx context.Context, user string, size int) error {
+	if !l.Enabled() {
+		return nil
+	}
+	mode, all := l.limitsOf(user)
+	if mode == Reject {
+		return l.allow(all, float64(size))
+	}
+
+	var wait time.Duration
+	for _, b := range all {
+		wait = max(wait, b.commands.Reserve(1), b.bytes.Reserve(float64(size)))
+	}
+	if wait == 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		for _, b := range all {
+			b.commands.Refund(1)
+			b.bytes.Refund(float64(size))
+		}
+		return ctx.Err()
+	}
+}
+
+// allow takes tokens from every bucket or from none of them.
+func (l *Limiter) allow(all []*buckets, size float64) error {
+	for i, b := range all {
+		if !b.commands.Allow(1) {
+			l.refund(all[:i], size)
+			return fmt.Errorf("%w: %s commands per second", ErrRateLimited, b.name)
+		}
+		if !b.bytes.Allow(size) {
+			b.commands.Refund(1)
+			l.refund(all[:i], size)
+			return fmt.Errorf("%w: %s bytes per second", ErrRateLimited, b.name)
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) refund(all []*buckets, size float64) {
+	for _, b := range all {
+		b.commands.Refund(1)
+		b.bytes.Refund(size)
+	}
+}
@@ -0,0 +1,113 @@
+package limits
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+func TestParseMode(t *testing.T) {
+	m, err := ParseMode("delay")
+	require.NoError(t, err)
+	assert.Equal(t, Delay, m)
+	_, err = ParseMode("drop")
+	require.ErrorContains(t, err, `unknown mode "drop"`)
+}
+
+func TestLimiter_Reject(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(Reject, Rate{CommandsPerSecond: 3}, map[string]Rate{
+		"app":  {CommandsPerSecond: 2},
+		"bulk": {BytesPerSecond: 10},
+		"none": {},
+	})
+	require.True(t, l.Enabled())
+
+	require.NoError(t, l.Wait(ctx, "app", 1))
+	require.NoError(t, l.Wait(ctx, "app", 1))
+	err := l.Wait(ctx, "app", 1)
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.ErrorContains(t, err, `user "app" commands per second`)
+
+	// the rejected command of the user is not counted globally
+	require.NoError(t, l.Wait(ctx, "none", 1))
+	err = l.Wait(ctx, "none", 1)
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.ErrorContains(t, err, "global commands per second")
+}
+
+func TestLimiter_RejectBytes(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(Reject, Rate{}, map[string]Rate{"bulk": {BytesPerSecond: 10}})
+
+	require.NoError(t, l.Wait(ctx, "bulk", 8))
+	err := l.Wait(ctx, "bulk", 8)
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.ErrorContains(t, err, `user "bulk" bytes per second`)
+	require.NoError(t, l.Wait(ctx, "other", 1000), "other users are not limited")
+}
+
+func TestLimiter_Delay(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(Delay, Rate{BytesPerSecond: 1000}, nil)
+
+	require.NoError(t, l.Wait(ctx, "", 1000))
+	start := time.Now()
+	require.NoError(t, l.Wait(ctx, "", 50))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestLimiter_DelayCanceled(t *testing.T) {
+	l := NewLimiter(Delay, Rate{CommandsPerSecond: 1}, nil)
+	require.NoError(t, l.Wait(context.Background(), "", 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Wait(ctx, "", 1), context.DeadlineExceeded)
+	assert.InDelta(t, 0, l.global.commands.tokens, 0.1, "tokens of the canceled command are refunded")
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	var l *Limiter
+	assert.False(t, l.Enabled())
+	require.NoError(t, l.Wait(context.Background(), "app", 1))
+
+	l, err := FromConfig(config.Limits{Mode: "reject"}, config.ACL{Users: []config.ACLUser{{Name: "app"}}})
+	require.NoError(t, err)
+	assert.False(t, l.Enabled())
+}
+
+func TestLimiter_Replace(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(Reject, Rate{}, nil)
+	require.NoError(t, l.Wait(ctx, "app", 1))
+
+	l.Replace(NewLimiter(Reject, Rate{}, map[string]Rate{"app": {CommandsPerSecond: 1}}))
+	assert.True(t, l.Enabled())
+	require.NoError(t, l.Wait(ctx, "app", 1))
+	require.ErrorIs(t, l.Wait(ctx, "app", 1), ErrRateLimited)
+	require.NoError(t, l.Wait(ctx, "other", 1))
+
+	l.Replace(NewLimiter(Delay, Rate{}, nil))
+	assert.False(t, l.Enabled())
+	require.NoError(t, l.Wait(ctx, "app", 1))
+}
+
+func TestFromConfig(t *testing.T) {
+	l, err := FromConfig(config.Limits{Mode: "delay", BytesPerSecond: 100}, config.ACL{Users: []config.ACLUser{
+		{Name: "app", CommandsPerSecond: 10},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, Delay, l.mode)
+	assert.Nil(t, l.global.commands)
+	assert.NotNil(t, l.global.bytes)
+	assert.Contains(t, l.users, "app")
+
+	_, err = FromConfig(config.Limits{Mode: "slow"}, config.ACL{})
+	require.Error(t, err)
+}
@@ -0,0 +1,240 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+var ErrQuotaExceeded = errors.New("QUOTA quota exceeded")
+
+// Quota limits the number of keys written by a user and their memory,
+// the sum of sizes of keys and values. Zero disables a limit.
+type Quota struct {
+	MaxKeys   int
+	MaxMemory int64
+}
+
+func (q Quota) enabled() bool {
+	return q.MaxKeys > 0 || q.MaxMemory > 0
+}
+
+// Usage is the number of keys of a user and their memory.
+type Usage struct {
+	Keys   int
+	Memory int64
+}
+
+type dbKey struct {
+	db  int
+	key string
+}
+
+type owner struct {
+	user string
+	size int64
+}
+
+// Quotas tracks keys written by users with quotas since the start of the
+// server. A key belongs to the user who wrote it last, keys written before
+// the start or by users without quotas are not counted. Usage is not
+// persisted, so config allows quotas with the memory engine only.
+type Quotas struct {
+	mu     sync.Mutex
+	quotas map[string]Quota
+	keys   map[dbKey]owner
+	usage  map[string]Usage
+}
+
+func NewQuotas(quotas map[string]Quota) *Quotas {
+	q := &Quotas{
+		quotas: make(map[string]Quota, len(quotas)),
+		keys:   make(map[dbKey]owner),
+		usage:  make(map[string]Usage),
+	}
+	for name, quota := range quotas {
+		if quota.enabled() {
+			q.quotas[name] = quota
+		}
+	}
+	return q
+}
+
+// QuotasFromConfig creates quotas of ACL users.
+func QuotasFromConfig(a config.ACL) *Quotas {
+	quotas := make(map[string]Quota, len(a.Users))
+	for _, u := range a.Users {
+		quotas[u.Name] = Quota{MaxKeys: u.MaxKeys, MaxMemory: u.MaxMemory}
+	}
+	return NewQuotas(quotas)
+}
+
+// Replace replaces quotas of users by quotas of other. Keys written
+// while a user had no quota are not counted.
+func (q *Quotas) Replace(other *Quotas) {
+	other.mu.Lock()
+	quotas := other.quotas
+	other.mu.Unlock()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.quotas = quotas
+}
+
+// Enabled reports whether any user has a quota. Methods of disabled quotas do nothing.
+func (q *Quotas) Enabled() bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.quotas) > 0
+}
+
+// Set accounts a write of the key by the user before the write, so concurrent
+// writes can't exceed the quota. It fails with ErrQuotaExceeded when the write
+// exceeds the quota of the user. undo reverts the accounting of a failed write.
+func (q *Quotas) Set(user string, db int, key string, size int) (undo func(), err error) {
+	if !q.Enabled() {
+		return func() {}, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	k := dbKey{db: db, key: key}
+	prev, had := q.keys[k]
+	quota, limited := q.quotas[user]
+	if limited {
+		u := q.usage[user]
+		u.Memory += int64(size)
+		if had && prev.user == user {
+			u.Memory -= prev.size
+		} else {
+			u.Keys++
+		}
+		if quota.MaxKeys > 0 && u.Keys > quota.MaxKeys {
+			return nil, fmt.Errorf("%w: user %q can't have more than %d keys", ErrQuotaExceeded, user, quota.MaxKeys)
+		}
+		if quota.MaxMemory > 0 && u.Memory > quota.MaxMemory {
+			return nil, fmt.Errorf("%w: user %q can't use more than %d bytes", ErrQuotaExceeded, user, quota.MaxMemory)
+		}
+	}
+
+	q.remove(k)
+	if limited {
+		q.add(k, owner{user: user, size: int64(size)})
+	}
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.remove(k)
+		if had {
+			q.add(k, prev)
+		}
+	}, nil
+}
+
+// Del releases a deleted key.
+func (q *Quotas) Del(db int, key string) {
+	if !q.Enabled() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(dbKey{db: db, key: key})
+}
+
+// Move accounts the key moved to another database.
+func (q *Quotas) Move(key string, from, to int) {
+	if !q.Enabled() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	k := dbKey{db: from, key: key}
+	if o, ok := q.keys[k]; ok {
+		delete(q.keys, k)
+		q.keys[dbKey{db: to, key: key}] = o
+	}
+}
+
+// Flush releases all keys of the database.
+func (q *Quotas) Flush(db int) {
+	if !q.Enabled() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for k := range q.keys {
+		if k.db == db {
+			q.remove(k)
+		}
+	}
+}
+
+// FlushAll releases all keys.
+func (q *Quotas) FlushAll() {
+	if !q.Enabled() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	clear(q.keys)
+	clear(q.usage)
+}
+
+// Swap accounts swapped databases.
+func (q *Quotas) Swap(a, b int) {
+	if !q.Enabled() {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	swapped := make(map[dbKey]owner, len(q.keys))
+	for k, o := range q.keys {
+		switch k.db {
+		case a:
+			k.db = b
+		case b:
+			k.db = a
+		}
+		swapped[k] = o
+	}
+	q.keys = swapped
+}
+
+// Usage returns the keys and memory used by the user.
+func (q *Quotas) Usage(user string) Usage {
+	if !q.Enabled() {
+		return Usage{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage[user]
+}
+
+func (q *Quotas) add(k dbKey, o owner) {
+	q.keys[k] = o
+	u := q.usage[o.user]
+	u.Keys++
+	u.Memory += o.size
+	q.usage[o.user] = u
+}
+
+func (q *Quotas) remove(k dbKey) {
+	o, ok := q.keys[k]
+	if !ok {
+		return
+	}
+	delete(q.keys, k)
+	u := q.usage[o.user]
+	u.Keys--
+	u.Memory -= o.size
+	if u.Keys == 0 {
+		delete(q.usage, o.user)
+		return
+	}
+	q.usage[o.user] = u
+}
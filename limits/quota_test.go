@@ -0,0 +1,121 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+func TestQuotas_MaxKeys(t *testing.T) {
+	q := NewQuotas(map[string]Quota{"app": {MaxKeys: 2}})
+
+	_, err := q.Set("app", 0, "a", 10)
+	require.NoError(t, err)
+	_, err = q.Set("app", 0, "b", 10)
+	require.NoError(t, err)
+	_, err = q.Set("app", 0, "a", 20)
+	require.NoError(t, err, "overwrites don't add keys")
+	_, err = q.Set("app", 1, "a", 10)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, `user "app" can't have more than 2 keys`)
+	assert.Equal(t, Usage{Keys: 2, Memory: 30}, q.Usage("app"))
+
+	q.Del(0, "a")
+	_, err = q.Set("app", 1, "a", 10)
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Keys: 2, Memory: 20}, q.Usage("app"))
+}
+
+func TestQuotas_MaxMemory(t *testing.T) {
+	q := NewQuotas(map[string]Quota{"app": {MaxMemory: 100}})
+
+	_, err := q.Set("app", 0, "a", 60)
+	require.NoError(t, err)
+	_, err = q.Set("app", 0, "b", 60)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	_, err = q.Set("app", 0, "a", 100)
+	require.NoError(t, err, "the old value of the key is released")
+	assert.Equal(t, Usage{Keys: 1, Memory: 100}, q.Usage("app"))
+}
+
+func TestQuotas_Undo(t *testing.T) {
+	q := NewQuotas(map[string]Quota{"app": {MaxKeys: 10}})
+
+	_, err := q.Set("app", 0, "a", 10)
+	require.NoError(t, err)
+	undo, err := q.Set("app", 0, "a", 50)
+	require.NoError(t, err)
+	undo()
+	assert.Equal(t, Usage{Keys: 1, Memory: 10}, q.Usage("app"))
+
+	undo, err = q.Set("app", 0, "b", 50)
+	require.NoError(t, err)
+	undo()
+	assert.Equal(t, Usage{Keys: 1, Memory: 10}, q.Usage("app"))
+}
+
+func TestQuotas_Owner(t *testing.T) {
+	q := NewQuotas(map[string]Quota{"app": {MaxKeys: 10}, "other": {MaxKeys: 10}})
+
+	_, err := q.Set("app", 0, "a", 10)
+	require.NoError(t, err)
+	_, err = q.Set("other", 0, "a", 5)
+	require.NoError(t, err)
+	assert.Equal(t, Usage{}, q.Usage("app"), "the key belongs to the last writer")
+	assert.Equal(t, Usage{Keys: 1, Memory: 5}, q.Usage("other"))
+
+	_, err = q.Set("unlimited", 0, "a", 5)
+	require.NoError(t, err)
+	assert.Equal(t, Usage{}, q.Usage("other"))
+}
+
+func TestQuotas_Databases(t *testing.T) {
+	q := NewQuotas(map[string]Quota{"app": {MaxKeys: 10}})
+	for _, db := range []int{0, 1, 2} {
+		_, err := q.Set("app", db, "a", 10)
+		require.NoError(t, err)
+	}
+
+	q.Move("a", 2, 3)
+	q.Swap(0, 3)
+	q.Flush(0)
+	assert.Equal(t, Usage{Keys: 2, Memory: 20}, q.Usage("app"))
+	q.Del(3, "a")
+	assert.Equal(t, Usage{Keys: 1, Memory: 10}, q.Usage("app"), "the key of db 0 is in db 3 after the swap")
+	q.FlushAll()
+	assert.Equal(t, Usage{}, q.Usage("app"))
+}
+
+func TestQuotas_Disabled(t *testing.T) {
+	q := QuotasFromConfig(config.ACL{Users: []config.ACLUser{{Name: "app"}}})
+	assert.False(t, q.Enabled())
+
+	var nilQuotas *Quotas
+	undo, err := nilQuotas.Set("app", 0, "a", 10)
+	require.NoError(t, err)
+	undo()
+	nilQuotas.Del(0, "a")
+	nilQuotas.FlushAll()
+	assert.Equal(t, Usage{}, nilQuotas.Usage("app"))
+}
+
+func TestQuotas_Replace(t *testing.T) {
+	q := NewQuotas(nil)
+	_, err := q.Set("app", 0, "before", 10)
+	require.NoError(t, err)
+
+	q.Replace(NewQuotas(map[string]Quota{"app": {MaxKeys: 1}}))
+	require.True(t, q.Enabled())
+	_, err = q.Set("app", 0, "a", 10)
+	require.NoError(t, err, "keys written without the quota are not counted")
+	_, err = q.Set("app", 0, "b", 10)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	q.Replace(NewQuotas(map[string]Quota{"app": {MaxKeys: 2}}))
+	_, err = q.Set("app", 0, "b", 10)
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Keys: 2, Memory: 20}, q.Usage("app"))
+}
@@ -0,0 +1,184 @@
+// Package lockstat measures how long goroutines wait for mutexes.
+//
+// Mutex and RWMutex are drop-in replacements of the sync mutexes. Locks
+// given a name with Track count acquisitions and wait times under that
+// name, locks of the same name share counters. Measuring is off until
+// Enable, a disabled or untracked lock costs one atomic load.
+package lockstat
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var enabled atomic.Bool
+
+// Enable turns measuring of tracked locks on or off.
+func Enable(on bool) {
+	enabled.Store(on)
+}
+
+// Enabled reports whether tracked locks are measured.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Stats are counters of locks of a name.
+type Stats struct {
+	Name string
+	// Reads and Writes count shared and exclusive acquisitions.
+	Reads  uint64
+	Writes uint64
+	// Contended counts acquisitions which waited for another holder.
+	Contended uint64
+	// Wait is the total and MaxWait the longest wait of contended acquisitions.
+	Wait    time.Duration
+	MaxWait time.Duration
+}
+
+type counters struct {
+	reads     atomic.Uint64
+	writes    atomic.Uint64
+	contended atomic.Uint64
+	wait      atomic.Int64
+	maxWait   atomic.Int64
+}
+
+func (c *counters) acquired(exclusive bool, wait time.Duration) {
+	if exclusive {
+		c.writes.Add(1)
+	} else {
+		c.reads.Add(1)
+	}
+	if wait == 0 {
+		return
+	}
+	c.contended.Add(1)
+	c.wait.Add(int64(wait))
+	for {
+		maxWait := c.maxWait.Load()
+		if int64(wait) <= maxWait || c.maxWait.CompareAndSwap(maxWait, int64(wait)) {
+			return
+		}
+	}
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*counters)
+)
+
+func countersOf(name string) *counters {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	c, ok := registry[name]
+	if !ok {
+		c = &counters{}
+		registry[name] = c
+	}
+	return c
+}
+
+// Snapshot returns counters of all tracked names ordered by the total wait, longest first.
+func Snapshot() []Stats {
+	registryMu.Lock()
+	stats := make([]Stats, 0, len(registry))
+	for name, c := range registry {
+		stats = append(stats, Stats{
+			Name:      name,
+			Reads:     c.reads.Load(),
+			Writes:    c.writes.Load(),
+			Contended: c.contended.Load(),
+			Wait:      time.Duration(c.wait.Load()),
+			MaxWait:   time.Duration(c.maxWait.Load()),
+		})
+	}
+	registryMu.Unlock()
+
+	slices.SortFunc(stats, func(a, b Stats) int {
+		if c := cmp.Compare(b.Wait, a.Wait); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return stats
+}
+
+// Mutex is a sync.Mutex measuring wait times when tracked.
+type Mutex struct {
+	mu    sync.Mutex
+	stats *counters
+}
+
+// Track counts the lock under the name. It must be called before the lock is used.
+func (m *Mutex) Track(name string) {
+	m.stats = countersOf(name)
+}
+
+func (m *Mutex) Lock() {
+	if m.stats == nil || !enabled.Load() {
+		m.mu.Lock()
+		return
+	}
+	if m.mu.TryLock() {
+		m.stats.acquired(true, 0)
+		return
+	}
+	start := time.Now()
+	m.mu.Lock()
+	m.stats.acquired(true, time.Since(start))
+}
+
+func (m *Mutex) Unlock() {
+	m.mu.Unlock()
+}
+
+// RWMutex is a sync.RWMutex measuring wait times when tracked.
+type RWMutex struct {
+	mu    sync.RWMutex
+	stats *counters
+}
+
+// Track counts the lock under the name. It must be called before the lock is used.
+func (m *RWMutex) Track(name string) {
+	m.stats = countersOf(name)
+}
+
+func (m *RWMutex) Lock() {
+	if m.stats == nil || !enabled.Load() {
+		m.mu.Lock()
+		return
+	}
+	if m.mu.TryLock() {
+		m.stats.acquired(true, 0)
+		return
+	}
+	start := time.Now()
+	m.mu.Lock()
+	m.stats.acquired(true, time.Since(start))
+}
+
+func (m *RWMutex) Unlock() {
+	m.mu.Unlock()
+}
+
+func (m *RWMutex) RLock() {
+	if m.stats == nil || !enabled.Load() {
+		m.mu.RLock()
+		return
+	}
+	if m.mu.TryRLock() {
+		m.stats.acquired(false, 0)
+		return
+	}
+	start := time.Now()
+	m.mu.RLock()
+	m.stats.acquired(false, time.Since(start))
+}
+
+func (m *RWMutex) RUnlock() {
+	m.mu.RUnlock()
+}
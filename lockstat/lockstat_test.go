@@ -0,0 +1,89 @@
+package lockstat
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statsOf(t *testing.T, name string) Stats {
+	t.Helper()
+	for _, s := range Snapshot() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no stats of %q", name)
+	return Stats{}
+}
+
+func TestRWMutex(t *testing.T) {
+	Enable(true)
+	defer Enable(false)
+
+	var mu RWMutex
+	mu.Track(t.Name())
+	mu.RLock()
+	mu.RUnlock()
+
+	mu.Lock()
+	acquired := make(chan struct{})
+	go func() {
+		mu.RLock()
+		close(acquired)
+		mu.RUnlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	mu.Unlock()
+	<-acquired
+
+	s := statsOf(t, t.Name())
+	assert.Equal(t, uint64(2), s.Reads)
+	assert.Equal(t, uint64(1), s.Writes)
+	assert.Equal(t, uint64(1), s.Contended)
+	assert.GreaterOrEqual(t, s.Wait, 10*time.Millisecond)
+	assert.Equal(t, s.Wait, s.MaxWait)
+}
+
+func TestMutex_SharedName(t *testing.T) {
+	Enable(true)
+	defer Enable(false)
+
+	var a, b Mutex
+	a.Track(t.Name())
+	b.Track(t.Name())
+	var wg sync.WaitGroup
+	for _, mu := range []*Mutex{&a, &b} {
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 100 {
+					mu.Lock()
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(800), statsOf(t, t.Name()).Writes)
+}
+
+func TestDisabled(t *testing.T) {
+	var mu Mutex
+	mu.Track(t.Name())
+	mu.Lock()
+	mu.Unlock()
+	require.False(t, Enabled())
+	assert.Zero(t, statsOf(t, t.Name()).Writes)
+
+	// untracked locks are plain mutexes
+	var untracked RWMutex
+	Enable(true)
+	defer Enable(false)
+	untracked.Lock()
+	untracked.Unlock()
+}
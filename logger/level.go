@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Levels are the default level and levels of scopes which differ from it.
+type Levels struct {
+	Default slog.Level
+	Scopes  map[string]slog.Level
+}
+
+// ParseLevels parses levels like "info" or "info,storage=debug". A spec
+// without a scope sets the default level, which is info when unset.
+func ParseLevels(specs ...string) (Levels, error) {
+	levels := Levels{Default: slog.LevelInfo, Scopes: make(map[string]slog.Level)}
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			scope, name, ok := strings.Cut(part, "=")
+			if !ok {
+				scope, name = "", part
+			}
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(name)); err != nil {
+				return Levels{}, fmt.Errorf("invalid log level %q", part)
+			}
+			if scope == "" {
+				levels.Default = level
+				continue
+			}
+			levels.Scopes[scope] = level
+		}
+	}
+	return levels, nil
+}
+
+// Of returns the level of the scope.
+func (l Levels) Of(scope string) slog.Level {
+	if level, ok := l.Scopes[scope]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// String formats the levels as parsed by ParseLevels, scopes are sorted.
+func (l Levels) String() string {
+	parts := []string{strings.ToLower(l.Default.String())}
+	for _, scope := range slices.Sorted(maps.Keys(l.Scopes)) {
+		parts = append(parts, scope+"="+strings.ToLower(l.Scopes[scope].String()))
+	}
+	return strings.Join(parts, ",")
+}
+
+var current atomic.Pointer[Levels]
+
+func init() {
+	current.Store(&Levels{Default: slog.LevelInfo})
+}
+
+// CurrentLevels returns the levels of loggers.
+func CurrentLevels() Levels {
+	return *current.Load()
+}
+
+// SetLevels changes levels of all loggers at runtime.
+func SetLevels(levels Levels) {
+	current.Store(&levels)
+}
+
+// handler filters records by the level of its scope.
+type handler struct {
+	slog.Handler
+	scope string
+}
+
+func newHandler(h slog.Handler, scope string) *handler {
+	return &handler{Handler: h, scope: scope}
+}
+
+func (h *handler) withScope(scope string) *handler {
+	return &handler{Handler: h.Handler, scope: scope}
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= current.Load().Of(h.scope) && h.Handler.Enabled(ctx, level)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{Handler: h.Handler.WithAttrs(attrs), scope: h.scope}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{Handler: h.Handler.WithGroup(name), scope: h.scope}
+}
@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    Levels
+		wantErr string
+	}{
+		{name: "empty", want: Levels{Default: slog.LevelInfo, Scopes: map[string]slog.Level{}}},
+		{name: "default", specs: []string{"warn"}, want: Levels{Default: slog.LevelWarn, Scopes: map[string]slog.Level{}}},
+		{
+			name:  "scopes",
+			specs: []string{"error", "storage=debug, compute=INFO"},
+			want:  Levels{Default: slog.LevelError, Scopes: map[string]slog.Level{"storage": slog.LevelDebug, "compute": slog.LevelInfo}},
+		},
+		{name: "invalid", specs: []string{"storage=loud"}, wantErr: `invalid log level "storage=loud"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, err := ParseLevels(tt.specs...)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, levels)
+		})
+	}
+}
+
+func TestLevels_String(t *testing.T) {
+	levels, err := ParseLevels("warn,storage=debug,compute=info")
+	require.NoError(t, err)
+	assert.Equal(t, "warn,compute=info,storage=debug", levels.String())
+	assert.Equal(t, slog.LevelDebug, levels.Of("storage"))
+	assert.Equal(t, slog.LevelWarn, levels.Of("network"))
+}
+
+func TestHandler_ScopeLevels(t *testing.T) {
+	prev := CurrentLevels()
+	defer SetLevels(prev)
+
+	var buf bytes.Buffer
+	root := slog.New(newHandler(slog.NewTextHandler(&buf, defaultOptions()), ""))
+	storage := slog.New(root.Handler().(*handler).withScope("storage")).With("scope", "storage")
+
+	SetLevels(Levels{Default: slog.LevelInfo, Scopes: map[string]slog.Level{"storage": slog.LevelDebug}})
+	root.Debug("hidden")
+	storage.Debug("shown")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "msg=shown scope=storage")
+
+	// levels change without recreating loggers
+	buf.Reset()
+	SetLevels(Levels{Default: slog.LevelDebug})
+	root.Debug("root debug")
+	storage.WithGroup("g").Debug("storage debug")
+	assert.Contains(t, buf.String(), "root debug")
+	assert.Contains(t, buf.String(), "storage debug")
+	assert.False(t, storage.Enabled(context.Background(), slog.LevelDebug-1))
+}
@@ -4,6 +4,8 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"sync/atomic"
@@ -12,14 +14,15 @@ import (
 	"github.com/sattellite/bcdb/config"
 )
 
-var l = slog.New(slog.NewTextHandler(os.Stdout, defaultOptions()))
+var l = slog.New(newHandler(slog.NewTextHandler(os.Stdout, defaultOptions()), ""))
 
 var defaultChanged atomic.Bool
 
 func defaultOptions() *slog.HandlerOptions {
 	return &slog.HandlerOptions{
 		AddSource: false,
-		Level:     slog.LevelInfo,
+		// levels are checked by scopes, see Levels
+		Level: slog.LevelDebug,
 		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
 			if a.Key == slog.TimeKey {
 				return slog.Attr{
@@ -43,16 +46,76 @@ func SetDefault(dl *slog.Logger) *slog.Logger {
 	return l
 }
 
-func WithConfig(c *config.Config) *slog.Logger {
-	opts := defaultOptions()
+// WithConfig creates the logger of the config and sets levels of scopes.
+// Debug of the config lowers the default level to debug. The returned
+// closer closes the log file after the last record.
+func WithConfig(c *config.Config) (*slog.Logger, io.Closer, error) {
+	var cfg config.Log
+	if c != nil {
+		cfg = c.Log
+	}
+
+	levels, err := LevelsFromConfig(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w, err := output(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var h slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		h = slog.NewTextHandler(w, defaultOptions())
+	case "json":
+		h = slog.NewJSONHandler(w, defaultOptions())
+	default:
+		_ = w.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	current.Store(&levels)
+	return slog.New(newHandler(h, "")), w, nil
+}
 
-	if c != nil && c.Debug {
-		opts.Level = slog.LevelDebug
+// LevelsFromConfig parses the level and levels of scopes of the config,
+// debug mode sets the default level to debug.
+func LevelsFromConfig(c *config.Config) (Levels, error) {
+	if c == nil {
+		return ParseLevels()
 	}
+	spec := c.Log.Level
+	if c.Debug {
+		spec = "debug"
+	}
+	return ParseLevels(append([]string{spec}, c.Log.Levels...)...)
+}
+
+// stdStream is stdout or stderr, they are not closed with the logger.
+type stdStream struct {
+	*os.File
+}
 
-	return slog.New(slog.NewTextHandler(os.Stdout, opts))
+func (stdStream) Close() error {
+	return nil
 }
 
+func output(cfg config.Log) (io.WriteCloser, error) {
+	switch cfg.Output {
+	case "", "stdout":
+		return stdStream{os.Stdout}, nil
+	case "stderr":
+		return stdStream{os.Stderr}, nil
+	}
+	return OpenFile(cfg.Output, Rotation{MaxSize: cfg.MaxSize, MaxAge: cfg.MaxAge, MaxFiles: cfg.MaxFiles})
+}
+
+// WithScope returns the logger of the component, its records are
+// filtered by the level of the scope.
 func WithScope(scope string) *slog.Logger {
+	if h, ok := l.Handler().(*handler); ok {
+		return slog.New(h.withScope(scope)).With("scope", scope)
+	}
 	return l.With("scope", scope)
 }
@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+func TestWithConfig(t *testing.T) {
+	prev := CurrentLevels()
+	defer SetLevels(prev)
+
+	path := filepath.Join(t.TempDir(), "bcdb.log")
+	l, closer, err := WithConfig(&config.Config{Log: config.Log{
+		Format: "json",
+		Level:  "warn",
+		Levels: []string{"storage=debug"},
+		Output: path,
+	}})
+	require.NoError(t, err)
+	defer closer.Close()
+	assert.Equal(t, "warn,storage=debug", CurrentLevels().String())
+
+	l.Info("hidden")
+	l.Warn("shown", "key", "value")
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(readFile(t, path)), &record))
+	assert.Equal(t, "shown", record["msg"])
+	assert.Equal(t, "value", record["key"])
+}
+
+func TestWithConfig_Errors(t *testing.T) {
+	prev := CurrentLevels()
+	defer SetLevels(prev)
+
+	_, _, err := WithConfig(&config.Config{Log: config.Log{Format: "xml"}})
+	require.EqualError(t, err, `unknown log format "xml"`)
+	_, _, err = WithConfig(&config.Config{Log: config.Log{Level: "loud"}})
+	require.EqualError(t, err, `invalid log level "loud"`)
+	_, _, err = WithConfig(&config.Config{Log: config.Log{Output: filepath.Join(t.TempDir(), "missing", "bcdb.log")}})
+	require.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultMaxFiles is the number of rotated files kept when unset.
+const DefaultMaxFiles = 5
+
+// rotateRetryInterval is the time after a failed rotation before the next try.
+const rotateRetryInterval = time.Minute
+
+// Rotation rotates a log file larger than MaxSize bytes or older than
+// MaxAge, zero disables the limit. Rotated files are named path.1 for
+// the newest to path.MaxFiles for the oldest, older files are removed.
+type Rotation struct {
+	MaxSize  int64
+	MaxAge   time.Duration
+	MaxFiles int
+}
+
+// File is a log file rotated by size and age.
+type File struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+	size   int64
+	opened time.Time
+	// failed is the time of the last failed rotation
+	failed time.Time
+}
+
+// OpenFile opens the log file for appending.
+func OpenFile(path string, r Rotation) (*File, error) {
+	if r.MaxFiles <= 0 {
+		r.MaxFiles = DefaultMaxFiles
+	}
+	f := &File{path: path, rotation: r, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.f, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+// Write appends the record, rotating the file first when it is due.
+// A record is never split between files. When rotation fails, the record
+// is appended to the file at its path and the error is returned.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.f == nil {
+		// the file was not reopened after the last rotation
+		if err := f.open(); err != nil {
+			return 0, fmt.Errorf("reopen log file: %w", err)
+		}
+	}
+	var rErr error
+	if f.due(len(p)) {
+		if rErr = f.rotate(); rErr != nil {
+			f.failed = f.now()
+			rErr = fmt.Errorf("rotate log file: %w", rErr)
+		}
+		if f.f == nil {
+			return 0, rErr
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(rErr, err)
+}
+
+func (f *File) due(next int) bool {
+	if f.size == 0 || f.now().Sub(f.failed) < rotateRetryInterval {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+int64(next) > f.rotation.MaxSize {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && f.now().Sub(f.opened) >= f.rotation.MaxAge
+}
+
+// rotate shifts rotated files, dropping the oldest, and reopens the file.
+// The file is reopened when shifting fails too, and records are appended
+// to it until rotation succeeds.
+func (f *File) rotate() error {
+	err := f.f.Close()
+	f.f = nil
+	if err == nil {
+		err = f.shift()
+	}
+	if oErr := f.open(); oErr != nil {
+		return errors.Join(err, oErr)
+	}
+	return err
+}
+
+func (f *File) shift() error {
+	max := f.rotation.MaxFiles
+	if err := os.Remove(f.rotated(max)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := max - 1; i >= 1; i-- {
+		if err := os.Rename(f.rotated(i), f.rotated(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.rotated(1))
+}
+
+func (f *File) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
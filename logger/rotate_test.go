@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFile_RotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bcdb.log")
+	f, err := OpenFile(path, Rotation{MaxSize: 10, MaxFiles: 2})
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "fourth\n", readFile(t, path))
+	assert.Equal(t, "third\n", readFile(t, path+".1"))
+	assert.Equal(t, "second\n", readFile(t, path+".2"))
+	assert.NoFileExists(t, path+".3", "the oldest file is removed")
+}
+
+func TestFile_RotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bcdb.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+	f, err := OpenFile(path, Rotation{MaxAge: time.Hour})
+	require.NoError(t, err)
+	defer f.Close()
+
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	_, err = f.Write([]byte("appended\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "old\nappended\n", readFile(t, path))
+
+	now = now.Add(2 * time.Hour)
+	_, err = f.Write([]byte("new\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", readFile(t, path))
+	assert.Equal(t, "old\nappended\n", readFile(t, path+".1"))
+}
+
+func TestFile_RotateFailed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bcdb.log")
+	f, err := OpenFile(path, Rotation{MaxSize: 10, MaxFiles: 1})
+	require.NoError(t, err)
+	defer f.Close()
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	_, err = f.Write([]byte("first\n"))
+	require.NoError(t, err)
+	// the rotated file can not be replaced by the file
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "dir"), 0o755))
+
+	// records are appended to the file while rotation fails
+	n, err := f.Write([]byte("second\n"))
+	require.ErrorContains(t, err, "rotate log file")
+	assert.Equal(t, 7, n)
+	_, err = f.Write([]byte("third\n"))
+	require.NoError(t, err, "rotation is not retried right away")
+	assert.Equal(t, "first\nsecond\nthird\n", readFile(t, path))
+
+	require.NoError(t, os.RemoveAll(path+".1"))
+	now = now.Add(rotateRetryInterval)
+	_, err = f.Write([]byte("fourth\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "fourth\n", readFile(t, path))
+	assert.Equal(t, "first\nsecond\nthird\n", readFile(t, path+".1"))
+
+	require.NoError(t, f.Close())
+	_, err = f.Write([]byte("closed\n"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
@@ -0,0 +1,57 @@
+package membership
+
+import (
+	"math"
+	"slices"
+)
+
+type broadcast struct {
+	update    update
+	transmits int
+}
+
+// broadcastQueue keeps updates to piggyback on outgoing messages.
+// Only the latest update about a member is kept and every update
+// is sent a limited number of times, the least sent go first.
+type broadcastQueue struct {
+	items map[string]*broadcast
+}
+
+func newBroadcastQueue() *broadcastQueue {
+	return &broadcastQueue{items: make(map[string]*broadcast)}
+}
+
+func (q *broadcastQueue) add(u update) {
+	q.items[u.ID] = &broadcast{update: u}
+}
+
+// take returns up to limit updates and drops the ones sent maxTransmits times.
+func (q *broadcastQueue) take(limit, maxTransmits int) []update {
+	if len(q.items) == 0 || limit <= 0 {
+		return nil
+	}
+
+	items := make([]*broadcast, 0, len(q.items))
+	for _, b := range q.items {
+		items = append(items, b)
+	}
+	slices.SortFunc(items, func(a, b *broadcast) int {
+		return a.transmits - b.transmits
+	})
+
+	updates := make([]update, 0, min(limit, len(items)))
+	for _, b := range items[:min(limit, len(items))] {
+		updates = append(updates, b.update)
+		b.transmits++
+		if b.transmits >= maxTransmits {
+			delete(q.items, b.update.ID)
+		}
+	}
+	return updates
+}
+
+// retransmitLimit scales the number of transmissions with the cluster size,
+// so an update reaches every member with high probability.
+func retransmitLimit(mult, members int) int {
+	return mult * int(math.Ceil(math.Log10(float64(members+1))))
+}
@@ -0,0 +1,36 @@
+package membership
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcastQueue(t *testing.T) {
+	q := newBroadcastQueue()
+	assert.Empty(t, q.take(10, 2), "empty queue")
+
+	q.add(update{ID: "a", State: StateAlive})
+	q.add(update{ID: "b", State: StateAlive})
+	// newer update about the same member replaces the older one
+	q.add(update{ID: "a", State: StateSuspect})
+
+	first := q.take(1, 2)
+	assert.Len(t, first, 1)
+
+	// the least sent update goes next
+	second := q.take(1, 2)
+	assert.Len(t, second, 1)
+	assert.NotEqual(t, first[0].ID, second[0].ID)
+
+	all := q.take(10, 2)
+	assert.ElementsMatch(t, []update{{ID: "a", State: StateSuspect}, {ID: "b", State: StateAlive}}, all)
+	assert.Empty(t, q.take(10, 2), "updates are dropped after max transmits")
+}
+
+func TestRetransmitLimit(t *testing.T) {
+	assert.Equal(t, 4, retransmitLimit(4, 1))
+	assert.Equal(t, 4, retransmitLimit(4, 9))
+	assert.Equal(t, 8, retransmitLimit(4, 10))
+	assert.Equal(t, 12, retransmitLimit(4, 100))
+}
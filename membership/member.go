@@ -0,0 +1,76 @@
+package membership
+
+// State of a member as seen by the current node.
+type State int
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+	StateLeft
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return "unknown"
+}
+
+// gone reports whether the member is not a part of the cluster anymore.
+func (s State) gone() bool {
+	return s == StateDead || s == StateLeft
+}
+
+// Member of the cluster. Incarnation is increased by the member itself
+// to refute suspicions, so newer information always wins.
+type Member struct {
+	ID          string
+	Addr        string
+	State       State
+	Incarnation uint64
+}
+
+// EventType describes a change of the membership.
+type EventType int
+
+const (
+	// EventJoin is sent when a new member is discovered or a dead one rejoins.
+	EventJoin EventType = iota
+	// EventSuspect is sent when a member stops answering probes.
+	EventSuspect
+	// EventAlive is sent when a suspected member refutes the suspicion.
+	EventAlive
+	// EventDead is sent when a suspicion is confirmed.
+	EventDead
+	// EventLeave is sent when a member leaves gracefully.
+	EventLeave
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventJoin:
+		return "join"
+	case EventSuspect:
+		return "suspect"
+	case EventAlive:
+		return "alive"
+	case EventDead:
+		return "dead"
+	case EventLeave:
+		return "leave"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Type   EventType
+	Member Member
+}
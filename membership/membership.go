@@ -0,0 +1,526 @@
+// Package membership implements SWIM-style cluster membership.
+//
+// Every protocol period a node probes one member with a ping. If the member
+// does not answer in time, other members are asked to probe it indirectly,
+// and if they fail too the member becomes suspected. A suspected member that
+// does not refute the suspicion during the suspicion timeout is declared dead.
+// Membership changes are gossiped by piggybacking them on protocol messages.
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrNoSeeds = errors.New("no seed answered")
+
+type Config struct {
+	// ID is a unique name of the current node.
+	ID string
+	// AdvertiseAddr is the address announced to other members.
+	// Transport address is used if empty.
+	AdvertiseAddr string
+	// ProbeInterval is the length of a protocol period.
+	ProbeInterval time.Duration
+	// ProbeTimeout is the time to wait for a direct ack.
+	ProbeTimeout time.Duration
+	// SuspicionTimeout is the time a suspected member has to refute the suspicion.
+	SuspicionTimeout time.Duration
+	// IndirectChecks is the number of members asked to probe a silent member.
+	IndirectChecks int
+	// RetransmitMult scales the number of times an update is gossiped.
+	RetransmitMult int
+	// MaxPiggyback limits the number of updates in a single message.
+	MaxPiggyback int
+}
+
+func (c Config) withDefaults() Config {
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = time.Second
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = c.ProbeInterval / 2
+	}
+	if c.SuspicionTimeout <= 0 {
+		c.SuspicionTimeout = 5 * c.ProbeInterval
+	}
+	if c.IndirectChecks <= 0 {
+		c.IndirectChecks = 3
+	}
+	if c.RetransmitMult <= 0 {
+		c.RetransmitMult = 4
+	}
+	if c.MaxPiggyback <= 0 {
+		c.MaxPiggyback = 16
+	}
+	return c
+}
+
+type memberState struct {
+	Member
+	suspectedAt time.Time
+}
+
+type Memberlist struct {
+	logger    *slog.Logger
+	cfg       Config
+	transport Transport
+
+	mu          sync.Mutex
+	self        Member
+	leaving     bool
+	members     map[string]*memberState
+	broadcasts  *broadcastQueue
+	probeOrder  []string
+	seq         uint64
+	acks        map[uint64]chan struct{}
+	subscribers map[int]chan Event
+	lastSub     int
+}
+
+func New(l *slog.Logger, cfg Config, t Transport) (*Memberlist, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if t == nil {
+		return nil, errors.New("transport is required")
+	}
+	if cfg.ID == "" {
+		return nil, errors.New("node id is required")
+	}
+
+	cfg = cfg.withDefaults()
+	addr := cfg.AdvertiseAddr
+	if addr == "" {
+		addr = t.Addr()
+	}
+
+	return &Memberlist{
+		logger:      l.With("module", "membership", "node", cfg.ID),
+		cfg:         cfg,
+		transport:   t,
+		self:        Member{ID: cfg.ID, Addr: addr, State: StateAlive},
+		members:     make(map[string]*memberState),
+		broadcasts:  newBroadcastQueue(),
+		acks:        make(map[uint64]chan struct{}),
+		subscribers: make(map[int]chan Event),
+	}, nil
+}
+
+// Run probes members and handles messages until the context is canceled.
+// The transport is closed on return.
+func (m *Memberlist) Run(ctx context.Context) {
+	m.logger.Info("membership started", slog.String("addr", m.self.Addr))
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for pkt := range m.transport.Packets() {
+			m.handle(pkt)
+		}
+	}()
+
+	ticker := time.NewTicker(m.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = m.transport.Close()
+			<-received
+			m.closeSubscribers()
+			m.logger.Info("membership stopped")
+			return
+		case <-ticker.C:
+			m.probe(ctx)
+			m.reapSuspects()
+		}
+	}
+}
+
+// Join announces the current node to the seeds and fetches the member list
+// from the first one that answers. Run must be started before.
+func (m *Memberlist) Join(ctx context.Context, seeds ...string) error {
+	seq, acked := m.expectAck()
+	defer m.cancelAck(seq)
+
+	ticker := time.NewTicker(m.cfg.ProbeTimeout)
+	defer ticker.Stop()
+	for {
+		for _, seed := range seeds {
+			if seed == m.self.Addr {
+				continue
+			}
+			m.send(seed, &message{Type: messageJoin, Seq: seq})
+		}
+
+		select {
+		case <-acked:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrNoSeeds, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Leave tells other members that the current node leaves the cluster
+// and waits until the news is gossiped or the context is canceled.
+func (m *Memberlist) Leave(ctx context.Context) {
+	m.mu.Lock()
+	m.leaving = true
+	m.self.State = StateLeft
+	m.broadcasts.add(update(m.self))
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(m.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		m.mu.Lock()
+		_, pending := m.broadcasts.items[m.self.ID]
+		m.mu.Unlock()
+		if !pending {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Members returns alive and suspected members including the current node.
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := make([]Member, 0, len(m.members)+1)
+	if !m.self.State.gone() {
+		members = append(members, m.self)
+	}
+	for _, ms := range m.members {
+		if !ms.State.gone() {
+			members = append(members, ms.Member)
+		}
+	}
+	slices.SortFunc(members, func(a, b Member) int {
+		switch {
+		case a.ID < b.ID:
+			return -1
+		case a.ID > b.ID:
+			return 1
+		}
+		return 0
+	})
+	return members
+}
+
+// Subscribe returns a channel of membership events and a function to unsubscribe.
+// Events are dropped if the subscriber does not keep up with the buffer of the given size.
+// The channel is closed on unsubscribe or when Run returns.
+func (m *Memberlist) Subscribe(size int) (<-chan Event, func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastSub++
+	id := m.lastSub
+	ch := make(chan Event, size)
+	m.subscribers[id] = ch
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if sub, ok := m.subscribers[id]; ok {
+			delete(m.subscribers, id)
+			close(sub)
+		}
+	}
+}
+
+func (m *Memberlist) closeSubscribers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, ch := range m.subscribers {
+		delete(m.subscribers, id)
+		close(ch)
+	}
+}
+
+// emit sends the event to subscribers. Caller must hold the lock.
+func (m *Memberlist) emit(t EventType, member Member) {
+	m.logger.Info("membership changed", slog.String("event", t.String()), slog.String("member", member.ID))
+	for _, ch := range m.subscribers {
+		select {
+		case ch <- Event{Type: t, Member: member}:
+		default:
+			m.logger.Warn("event dropped, subscriber is too slow", slog.String("event", t.String()))
+		}
+	}
+}
+
+// probe runs a single protocol period against the next member.
+func (m *Memberlist) probe(ctx context.Context) {
+	target, ok := m.nextTarget()
+	if !ok {
+		return
+	}
+
+	seq, acked := m.expectAck()
+	defer m.cancelAck(seq)
+	m.send(target.Addr, &message{Type: messagePing, Seq: seq})
+
+	if m.wait(ctx, acked, m.cfg.ProbeTimeout) {
+		return
+	}
+
+	for _, peer := range m.randomPeers(m.cfg.IndirectChecks, target.ID) {
+		m.send(peer.Addr, &message{Type: messagePingReq, Seq: seq, Target: target.Addr})
+	}
+
+	if m.wait(ctx, acked, max(m.cfg.ProbeInterval-m.cfg.ProbeTimeout, m.cfg.ProbeTimeout)) {
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	m.apply(update{ID: target.ID, Addr: target.Addr, State: StateSuspect, Incarnation: target.Incarnation})
+}
+
+func (m *Memberlist) wait(ctx context.Context, acked <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-acked:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nextTarget walks members in a random order, reshuffling after every round.
+func (m *Memberlist) nextTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for range 2 {
+		for len(m.probeOrder) > 0 {
+			id := m.probeOrder[0]
+			m.probeOrder = m.probeOrder[1:]
+			if ms, ok := m.members[id]; ok && !ms.State.gone() {
+				return ms.Member, true
+			}
+		}
+		for id, ms := range m.members {
+			if !ms.State.gone() {
+				m.probeOrder = append(m.probeOrder, id)
+			}
+		}
+		rand.Shuffle(len(m.probeOrder), func(i, j int) {
+			m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+		})
+	}
+	return Member{}, false
+}
+
+// randomPeers returns up to n random alive members except the given one.
+func (m *Memberlist) randomPeers(n int, except string) []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peers := make([]Member, 0, len(m.members))
+	for id, ms := range m.members {
+		if id != except && ms.State == StateAlive {
+			peers = append(peers, ms.Member)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	return peers[:min(n, len(peers))]
+}
+
+// reapSuspects declares dead the members that did not refute suspicion in time.
+func (m *Memberlist) reapSuspects() {
+	m.mu.Lock()
+	var dead []update
+	for _, ms := range m.members {
+		if ms.State == StateSuspect && time.Since(ms.suspectedAt) >= m.cfg.SuspicionTimeout {
+			dead = append(dead, update{ID: ms.ID, Addr: ms.Addr, State: StateDead, Incarnation: ms.Incarnation})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, u := range dead {
+		m.apply(u)
+	}
+}
+
+func (m *Memberlist) expectAck() (uint64, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	ch := make(chan struct{})
+	m.acks[m.seq] = ch
+	return m.seq, ch
+}
+
+func (m *Memberlist) resolveAck(seq uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ch, ok := m.acks[seq]; ok {
+		delete(m.acks, seq)
+		close(ch)
+	}
+}
+
+func (m *Memberlist) cancelAck(seq uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.acks, seq)
+}
+
+func (m *Memberlist) handle(pkt Packet) {
+	msg, err := decode(pkt.Data)
+	if err != nil {
+		m.logger.Debug("invalid message", slog.String("from", pkt.From), slog.Any("error", err))
+		return
+	}
+
+	m.apply(msg.From)
+	for _, u := range msg.Updates {
+		m.apply(u)
+	}
+
+	switch msg.Type {
+	case messagePing:
+		m.send(pkt.From, &message{Type: messageAck, Seq: msg.Seq})
+	case messageAck, messageJoinAck:
+		m.resolveAck(msg.Seq)
+	case messagePingReq:
+		go m.probeFor(pkt.From, msg.Seq, msg.Target)
+	case messageJoin:
+		m.send(pkt.From, &message{Type: messageJoinAck, Seq: msg.Seq, Updates: m.snapshot()})
+	}
+}
+
+// probeFor pings the target on behalf of the requester and forwards the ack.
+func (m *Memberlist) probeFor(requester string, requesterSeq uint64, target string) {
+	seq, acked := m.expectAck()
+	defer m.cancelAck(seq)
+	m.send(target, &message{Type: messagePing, Seq: seq})
+
+	if m.wait(context.Background(), acked, m.cfg.ProbeTimeout) {
+		m.send(requester, &message{Type: messageAck, Seq: requesterSeq})
+	}
+}
+
+// snapshot returns the full state of the cluster for joining members.
+func (m *Memberlist) snapshot() []update {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updates := make([]update, 0, len(m.members)+1)
+	updates = append(updates, update(m.self))
+	for _, ms := range m.members {
+		updates = append(updates, update(ms.Member))
+	}
+	return updates
+}
+
+// send piggybacks pending updates on the message and sends it.
+func (m *Memberlist) send(addr string, msg *message) {
+	m.mu.Lock()
+	msg.From = update(m.self)
+	limit := retransmitLimit(m.cfg.RetransmitMult, len(m.members)+1)
+	msg.Updates = append(msg.Updates, m.broadcasts.take(m.cfg.MaxPiggyback, limit)...)
+	m.mu.Unlock()
+
+	data, err := encode(msg)
+	if err != nil {
+		m.logger.Error("failed to encode message", slog.Any("error", err))
+		return
+	}
+	if sErr := m.transport.Send(addr, data); sErr != nil {
+		m.logger.Debug("failed to send message", slog.String("to", addr), slog.Any("error", sErr))
+	}
+}
+
+// apply merges gossip about a member into the local state.
+// Accepted updates are gossiped further.
+func (m *Memberlist) apply(u update) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u.ID == m.self.ID {
+		m.refute(u)
+		return
+	}
+
+	ms, known := m.members[u.ID]
+	if !known {
+		// news about unknown members that are gone are not interesting
+		if u.State.gone() {
+			return
+		}
+		ms = &memberState{Member: u.member()}
+		if u.State == StateSuspect {
+			ms.suspectedAt = time.Now()
+		}
+		m.members[u.ID] = ms
+		m.broadcasts.add(u)
+		m.emit(EventJoin, ms.Member)
+		return
+	}
+
+	prev := ms.State
+	switch u.State {
+	case StateAlive:
+		if u.Incarnation <= ms.Incarnation {
+			return
+		}
+	case StateSuspect:
+		if prev.gone() || u.Incarnation < ms.Incarnation || (prev == StateSuspect && u.Incarnation == ms.Incarnation) {
+			return
+		}
+	case StateDead, StateLeft:
+		if prev.gone() || u.Incarnation < ms.Incarnation {
+			return
+		}
+	}
+
+	ms.Member = u.member()
+	m.broadcasts.add(u)
+
+	switch {
+	case u.State == StateAlive && prev.gone():
+		m.emit(EventJoin, ms.Member)
+	case u.State == StateAlive && prev == StateSuspect:
+		m.emit(EventAlive, ms.Member)
+	case u.State == StateSuspect && prev != StateSuspect:
+		ms.suspectedAt = time.Now()
+		m.emit(EventSuspect, ms.Member)
+	case u.State == StateDead:
+		m.emit(EventDead, ms.Member)
+	case u.State == StateLeft:
+		m.emit(EventLeave, ms.Member)
+	}
+}
+
+// refute answers suspicions about the current node with a newer incarnation.
+// Caller must hold the lock.
+func (m *Memberlist) refute(u update) {
+	if m.leaving || u.State == StateAlive || u.Incarnation < m.self.Incarnation {
+		return
+	}
+	m.self.Incarnation = u.Incarnation + 1
+	m.broadcasts.add(update(m.self))
+	m.logger.Info("refuted suspicion", slog.String("state", u.State.String()), slog.Uint64("incarnation", m.self.Incarnation))
+}
@@ -0,0 +1,317 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var testConfig = Config{
+	ProbeInterval:    30 * time.Millisecond,
+	ProbeTimeout:     10 * time.Millisecond,
+	SuspicionTimeout: 150 * time.Millisecond,
+}
+
+const waitFor = 5 * time.Second
+
+// simNetwork delivers packets between in-process transports
+// and can cut links between them.
+type simNetwork struct {
+	mu    sync.Mutex
+	nodes map[string]*simTransport
+	cut   map[[2]string]bool
+}
+
+func newSimNetwork() *simNetwork {
+	return &simNetwork{
+		nodes: make(map[string]*simTransport),
+		cut:   make(map[[2]string]bool),
+	}
+}
+
+func (n *simNetwork) transport(addr string) *simTransport {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	t := &simTransport{net: n, addr: addr, packets: make(chan Packet, 256)}
+	n.nodes[addr] = t
+	return t
+}
+
+// cutLink drops packets between the addresses in both directions.
+func (n *simNetwork) cutLink(a, b string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cut[[2]string{a, b}] = true
+	n.cut[[2]string{b, a}] = true
+}
+
+func (n *simNetwork) deliver(from, to string, data []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	t, ok := n.nodes[to]
+	if !ok || t.closed || n.cut[[2]string{from, to}] {
+		return
+	}
+	select {
+	case t.packets <- Packet{From: from, Data: data}:
+	default:
+	}
+}
+
+type simTransport struct {
+	net     *simNetwork
+	addr    string
+	packets chan Packet
+	closed  bool
+}
+
+func (t *simTransport) Addr() string {
+	return t.addr
+}
+
+func (t *simTransport) Send(addr string, data []byte) error {
+	t.net.deliver(t.addr, addr, data)
+	return nil
+}
+
+func (t *simTransport) Packets() <-chan Packet {
+	return t.packets
+}
+
+func (t *simTransport) Close() error {
+	t.net.mu.Lock()
+	defer t.net.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.packets)
+	}
+	return nil
+}
+
+type testNode struct {
+	list *Memberlist
+	stop func()
+}
+
+func startNode(t *testing.T, id string, tr Transport, seeds ...string) *testNode {
+	t.Helper()
+	cfg := testConfig
+	cfg.ID = id
+	list, err := New(noopLogger, cfg, tr)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		list.Run(ctx)
+	}()
+	stop := sync.OnceFunc(func() {
+		cancel()
+		<-stopped
+	})
+	t.Cleanup(stop)
+
+	if len(seeds) > 0 {
+		jctx, jcancel := context.WithTimeout(ctx, waitFor)
+		defer jcancel()
+		require.NoError(t, list.Join(jctx, seeds...))
+	}
+	return &testNode{list: list, stop: stop}
+}
+
+func startSimCluster(t *testing.T, net *simNetwork, size int) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, 0, size)
+	for i := range size {
+		addr := fmt.Sprintf("node-%d", i)
+		if i == 0 {
+			nodes = append(nodes, startNode(t, addr, net.transport(addr)))
+			continue
+		}
+		nodes = append(nodes, startNode(t, addr, net.transport(addr), "node-0"))
+	}
+	return nodes
+}
+
+func aliveCount(m *Memberlist) int {
+	n := 0
+	for _, member := range m.Members() {
+		if member.State == StateAlive {
+			n++
+		}
+	}
+	return n
+}
+
+func waitConverged(t *testing.T, nodes []*testNode, size int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if aliveCount(n.list) != size {
+				return false
+			}
+		}
+		return true
+	}, waitFor, 10*time.Millisecond, "cluster did not converge")
+}
+
+func waitEvent(t *testing.T, events <-chan Event, typ EventType, id string) {
+	t.Helper()
+	timeout := time.After(waitFor)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == typ && e.Member.ID == id {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no %s event for %s", typ, id)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tr := newSimNetwork().transport("a")
+	_, err := New(nil, Config{ID: "a"}, tr)
+	require.Error(t, err)
+	_, err = New(noopLogger, Config{ID: "a"}, nil)
+	require.Error(t, err)
+	_, err = New(noopLogger, Config{}, tr)
+	require.Error(t, err)
+
+	m, err := New(noopLogger, Config{ID: "a"}, tr)
+	require.NoError(t, err)
+	assert.Equal(t, []Member{{ID: "a", Addr: "a", State: StateAlive}}, m.Members())
+}
+
+func TestJoinConverges(t *testing.T) {
+	const size = 16
+	nodes := startSimCluster(t, newSimNetwork(), size)
+	waitConverged(t, nodes, size)
+}
+
+func TestJoinWithoutSeeds(t *testing.T) {
+	net := newSimNetwork()
+	n := startNode(t, "a", net.transport("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, n.list.Join(ctx, "missing"), ErrNoSeeds)
+}
+
+func TestFailureDetection(t *testing.T) {
+	const size = 8
+	nodes := startSimCluster(t, newSimNetwork(), size)
+	waitConverged(t, nodes, size)
+
+	events, unsubscribe := nodes[0].list.Subscribe(64)
+	defer unsubscribe()
+
+	nodes[size-1].stop()
+	waitEvent(t, events, EventSuspect, "node-7")
+	waitEvent(t, events, EventDead, "node-7")
+	waitConverged(t, nodes[:size-1], size-1)
+}
+
+func TestIndirectProbe(t *testing.T) {
+	net := newSimNetwork()
+	nodes := startSimCluster(t, net, 4)
+	waitConverged(t, nodes, 4)
+
+	events, unsubscribe := nodes[1].list.Subscribe(64)
+	defer unsubscribe()
+
+	// node-1 can't reach node-2 directly, but other nodes probe it on request
+	net.cutLink("node-1", "node-2")
+	time.Sleep(20 * testConfig.ProbeInterval)
+
+	for {
+		select {
+		case e := <-events:
+			assert.NotEqual(t, EventDead, e.Type, "member must not be declared dead: %v", e)
+			continue
+		default:
+		}
+		break
+	}
+	waitConverged(t, nodes, 4)
+}
+
+func TestRefuteSuspicion(t *testing.T) {
+	nodes := startSimCluster(t, newSimNetwork(), 3)
+	waitConverged(t, nodes, 3)
+
+	events, unsubscribe := nodes[0].list.Subscribe(64)
+	defer unsubscribe()
+
+	// a false suspicion is gossiped and refuted by the suspected node
+	nodes[0].list.apply(update{ID: "node-1", Addr: "node-1", State: StateSuspect})
+	waitEvent(t, events, EventSuspect, "node-1")
+	waitEvent(t, events, EventAlive, "node-1")
+
+	for _, m := range nodes[0].list.Members() {
+		if m.ID == "node-1" {
+			assert.Positive(t, m.Incarnation)
+		}
+	}
+}
+
+func TestLeave(t *testing.T) {
+	nodes := startSimCluster(t, newSimNetwork(), 4)
+	waitConverged(t, nodes, 4)
+
+	events, unsubscribe := nodes[0].list.Subscribe(64)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitFor)
+	defer cancel()
+	nodes[3].list.Leave(ctx)
+	nodes[3].stop()
+
+	waitEvent(t, events, EventLeave, "node-3")
+	waitConverged(t, nodes[:3], 3)
+}
+
+func TestSubscribeClosedOnStop(t *testing.T) {
+	n := startNode(t, "a", newSimNetwork().transport("a"))
+	events, unsubscribe := n.list.Subscribe(1)
+	defer unsubscribe()
+
+	n.stop()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "events channel should be closed")
+	case <-time.After(waitFor):
+		t.Fatal("events channel is not closed")
+	}
+}
+
+func TestUDPCluster(t *testing.T) {
+	const size = 5
+	nodes := make([]*testNode, 0, size)
+	var seed string
+	for i := range size {
+		tr, err := NewUDPTransport("127.0.0.1:0")
+		require.NoError(t, err)
+		if i == 0 {
+			seed = tr.Addr()
+			nodes = append(nodes, startNode(t, fmt.Sprintf("udp-%d", i), tr))
+			continue
+		}
+		nodes = append(nodes, startNode(t, fmt.Sprintf("udp-%d", i), tr, seed))
+	}
+	waitConverged(t, nodes, size)
+
+	nodes[size-1].stop()
+	waitConverged(t, nodes[:size-1], size-1)
+}
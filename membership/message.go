@@ -0,0 +1,52 @@
+package membership
+
+import (
+	"encoding/json"
+)
+
+type messageType int
+
+const (
+	messagePing messageType = iota
+	messageAck
+	messagePingReq
+	messageJoin
+	messageJoinAck
+)
+
+// message is a single UDP datagram exchanged between members.
+// Every message carries the state of the sender, so members that
+// missed the gossip about it learn it directly, and piggybacks
+// recent membership updates.
+type message struct {
+	Type messageType `json:"t"`
+	Seq  uint64      `json:"s"`
+	From update      `json:"f"`
+	// Target is the address to probe for ping-req messages.
+	Target  string   `json:"a,omitempty"`
+	Updates []update `json:"u,omitempty"`
+}
+
+// update is a piece of gossip about a single member.
+type update struct {
+	ID          string `json:"id"`
+	Addr        string `json:"addr"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"inc"`
+}
+
+func (u update) member() Member {
+	return Member(u)
+}
+
+func encode(msg *message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func decode(data []byte) (*message, error) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
@@ -0,0 +1,84 @@
+package membership
+
+import (
+	"errors"
+	"net"
+)
+
+// maxPacketSize is the largest UDP payload.
+const maxPacketSize = 65507
+
+// Packet is a datagram received from the address.
+type Packet struct {
+	From string
+	Data []byte
+}
+
+// Transport delivers datagrams between members.
+// It is an interface so tests can simulate lossy networks in process.
+type Transport interface {
+	// Addr returns the address other members use to reach this one.
+	Addr() string
+	// Send sends a datagram. Delivery is not guaranteed.
+	Send(addr string, data []byte) error
+	// Packets returns received datagrams. It is closed by Close.
+	Packets() <-chan Packet
+	Close() error
+}
+
+type UDPTransport struct {
+	conn    net.PacketConn
+	packets chan Packet
+}
+
+func NewUDPTransport(address string) (*UDPTransport, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &UDPTransport{
+		conn:    conn,
+		packets: make(chan Packet, 64),
+	}
+	go t.read()
+	return t, nil
+}
+
+func (t *UDPTransport) read() {
+	defer close(t.packets)
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		t.packets <- Packet{From: addr.String(), Data: data}
+	}
+}
+
+func (t *UDPTransport) Addr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *UDPTransport) Send(address string, data []byte) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(data, addr)
+	return err
+}
+
+func (t *UDPTransport) Packets() <-chan Packet {
+	return t.packets
+}
+
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,150 @@
+// Package metrics collects counters, gauges and histograms and exposes
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the type of a metric family.
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// Label is a name and a value of a label of a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value of a family. Suffix is added to the name of the family,
+// as "_bucket", "_sum" and "_count" of histograms.
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named group of samples of the same type.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Collector produces families of metrics on every scrape. Components
+// implement it to expose their own metrics and are added with Register.
+type Collector interface {
+	Collect() []Family
+}
+
+// Registry holds collectors and writes their metrics.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds collectors. Names of families must be unique across collectors.
+func (r *Registry) Register(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, cs...)
+}
+
+// Gather collects families of all collectors ordered by name.
+func (r *Registry) Gather() []Family {
+	r.mu.RLock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.RUnlock()
+
+	var families []Family
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	slices.SortStableFunc(families, func(a, b Family) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return families
+}
+
+// WriteText writes the families in the text exposition format.
+func WriteText(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name + s.Suffix)
+			writeLabels(bw, s.Labels)
+			bw.WriteString(" " + formatValue(s.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteText(w, r.Gather())
+	})
+}
+
+func writeLabels(w *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	w.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(l.Name + `="` + escapeLabel(l.Value) + `"`)
+	}
+	w.WriteByte('}')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gather(t *testing.T, cs ...Collector) string {
+	t.Helper()
+	reg := NewRegistry()
+	reg.Register(cs...)
+	var b strings.Builder
+	require.NoError(t, WriteText(&b, reg.Gather()))
+	return b.String()
+}
+
+func TestWriteText(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Requests.", "method", "code")
+	requests.With("get", "200").Add(2)
+	requests.With("del", "500").Inc()
+	temp := NewGaugeVec("temperature", "Line one\nline \\two.")
+	temp.With().Set(-1.5)
+	latency := NewHistogramVec("latency_seconds", "", []float64{1, 0.1}, "path")
+	latency.With(`"quoted"`).Observe(0.05)
+	latency.With(`"quoted"`).Observe(0.5)
+	latency.With(`"quoted"`).Observe(2)
+
+	assert.Equal(t, `# TYPE latency_seconds histogram
+latency_seconds_bucket{path="\"quoted\"",le="0.1"} 1
+latency_seconds_bucket{path="\"quoted\"",le="1"} 2
+latency_seconds_bucket{path="\"quoted\"",le="+Inf"} 3
+latency_seconds_sum{path="\"quoted\""} 2.55
+latency_seconds_count{path="\"quoted\""} 3
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{method="del",code="500"} 1
+requests_total{method="get",code="200"} 2
+# HELP temperature Line one\nline \\two.
+# TYPE temperature gauge
+temperature -1.5
+`, gather(t, temp, requests, latency))
+}
+
+func TestFuncCollectors(t *testing.T) {
+	value := 3.0
+	out := gather(t,
+		NewGaugeFunc("queue_length", "Queued items.", func() float64 { return value }),
+		NewCounterFunc("flushes_total", "Flushes.", func() float64 { return value * 2 }),
+	)
+	assert.Contains(t, out, "# TYPE queue_length gauge\nqueue_length 3\n")
+	assert.Contains(t, out, "# TYPE flushes_total counter\nflushes_total 6\n")
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	c := NewCounterVec("hits_total", "", "shard")
+	h := NewHistogramVec("size", "", nil)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				c.With("a").Inc()
+				h.With().Observe(0.001)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Contains(t, gather(t, c), `hits_total{shard="a"} 8000`)
+	assert.Contains(t, gather(t, h), "size_count 8000")
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	g := NewGaugeVec("up", "")
+	g.With().Set(1)
+	reg := NewRegistry()
+	reg.Register(g)
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	assert.Equal(t, "# TYPE up gauge\nup 1\n", rec.Body.String())
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 0, want: "0"},
+		{value: 1e21, want: "1e+21"},
+		{value: 0.25, want: "0.25"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, formatValue(tt.value))
+	}
+}
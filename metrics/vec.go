@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are upper bounds of latency histograms in seconds.
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// atomicFloat is a float64 updated atomically.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter is a value that only grows.
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add adds a non-negative value, negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v > 0 {
+		c.v.add(v)
+	}
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.set(v)
+}
+
+func (g *Gauge) Add(v float64) {
+	g.v.add(v)
+}
+
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Histogram counts observations by buckets of upper bounds.
+type Histogram struct {
+	bounds []float64
+	// counts are not cumulative, the last one counts values over all bounds
+	counts []atomic.Uint64
+	sum    atomicFloat
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+// Observe adds the value to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.bounds, v)
+	h.counts[i].Add(1)
+	h.sum.add(v)
+}
+
+func (h *Histogram) samples(labels []Label) []Sample {
+	cumulative := make([]uint64, len(h.bounds))
+	var count uint64
+	for i := range h.bounds {
+		count += h.counts[i].Load()
+		cumulative[i] = count
+	}
+	count += h.counts[len(h.bounds)].Load()
+	return HistogramSamples(labels, h.bounds, cumulative, count, h.sum.load())
+}
+
+// HistogramSamples returns samples of a histogram with cumulative counts of
+// buckets by their upper bounds, the total count and the sum of observations.
+// It lets collectors expose histograms measured by themselves.
+func HistogramSamples(labels []Label, bounds []float64, cumulative []uint64, count uint64, sum float64) []Sample {
+	samples := make([]Sample, 0, len(bounds)+3)
+	for i, bound := range bounds {
+		samples = append(samples, Sample{
+			Suffix: "_bucket",
+			Labels: append(slices.Clip(labels), Label{Name: "le", Value: formatValue(bound)}),
+			Value:  float64(cumulative[i]),
+		})
+	}
+	return append(samples,
+		Sample{Suffix: "_bucket", Labels: append(slices.Clip(labels), Label{Name: "le", Value: "+Inf"}), Value: float64(count)},
+		Sample{Suffix: "_sum", Labels: labels, Value: sum},
+		Sample{Suffix: "_count", Labels: labels, Value: float64(count)},
+	)
+}
+
+// vec holds metrics of a family by values of its labels.
+type vec[T any] struct {
+	name   string
+	help   string
+	typ    Type
+	labels []string
+	create func() *T
+
+	mu       sync.RWMutex
+	children map[string]*child[T]
+}
+
+type child[T any] struct {
+	labels []Label
+	metric *T
+}
+
+func newVec[T any](name, help string, typ Type, labels []string, create func() *T) *vec[T] {
+	return &vec[T]{name: name, help: help, typ: typ, labels: labels, create: create, children: make(map[string]*child[T])}
+}
+
+// with returns the metric of the label values, missing values are empty.
+func (v *vec[T]) with(values []string) *T {
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.metric
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.children[key]; ok {
+		return c.metric
+	}
+	labels := make([]Label, len(v.labels))
+	for i, name := range v.labels {
+		labels[i] = Label{Name: name}
+		if i < len(values) {
+			labels[i].Value = values[i]
+		}
+	}
+	c = &child[T]{labels: labels, metric: v.create()}
+	v.children[key] = c
+	return c.metric
+}
+
+// collect returns the family with samples ordered by label values.
+func (v *vec[T]) collect(samples func(labels []Label, m *T) []Sample) []Family {
+	v.mu.RLock()
+	children := make([]*child[T], 0, len(v.children))
+	for _, c := range v.children {
+		children = append(children, c)
+	}
+	v.mu.RUnlock()
+
+	slices.SortFunc(children, func(a, b *child[T]) int {
+		for i := range a.labels {
+			if c := cmp.Compare(a.labels[i].Value, b.labels[i].Value); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+	f := Family{Name: v.name, Help: v.help, Type: v.typ}
+	for _, c := range children {
+		f.Samples = append(f.Samples, samples(c.labels, c.metric)...)
+	}
+	return []Family{f}
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	v *vec[Counter]
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: newVec(name, help, TypeCounter, labels, func() *Counter { return &Counter{} })}
+}
+
+// With returns the counter of the label values in the order of the label names.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.v.with(values)
+}
+
+func (c *CounterVec) Collect() []Family {
+	return c.v.collect(func(labels []Label, m *Counter) []Sample {
+		return []Sample{{Labels: labels, Value: m.v.load()}}
+	})
+}
+
+// GaugeVec is a family of gauges partitioned by labels.
+type GaugeVec struct {
+	v *vec[Gauge]
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: newVec(name, help, TypeGauge, labels, func() *Gauge { return &Gauge{} })}
+}
+
+// With returns the gauge of the label values in the order of the label names.
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.v.with(values)
+}
+
+func (g *GaugeVec) Collect() []Family {
+	return g.v.collect(func(labels []Label, m *Gauge) []Sample {
+		return []Sample{{Labels: labels, Value: m.v.load()}}
+	})
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	v *vec[Histogram]
+}
+
+// NewHistogramVec creates histograms with the bucket bounds, DefaultBuckets when bounds are empty.
+func NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	bounds = slices.Sorted(slices.Values(bounds))
+	return &HistogramVec{v: newVec(name, help, TypeHistogram, labels, func() *Histogram { return newHistogram(bounds) })}
+}
+
+// With returns the histogram of the label values in the order of the label names.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.v.with(values)
+}
+
+func (h *HistogramVec) Collect() []Family {
+	return h.v.collect(func(labels []Label, m *Histogram) []Sample {
+		return m.samples(labels)
+	})
+}
+
+// funcCollector reads the value of a single sample on every scrape.
+type funcCollector struct {
+	name string
+	help string
+	typ  Type
+	fn   func() float64
+}
+
+// NewGaugeFunc exposes the value returned by fn as a gauge.
+func NewGaugeFunc(name, help string, fn func() float64) Collector {
+	return funcCollector{name: name, help: help, typ: TypeGauge, fn: fn}
+}
+
+// NewCounterFunc exposes the value returned by fn as a counter.
+func NewCounterFunc(name, help string, fn func() float64) Collector {
+	return funcCollector{name: name, help: help, typ: TypeCounter, fn: fn}
+}
+
+func (f funcCollector) Collect() []Family {
+	return []Family{{Name: f.name, Help: f.help, Type: f.typ, Samples: []Sample{{Value: f.fn()}}}}
+}
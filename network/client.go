@@ -0,0 +1,109 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Client is a connection to a bcdb server. It is not safe for concurrent use.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func Dial(ctx context.Context, address string) (*Client, error) {
+	return dial(ctx, "tcp", address)
+}
+
+func dial(ctx context.Context, network, address string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// DialTLS connects to a bcdb server over TLS.
+func DialTLS(ctx context.Context, address string, cfg *tls.Config) (*Client, error) {
+	d := tls.Dialer{Config: cfg}
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// Do sends the command and waits for the reply.
+// Errors sent by the server are returned as *ReplyError.
+func (c *Client) Do(ctx context.Context, command string) (string, error) {
+	// zero deadline means no timeout
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	if _, err := fmt.Fprintf(c.conn, "%s\n", command); err != nil {
+		return "", err
+	}
+	return readReply(c.r)
+}
+
+// Receive waits for the next value of a stream started by a command like MONITOR.
+func (c *Client) Receive(ctx context.Context) (string, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+	return readReply(c.r)
+}
+
+// Reply is the reply to a pipelined command.
+// Errors sent by the server are returned as *ReplyError in Err.
+type Reply struct {
+	Value string
+	Err   error
+}
+
+// Pipeline sends the commands without waiting for replies and returns the replies in order.
+// Commands are written while the replies are read, so large pipelines don't block the server.
+func (c *Client) Pipeline(ctx context.Context, commands ...string) ([]Reply, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(c.conn)
+		for _, cmd := range commands {
+			if _, err := fmt.Fprintf(w, "%s\n", cmd); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- w.Flush()
+	}()
+
+	replies := make([]Reply, 0, len(commands))
+	for range commands {
+		value, err := readReply(c.r)
+		var replyErr *ReplyError
+		if err != nil && !errors.As(err, &replyErr) {
+			// unblock the writer
+			_ = c.conn.Close()
+			<-written
+			return nil, err
+		}
+		replies = append(replies, Reply{Value: value, Err: err})
+	}
+	return replies, <-written
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
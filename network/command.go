@@ -0,0 +1,31 @@
+package network
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FormatCommand joins the command and its arguments into a request line.
+// Arguments with spaces, quotes or non-printable characters are written
+// as double-quoted strings with Go escapes, which the parser unquotes.
+func FormatCommand(name string, args ...string) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, arg := range args {
+		sb.WriteByte(' ')
+		if needsQuote(arg) {
+			sb.WriteString(strconv.Quote(arg))
+			continue
+		}
+		sb.WriteString(arg)
+	}
+	return sb.String()
+}
+
+func needsQuote(arg string) bool {
+	if arg == "" || strings.ContainsAny(arg, ` "\`) {
+		return true
+	}
+	return strings.IndexFunc(arg, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0
+}
@@ -0,0 +1,26 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "plain", args: []string{"key", "value"}, want: "SET key value"},
+		{name: "space", args: []string{"key", "a b"}, want: `SET key "a b"`},
+		{name: "newline", args: []string{"key", "a\nb"}, want: `SET key "a\nb"`},
+		{name: "quotes", args: []string{`"key"`, `a\b`}, want: `SET "\"key\"" "a\\b"`},
+		{name: "empty", args: []string{"key", ""}, want: `SET key ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FormatCommand("SET", tt.args...))
+		})
+	}
+}
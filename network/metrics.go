@@ -0,0 +1,50 @@
+package network
+
+import (
+	"sync/atomic"
+
+	"github.com/sattellite/bcdb/metrics"
+)
+
+// Metrics counts connections of servers. One Metrics can be shared by servers
+// of different listeners, connections are labeled by the listener network.
+type Metrics struct {
+	accepted *metrics.CounterVec
+	active   *metrics.GaugeVec
+	rejected atomic.Uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		accepted: metrics.NewCounterVec("bcdb_connections_total", "Accepted connections.", "network"),
+		active:   metrics.NewGaugeVec("bcdb_connections_active", "Open connections.", "network"),
+	}
+}
+
+// Collect implements metrics.Collector.
+func (m *Metrics) Collect() []metrics.Family {
+	families := append(m.accepted.Collect(), m.active.Collect()...)
+	return append(families, metrics.Family{
+		Name:    "bcdb_handshake_errors_total",
+		Help:    "Connections closed by a failed TLS handshake.",
+		Type:    metrics.TypeCounter,
+		Samples: []metrics.Sample{{Value: float64(m.rejected.Load())}},
+	})
+}
+
+// opened counts the accepted connection and returns the func counting its close.
+func (m *Metrics) opened(network string) func() {
+	if m == nil {
+		return func() {}
+	}
+	m.accepted.With(network).Inc()
+	active := m.active.With(network)
+	active.Inc()
+	return active.Dec
+}
+
+func (m *Metrics) handshakeFailed() {
+	if m != nil {
+		m.rejected.Add(1)
+	}
+}
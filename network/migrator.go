@@ -0,0 +1,75 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Migrator writes keys of migrating slots to other nodes. Keys are written
+// with ASKING, so targets accept them while the slots are importing.
+type Migrator struct {
+	user     string
+	password string
+	tls      *TLS
+}
+
+type MigratorOption func(*Migrator)
+
+// WithMigratorAuth authenticates migration connections with AUTH,
+// targets with ACL users refuse commands of anonymous clients.
+func WithMigratorAuth(user, password string) MigratorOption {
+	return func(m *Migrator) {
+		m.user, m.password = user, password
+	}
+}
+
+// WithMigratorTLS connects to nodes over TLS with the client config of t.
+func WithMigratorTLS(t *TLS) MigratorOption {
+	return func(m *Migrator) {
+		m.tls = t
+	}
+}
+
+func NewMigrator(opts ...MigratorOption) *Migrator {
+	m := &Migrator{}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Migrate writes the key to the database db of the node at address.
+// Nodes without numbered databases accept keys of database 0 only.
+func (m *Migrator) Migrate(ctx context.Context, address string, db int, key, value string) error {
+	client, err := m.dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.user != "" {
+		if _, err = client.Do(ctx, FormatCommand("AUTH", m.user, m.password)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if db != 0 {
+		if _, err = client.Do(ctx, FormatCommand("SELECT", strconv.Itoa(db))); err != nil {
+			return fmt.Errorf("select: %w", err)
+		}
+	}
+	if _, err = client.Do(ctx, "ASKING"); err != nil {
+		return fmt.Errorf("asking: %w", err)
+	}
+	if _, err = client.Do(ctx, FormatCommand("SET", key, value)); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) dial(ctx context.Context, address string) (*Client, error) {
+	if m.tls != nil {
+		return DialTLS(ctx, address, m.tls.ClientConfig())
+	}
+	return Dial(ctx, address)
+}
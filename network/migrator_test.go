@@ -0,0 +1,63 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+)
+
+// recordHandler replies OK and records commands with the user of the session.
+type recordHandler struct {
+	mu       *sync.Mutex
+	commands *[]string
+	users    *[]string
+}
+
+func (h recordHandler) Parse(input string) (*query.Query, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.commands = append(*h.commands, input)
+	return query.New(0), nil
+}
+
+func (h recordHandler) Handle(ctx context.Context, _ query.Query) (result.Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.users = append(*h.users, session.FromContext(ctx).User())
+	return result.Result{Value: "OK"}, nil
+}
+
+func TestMigrator(t *testing.T) {
+	ca := newTestCA(t)
+	serverCerts, err := NewTLS(noopLogger, writeServerFiles(t, t.TempDir(), ca, "target"))
+	require.NoError(t, err)
+	h := recordHandler{mu: &sync.Mutex{}, commands: &[]string{}, users: &[]string{}}
+	addr := startServer(t, h, WithTLS(serverCerts.ServerConfig()))
+
+	// the node verifies the target with the CA and presents its certificate
+	nodeCfg := writeServerFiles(t, t.TempDir(), ca, "source")
+	nodeCfg.CAFile = nodeCfg.ClientCAFile
+	nodeCerts, err := NewTLS(noopLogger, nodeCfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := NewMigrator(WithMigratorAuth("migrate", "secret key"), WithMigratorTLS(nodeCerts))
+	require.NoError(t, m.Migrate(ctx, addr, 2, "foo", "bar baz"))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Equal(t, []string{`AUTH migrate "secret key"`, "SELECT 2", "ASKING", `SET foo "bar baz"`}, *h.commands)
+	assert.Equal(t, []string{"source", "source", "source", "source"}, *h.users)
+
+	// targets are verified with the CA
+	require.Error(t, NewMigrator(WithMigratorTLS(serverCerts)).Migrate(ctx, addr, 0, "foo", "bar"))
+}
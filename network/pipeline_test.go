@@ -0,0 +1,132 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+)
+
+// blockingHandler counts parsed commands and executes them after unblock is closed.
+type blockingHandler struct {
+	echoHandler
+	parsed  atomic.Int64
+	unblock chan struct{}
+}
+
+func (h *blockingHandler) Parse(input string) (*query.Query, error) {
+	h.parsed.Add(1)
+	return h.echoHandler.Parse(input)
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, q query.Query) (result.Result, error) {
+	<-h.unblock
+	return h.echoHandler.Handle(ctx, q)
+}
+
+func TestServerPipeline(t *testing.T) {
+	addr := startServer(t, echoHandler{}, WithPipeline(8))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	const count = 10000
+	commands := make([]string, 0, count)
+	for i := range count {
+		if i%100 == 0 {
+			commands = append(commands, "UNKNOWN")
+			continue
+		}
+		commands = append(commands, fmt.Sprintf("ECHO %d", i))
+	}
+	replies, err := client.Pipeline(ctx, commands...)
+	require.NoError(t, err)
+	require.Len(t, replies, count)
+	for i, reply := range replies {
+		if i%100 == 0 {
+			require.Error(t, reply.Err, "reply %d", i)
+			continue
+		}
+		require.NoError(t, reply.Err)
+		require.Equal(t, strconv.Itoa(i), reply.Value, "replies are ordered")
+	}
+}
+
+func TestServerPipeline_Backpressure(t *testing.T) {
+	const queue = 4
+	h := &blockingHandler{unblock: make(chan struct{})}
+	addr := startServer(t, h, WithPipeline(queue))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	commands := make([]string, 100)
+	for i := range commands {
+		commands[i] = "ECHO " + strconv.Itoa(i)
+	}
+	done := make(chan []Reply)
+	go func() {
+		replies, pErr := client.Pipeline(ctx, commands...)
+		assert.NoError(t, pErr)
+		done <- replies
+	}()
+
+	// one command executes, the queue is full and one more waits for the queue
+	require.Eventually(t, func() bool { return h.parsed.Load() == queue+2 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(queue+2), h.parsed.Load(), "reader should wait for the queue")
+
+	close(h.unblock)
+	replies := <-done
+	require.Len(t, replies, len(commands))
+	assert.Equal(t, "99", replies[99].Value)
+}
+
+func BenchmarkServer(b *testing.B) {
+	const batch = 100
+	addr := startServer(b, echoHandler{})
+	ctx := context.Background()
+
+	b.Run("sequential", func(b *testing.B) {
+		client, err := Dial(ctx, addr)
+		require.NoError(b, err)
+		defer client.Close()
+		b.ResetTimer()
+		for range b.N {
+			if _, dErr := client.Do(ctx, "ECHO value"); dErr != nil {
+				b.Fatal(dErr)
+			}
+		}
+	})
+
+	b.Run("pipelined", func(b *testing.B) {
+		client, err := Dial(ctx, addr)
+		require.NoError(b, err)
+		defer client.Close()
+		commands := make([]string, batch)
+		for i := range commands {
+			commands[i] = "ECHO value"
+		}
+		b.ResetTimer()
+		for sent := 0; sent < b.N; sent += batch {
+			n := min(batch, b.N-sent)
+			if _, pErr := client.Pipeline(ctx, commands[:n]...); pErr != nil {
+				b.Fatal(pErr)
+			}
+		}
+	})
+}
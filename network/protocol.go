@@ -0,0 +1,105 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The protocol is line based. A request is a single line with a command.
+// A reply starts with a type byte:
+//
+//	+value\n         single line value
+//	$length\nvalue\n multi-line value of the given length in bytes
+//	-error\n         error message
+const (
+	replySimple = '+'
+	replyBulk   = '$'
+	replyError  = '-'
+)
+
+var (
+	ErrProtocol    = errors.New("protocol error")
+	ErrLineTooLong = errors.New("line is too long")
+)
+
+// ReplyError is an error returned by the server.
+type ReplyError struct {
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return e.Message
+}
+
+func writeValue(w io.Writer, value string) error {
+	var err error
+	if strings.ContainsAny(value, "\r\n") {
+		_, err = fmt.Fprintf(w, "%c%d\n%s\n", replyBulk, len(value), value)
+	} else {
+		_, err = fmt.Fprintf(w, "%c%s\n", replySimple, value)
+	}
+	return err
+}
+
+func writeError(w io.Writer, e error) error {
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(e.Error())
+	_, err := fmt.Fprintf(w, "%c%s\n", replyError, msg)
+	return err
+}
+
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := readLine(r, 0)
+	if err != nil {
+		return "", err
+	}
+	if line == "" {
+		return "", ErrProtocol
+	}
+
+	switch line[0] {
+	case replySimple:
+		return line[1:], nil
+	case replyError:
+		return "", &ReplyError{Message: line[1:]}
+	case replyBulk:
+		size, cErr := strconv.Atoi(line[1:])
+		if cErr != nil || size < 0 {
+			return "", fmt.Errorf("%w: invalid length %q", ErrProtocol, line[1:])
+		}
+		buf := make([]byte, size+1)
+		if _, rErr := io.ReadFull(r, buf); rErr != nil {
+			return "", rErr
+		}
+		return string(buf[:size]), nil
+	}
+	return "", fmt.Errorf("%w: unknown reply type %q", ErrProtocol, line[0])
+}
+
+// readLine reads a line of at most limit bytes, zero means no limit.
+// The rest of a longer line is discarded and ErrLineTooLong is returned.
+func readLine(r *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			tooLong = limit > 0 && len(bytes.TrimRight(line, "\r\n")) > limit
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if tooLong {
+			return "", fmt.Errorf("%w, at most %d bytes are allowed", ErrLineTooLong, limit)
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
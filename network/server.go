@@ -0,0 +1,353 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/trace"
+)
+
+// Handler executes client commands.
+type Handler interface {
+	Parse(input string) (*query.Query, error)
+	Handle(ctx context.Context, q query.Query) (result.Result, error)
+}
+
+// handshakeTimeout limits the TLS handshake of new connections.
+const handshakeTimeout = 10 * time.Second
+
+// streamWriteTimeout disconnects clients not reading streams of MONITOR.
+const streamWriteTimeout = 10 * time.Second
+
+// DefaultPipeline is the number of commands of a connection read ahead of execution.
+const DefaultPipeline = 128
+
+// DefaultMaxLineSize limits the length of a command in bytes.
+const DefaultMaxLineSize = 1 << 20
+
+// ServerOption configures optional server features.
+type ServerOption func(*Server)
+
+// WithTLS serves connections over TLS. The common name of a verified
+// client certificate becomes the user of the session.
+func WithTLS(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tls = cfg
+	}
+}
+
+// WithPipeline sets the number of commands of a connection read ahead of execution.
+func WithPipeline(size int) ServerOption {
+	return func(s *Server) {
+		if size > 0 {
+			s.pipeline = size
+		}
+	}
+}
+
+// WithMaxLineSize limits the length of a command in bytes. Longer
+// commands are discarded and answered with an error.
+func WithMaxLineSize(size int) ServerOption {
+	return func(s *Server) {
+		if size > 0 {
+			s.maxLineSize = size
+		}
+	}
+}
+
+// WithSessions tracks sessions of connections in the registry,
+// so they can be listed and killed by CLIENT commands.
+func WithSessions(reg *session.Registry) ServerOption {
+	return func(s *Server) {
+		s.sessions = reg
+	}
+}
+
+// WithMetrics counts connections of the server.
+func WithMetrics(m *Metrics) ServerOption {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithTracer starts a trace of every command of the server.
+func WithTracer(t *trace.Tracer) ServerOption {
+	return func(s *Server) {
+		s.tracer = t
+	}
+}
+
+type Server struct {
+	logger      *slog.Logger
+	address     string
+	handler     Handler
+	tls         *tls.Config
+	pipeline    int
+	maxLineSize int
+	sessions    *session.Registry
+	metrics     *Metrics
+	tracer      *trace.Tracer
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+func NewServer(l *slog.Logger, address string, h Handler, opts ...ServerOption) *Server {
+	s := &Server{
+		logger:      l.With("module", "network"),
+		address:     address,
+		handler:     h,
+		pipeline:    DefaultPipeline,
+		maxLineSize: DefaultMaxLineSize,
+		conns:       make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run accepts connections until the context is canceled.
+func (s *Server) Run(ctx context.Context) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on the listener until the context is canceled.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.tls != nil {
+		ln = tls.NewListener(ln, s.tls)
+	}
+	s.logger.Info("listening", slog.String("address", ln.Addr().String()), slog.Bool("tls", s.tls != nil))
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+		s.closeConns()
+	}()
+
+	defer func() {
+		s.wg.Wait()
+		s.logger.Info("stopped")
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.track(conn)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	if conn.RemoteAddr().Network() == "unix" {
+		// clients of Unix sockets are unnamed
+		remote = "unix:" + conn.LocalAddr().String()
+	}
+	defer s.metrics.opened(conn.LocalAddr().Network())()
+	sess := session.New(remote)
+	// killing the session cancels in-flight commands and closes the connection
+	ctx, cancel := context.WithCancel(session.NewContext(ctx, sess))
+	defer cancel()
+	if s.sessions != nil {
+		s.sessions.Add(sess, cancel)
+		defer s.sessions.Remove(sess.ID)
+	}
+	l := s.logger.With(slog.Uint64("session", sess.ID), slog.String("remote", sess.RemoteAddr))
+	l.Debug("connection accepted")
+	defer l.Debug("connection closed")
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		hctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		err := tc.HandshakeContext(hctx)
+		cancel()
+		if err != nil {
+			l.Debug("tls handshake failed", slog.Any("error", err))
+			s.metrics.handshakeFailed()
+			return
+		}
+		if name := peerName(tc.ConnectionState()); name != "" {
+			sess.SetUser(name)
+			l.Debug("authenticated by client certificate", slog.String("user", name))
+		}
+	}
+
+	// the reader parses commands ahead of execution, the queue is bounded,
+	// so a client sending faster than commands execute is blocked by TCP
+	reqs := make(chan request, s.pipeline)
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.readRequests(conn, reqs, stop)
+
+	w := bufio.NewWriter(conn)
+	for {
+		var req request
+		select {
+		case <-ctx.Done():
+			return
+		case r, ok := <-reqs:
+			if !ok {
+				// the client closed its side, replies of executed commands are sent
+				_ = w.Flush()
+				return
+			}
+			req = r
+		}
+
+		stream, hErr := s.reply(ctx, req, w)
+		if hErr != nil {
+			l.Debug("failed to write reply", slog.Any("error", hErr))
+			return
+		}
+		if stream != nil {
+			s.stream(ctx, conn, stream, reqs, w)
+			return
+		}
+		if ctx.Err() != nil {
+			// the reply of the interrupted command is sent before closing
+			_ = w.Flush()
+			return
+		}
+		// replies of pipelined commands are flushed together
+		if len(reqs) > 0 {
+			continue
+		}
+		if fErr := w.Flush(); fErr != nil {
+			return
+		}
+	}
+}
+
+// request is a parsed command waiting for execution.
+type request struct {
+	query *query.Query
+	err   error
+}
+
+// readRequests reads and parses commands until the connection is closed or stop is closed.
+func (s *Server) readRequests(conn net.Conn, reqs chan<- request, stop <-chan struct{}) {
+	defer close(reqs)
+	r := bufio.NewReader(conn)
+	for {
+		var req request
+		line, err := readLine(r, s.maxLineSize)
+		switch {
+		case errors.Is(err, ErrLineTooLong):
+			req.err = err
+		case err != nil:
+			return
+		case line == "":
+			continue
+		default:
+			req.query, req.err = s.handler.Parse(line)
+		}
+		select {
+		case reqs <- req:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reply executes the request and writes the reply. It returns the stream
+// of values to send after the reply, when the command has one.
+func (s *Server) reply(ctx context.Context, req request, w *bufio.Writer) (<-chan string, error) {
+	if req.err != nil {
+		return nil, writeError(w, req.err)
+	}
+	method := req.query.Command()
+	ctx, span := s.tracer.Start(ctx, "network.request",
+		slog.String("command", method.String()),
+		slog.Uint64("session", session.FromContext(ctx).ID))
+	res, hErr := s.handler.Handle(ctx, *req.query)
+	span.SetError(hErr)
+	span.End()
+	if hErr != nil {
+		return nil, writeError(w, hErr)
+	}
+	return res.Stream, writeValue(w, res.Value)
+}
+
+// stream sends values of the stream until it is closed or the client disconnects.
+// Commands sent by the client meanwhile are ignored. A client not reading
+// the stream is disconnected after streamWriteTimeout.
+func (s *Server) stream(ctx context.Context, conn net.Conn, stream <-chan string, reqs <-chan request, w *bufio.Writer) {
+	flush := func() error {
+		if err := conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	if err := flush(); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-reqs:
+			if !ok {
+				return
+			}
+		case value, ok := <-stream:
+			if !ok {
+				_ = flush()
+				return
+			}
+			if err := writeValue(w, value); err != nil {
+				return
+			}
+			if len(stream) > 0 {
+				continue
+			}
+			if err := flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) track(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = struct{}{}
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	_ = conn.Close()
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,299 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sattellite/bcdb/compute/command"
+	"github.com/sattellite/bcdb/compute/query"
+	"github.com/sattellite/bcdb/compute/result"
+	"github.com/sattellite/bcdb/compute/session"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/trace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// echoHandler replies with the arguments of the query and the session id.
+type echoHandler struct{}
+
+func (echoHandler) Parse(input string) (*query.Query, error) {
+	parts := strings.Split(input, " ")
+	if parts[0] != "ECHO" {
+		return nil, command.ErrInvalidCommand
+	}
+	return query.New(command.MethodGet, parts[1:]...), nil
+}
+
+func (echoHandler) Handle(ctx context.Context, q query.Query) (result.Result, error) {
+	if len(q.Arguments()) == 0 {
+		return result.Result{}, errors.New("nothing\nto echo")
+	}
+	switch q.Arguments()[0] {
+	case "session":
+		return result.Result{Value: session.FromContext(ctx).RemoteAddr}, nil
+	case "user":
+		return result.Result{Value: session.FromContext(ctx).User()}, nil
+	case "traced":
+		return result.Result{Value: strconv.FormatBool(trace.FromContext(ctx) != nil)}, nil
+	}
+	return result.Result{Value: strings.Join(q.Arguments(), "\n")}, nil
+}
+
+func startServer(t testing.TB, h Handler, opts ...ServerOption) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := NewServer(noopLogger, "", h, opts...)
+	stopped := make(chan error)
+	go func() {
+		stopped <- srv.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-stopped)
+	})
+	return ln.Addr().String()
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	addr := startServer(t, echoHandler{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+		errMsg   string
+	}{
+		{"Single line value", "ECHO hello", "hello", ""},
+		{"Multi-line value", "ECHO hello world", "hello\nworld", ""},
+		{"Parse error", "UNKNOWN", "", command.ErrInvalidCommand.Error()},
+		{"Handle error with new line", "ECHO", "", "nothing to echo"},
+		{"Session is set", "ECHO session", client.conn.LocalAddr().String(), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, dErr := client.Do(ctx, tt.command)
+			if tt.errMsg != "" {
+				var replyErr *ReplyError
+				require.ErrorAs(t, dErr, &replyErr)
+				assert.Equal(t, tt.errMsg, replyErr.Message)
+				return
+			}
+			require.NoError(t, dErr)
+			assert.Equal(t, tt.expected, res)
+		})
+	}
+}
+
+func TestServerStopClosesConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := NewServer(noopLogger, "", echoHandler{})
+	stopped := make(chan error)
+	go func() {
+		stopped <- srv.Serve(ctx, ln)
+	}()
+
+	client, dErr := Dial(context.Background(), ln.Addr().String())
+	require.NoError(t, dErr)
+	defer client.Close()
+	_, doErr := client.Do(context.Background(), "ECHO ping")
+	require.NoError(t, doErr)
+
+	cancel()
+	select {
+	case sErr := <-stopped:
+		require.NoError(t, sErr)
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	_, doErr = client.Do(context.Background(), "ECHO ping")
+	require.Error(t, doErr, "connection should be closed")
+}
+
+// waitHandler blocks commands until their context is canceled.
+type waitHandler struct {
+	echoHandler
+	started chan struct{}
+}
+
+func (h waitHandler) Handle(ctx context.Context, _ query.Query) (result.Result, error) {
+	h.started <- struct{}{}
+	<-ctx.Done()
+	return result.Result{}, ctx.Err()
+}
+
+func TestServerKillSession(t *testing.T) {
+	sessions := session.NewRegistry()
+	h := waitHandler{started: make(chan struct{})}
+	addr := startServer(t, h, WithSessions(sessions))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	done := make(chan error)
+	go func() {
+		_, doErr := client.Do(ctx, "ECHO wait")
+		done <- doErr
+	}()
+
+	<-h.started
+	require.Len(t, sessions.List(), 1)
+	require.True(t, sessions.Kill(sessions.List()[0].ID))
+
+	require.ErrorContains(t, <-done, context.Canceled.Error(), "the in-flight command is interrupted")
+	_, err = client.Do(ctx, "ECHO ping")
+	require.Error(t, err, "connection should be closed")
+	require.Eventually(t, func() bool {
+		return len(sessions.List()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+// streamHandler replies with a stream of the arguments.
+type streamHandler struct {
+	echoHandler
+}
+
+func (streamHandler) Handle(_ context.Context, q query.Query) (result.Result, error) {
+	stream := make(chan string, len(q.Arguments()))
+	for _, arg := range q.Arguments() {
+		stream <- arg
+	}
+	close(stream)
+	return result.Result{Value: "OK", Stream: stream}, nil
+}
+
+func TestServerStream(t *testing.T) {
+	addr := startServer(t, streamHandler{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	value, err := client.Do(ctx, "ECHO a b")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", value)
+	for _, want := range []string{"a", "b"} {
+		value, err = client.Receive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, value)
+	}
+	_, err = client.Receive(ctx)
+	require.ErrorIs(t, err, io.EOF, "the connection is closed with the stream")
+}
+
+func TestServerMaxLineSize(t *testing.T) {
+	// lines longer than the buffer of the reader are read in chunks
+	addr := startServer(t, echoHandler{}, WithMaxLineSize(8192))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer client.Close()
+
+	value, err := client.Do(ctx, "ECHO "+strings.Repeat("a", 8187))
+	require.NoError(t, err)
+	assert.Len(t, value, 8187)
+
+	_, err = client.Do(ctx, "ECHO "+strings.Repeat("a", 8188))
+	var replyErr *ReplyError
+	require.ErrorAs(t, err, &replyErr)
+	assert.Equal(t, "line is too long, at most 8192 bytes are allowed", replyErr.Message)
+
+	// the rest of the long line is discarded, the connection is kept
+	_, err = client.Do(ctx, "ECHO "+strings.Repeat("a", 100000))
+	require.ErrorAs(t, err, &replyErr)
+	value, err = client.Do(ctx, "ECHO ok")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", value)
+}
+
+func TestServerMetrics(t *testing.T) {
+	m := NewMetrics()
+	addr := startServer(t, echoHandler{}, WithMetrics(m))
+	collect := func() string {
+		var b strings.Builder
+		require.NoError(t, metrics.WriteText(&b, m.Collect()))
+		return b.String()
+	}
+
+	client, err := Dial(context.Background(), addr)
+	require.NoError(t, err)
+	_, err = client.Do(context.Background(), "ECHO ping")
+	require.NoError(t, err)
+	out := collect()
+	assert.Contains(t, out, `bcdb_connections_total{network="tcp"} 1`)
+	assert.Contains(t, out, `bcdb_connections_active{network="tcp"} 1`)
+
+	require.NoError(t, client.Close())
+	assert.Eventually(t, func() bool {
+		return strings.Contains(collect(), `bcdb_connections_active{network="tcp"} 0`)
+	}, time.Second, 10*time.Millisecond)
+}
+
+// spanRecorder keeps exported spans.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []trace.SpanData
+}
+
+func (r *spanRecorder) Export(spans []trace.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Close() error { return nil }
+
+func TestServerTracing(t *testing.T) {
+	rec := &spanRecorder{}
+	tr, err := trace.New(noopLogger, rec, trace.Options{SampleRatio: 1})
+	require.NoError(t, err)
+	addr := startServer(t, echoHandler{}, WithTracer(tr))
+
+	client, err := Dial(context.Background(), addr)
+	require.NoError(t, err)
+	defer client.Close()
+	res, err := client.Do(context.Background(), "ECHO traced")
+	require.NoError(t, err)
+	assert.Equal(t, "true", res)
+	_, err = client.Do(context.Background(), "ECHO")
+	require.Error(t, err)
+	require.NoError(t, tr.Close())
+
+	require.Len(t, rec.spans, 2)
+	assert.Equal(t, "network.request", rec.spans[0].Name)
+	assert.Equal(t, "GET", rec.spans[0].Attributes["command"])
+	assert.Equal(t, "nothing\nto echo", rec.spans[1].Error)
+}
@@ -0,0 +1,202 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+// Client certificate verification modes.
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+const defaultReloadInterval = 10 * time.Second
+
+// TLS loads the certificate of listeners, the CA verifying client
+// certificates and the CA verifying other nodes. Watch reloads them when
+// the files change, new connections use the new files and established
+// connections are kept.
+type TLS struct {
+	logger *slog.Logger
+	cfg    config.TLS
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	ca       *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func NewTLS(l *slog.Logger, cfg config.TLS) (*TLS, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("certificate and key files are required")
+	}
+	switch cfg.ClientAuth {
+	case "", ClientAuthRequire, ClientAuthOptional:
+	default:
+		return nil, fmt.Errorf("unknown client auth %q, expected %s or %s", cfg.ClientAuth, ClientAuthRequire, ClientAuthOptional)
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultReloadInterval
+	}
+
+	t := &TLS{logger: l.With("module", "tls"), cfg: cfg}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ServerConfig returns the config of TLS listeners. Every handshake uses
+// the files loaded last.
+func (t *TLS) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*t.cert},
+			}
+			if t.clientCA != nil {
+				cfg.ClientCAs = t.clientCA
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				if t.cfg.ClientAuth == ClientAuthOptional {
+					cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				}
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig returns the config of connections to other nodes. The node
+// presents the certificate of its listener, so servers requiring client
+// certificates accept it.
+func (t *TLS) ClientConfig() *tls.Config {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*t.cert},
+		RootCAs:      t.ca,
+	}
+}
+
+// Reload loads the files. On errors the previous files are kept.
+func (t *TLS) Reload() error {
+	modTimes, err := t.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.cfg.CertFile, t.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	clientCA, err := loadCA(t.cfg.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("load client CA: %w", err)
+	}
+	ca, err := loadCA(t.cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("load CA: %w", err)
+	}
+
+	t.mu.Lock()
+	t.cert, t.clientCA, t.ca, t.modTimes = &cert, clientCA, ca, modTimes
+	t.mu.Unlock()
+	return nil
+}
+
+// loadCA returns certificates of the PEM file, nil when the path is empty.
+func loadCA(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+func (t *TLS) stat() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, 4)
+	for _, path := range []string{t.cfg.CertFile, t.cfg.KeyFile, t.cfg.ClientCAFile, t.cfg.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// changed reports whether any file was modified since the last reload.
+func (t *TLS) changed() bool {
+	modTimes, err := t.stat()
+	if err != nil {
+		// files may be replaced right now, retry on the next check
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for path, mt := range modTimes {
+		if !mt.Equal(t.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the files every reload interval and reloads them
+// on changes until the context is canceled.
+func (t *TLS) Watch(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !t.changed() {
+			continue
+		}
+		if err := t.Reload(); err != nil {
+			t.logger.Error("failed to reload certificates", slog.Any("error", err))
+			continue
+		}
+		t.logger.Info("certificates reloaded")
+	}
+}
+
+// peerName returns the common name of the verified client certificate.
+func peerName(state tls.ConnectionState) string {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,231 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newSerial(t *testing.T) *big.Int {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	return serial
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerial(t),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM encoded certificate and key for the common name,
+// valid for the server at 127.0.0.1 and for clients.
+func (ca *testCA) issue(t *testing.T, cn string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerial(t),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func (ca *testCA) clientCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, cn)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+// writeServerFiles writes the server certificate and the client CA into dir.
+func writeServerFiles(t *testing.T, dir string, ca *testCA, cn string) config.TLS {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, cn)
+	cfg := config.TLS{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	require.NoError(t, os.WriteFile(cfg.CertFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(cfg.KeyFile, keyPEM, 0o600))
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, ca.pem, 0o600))
+	return cfg
+}
+
+func TestNewTLS(t *testing.T) {
+	cfg := writeServerFiles(t, t.TempDir(), newTestCA(t), "server")
+	tests := []struct {
+		name    string
+		cfg     config.TLS
+		wantErr string
+	}{
+		{name: "valid", cfg: cfg},
+		{name: "no key", cfg: config.TLS{CertFile: cfg.CertFile}, wantErr: "certificate and key files are required"},
+		{name: "missing file", cfg: config.TLS{CertFile: cfg.CertFile, KeyFile: "missing.key"}, wantErr: "missing.key"},
+		{name: "invalid CA", cfg: config.TLS{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, ClientCAFile: cfg.KeyFile}, wantErr: "no certificates"},
+		{name: "unknown client auth", cfg: config.TLS{CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, ClientAuth: "maybe"}, wantErr: "unknown client auth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTLS(noopLogger, tt.cfg)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := writeServerFiles(t, t.TempDir(), ca, "server")
+	cfg.ClientAuth = ClientAuthOptional
+	certs, err := NewTLS(noopLogger, cfg)
+	require.NoError(t, err)
+	addr := startServer(t, echoHandler{}, WithTLS(certs.ServerConfig()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// client without a certificate has no user
+	client, err := DialTLS(ctx, addr, &tls.Config{RootCAs: ca.pool()})
+	require.NoError(t, err)
+	defer client.Close()
+	res, err := client.Do(ctx, "ECHO user")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	// verified client certificate maps to the user
+	mtls, err := DialTLS(ctx, addr, &tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{ca.clientCert(t, "app")}})
+	require.NoError(t, err)
+	defer mtls.Close()
+	res, err = mtls.Do(ctx, "ECHO user")
+	require.NoError(t, err)
+	assert.Equal(t, "app", res)
+
+	// certificate of an unknown CA is rejected
+	other := newTestCA(t)
+	bad, err := DialTLS(ctx, addr, &tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{other.clientCert(t, "admin")}})
+	if err == nil {
+		defer bad.Close()
+		_, err = bad.Do(ctx, "ECHO user")
+	}
+	require.Error(t, err)
+
+	// plain connections fail the handshake
+	plain, err := Dial(ctx, addr)
+	require.NoError(t, err)
+	defer plain.Close()
+	_, err = plain.Do(ctx, "ECHO user")
+	require.Error(t, err)
+}
+
+func TestServerTLS_RequireClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	certs, err := NewTLS(noopLogger, writeServerFiles(t, t.TempDir(), ca, "server"))
+	require.NoError(t, err)
+	addr := startServer(t, echoHandler{}, WithTLS(certs.ServerConfig()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := DialTLS(ctx, addr, &tls.Config{RootCAs: ca.pool()})
+	if err == nil {
+		defer client.Close()
+		_, err = client.Do(ctx, "ECHO user")
+	}
+	require.Error(t, err)
+}
+
+func TestTLS_Watch(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := writeServerFiles(t, dir, ca, "first")
+	cfg.ReloadInterval = 10 * time.Millisecond
+	certs, err := NewTLS(noopLogger, cfg)
+	require.NoError(t, err)
+	addr := startServer(t, echoHandler{}, WithTLS(certs.ServerConfig()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go certs.Watch(ctx)
+
+	serverName := func() string {
+		client, dErr := DialTLS(ctx, addr, &tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{ca.clientCert(t, "app")}})
+		require.NoError(t, dErr)
+		defer client.Close()
+		_, dErr = client.Do(ctx, "ECHO user")
+		require.NoError(t, dErr)
+		return client.conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "first", serverName())
+
+	// replace the files with a new certificate, modification times must differ
+	next := writeServerFiles(t, t.TempDir(), ca, "second")
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{"server.crt", "server.key"} {
+		data, rErr := os.ReadFile(filepath.Join(filepath.Dir(next.CertFile), path))
+		require.NoError(t, rErr)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), data, 0o600))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, path), later, later))
+	}
+	require.Eventually(t, func() bool {
+		return serverName() == "second"
+	}, 5*time.Second, 20*time.Millisecond)
+}
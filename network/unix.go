@@ -0,0 +1,77 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultSocketPerm is the permission of the socket file when the config doesn't set it.
+const DefaultSocketPerm fs.FileMode = 0o600
+
+// ListenUnix listens on the Unix socket at path with the permissions.
+// A stale socket file left by a crashed server is removed, a socket of
+// a running server is kept and the error is returned. The file is removed
+// when the listener is closed.
+func ListenUnix(ctx context.Context, path string, perm fs.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(ctx, path); err != nil {
+		return nil, err
+	}
+
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if cErr := os.Chmod(path, perm); cErr != nil {
+		_ = ln.Close()
+		return nil, cErr
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	return ln, nil
+}
+
+func removeStaleSocket(ctx context.Context, path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	var d net.Dialer
+	if conn, dErr := d.DialContext(dctx, "unix", path); dErr == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// ParseSocketPerm parses octal permissions of the socket file, like 0660.
+// Empty string returns DefaultSocketPerm.
+func ParseSocketPerm(s string) (fs.FileMode, error) {
+	if s == "" {
+		return DefaultSocketPerm, nil
+	}
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 0o777 {
+		return 0, fmt.Errorf("invalid socket permissions %q, expected octal like 0660", s)
+	}
+	return fs.FileMode(perm), nil
+}
+
+// DialUnix connects to a bcdb server listening on the Unix socket.
+func DialUnix(ctx context.Context, path string) (*Client, error) {
+	return dial(ctx, "unix", path)
+}
@@ -0,0 +1,106 @@
+package network
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bcdb.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := ListenUnix(ctx, path, 0o660)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o660), info.Mode().Perm())
+
+	srv := NewServer(noopLogger, path, echoHandler{})
+	stopped := make(chan error)
+	go func() {
+		stopped <- srv.Serve(ctx, ln)
+	}()
+
+	client, err := DialUnix(ctx, path)
+	require.NoError(t, err)
+	defer client.Close()
+	res, err := client.Do(ctx, "ECHO hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", res)
+	res, err = client.Do(ctx, "ECHO session")
+	require.NoError(t, err)
+	assert.Equal(t, "unix:"+path, res)
+
+	// the second server doesn't take over the socket in use
+	_, err = ListenUnix(ctx, path, 0o660)
+	require.ErrorContains(t, err, "in use")
+
+	cancel()
+	select {
+	case sErr := <-stopped:
+		require.NoError(t, sErr)
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, fs.ErrNotExist, "socket file should be removed")
+}
+
+func TestListenUnix_Stale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bcdb.sock")
+
+	// socket file of a crashed server
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	ln, err := ListenUnix(context.Background(), path, DefaultSocketPerm)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	// regular files are not removed
+	file := filepath.Join(dir, "data")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0o600))
+	_, err = ListenUnix(context.Background(), file, DefaultSocketPerm)
+	require.ErrorContains(t, err, "not a socket")
+}
+
+func TestParseSocketPerm(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    fs.FileMode
+		wantErr bool
+	}{
+		{input: "", want: DefaultSocketPerm},
+		{input: "0660", want: 0o660},
+		{input: "777", want: 0o777},
+		{input: "0999", wantErr: true},
+		{input: "1777", wantErr: true},
+		{input: "rw", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			perm, err := ParseSocketPerm(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, perm)
+		})
+	}
+}
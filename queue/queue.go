@@ -0,0 +1,74 @@
+// Package queue passes items from many producers to a single consumer
+// goroutine through a bounded buffer. Producers may send while the queue
+// is closed, items sent after Close are dropped.
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Queue is a bounded queue consumed by a goroutine.
+type Queue[T any] struct {
+	items   chan T
+	block   bool
+	dropped atomic.Uint64
+	stopped chan struct{}
+	once    sync.Once
+
+	// mu guards sends to items from its close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New starts consume with the items of the queue of the size. Consume
+// returns when the items are closed by Close. When block is set, Send
+// waits for space in the full queue, otherwise the item is dropped.
+func New[T any](size int, block bool, consume func(items <-chan T)) *Queue[T] {
+	q := &Queue[T]{
+		items:   make(chan T, size),
+		block:   block,
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(q.stopped)
+		consume(q.items)
+	}()
+	return q
+}
+
+// Send queues the item.
+func (q *Queue[T]) Send(item T) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		q.dropped.Add(1)
+		return
+	}
+	if q.block {
+		q.items <- item
+		return
+	}
+	select {
+	case q.items <- item:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of items dropped by the full or closed queue.
+func (q *Queue[T]) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Close closes the queue and waits until the consumer handles the queued
+// items and returns.
+func (q *Queue[T]) Close() {
+	q.once.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		close(q.items)
+		q.mu.Unlock()
+	})
+	<-q.stopped
+}
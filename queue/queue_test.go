@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	var got []int
+	release := make(chan struct{})
+	q := New(2, false, func(items <-chan int) {
+		<-release
+		for item := range items {
+			got = append(got, item)
+		}
+	})
+
+	// the consumer waits, so items beyond the size are dropped
+	for i := range 4 {
+		q.Send(i)
+	}
+	assert.Equal(t, uint64(2), q.Dropped())
+
+	close(release)
+	q.Close()
+	q.Close()
+	assert.Equal(t, []int{0, 1}, got, "queued items are consumed before Close returns")
+
+	q.Send(4)
+	assert.Equal(t, uint64(3), q.Dropped(), "items sent after Close are dropped")
+}
+
+func TestQueue_Block(t *testing.T) {
+	var got []int
+	q := New(1, true, func(items <-chan int) {
+		for item := range items {
+			got = append(got, item)
+		}
+	})
+	for i := range 100 {
+		q.Send(i)
+	}
+	q.Close()
+	assert.Len(t, got, 100)
+	assert.Zero(t, q.Dropped())
+}
@@ -6,56 +6,65 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/sattellite/bcdb/config"
 	"github.com/sattellite/bcdb/logger"
-	"github.com/sattellite/bcdb/storage/engine"
 )
 
-type EngineType int
-
-const (
-	EngineTypeMemory EngineType = iota
-)
-
-func (t *EngineType) String() string {
-	if *t == EngineTypeMemory {
-		return "memory"
-	}
-	return "unknown"
-}
+// DefaultEngine is used when the config doesn't select an engine.
+const DefaultEngine = "memory"
 
 type Engine interface {
 	Set(ctx context.Context, key string, value any) error
 	Get(ctx context.Context, key string) (any, error)
 	Del(ctx context.Context, key string) error
+	Keys(ctx context.Context) ([]string, error)
 
 	Done() <-chan struct{}
 	Close(ctx context.Context)
 }
 
-func NewEngine(ctx context.Context, t EngineType) (Engine, error) {
-	l := logger.WithScope("storage")
-	l.Info("creating storage engine", slog.String("type", t.String()))
-	var eng Engine
-	var err error
-	done := make(chan struct{})
-	if t == EngineTypeMemory {
-		eng, err = engine.NewMemory(l, done)
+// NewEngine creates the engine registered under the name from the config
+// and closes it when the context is canceled.
+//
+// The engine is wrapped with logging and panic recovery, then with the
+// middlewares enabled in the config and then with mws in the given order.
+func NewEngine(ctx context.Context, cfg config.Storage, mws ...Middleware) (Engine, error) {
+	name := cfg.Engine
+	if name == "" {
+		name = DefaultEngine
 	}
+	l := logger.WithScope("storage")
+	l.Info("creating storage engine", slog.String("type", name))
+
+	eng, err := create(l, name, cfg)
 	if err != nil {
 		l.Error("failed to create storage engine", slog.Any("error", err))
 		return nil, err
 	}
+	eng = Chain(eng, append(configMiddlewares(l.With("engine", name), cfg), mws...)...)
 
 	go stopEngine(ctx, eng)
 	return eng, nil
 }
 
+func configMiddlewares(l *slog.Logger, cfg config.Storage) []Middleware {
+	mws := []Middleware{WithLogging(l), WithRecovery(l)}
+	if cfg.ReadOnly {
+		mws = append(mws, WithReadOnly())
+	}
+	if cfg.MaxKeySize > 0 || cfg.MaxValueSize > 0 {
+		mws = append(mws, WithLimits(cfg.MaxKeySize, cfg.MaxValueSize))
+	}
+	return mws
+}
+
 func stopEngine(ctx context.Context, eng Engine) {
 	<-ctx.Done()
 	l := logger.WithScope("storage")
 	l.Info("stopping storage engine")
 	if eng != nil {
-		tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		// the parent context is already canceled, the engine still needs time to close
+		tctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
 		defer cancel()
 		eng.Close(tctx)
 		select {
@@ -0,0 +1,441 @@
+// Package bitcask implements a log-structured hash table storage engine.
+//
+// Every write is appended to the active data file and an in-memory keydir
+// maps each key to the location of its latest record, so a read costs
+// a single disk access. Keys must fit in memory, values don't have to.
+// Full data files become immutable, background merge rewrites the live
+// records of immutable files into new files together with hint files,
+// which let the keydir be rebuilt on startup without reading the values.
+package bitcask
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/lockstat"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage/engine"
+	"github.com/sattellite/bcdb/trace"
+)
+
+type Options struct {
+	// Dir is the directory of the data files.
+	Dir string
+	// MaxFileSize is the size of the active data file in bytes that triggers its rotation.
+	MaxFileSize int64
+	// MergeInterval is how often the merge conditions are checked.
+	MergeInterval time.Duration
+	// MergeRatio is the share of dead bytes in immutable files that triggers merge.
+	MergeRatio float64
+	// SyncWrites syncs the active data file to disk on every write.
+	SyncWrites bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxFileSize <= 0 {
+		o.MaxFileSize = 64 << 20
+	}
+	if o.MergeInterval <= 0 {
+		o.MergeInterval = time.Minute
+	}
+	if o.MergeRatio <= 0 || o.MergeRatio > 1 {
+		o.MergeRatio = 0.5
+	}
+	return o
+}
+
+// fileStats tracks the size of the data file and how much of it is overwritten or deleted.
+type fileStats struct {
+	total int64
+	dead  int64
+}
+
+type Bitcask struct {
+	done    chan struct{}
+	opts    Options
+	logger  *slog.Logger
+	closing chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+	// merging serializes merges.
+	merging sync.Mutex
+
+	mu         lockstat.RWMutex
+	closed     bool
+	keydir     map[string]location
+	files      map[uint64]*os.File
+	stats      map[uint64]*fileStats
+	active     *os.File
+	activeID   uint64
+	activeSize int64
+	nextID     uint64
+	buf        []byte
+	// lastMerge is the time of the last merge.
+	lastMerge time.Time
+}
+
+func New(l *slog.Logger, done chan struct{}, opts Options) (*Bitcask, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if done == nil {
+		return nil, errors.New("done channel is required")
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("data directory is required")
+	}
+
+	b := &Bitcask{
+		done:    done,
+		opts:    opts.withDefaults(),
+		logger:  l.With("engine", "bitcask"),
+		closing: make(chan struct{}),
+		keydir:  make(map[string]location),
+		files:   make(map[uint64]*os.File),
+		stats:   make(map[uint64]*fileStats),
+		nextID:  1,
+	}
+	b.mu.Track("bitcask")
+	if err := b.open(); err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+
+	b.wg.Add(1)
+	go b.merger()
+	return b, nil
+}
+
+// open rebuilds the keydir from hint and data files and creates a new active file.
+func (b *Bitcask) open() error {
+	if err := os.MkdirAll(b.opts.Dir, 0o755); err != nil {
+		return err
+	}
+
+	ids, err := listFiles(b.opts.Dir, dataExt)
+	if err != nil {
+		return err
+	}
+	slices.Sort(ids)
+
+	start := time.Now()
+	for _, id := range ids {
+		if lErr := b.load(id); lErr != nil {
+			return fmt.Errorf("load data file %d: %w", id, lErr)
+		}
+		b.nextID = id + 1
+	}
+	b.logger.Info("loaded keydir",
+		slog.Int("files", len(ids)),
+		slog.Int("keys", len(b.keydir)),
+		slog.Duration("elapsed", time.Since(start)))
+
+	return b.rotate()
+}
+
+// load applies records of the data file to the keydir, using its hint file if there is one.
+func (b *Bitcask) load(id uint64) error {
+	path := fileName(b.opts.Dir, id, dataExt)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	b.files[id] = f
+	b.stats[id] = &fileStats{}
+
+	hErr := readHints(fileName(b.opts.Dir, id, hintExt), id, b.apply)
+	if hErr == nil {
+		stat, sErr := f.Stat()
+		if sErr != nil {
+			return sErr
+		}
+		b.stats[id].total = stat.Size()
+		return nil
+	}
+	if !errors.Is(hErr, os.ErrNotExist) {
+		b.logger.Warn("failed to read hint file, scanning data file", slog.Uint64("file", id), slog.Any("error", hErr))
+	}
+
+	size, err := scanFile(path, id, b.apply)
+	if err != nil {
+		return err
+	}
+	b.stats[id].total = size
+	return nil
+}
+
+// apply updates the keydir with the record. Caller must hold the write lock
+// or be the only user of the engine.
+func (b *Bitcask) apply(r record) {
+	if old, ok := b.keydir[r.key]; ok {
+		b.stats[old.file].dead += old.size
+	}
+	if r.deleted {
+		delete(b.keydir, r.key)
+		b.stats[r.loc.file].dead += r.loc.size
+		return
+	}
+	b.keydir[r.key] = r.loc
+}
+
+func (b *Bitcask) allocID() uint64 {
+	id := b.nextID
+	b.nextID++
+	return id
+}
+
+// rotate makes the active file immutable and creates a new one.
+// Caller must hold the write lock.
+func (b *Bitcask) rotate() error {
+	id := b.allocID()
+	f, err := os.OpenFile(fileName(b.opts.Dir, id, dataExt), os.O_CREATE|os.O_EXCL|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if b.active != nil {
+		if sErr := b.active.Sync(); sErr != nil {
+			b.logger.Error("failed to sync data file", slog.Uint64("file", b.activeID), slog.Any("error", sErr))
+		}
+	}
+
+	b.active, b.activeID, b.activeSize = f, id, 0
+	b.files[id] = f
+	b.stats[id] = &fileStats{}
+	return nil
+}
+
+func (b *Bitcask) Set(ctx context.Context, key string, value any) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+	data, err := engine.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+
+	b.lock(ctx)
+	defer b.mu.Unlock()
+	return b.write(ctx, key, data, false)
+}
+
+func (b *Bitcask) Get(ctx context.Context, key string) (any, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return nil, engine.ErrEmptyKey
+	}
+	value, err := b.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return engine.DecodeValue(value)
+}
+
+func (b *Bitcask) get(key string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, engine.ErrClosed
+	}
+	loc, ok := b.keydir[key]
+	if !ok {
+		return nil, engine.ErrNotFound
+	}
+	data, err := readRecord(b.files[loc.file], loc)
+	if err != nil {
+		return nil, fmt.Errorf("read %q from data file %d: %w", key, loc.file, err)
+	}
+	return data[loc.size-loc.valueSize:], nil
+}
+
+// readRecord reads the whole record and verifies its checksum.
+func readRecord(f *os.File, loc location) ([]byte, error) {
+	data := make([]byte, loc.size)
+	if _, err := f.ReadAt(data, loc.offset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data[4:]) != binary.LittleEndian.Uint32(data) {
+		return nil, errCorrupted
+	}
+	return data, nil
+}
+
+func (b *Bitcask) Del(ctx context.Context, key string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+
+	b.lock(ctx)
+	defer b.mu.Unlock()
+	if b.closed {
+		return engine.ErrClosed
+	}
+	if _, ok := b.keydir[key]; !ok {
+		return engine.ErrNotFound
+	}
+	return b.write(ctx, key, nil, true)
+}
+
+func (b *Bitcask) Keys(ctx context.Context) (keys []string, err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, engine.ErrClosed
+	}
+	keys = make([]string, 0, len(b.keydir))
+	for key := range b.keydir {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// lock takes the write lock, tracing the wait.
+func (b *Bitcask) lock(ctx context.Context) {
+	_, span := trace.Start(ctx, "bitcask.lock")
+	b.mu.Lock()
+	span.End()
+}
+
+// write appends the record to the active file and updates the keydir.
+// Caller must hold the write lock.
+func (b *Bitcask) write(ctx context.Context, key string, value []byte, deleted bool) error {
+	if b.closed {
+		return engine.ErrClosed
+	}
+	if b.activeSize >= b.opts.MaxFileSize {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+
+	b.buf = appendRecord(b.buf[:0], key, value, deleted)
+	if _, err := b.active.Write(b.buf); err != nil {
+		// drop the partial record, so offsets of the next records stay valid
+		if tErr := b.active.Truncate(b.activeSize); tErr != nil {
+			b.logger.Error("failed to truncate data file", slog.Uint64("file", b.activeID), slog.Any("error", tErr))
+		}
+		return err
+	}
+	if b.opts.SyncWrites {
+		_, span := trace.Start(ctx, "bitcask.fsync", slog.Uint64("file", b.activeID))
+		err := b.active.Sync()
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			return err
+		}
+	}
+
+	size := int64(len(b.buf))
+	loc := location{file: b.activeID, offset: b.activeSize, size: size, valueSize: int64(len(value))}
+	b.activeSize += size
+	b.stats[b.activeID].total += size
+	b.apply(record{key: key, deleted: deleted, loc: loc})
+	return nil
+}
+
+// Persistence returns the time of the last merge and the size of the data files.
+func (b *Bitcask) Persistence() engine.Persistence {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	p := engine.Persistence{LastSave: b.lastMerge}
+	for _, st := range b.stats {
+		p.LogSize += st.total
+	}
+	return p
+}
+
+// Collect exposes the number of data files, their size and the size of dead records.
+func (b *Bitcask) Collect() []metrics.Family {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var total, dead int64
+	for _, st := range b.stats {
+		total += st.total
+		dead += st.dead
+	}
+	gauge := func(name, help string, v float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.TypeGauge, Samples: []metrics.Sample{{Value: v}}}
+	}
+	return []metrics.Family{
+		gauge("bcdb_bitcask_files", "Data files.", float64(len(b.stats))),
+		gauge("bcdb_bitcask_keys", "Live keys.", float64(len(b.keydir))),
+		gauge("bcdb_bitcask_data_bytes", "Size of data files.", float64(total)),
+		gauge("bcdb_bitcask_dead_bytes", "Size of overwritten and deleted records.", float64(dead)),
+	}
+}
+
+func (b *Bitcask) Done() <-chan struct{} {
+	return b.done
+}
+
+// Close stops background merge, syncs the active file and closes the files.
+func (b *Bitcask) Close(ctx context.Context) {
+	b.logger.Info("closing")
+	closed := false
+	b.once.Do(func() {
+		closed = true
+		close(b.closing)
+
+		stopped := make(chan struct{})
+		go func() {
+			b.wg.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			b.logger.Warn("waiting for background work", slog.Any("error", ctx.Err()))
+			<-stopped
+		}
+
+		b.mu.Lock()
+		b.closed = true
+		if err := b.active.Sync(); err != nil {
+			b.logger.Error("failed to sync data file", slog.Uint64("file", b.activeID), slog.Any("error", err))
+		}
+		b.closeFiles()
+		b.mu.Unlock()
+		close(b.done)
+	})
+	if !closed {
+		b.logger.Warn("already closed")
+	}
+}
+
+func (b *Bitcask) closeFiles() {
+	for id, f := range b.files {
+		_ = f.Close()
+		delete(b.files, id)
+	}
+}
@@ -0,0 +1,290 @@
+package bitcask
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestBitcask(t *testing.T, opts Options) *Bitcask {
+	t.Helper()
+	b, err := New(noopLogger, make(chan struct{}), opts)
+	require.NoError(t, err)
+	return b
+}
+
+func closeBitcask(t *testing.T, b *Bitcask) {
+	t.Helper()
+	b.Close(context.Background())
+	select {
+	case <-b.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine is not closed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		logger  *slog.Logger
+		done    chan struct{}
+		opts    Options
+		wantErr bool
+	}{
+		{name: "valid", logger: noopLogger, done: make(chan struct{}), opts: Options{Dir: t.TempDir()}},
+		{name: "no logger", done: make(chan struct{}), opts: Options{Dir: t.TempDir()}, wantErr: true},
+		{name: "no done", logger: noopLogger, opts: Options{Dir: t.TempDir()}, wantErr: true},
+		{name: "no dir", logger: noopLogger, done: make(chan struct{}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(tt.logger, tt.done, tt.opts)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			closeBitcask(t, b)
+		})
+	}
+}
+
+func TestBitcask_SetGetDel(t *testing.T) {
+	b := newTestBitcask(t, Options{Dir: t.TempDir()})
+	defer closeBitcask(t, b)
+	ctx := context.Background()
+
+	require.NoError(t, b.Set(ctx, "key", "value"))
+	value, err := b.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	require.NoError(t, b.Set(ctx, "bytes", []byte{1, 2, 3}))
+	value, err = b.Get(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, value)
+
+	require.NoError(t, b.Del(ctx, "key"))
+	_, err = b.Get(ctx, "key")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	require.ErrorIs(t, b.Del(ctx, "key"), engine.ErrNotFound)
+
+	keys, err := b.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bytes"}, keys)
+
+	require.ErrorIs(t, b.Set(ctx, "", "value"), engine.ErrEmptyKey)
+	_, err = b.Get(ctx, "")
+	require.ErrorIs(t, err, engine.ErrEmptyKey)
+	require.ErrorIs(t, b.Del(ctx, ""), engine.ErrEmptyKey)
+	require.ErrorIs(t, b.Set(ctx, "number", 1), engine.ErrUnsupportedValue)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, b.Set(canceled, "key", "value"), context.Canceled)
+	_, err = b.Get(canceled, "bytes")
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, b.Del(canceled, "bytes"), context.Canceled)
+	_, err = b.Keys(canceled)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBitcask_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	opts := Options{Dir: dir, MaxFileSize: 256}
+
+	b := newTestBitcask(t, opts)
+	for i := range 100 {
+		require.NoError(t, b.Set(ctx, fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)))
+	}
+	require.NoError(t, b.Set(ctx, "key-0", "updated"))
+	require.NoError(t, b.Del(ctx, "key-1"))
+	closeBitcask(t, b)
+
+	files, err := listFiles(dir, dataExt)
+	require.NoError(t, err)
+	assert.Greater(t, len(files), 1, "data files should be rotated")
+
+	require.ErrorIs(t, b.Set(ctx, "key", "value"), engine.ErrClosed)
+	_, err = b.Get(ctx, "key-0")
+	require.ErrorIs(t, err, engine.ErrClosed)
+	// close again
+	b.Close(ctx)
+
+	b = newTestBitcask(t, opts)
+	defer closeBitcask(t, b)
+	value, err := b.Get(ctx, "key-0")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", value)
+	_, err = b.Get(ctx, "key-1")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	value, err = b.Get(ctx, "key-99")
+	require.NoError(t, err)
+	assert.Equal(t, "value-99", value)
+}
+
+func TestBitcask_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	b := newTestBitcask(t, Options{Dir: dir})
+	require.NoError(t, b.Set(ctx, "key", "value"))
+	id := b.activeID
+	closeBitcask(t, b)
+
+	// a record interrupted by a crash
+	f, err := os.OpenFile(fileName(dir, id, dataExt), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write(appendRecord(nil, "torn", []byte("value"), false)[:headerSize+2])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b = newTestBitcask(t, Options{Dir: dir})
+	defer closeBitcask(t, b)
+	value, err := b.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+	_, err = b.Get(ctx, "torn")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+}
+
+func TestBitcask_Merge(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	opts := Options{Dir: dir, MaxFileSize: 1 << 10}
+
+	b := newTestBitcask(t, opts)
+	const count = 500
+	for round := range 3 {
+		for i := range count {
+			require.NoError(t, b.Set(ctx, fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%d-%d", i, round)))
+		}
+	}
+	for i := 0; i < count; i += 2 {
+		require.NoError(t, b.Del(ctx, fmt.Sprintf("key-%03d", i)))
+	}
+	require.True(t, b.needsMerge())
+	require.Zero(t, b.Persistence().LastSave)
+	sizeBefore := b.Persistence().LogSize
+
+	before, err := listFiles(dir, dataExt)
+	require.NoError(t, err)
+	require.NoError(t, b.Merge(ctx))
+	assert.NotZero(t, b.Persistence().LastSave)
+	assert.Less(t, b.Persistence().LogSize, sizeBefore)
+	after, err := listFiles(dir, dataExt)
+	require.NoError(t, err)
+	assert.Less(t, len(after), len(before))
+	assert.False(t, b.needsMerge())
+
+	hints, err := listFiles(dir, hintExt)
+	require.NoError(t, err)
+	assert.NotEmpty(t, hints)
+
+	check := func(b *Bitcask) {
+		for i := range count {
+			key := fmt.Sprintf("key-%03d", i)
+			value, gErr := b.Get(ctx, key)
+			if i%2 == 0 {
+				require.ErrorIs(t, gErr, engine.ErrNotFound, key)
+				continue
+			}
+			require.NoError(t, gErr, key)
+			assert.Equal(t, fmt.Sprintf("value-%d-2", i), value)
+		}
+		keys, kErr := b.Keys(ctx)
+		require.NoError(t, kErr)
+		assert.Len(t, keys, count/2)
+	}
+	check(b)
+
+	// writes after merge override merged values
+	require.NoError(t, b.Set(ctx, "key-001", "new"))
+	closeBitcask(t, b)
+
+	b = newTestBitcask(t, opts)
+	defer closeBitcask(t, b)
+	value, err := b.Get(ctx, "key-001")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+	require.NoError(t, b.Set(ctx, "key-001", "value-1-2"))
+	check(b)
+}
+
+func TestBitcask_MergeConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBitcask(t, Options{Dir: t.TempDir(), MaxFileSize: 1 << 10})
+	defer closeBitcask(t, b)
+
+	for i := range 200 {
+		require.NoError(t, b.Set(ctx, fmt.Sprintf("key-%d", i), "old"))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 200 {
+			assert.NoError(t, b.Set(ctx, fmt.Sprintf("key-%d", i), "new"))
+		}
+	}()
+	for range 5 {
+		require.NoError(t, b.Merge(ctx))
+	}
+	wg.Wait()
+
+	for i := range 200 {
+		value, err := b.Get(ctx, fmt.Sprintf("key-%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, "new", value)
+	}
+}
+
+func TestBitcask_BackgroundMerge(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	b := newTestBitcask(t, Options{Dir: dir, MaxFileSize: 256, MergeInterval: 10 * time.Millisecond})
+	defer closeBitcask(t, b)
+
+	for range 20 {
+		require.NoError(t, b.Set(ctx, "key", "value"))
+	}
+	require.Eventually(t, func() bool {
+		hints, err := listFiles(dir, hintExt)
+		return err == nil && len(hints) > 0
+	}, 5*time.Second, 10*time.Millisecond, "immutable files should be merged")
+
+	value, err := b.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestReadHints_Corrupted(t *testing.T) {
+	path := fileName(t.TempDir(), 1, hintExt)
+	data := appendHint(nil, "key", location{offset: 10, size: 20, valueSize: 5})
+	require.NoError(t, writeHints(path, data))
+
+	var got []record
+	require.NoError(t, readHints(path, 1, func(r record) { got = append(got, r) }))
+	assert.Equal(t, []record{{key: "key", loc: location{file: 1, offset: 10, size: 20, valueSize: 5}}}, got)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	raw[0] ^= 0xff
+	require.NoError(t, os.WriteFile(path, raw, 0o644))
+	require.ErrorIs(t, readHints(path, 1, func(record) { t.Fatal("record of corrupted file") }), errCorrupted)
+}
@@ -0,0 +1,86 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+)
+
+// Hint files are written next to merged data files. They hold locations
+// of all the keys of the data file without values, so startup doesn't
+// have to read the data. A hint entry is
+// [key length][offset][record size][value size][key],
+// the file ends with crc32 of all the entries.
+
+func appendHint(buf []byte, key string, loc location) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = binary.AppendUvarint(buf, uint64(loc.offset))
+	buf = binary.AppendUvarint(buf, uint64(loc.size))
+	buf = binary.AppendUvarint(buf, uint64(loc.valueSize))
+	return append(buf, key...)
+}
+
+// writeHints replaces the hint file atomically.
+func writeHints(path string, data []byte) error {
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, wErr := f.Write(data); wErr != nil {
+		_ = f.Close()
+		return wErr
+	}
+	if sErr := f.Sync(); sErr != nil {
+		_ = f.Close()
+		return sErr
+	}
+	if cErr := f.Close(); cErr != nil {
+		return cErr
+	}
+	return os.Rename(tmp, path)
+}
+
+// readHints reads the hint file of the data file.
+func readHints(path string, id uint64, fn func(r record)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return errCorrupted
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return errCorrupted
+	}
+
+	// decode everything first, so a broken file doesn't apply a part of records
+	var records []record
+	for len(body) > 0 {
+		var fields [4]uint64
+		for i := range fields {
+			v, n := binary.Uvarint(body)
+			if n <= 0 {
+				return errCorrupted
+			}
+			fields[i] = v
+			body = body[n:]
+		}
+		if uint64(len(body)) < fields[0] {
+			return errCorrupted
+		}
+		records = append(records, record{
+			key: string(body[:fields[0]]),
+			loc: location{file: id, offset: int64(fields[1]), size: int64(fields[2]), valueSize: int64(fields[3])},
+		})
+		body = body[fields[0]:]
+	}
+
+	for _, r := range records {
+		fn(r)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package bitcask
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var errMergeAborted = errors.New("merge aborted")
+
+func (b *Bitcask) merger() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.opts.MergeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closing:
+			return
+		case <-ticker.C:
+		}
+
+		if !b.needsMerge() {
+			continue
+		}
+		if err := b.Merge(context.Background()); err != nil && !errors.Is(err, errMergeAborted) {
+			b.logger.Error("failed to merge", slog.Any("error", err))
+		}
+	}
+}
+
+// needsMerge reports whether the immutable files have enough dead bytes.
+func (b *Bitcask) needsMerge() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var total, dead int64
+	for id, st := range b.stats {
+		if id == b.activeID {
+			continue
+		}
+		total += st.total
+		dead += st.dead
+	}
+	return total > 0 && float64(dead) >= float64(total)*b.opts.MergeRatio
+}
+
+// moved is a live record copied by merge.
+type moved struct {
+	key string
+	old location
+	new location
+}
+
+// mergeOutput is a data file written by merge.
+type mergeOutput struct {
+	id    uint64
+	f     *os.File
+	w     *bufio.Writer
+	size  int64
+	hints []byte
+}
+
+// Merge rewrites live records of all the data files into new files and removes
+// the old ones. The active file is rotated first, so writes are not blocked.
+//
+// Merged files get ids between the old files and the new active file, which
+// keeps the order of records on startup: newer writes override merged values.
+func (b *Bitcask) Merge(ctx context.Context) error {
+	b.merging.Lock()
+	defer b.merging.Unlock()
+	start := time.Now()
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return engine.ErrClosed
+	}
+	inputs := make(map[uint64]*os.File, len(b.files))
+	for id, f := range b.files {
+		inputs[id] = f
+	}
+	// merge never needs more files than it reads, the last one takes the rest
+	reserved := make([]uint64, 0, len(inputs))
+	for range inputs {
+		reserved = append(reserved, b.allocID())
+	}
+	if err := b.rotate(); err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	var live []moved
+	for key, loc := range b.keydir {
+		if _, ok := inputs[loc.file]; ok {
+			live = append(live, moved{key: key, old: loc})
+		}
+	}
+	b.mu.Unlock()
+
+	// read the files sequentially
+	slices.SortFunc(live, func(x, y moved) int {
+		return cmp.Or(cmp.Compare(x.old.file, y.old.file), cmp.Compare(x.old.offset, y.old.offset))
+	})
+
+	outputs, err := b.writeMerged(ctx, inputs, reserved, live)
+	if err != nil {
+		removeOutputs(b.opts.Dir, outputs)
+		return err
+	}
+
+	reclaimed, err := b.applyMerge(inputs, outputs, live)
+	if err != nil {
+		removeOutputs(b.opts.Dir, outputs)
+		return err
+	}
+	b.removeInputs(inputs)
+	b.logger.Info("merged",
+		slog.Int("inputs", len(inputs)),
+		slog.Int("outputs", len(outputs)),
+		slog.Int("keys", len(live)),
+		slog.Int64("reclaimed", reclaimed),
+		slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// writeMerged copies the live records into the reserved files and writes their hint files.
+func (b *Bitcask) writeMerged(ctx context.Context, inputs map[uint64]*os.File, reserved []uint64, live []moved) ([]*mergeOutput, error) {
+	var outputs []*mergeOutput
+	var out *mergeOutput
+	for i := range live {
+		if i%1024 == 0 {
+			if b.isClosing() {
+				return outputs, errMergeAborted
+			}
+			if ctx.Err() != nil {
+				return outputs, ctx.Err()
+			}
+		}
+
+		if out == nil || (out.size >= b.opts.MaxFileSize && len(outputs) < len(reserved)) {
+			if out != nil {
+				if err := out.finish(b.opts.Dir); err != nil {
+					return outputs, err
+				}
+			}
+			f, err := os.OpenFile(fileName(b.opts.Dir, reserved[len(outputs)], dataExt), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+			if err != nil {
+				return outputs, err
+			}
+			out = &mergeOutput{id: reserved[len(outputs)], f: f, w: bufio.NewWriter(f)}
+			outputs = append(outputs, out)
+		}
+
+		m := &live[i]
+		data, err := readRecord(inputs[m.old.file], m.old)
+		if err != nil {
+			return outputs, err
+		}
+		if _, wErr := out.w.Write(data); wErr != nil {
+			return outputs, wErr
+		}
+		m.new = location{file: out.id, offset: out.size, size: m.old.size, valueSize: m.old.valueSize}
+		out.hints = appendHint(out.hints, m.key, m.new)
+		out.size += m.old.size
+	}
+
+	if out != nil {
+		if err := out.finish(b.opts.Dir); err != nil {
+			return outputs, err
+		}
+	}
+	return outputs, nil
+}
+
+// finish syncs the data file and writes its hint file.
+func (o *mergeOutput) finish(dir string) error {
+	if err := o.w.Flush(); err != nil {
+		return err
+	}
+	if err := o.f.Sync(); err != nil {
+		return err
+	}
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	o.f = nil
+	return writeHints(fileName(dir, o.id, hintExt), o.hints)
+}
+
+// applyMerge points the keydir to the merged records, unless they were overwritten
+// meanwhile, and returns the number of reclaimed bytes.
+func (b *Bitcask) applyMerge(inputs map[uint64]*os.File, outputs []*mergeOutput, live []moved) (int64, error) {
+	readers := make(map[uint64]*os.File, len(outputs))
+	for _, o := range outputs {
+		f, err := os.Open(fileName(b.opts.Dir, o.id, dataExt))
+		if err != nil {
+			for _, r := range readers {
+				_ = r.Close()
+			}
+			return 0, err
+		}
+		readers[o.id] = f
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		for _, r := range readers {
+			_ = r.Close()
+		}
+		return 0, engine.ErrClosed
+	}
+
+	var reclaimed int64
+	for _, o := range outputs {
+		b.files[o.id] = readers[o.id]
+		b.stats[o.id] = &fileStats{total: o.size}
+		reclaimed -= o.size
+	}
+	for _, m := range live {
+		if b.keydir[m.key] == m.old {
+			b.keydir[m.key] = m.new
+			continue
+		}
+		b.stats[m.new.file].dead += m.new.size
+	}
+	for id := range inputs {
+		reclaimed += b.stats[id].total
+		delete(b.files, id)
+		delete(b.stats, id)
+	}
+	b.lastMerge = time.Now()
+	return reclaimed, nil
+}
+
+// removeInputs deletes merged files. Readers are done with them,
+// because the files were removed from the engine under the write lock.
+func (b *Bitcask) removeInputs(inputs map[uint64]*os.File) {
+	for id, f := range inputs {
+		_ = f.Close()
+		for _, ext := range []string{dataExt, hintExt} {
+			if err := os.Remove(fileName(b.opts.Dir, id, ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				b.logger.Error("failed to remove merged file", slog.Uint64("file", id), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func removeOutputs(dir string, outputs []*mergeOutput) {
+	for _, o := range outputs {
+		if o.f != nil {
+			_ = o.f.Close()
+		}
+		_ = os.Remove(fileName(dir, o.id, dataExt))
+		_ = os.Remove(fileName(dir, o.id, hintExt))
+	}
+}
+
+func (b *Bitcask) isClosing() bool {
+	select {
+	case <-b.closing:
+		return true
+	default:
+		return false
+	}
+}
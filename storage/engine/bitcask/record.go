@@ -0,0 +1,137 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errCorrupted = errors.New("corrupted data")
+
+// Data file record layout:
+//
+//	crc32        checksum of the rest of the record
+//	flags        1 byte, flagTombstone for deleted keys
+//	key length   4 bytes
+//	value length 4 bytes
+//	key, value
+const headerSize = 4 + 1 + 4 + 4
+
+const flagTombstone byte = 1
+
+const (
+	dataExt = ".data"
+	hintExt = ".hint"
+)
+
+// location is the position of the latest record of a key.
+type location struct {
+	file   uint64
+	offset int64
+	// size is the size of the whole record.
+	size int64
+	// valueSize is the size of the value at the end of the record.
+	valueSize int64
+}
+
+func (l location) valueOffset() int64 {
+	return l.offset + l.size - l.valueSize
+}
+
+func appendRecord(buf []byte, key string, value []byte, deleted bool) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+	var flags byte
+	if deleted {
+		flags = flagTombstone
+	}
+	buf = append(buf, flags)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(key)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(value)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.LittleEndian.PutUint32(buf[start:], crc32.ChecksumIEEE(buf[start+4:]))
+	return buf
+}
+
+type record struct {
+	key     string
+	deleted bool
+	loc     location
+}
+
+// scanFile reads records of the data file and returns the size of its valid part.
+// A torn or corrupted record ends the scan, it is a write interrupted by a crash.
+func scanFile(path string, id uint64, fn func(r record)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		if _, rErr := io.ReadFull(r, header); rErr != nil {
+			if errors.Is(rErr, io.EOF) || errors.Is(rErr, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, rErr
+		}
+		keySize := int64(binary.LittleEndian.Uint32(header[5:]))
+		valueSize := int64(binary.LittleEndian.Uint32(header[9:]))
+
+		data := make([]byte, keySize+valueSize)
+		if _, rErr := io.ReadFull(r, data); rErr != nil {
+			if errors.Is(rErr, io.EOF) || errors.Is(rErr, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, rErr
+		}
+		crc := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, data)
+		if crc != binary.LittleEndian.Uint32(header) {
+			return offset, nil
+		}
+
+		size := headerSize + keySize + valueSize
+		fn(record{
+			key:     string(data[:keySize]),
+			deleted: header[4]&flagTombstone != 0,
+			loc:     location{file: id, offset: offset, size: size, valueSize: valueSize},
+		})
+		offset += size
+	}
+}
+
+func fileName(dir string, id uint64, ext string) string {
+	return filepath.Join(dir, strconv.FormatUint(id, 10)+ext)
+}
+
+// listFiles returns ids of the files with the extension in the directory.
+func listFiles(dir, ext string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ext)
+		if !ok || e.IsDir() {
+			continue
+		}
+		id, pErr := strconv.ParseUint(name, 10, 64)
+		if pErr != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnsupportedValue = errors.New("unsupported value type")
+
+// Value type tags of encoded values.
+const (
+	valueString byte = 's'
+	valueBytes  byte = 'b'
+)
+
+// EncodeValue converts a value to bytes for persistent engines.
+// Only strings and byte slices are supported.
+func EncodeValue(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return append([]byte{valueString}, v...), nil
+	case []byte:
+		return append([]byte{valueBytes}, v...), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, value)
+}
+
+// DecodeValue restores a value encoded by EncodeValue.
+func DecodeValue(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty value", ErrUnsupportedValue)
+	}
+	switch data[0] {
+	case valueString:
+		return string(data[1:]), nil
+	case valueBytes:
+		return append([]byte{}, data[1:]...), nil
+	}
+	return nil, fmt.Errorf("%w: tag %q", ErrUnsupportedValue, data[0])
+}
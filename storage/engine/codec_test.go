@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecodeValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		wantErr bool
+	}{
+		{name: "string", value: "value"},
+		{name: "empty string", value: ""},
+		{name: "bytes", value: []byte{0, 1, 2}},
+		{name: "empty bytes", value: []byte{}},
+		{name: "unsupported", value: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeValue(tt.value)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrUnsupportedValue)
+				return
+			}
+			require.NoError(t, err)
+
+			value, err := DecodeValue(data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+
+	_, err := DecodeValue(nil)
+	require.ErrorIs(t, err, ErrUnsupportedValue)
+	_, err = DecodeValue([]byte("x"))
+	require.ErrorIs(t, err, ErrUnsupportedValue)
+}
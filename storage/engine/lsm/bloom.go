@@ -0,0 +1,67 @@
+package lsm
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter answers whether a key may be in an SSTable,
+// so lookups of missing keys skip reading its blocks.
+type bloomFilter struct {
+	bits []byte
+	k    uint8
+}
+
+func bloomHash(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func newBloomFilter(hashes []uint64, bitsPerKey int) bloomFilter {
+	// k = ln(2) * bits per key minimizes false positives
+	k := uint8(max(1, min(30, int(float64(bitsPerKey)*math.Ln2))))
+	nbits := max(64, len(hashes)*bitsPerKey)
+	b := bloomFilter{bits: make([]byte, (nbits+7)/8), k: k}
+	for _, h := range hashes {
+		b.add(h)
+	}
+	return b
+}
+
+func (b bloomFilter) add(h uint64) {
+	nbits := uint64(len(b.bits) * 8)
+	delta := h>>33 | h<<31
+	for range b.k {
+		pos := h % nbits
+		b.bits[pos/8] |= 1 << (pos % 8)
+		h += delta
+	}
+}
+
+func (b bloomFilter) mayContain(h uint64) bool {
+	if len(b.bits) == 0 {
+		return true
+	}
+	nbits := uint64(len(b.bits) * 8)
+	delta := h>>33 | h<<31
+	for range b.k {
+		pos := h % nbits
+		if b.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
+func (b bloomFilter) encode() []byte {
+	return append([]byte{b.k}, b.bits...)
+}
+
+func decodeBloomFilter(data []byte) (bloomFilter, error) {
+	if len(data) < 1 {
+		return bloomFilter{}, errCorrupted
+	}
+	return bloomFilter{k: data[0], bits: data[1:]}, nil
+}
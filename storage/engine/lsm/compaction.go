@@ -0,0 +1,262 @@
+package lsm
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+var errCompactionAborted = errors.New("compaction aborted")
+
+// compaction merges tables of a level with overlapping tables of the next level.
+type compaction struct {
+	level int
+	// inputs are tables of the level, newest first.
+	inputs []*table
+	// overlaps are tables of the next level.
+	overlaps []*table
+	// dropTombstones is set when no deeper level can hold older values.
+	dropTombstones bool
+}
+
+func (t *LSM) compactor() {
+	defer t.wg.Done()
+	for {
+		select {
+		case <-t.closing:
+			return
+		case <-t.compactCh:
+		}
+
+		for c := t.pickCompaction(); c != nil; c = t.pickCompaction() {
+			err := t.compact(c)
+			if errors.Is(err, errCompactionAborted) {
+				return
+			}
+			if err != nil {
+				t.logger.Error("failed to compact", slog.Int("level", c.level), slog.Any("error", err))
+				break
+			}
+		}
+	}
+}
+
+// levelMaxBytes returns the size of the level that triggers its compaction.
+func (t *LSM) levelMaxBytes(level int) int64 {
+	size := t.opts.LevelSizeBase
+	for range level - 1 {
+		size *= int64(t.opts.LevelSizeMultiplier)
+	}
+	return size
+}
+
+func (t *LSM) pickCompaction() *compaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.levels[0]) >= t.opts.L0CompactionTrigger {
+		inputs := slices.Clone(t.levels[0])
+		smallest, largest := keyRange(inputs)
+		return t.newCompaction(0, inputs, overlapping(t.levels[1], smallest, largest))
+	}
+
+	for level := 1; level < maxLevels-1; level++ {
+		if levelSize(t.levels[level]) <= t.levelMaxBytes(level) {
+			continue
+		}
+		// compact tables of the level in turns, so the whole key range is rewritten
+		tables := t.levels[level]
+		i := slices.IndexFunc(tables, func(tbl *table) bool {
+			return tbl.smallest > t.cursors[level]
+		})
+		if i < 0 {
+			i = 0
+		}
+		tbl := tables[i]
+		t.cursors[level] = tbl.largest
+		return t.newCompaction(level, []*table{tbl}, overlapping(t.levels[level+1], tbl.smallest, tbl.largest))
+	}
+	return nil
+}
+
+// newCompaction creates the compaction. Caller must hold the lock.
+func (t *LSM) newCompaction(level int, inputs, overlaps []*table) *compaction {
+	c := &compaction{level: level, inputs: inputs, overlaps: overlaps, dropTombstones: true}
+	for _, ts := range t.levels[level+2:] {
+		if len(ts) > 0 {
+			c.dropTombstones = false
+		}
+	}
+	return c
+}
+
+func (t *LSM) compact(c *compaction) error {
+	start := time.Now()
+	iters := make([]iterator, 0, len(c.inputs)+len(c.overlaps))
+	for _, tbl := range c.inputs {
+		iters = append(iters, tbl.iter())
+	}
+	for _, tbl := range c.overlaps {
+		iters = append(iters, tbl.iter())
+	}
+
+	outputs, err := t.writeTables(newMergeIter(iters...), c.dropTombstones)
+	if err != nil {
+		return err
+	}
+
+	if aErr := t.applyCompaction(c, outputs); aErr != nil {
+		dropTables(outputs)
+		return aErr
+	}
+	t.logger.Debug("compacted",
+		slog.Int("level", c.level),
+		slog.Int("inputs", len(c.inputs)+len(c.overlaps)),
+		slog.Int("outputs", len(outputs)),
+		slog.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+// writeTables splits entries of the iterator into tables of the target size.
+func (t *LSM) writeTables(it iterator, dropTombstones bool) ([]*table, error) {
+	var outputs []*table
+	var w *tableWriter
+	fail := func(err error) ([]*table, error) {
+		if w != nil {
+			w.abort()
+		}
+		dropTables(outputs)
+		return nil, err
+	}
+
+	for n := 0; it.next(); n++ {
+		if n%1024 == 0 && t.isClosing() {
+			return fail(errCompactionAborted)
+		}
+		i := it.item()
+		if dropTombstones && i.entry.deleted {
+			continue
+		}
+
+		if w == nil {
+			var err error
+			if w, err = t.newTableWriter(); err != nil {
+				return fail(err)
+			}
+		}
+		if err := w.add(i.key, i.entry); err != nil {
+			return fail(err)
+		}
+		if w.size() >= uint64(t.opts.TableSize) {
+			tbl, err := t.finishTable(w)
+			w = nil
+			if err != nil {
+				return fail(err)
+			}
+			outputs = append(outputs, tbl)
+		}
+	}
+	if err := it.err(); err != nil {
+		return fail(err)
+	}
+
+	if w != nil {
+		tbl, err := t.finishTable(w)
+		w = nil
+		if err != nil {
+			return fail(err)
+		}
+		outputs = append(outputs, tbl)
+	}
+	return outputs, nil
+}
+
+func (t *LSM) newTableWriter() (*tableWriter, error) {
+	t.mu.Lock()
+	id := t.allocID()
+	t.mu.Unlock()
+	return newTableWriter(t.opts.Dir, id, t.opts.BlockSize, t.opts.BloomBitsPerKey)
+}
+
+func (t *LSM) finishTable(w *tableWriter) (*table, error) {
+	if err := w.finish(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return openTable(w.path, w.id)
+}
+
+// applyCompaction replaces inputs with outputs and persists the new levels.
+func (t *LSM) applyCompaction(c *compaction, outputs []*table) error {
+	t.mu.Lock()
+	prev, next := t.levels[c.level], t.levels[c.level+1]
+
+	t.levels[c.level] = slices.DeleteFunc(slices.Clone(prev), func(tbl *table) bool {
+		return slices.Contains(c.inputs, tbl)
+	})
+	merged := slices.DeleteFunc(slices.Clone(next), func(tbl *table) bool {
+		return slices.Contains(c.overlaps, tbl)
+	})
+	merged = append(merged, outputs...)
+	slices.SortFunc(merged, func(a, b *table) int {
+		return strings.Compare(a.smallest, b.smallest)
+	})
+	t.levels[c.level+1] = merged
+
+	if err := t.saveManifest(); err != nil {
+		t.levels[c.level], t.levels[c.level+1] = prev, next
+		t.mu.Unlock()
+		return err
+	}
+	t.mu.Unlock()
+
+	dropTables(c.inputs)
+	dropTables(c.overlaps)
+	return nil
+}
+
+func (t *LSM) isClosing() bool {
+	select {
+	case <-t.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// dropTables removes the tables once readers release them.
+func dropTables(tables []*table) {
+	for _, tbl := range tables {
+		tbl.obsolete.Store(true)
+		tbl.unref()
+	}
+}
+
+func keyRange(tables []*table) (string, string) {
+	smallest, largest := tables[0].smallest, tables[0].largest
+	for _, tbl := range tables[1:] {
+		smallest = min(smallest, tbl.smallest)
+		largest = max(largest, tbl.largest)
+	}
+	return smallest, largest
+}
+
+func overlapping(tables []*table, smallest, largest string) []*table {
+	var res []*table
+	for _, tbl := range tables {
+		if tbl.overlaps(smallest, largest) {
+			res = append(res, tbl)
+		}
+	}
+	return res
+}
+
+func levelSize(tables []*table) int64 {
+	var size int64
+	for _, tbl := range tables {
+		size += tbl.size
+	}
+	return size
+}
@@ -0,0 +1,103 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+)
+
+var errCorrupted = errors.New("corrupted data")
+
+// entry is a value or a tombstone of a deleted key.
+type entry struct {
+	value   []byte
+	deleted bool
+}
+
+const (
+	flagValue     byte = 0
+	flagTombstone byte = 1
+)
+
+// appendEntry encodes the entry as [key length][key][flag][value length][value].
+func appendEntry(buf []byte, key string, e entry) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	if e.deleted {
+		return append(buf, flagTombstone)
+	}
+	buf = append(buf, flagValue)
+	buf = binary.AppendUvarint(buf, uint64(len(e.value)))
+	return append(buf, e.value...)
+}
+
+// decodeEntry decodes an entry encoded by appendEntry and returns the number of read bytes.
+func decodeEntry(data []byte) (string, entry, int, error) {
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < keyLen+1 {
+		return "", entry{}, 0, errCorrupted
+	}
+	pos := n
+	key := string(data[pos : pos+int(keyLen)])
+	pos += int(keyLen)
+
+	flag := data[pos]
+	pos++
+	if flag == flagTombstone {
+		return key, entry{deleted: true}, pos, nil
+	}
+	if flag != flagValue {
+		return "", entry{}, 0, errCorrupted
+	}
+
+	valueLen, vn := binary.Uvarint(data[pos:])
+	if vn <= 0 || uint64(len(data)-pos-vn) < valueLen {
+		return "", entry{}, 0, errCorrupted
+	}
+	pos += vn
+	value := slices.Clone(data[pos : pos+int(valueLen)])
+	pos += int(valueLen)
+	return key, entry{value: value}, pos, nil
+}
+
+// memtable keeps the latest writes in memory until they are flushed to an SSTable.
+type memtable struct {
+	entries map[string]entry
+	size    int
+}
+
+func newMemtable() *memtable {
+	return &memtable{entries: make(map[string]entry)}
+}
+
+func (m *memtable) put(key string, e entry) {
+	if old, ok := m.entries[key]; ok {
+		m.size -= len(key) + len(old.value)
+	}
+	m.entries[key] = e
+	m.size += len(key) + len(e.value)
+}
+
+func (m *memtable) get(key string) (entry, bool) {
+	e, ok := m.entries[key]
+	return e, ok
+}
+
+func (m *memtable) empty() bool {
+	return len(m.entries) == 0
+}
+
+// iter returns the entries sorted by key.
+func (m *memtable) iter() iterator {
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	items := make([]item, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, item{key: key, entry: m.entries[key]})
+	}
+	return &sliceIter{items: items, pos: -1}
+}
@@ -0,0 +1,128 @@
+package lsm
+
+import (
+	"container/heap"
+)
+
+type item struct {
+	key   string
+	entry entry
+}
+
+// iterator walks entries in key order.
+type iterator interface {
+	next() bool
+	item() item
+	err() error
+}
+
+type sliceIter struct {
+	items []item
+	pos   int
+}
+
+func (it *sliceIter) next() bool {
+	it.pos++
+	return it.pos < len(it.items)
+}
+
+func (it *sliceIter) item() item {
+	return it.items[it.pos]
+}
+
+func (it *sliceIter) err() error {
+	return nil
+}
+
+// mergeIter merges iterators ordered from the newest to the oldest.
+// For duplicated keys only the newest entry is returned.
+type mergeIter struct {
+	heap    iterHeap
+	current item
+	failure error
+}
+
+func newMergeIter(iters ...iterator) *mergeIter {
+	m := &mergeIter{}
+	for prio, it := range iters {
+		m.push(it, prio)
+	}
+	heap.Init(&m.heap)
+	return m
+}
+
+func (m *mergeIter) push(it iterator, prio int) {
+	if it.next() {
+		m.heap = append(m.heap, &heapItem{iter: it, prio: prio})
+		return
+	}
+	if err := it.err(); err != nil && m.failure == nil {
+		m.failure = err
+	}
+}
+
+func (m *mergeIter) next() bool {
+	if m.failure != nil || len(m.heap) == 0 {
+		return false
+	}
+
+	top := m.heap[0]
+	m.current = top.iter.item()
+	// skip older entries of the same key
+	for len(m.heap) > 0 && m.heap[0].iter.item().key == m.current.key {
+		h := m.heap[0]
+		if h.iter.next() {
+			heap.Fix(&m.heap, 0)
+			continue
+		}
+		if err := h.iter.err(); err != nil {
+			m.failure = err
+			return false
+		}
+		heap.Pop(&m.heap)
+	}
+	return true
+}
+
+func (m *mergeIter) item() item {
+	return m.current
+}
+
+func (m *mergeIter) err() error {
+	return m.failure
+}
+
+type heapItem struct {
+	iter iterator
+	prio int
+}
+
+type iterHeap []*heapItem
+
+func (h iterHeap) Len() int {
+	return len(h)
+}
+
+func (h iterHeap) Less(i, j int) bool {
+	ki, kj := h[i].iter.item().key, h[j].iter.item().key
+	if ki != kj {
+		return ki < kj
+	}
+	return h[i].prio < h[j].prio
+}
+
+func (h iterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *iterHeap) Push(x any) {
+	*h = append(*h, x.(*heapItem))
+}
+
+func (h *iterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,683 @@
+// Package lsm implements a storage engine based on a log-structured merge tree.
+//
+// Writes go to the write-ahead log and the memtable. A full memtable becomes
+// immutable and is flushed to a sorted table (SSTable) on level 0 in background.
+// Tables of level 0 may overlap, tables of deeper levels don't. Background
+// compaction merges tables into deeper levels once a level grows too large,
+// dropping overwritten values and tombstones of deleted keys.
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/lockstat"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage/engine"
+	"github.com/sattellite/bcdb/trace"
+)
+
+const maxLevels = 7
+
+// Failed flushes are retried with a delay doubling from flushRetryMin up to flushRetryMax.
+const (
+	flushRetryMin = 100 * time.Millisecond
+	flushRetryMax = 10 * time.Second
+)
+
+type Options struct {
+	// Dir is the directory of the data files.
+	Dir string
+	// MemtableSize is the size of the memtable in bytes that triggers a flush.
+	MemtableSize int
+	// BlockSize is the size of SSTable data blocks in bytes.
+	BlockSize int
+	// TableSize is the target size of tables created by compaction.
+	TableSize int
+	// L0CompactionTrigger is the number of level 0 tables that triggers compaction.
+	L0CompactionTrigger int
+	// LevelSizeBase is the maximum size of level 1 in bytes,
+	// every next level is LevelSizeMultiplier times larger.
+	LevelSizeBase       int64
+	LevelSizeMultiplier int
+	// BloomBitsPerKey is the size of bloom filters per key.
+	BloomBitsPerKey int
+	// SyncWrites syncs the write-ahead log to disk on every write.
+	SyncWrites bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.MemtableSize <= 0 {
+		o.MemtableSize = 4 << 20
+	}
+	if o.BlockSize <= 0 {
+		o.BlockSize = 4 << 10
+	}
+	if o.TableSize <= 0 {
+		o.TableSize = 2 << 20
+	}
+	if o.L0CompactionTrigger <= 0 {
+		o.L0CompactionTrigger = 4
+	}
+	if o.LevelSizeBase <= 0 {
+		o.LevelSizeBase = 10 << 20
+	}
+	if o.LevelSizeMultiplier <= 1 {
+		o.LevelSizeMultiplier = 10
+	}
+	if o.BloomBitsPerKey <= 0 {
+		o.BloomBitsPerKey = 10
+	}
+	return o
+}
+
+type LSM struct {
+	done    chan struct{}
+	opts    Options
+	logger  *slog.Logger
+	closing chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+
+	flushCh   chan struct{}
+	compactCh chan struct{}
+
+	// flushTable writes the immutable memtable, tests replace it to inject failures.
+	flushTable func(it iterator) (*table, error)
+
+	mu lockstat.RWMutex
+	// flushed is signaled when the immutable memtable is flushed or its flush fails.
+	flushed *sync.Cond
+	// flushErr is the error of the last flush, writers waiting for the flush return it.
+	flushErr error
+	closed   bool
+	mem     *memtable
+	imm     *memtable
+	log     *wal
+	logID   uint64
+	immLog  uint64
+	nextID  uint64
+	// levels[0] is ordered from the newest table, deeper levels by keys.
+	levels [maxLevels][]*table
+	// cursors of the next table to compact on every level.
+	cursors [maxLevels]string
+	// lastFlush is the time of the last memtable flush.
+	lastFlush time.Time
+}
+
+func New(l *slog.Logger, done chan struct{}, opts Options) (*LSM, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if done == nil {
+		return nil, errors.New("done channel is required")
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("data directory is required")
+	}
+
+	t := &LSM{
+		done:      done,
+		opts:      opts.withDefaults(),
+		logger:    l.With("engine", "lsm"),
+		closing:   make(chan struct{}),
+		flushCh:   make(chan struct{}, 1),
+		compactCh: make(chan struct{}, 1),
+		mem:       newMemtable(),
+	}
+	t.mu.Track("lsm")
+	t.flushed = sync.NewCond(&t.mu)
+	t.flushTable = t.writeTable
+
+	if err := t.open(); err != nil {
+		t.closeTables()
+		return nil, err
+	}
+
+	t.wg.Add(2)
+	go t.flusher()
+	go t.compactor()
+	t.scheduleCompaction()
+	return t, nil
+}
+
+// open restores the tree from the manifest and replays write-ahead logs.
+func (t *LSM) open() error {
+	if err := os.MkdirAll(t.opts.Dir, 0o755); err != nil {
+		return err
+	}
+
+	m, err := loadManifest(t.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("load manifest: %w", err)
+	}
+	t.nextID = m.NextID
+
+	live := make(map[uint64]bool)
+	for level, ids := range m.Levels {
+		if level >= maxLevels {
+			return fmt.Errorf("too many levels in manifest: %d", len(m.Levels))
+		}
+		for _, id := range ids {
+			tbl, oErr := openTable(fileName(t.opts.Dir, id, tableExt), id)
+			if oErr != nil {
+				return oErr
+			}
+			t.levels[level] = append(t.levels[level], tbl)
+			live[id] = true
+		}
+	}
+
+	// tables of interrupted flushes and compactions
+	ids, err := listFiles(t.opts.Dir, tableExt)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !live[id] {
+			_ = os.Remove(fileName(t.opts.Dir, id, tableExt))
+		}
+	}
+
+	if rErr := t.recover(); rErr != nil {
+		return rErr
+	}
+
+	t.logID = t.allocID()
+	t.log, err = createWAL(fileName(t.opts.Dir, t.logID, walExt), t.opts.SyncWrites)
+	return err
+}
+
+// recover flushes writes of the logs left after a crash to level 0.
+func (t *LSM) recover() error {
+	ids, err := listFiles(t.opts.Dir, walExt)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	slices.Sort(ids)
+
+	mem := newMemtable()
+	for _, id := range ids {
+		if rErr := replayWAL(fileName(t.opts.Dir, id, walExt), mem.put); rErr != nil {
+			return fmt.Errorf("replay log %d: %w", id, rErr)
+		}
+	}
+	t.logger.Info("recovered write-ahead log", slog.Int("logs", len(ids)), slog.Int("keys", len(mem.entries)))
+
+	if !mem.empty() {
+		tbl, wErr := t.writeTable(mem.iter())
+		if wErr != nil {
+			return wErr
+		}
+		t.levels[0] = append([]*table{tbl}, t.levels[0]...)
+		if sErr := t.saveManifest(); sErr != nil {
+			return sErr
+		}
+	}
+
+	for _, id := range ids {
+		_ = os.Remove(fileName(t.opts.Dir, id, walExt))
+	}
+	return nil
+}
+
+func (t *LSM) allocID() uint64 {
+	id := t.nextID
+	t.nextID++
+	return id
+}
+
+// saveManifest writes the current levels. Caller must hold the write lock
+// or be the only user of the tree.
+func (t *LSM) saveManifest() error {
+	m := manifest{NextID: t.nextID, Levels: make([][]uint64, maxLevels)}
+	for level, tables := range t.levels {
+		m.Levels[level] = make([]uint64, 0, len(tables))
+		for _, tbl := range tables {
+			m.Levels[level] = append(m.Levels[level], tbl.id)
+		}
+	}
+	return saveManifest(t.opts.Dir, m)
+}
+
+// writeTable writes entries of the iterator into a new table.
+func (t *LSM) writeTable(it iterator) (*table, error) {
+	w, err := t.newTableWriter()
+	if err != nil {
+		return nil, err
+	}
+	for it.next() {
+		if aErr := w.add(it.item().key, it.item().entry); aErr != nil {
+			w.abort()
+			return nil, aErr
+		}
+	}
+	if iErr := it.err(); iErr != nil {
+		w.abort()
+		return nil, iErr
+	}
+	return t.finishTable(w)
+}
+
+func (t *LSM) Set(ctx context.Context, key string, value any) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+	data, err := engine.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	return t.write(ctx, key, entry{value: data})
+}
+
+func (t *LSM) Get(ctx context.Context, key string) (any, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return nil, engine.ErrEmptyKey
+	}
+	e, ok, err := t.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || e.deleted {
+		return nil, engine.ErrNotFound
+	}
+	return engine.DecodeValue(e.value)
+}
+
+func (t *LSM) Del(ctx context.Context, key string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+
+	// the key is checked under the write lock, so a concurrent Set
+	// can't happen between the check and the tombstone
+	_, span := trace.Start(ctx, "lsm.lock")
+	t.mu.Lock()
+	span.End()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return engine.ErrClosed
+	}
+	e, ok := t.memGet(key)
+	if !ok {
+		var err error
+		if e, ok, err = tablesGet(t.levels, key); err != nil {
+			return err
+		}
+	}
+	if !ok || e.deleted {
+		return engine.ErrNotFound
+	}
+	return t.writeLocked(ctx, key, entry{deleted: true})
+}
+
+func (t *LSM) Keys(ctx context.Context) (keys []string, err error) {
+	iters, release, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	it := newMergeIter(iters...)
+	for it.next() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !it.item().entry.deleted {
+			keys = append(keys, it.item().key)
+		}
+	}
+	return keys, it.err()
+}
+
+// write appends the entry to the log and the memtable,
+// rotating the memtable when it is full.
+func (t *LSM) write(ctx context.Context, key string, e entry) error {
+	_, span := trace.Start(ctx, "lsm.lock")
+	t.mu.Lock()
+	span.End()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return engine.ErrClosed
+	}
+	return t.writeLocked(ctx, key, e)
+}
+
+// writeLocked appends the entry to the log and the memtable. Caller must hold the write lock.
+func (t *LSM) writeLocked(ctx context.Context, key string, e entry) error {
+	if t.mem.size >= t.opts.MemtableSize {
+		if err := t.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := t.log.append(ctx, key, e); err != nil {
+		return err
+	}
+	t.mem.put(key, e)
+	return nil
+}
+
+// rotate makes the memtable immutable and schedules its flush.
+// Writers wait while the previous memtable is still being flushed,
+// and fail while its flush fails. Caller must hold the write lock.
+func (t *LSM) rotate() error {
+	for t.imm != nil && !t.closed && t.flushErr == nil {
+		t.flushed.Wait()
+	}
+	if t.closed {
+		return engine.ErrClosed
+	}
+	if t.imm != nil {
+		return fmt.Errorf("flush memtable: %w", t.flushErr)
+	}
+
+	id := t.allocID()
+	log, err := createWAL(fileName(t.opts.Dir, id, walExt), t.opts.SyncWrites)
+	if err != nil {
+		return err
+	}
+	if cErr := t.log.close(); cErr != nil {
+		t.logger.Error("failed to close write-ahead log", slog.Any("error", cErr))
+	}
+
+	t.imm, t.immLog = t.mem, t.logID
+	t.mem, t.log, t.logID = newMemtable(), log, id
+
+	select {
+	case t.flushCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (t *LSM) get(key string) (entry, bool, error) {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return entry{}, false, engine.ErrClosed
+	}
+	if e, ok := t.memGet(key); ok {
+		t.mu.RUnlock()
+		return e, true, nil
+	}
+	tables := t.refTables()
+	t.mu.RUnlock()
+	defer unrefTables(tables)
+	return tablesGet(tables, key)
+}
+
+// memGet finds the key in the memtables. Caller must hold the lock.
+func (t *LSM) memGet(key string) (entry, bool) {
+	if e, ok := t.mem.get(key); ok {
+		return e, true
+	}
+	if t.imm != nil {
+		return t.imm.get(key)
+	}
+	return entry{}, false
+}
+
+// tablesGet finds the newest entry of the key in the tables.
+func tablesGet(tables [maxLevels][]*table, key string) (entry, bool, error) {
+	for level, ts := range tables {
+		for _, tbl := range ts {
+			if level > 0 && (key < tbl.smallest || key > tbl.largest) {
+				continue
+			}
+			e, ok, err := tbl.get(key)
+			if err != nil {
+				return entry{}, false, err
+			}
+			if ok {
+				return e, true, nil
+			}
+		}
+	}
+	return entry{}, false, nil
+}
+
+// snapshot returns iterators over all data from the newest to the oldest.
+func (t *LSM) snapshot() ([]iterator, func(), error) {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return nil, nil, engine.ErrClosed
+	}
+	iters := []iterator{t.mem.iter()}
+	if t.imm != nil {
+		iters = append(iters, t.imm.iter())
+	}
+	tables := t.refTables()
+	t.mu.RUnlock()
+
+	for _, ts := range tables {
+		for _, tbl := range ts {
+			iters = append(iters, tbl.iter())
+		}
+	}
+	return iters, func() { unrefTables(tables) }, nil
+}
+
+// refTables returns the current tables and holds them until unrefTables.
+// Caller must hold the lock.
+func (t *LSM) refTables() [maxLevels][]*table {
+	var tables [maxLevels][]*table
+	for level, ts := range t.levels {
+		tables[level] = slices.Clone(ts)
+		for _, tbl := range ts {
+			tbl.ref()
+		}
+	}
+	return tables
+}
+
+func unrefTables(tables [maxLevels][]*table) {
+	for _, ts := range tables {
+		for _, tbl := range ts {
+			tbl.unref()
+		}
+	}
+}
+
+// flusher flushes rotated memtables. Failed flushes are retried with
+// a growing delay, the memtable stays in its write-ahead log meanwhile.
+func (t *LSM) flusher() {
+	defer t.wg.Done()
+	var retry <-chan time.Time
+	delay := flushRetryMin
+	for {
+		select {
+		case <-t.closing:
+			return
+		case <-t.flushCh:
+		case <-retry:
+		}
+		retry = nil
+		if err := t.flush(); err != nil {
+			t.logger.Error("failed to flush memtable", slog.Any("error", err), slog.Duration("retry", delay))
+			retry = time.After(delay)
+			delay = min(2*delay, flushRetryMax)
+			continue
+		}
+		delay = flushRetryMin
+	}
+}
+
+// flush writes the immutable memtable to level 0.
+func (t *LSM) flush() error {
+	t.mu.RLock()
+	imm, logID := t.imm, t.immLog
+	t.mu.RUnlock()
+	if imm == nil {
+		return nil
+	}
+
+	start := time.Now()
+	tbl, err := t.flushTable(imm.iter())
+	if err != nil {
+		t.mu.Lock()
+		t.flushErr = err
+		t.flushed.Broadcast()
+		t.mu.Unlock()
+		return err
+	}
+
+	t.mu.Lock()
+	t.levels[0] = append([]*table{tbl}, t.levels[0]...)
+	t.imm, t.flushErr = nil, nil
+	t.lastFlush = time.Now()
+	err = t.saveManifest()
+	t.flushed.Broadcast()
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(fileName(t.opts.Dir, logID, walExt))
+	t.logger.Debug("memtable flushed", slog.Uint64("table", tbl.id), slog.Duration("elapsed", time.Since(start)))
+	t.scheduleCompaction()
+	return nil
+}
+
+func (t *LSM) scheduleCompaction() {
+	select {
+	case t.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+// Persistence returns the time of the last memtable flush and the size of the write-ahead log.
+func (t *LSM) Persistence() engine.Persistence {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	p := engine.Persistence{LastSave: t.lastFlush}
+	if t.log != nil {
+		p.LogSize = t.log.size
+	}
+	return p
+}
+
+// Collect exposes the number of tables on every level and the size of the write-ahead log.
+func (t *LSM) Collect() []metrics.Family {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tables := metrics.Family{Name: "bcdb_lsm_tables", Help: "Tables of the LSM-tree by level.", Type: metrics.TypeGauge}
+	for level, ts := range t.levels {
+		tables.Samples = append(tables.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "level", Value: strconv.Itoa(level)}},
+			Value:  float64(len(ts)),
+		})
+	}
+	var walSize int64
+	if t.log != nil {
+		walSize = t.log.size
+	}
+	return []metrics.Family{
+		tables,
+		{Name: "bcdb_lsm_wal_bytes", Help: "Size of the write-ahead log.", Type: metrics.TypeGauge, Samples: []metrics.Sample{{Value: float64(walSize)}}},
+	}
+}
+
+func (t *LSM) Done() <-chan struct{} {
+	return t.done
+}
+
+// Close stops background work, flushes the memtable and closes the files.
+func (t *LSM) Close(ctx context.Context) {
+	t.logger.Info("closing")
+	closed := false
+	t.once.Do(func() {
+		closed = true
+		close(t.closing)
+
+		stopped := make(chan struct{})
+		go func() {
+			t.wg.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			t.logger.Warn("waiting for background work", slog.Any("error", ctx.Err()))
+			<-stopped
+		}
+
+		t.mu.Lock()
+		t.closed = true
+		t.flushed.Broadcast()
+		t.mu.Unlock()
+
+		if err := t.flushAll(); err != nil {
+			t.logger.Error("failed to flush memtable", slog.Any("error", err))
+		}
+		t.closeTables()
+		close(t.done)
+	})
+	if !closed {
+		t.logger.Warn("already closed")
+	}
+}
+
+// flushAll writes both memtables to level 0 on close.
+func (t *LSM) flushAll() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	err := t.log.close()
+	pending := !t.mem.empty()
+	if pending {
+		t.imm, t.immLog = t.mem, t.logID
+		t.mem = newMemtable()
+	}
+	logID := t.logID
+	t.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if pending {
+		return t.flush()
+	}
+	return os.Remove(fileName(t.opts.Dir, logID, walExt))
+}
+
+func (t *LSM) closeTables() {
+	for level, ts := range t.levels {
+		for _, tbl := range ts {
+			tbl.unref()
+		}
+		t.levels[level] = nil
+	}
+}
@@ -0,0 +1,379 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// smallOptions makes the tree flush and compact after a few writes.
+func smallOptions(dir string) Options {
+	return Options{
+		Dir:                 dir,
+		MemtableSize:        1 << 10,
+		BlockSize:           256,
+		TableSize:           2 << 10,
+		L0CompactionTrigger: 2,
+		LevelSizeBase:       4 << 10,
+		LevelSizeMultiplier: 2,
+	}
+}
+
+func newTestLSM(t *testing.T, opts Options) *LSM {
+	t.Helper()
+	tree, err := New(noopLogger, make(chan struct{}), opts)
+	require.NoError(t, err)
+	return tree
+}
+
+func closeLSM(t *testing.T, tree *LSM) {
+	t.Helper()
+	tree.Close(context.Background())
+	select {
+	case <-tree.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine is not closed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		logger  *slog.Logger
+		done    chan struct{}
+		opts    Options
+		wantErr bool
+	}{
+		{name: "valid", logger: noopLogger, done: make(chan struct{}), opts: Options{Dir: t.TempDir()}},
+		{name: "no logger", done: make(chan struct{}), opts: Options{Dir: t.TempDir()}, wantErr: true},
+		{name: "no done", logger: noopLogger, opts: Options{Dir: t.TempDir()}, wantErr: true},
+		{name: "no dir", logger: noopLogger, done: make(chan struct{}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := New(tt.logger, tt.done, tt.opts)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			closeLSM(t, tree)
+		})
+	}
+}
+
+func TestLSM_SetGetDel(t *testing.T) {
+	tree := newTestLSM(t, Options{Dir: t.TempDir()})
+	defer closeLSM(t, tree)
+	ctx := context.Background()
+
+	require.NoError(t, tree.Set(ctx, "key", "value"))
+	value, err := tree.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	require.NoError(t, tree.Set(ctx, "bytes", []byte{1, 2, 3}))
+	value, err = tree.Get(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, value)
+
+	require.NoError(t, tree.Del(ctx, "key"))
+	_, err = tree.Get(ctx, "key")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	require.ErrorIs(t, tree.Del(ctx, "key"), engine.ErrNotFound)
+
+	require.ErrorIs(t, tree.Set(ctx, "", "value"), engine.ErrEmptyKey)
+	_, err = tree.Get(ctx, "")
+	require.ErrorIs(t, err, engine.ErrEmptyKey)
+	require.ErrorIs(t, tree.Del(ctx, ""), engine.ErrEmptyKey)
+	require.ErrorIs(t, tree.Set(ctx, "number", 1), engine.ErrUnsupportedValue)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, tree.Set(canceled, "key", "value"), context.Canceled)
+	_, err = tree.Get(canceled, "bytes")
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, tree.Del(canceled, "bytes"), context.Canceled)
+}
+
+func TestLSM_FlushAndCompaction(t *testing.T) {
+	dir := t.TempDir()
+	tree := newTestLSM(t, smallOptions(dir))
+	ctx := context.Background()
+
+	require.NoError(t, tree.Set(ctx, "key-00000", "value-0"))
+	assert.Positive(t, tree.Persistence().LogSize)
+	assert.Zero(t, tree.Persistence().LastSave)
+
+	const count = 2000
+	for i := range count {
+		require.NoError(t, tree.Set(ctx, fmt.Sprintf("key-%05d", i), fmt.Sprintf("value-%d", i)))
+	}
+	// overwrite and delete a part of the keys, so compaction has older versions to drop
+	for i := 0; i < count; i += 3 {
+		require.NoError(t, tree.Set(ctx, fmt.Sprintf("key-%05d", i), fmt.Sprintf("new-%d", i)))
+	}
+	for i := 1; i < count; i += 3 {
+		require.NoError(t, tree.Del(ctx, fmt.Sprintf("key-%05d", i)))
+	}
+
+	require.Eventually(t, func() bool {
+		tree.mu.RLock()
+		defer tree.mu.RUnlock()
+		return len(tree.levels[0]) < tree.opts.L0CompactionTrigger && len(tree.levels[1]) > 0
+	}, 5*time.Second, 10*time.Millisecond, "tables should be compacted")
+	assert.NotZero(t, tree.Persistence().LastSave)
+
+	check := func(tree *LSM) {
+		for i := range count {
+			key := fmt.Sprintf("key-%05d", i)
+			value, err := tree.Get(ctx, key)
+			switch i % 3 {
+			case 0:
+				require.NoError(t, err, key)
+				assert.Equal(t, fmt.Sprintf("new-%d", i), value)
+			case 1:
+				require.ErrorIs(t, err, engine.ErrNotFound, key)
+			case 2:
+				require.NoError(t, err, key)
+				assert.Equal(t, fmt.Sprintf("value-%d", i), value)
+			}
+		}
+		keys, err := tree.Keys(ctx)
+		require.NoError(t, err)
+		assert.Len(t, keys, count-(count+1)/3)
+		assert.True(t, slices.IsSorted(keys))
+	}
+	check(tree)
+	closeLSM(t, tree)
+
+	// reopen from the manifest
+	tree = newTestLSM(t, smallOptions(dir))
+	defer closeLSM(t, tree)
+	check(tree)
+
+	// obsolete tables are removed from the disk,
+	// compaction after reopen may still be writing its outputs
+	require.Eventually(t, func() bool {
+		tree.mu.RLock()
+		defer tree.mu.RUnlock()
+		tables, err := listFiles(dir, tableExt)
+		require.NoError(t, err)
+		var live int
+		for _, ts := range tree.levels {
+			live += len(ts)
+		}
+		return len(tables) == live
+	}, 5*time.Second, 10*time.Millisecond, "only live tables should be on the disk")
+}
+
+func TestLSM_CloseFlushesMemtable(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	tree := newTestLSM(t, Options{Dir: dir})
+	require.NoError(t, tree.Set(ctx, "key", "value"))
+	closeLSM(t, tree)
+
+	wals, err := listFiles(dir, walExt)
+	require.NoError(t, err)
+	assert.Empty(t, wals, "logs should be removed after flush")
+	tables, err := listFiles(dir, tableExt)
+	require.NoError(t, err)
+	assert.Len(t, tables, 1)
+
+	require.ErrorIs(t, tree.Set(ctx, "key", "value"), engine.ErrClosed)
+	_, err = tree.Get(ctx, "key")
+	require.ErrorIs(t, err, engine.ErrClosed)
+	// close again
+	tree.Close(ctx)
+
+	tree = newTestLSM(t, Options{Dir: dir})
+	defer closeLSM(t, tree)
+	value, err := tree.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestLSM_RecoverWAL(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	tree := newTestLSM(t, Options{Dir: dir})
+	require.NoError(t, tree.Set(ctx, "a", "1"))
+	require.NoError(t, tree.Set(ctx, "b", "2"))
+	require.NoError(t, tree.Del(ctx, "a"))
+
+	// simulate a crash: stop background work without flushing the memtable
+	tree.once.Do(func() {
+		close(tree.closing)
+		tree.wg.Wait()
+		require.NoError(t, tree.log.close())
+		tree.closeTables()
+	})
+
+	// torn record at the end of the log
+	f, err := os.OpenFile(fileName(dir, tree.logID, walExt), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{10, 0, 0, 0, 1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	tree = newTestLSM(t, Options{Dir: dir})
+	defer closeLSM(t, tree)
+	_, err = tree.Get(ctx, "a")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	value, err := tree.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
+
+func TestLSM_FlushFailure(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	tree := newTestLSM(t, smallOptions(dir))
+	failure := errors.New("no space left on device")
+	var failing atomic.Bool
+	failing.Store(true)
+	tree.mu.Lock()
+	tree.flushTable = func(it iterator) (*table, error) {
+		if failing.Load() {
+			return nil, failure
+		}
+		return tree.writeTable(it)
+	}
+	tree.mu.Unlock()
+
+	// writes fail instead of waiting for the flush forever
+	written := make(chan int)
+	go func() {
+		defer close(written)
+		for i := 0; ; i++ {
+			if err := tree.Set(ctx, fmt.Sprintf("key-%05d", i), "value"); err != nil {
+				assert.ErrorIs(t, err, failure)
+				written <- i
+				return
+			}
+		}
+	}()
+	var n int
+	select {
+	case n = <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write is blocked by the failed flush")
+	}
+	_, err := tree.Get(ctx, fmt.Sprintf("key-%05d", n))
+	require.ErrorIs(t, err, engine.ErrNotFound, "failed write should not be applied")
+
+	// the flusher retries and writes succeed again
+	failing.Store(false)
+	require.Eventually(t, func() bool {
+		return tree.Set(ctx, fmt.Sprintf("key-%05d", n), "value") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	closeLSM(t, tree)
+
+	tree = newTestLSM(t, smallOptions(dir))
+	defer closeLSM(t, tree)
+	for i := 0; i <= n; i++ {
+		value, err := tree.Get(ctx, fmt.Sprintf("key-%05d", i))
+		require.NoError(t, err)
+		assert.Equal(t, "value", value)
+	}
+}
+
+func TestLSM_RemovesUnknownTables(t *testing.T) {
+	dir := t.TempDir()
+	tree := newTestLSM(t, Options{Dir: dir})
+	closeLSM(t, tree)
+
+	// a table of an interrupted compaction
+	orphan := filepath.Join(dir, "1000"+tableExt)
+	require.NoError(t, os.WriteFile(orphan, []byte("partial"), 0o644))
+
+	tree = newTestLSM(t, Options{Dir: dir})
+	defer closeLSM(t, tree)
+	assert.NoFileExists(t, orphan)
+}
+
+func TestLSM_Concurrent(t *testing.T) {
+	tree := newTestLSM(t, smallOptions(t.TempDir()))
+	defer closeLSM(t, tree)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				key := fmt.Sprintf("w%d-%d", w, i)
+				assert.NoError(t, tree.Set(ctx, key, key))
+				value, err := tree.Get(ctx, key)
+				assert.NoError(t, err)
+				assert.Equal(t, key, value)
+				if i%10 == 0 {
+					_, err = tree.Keys(ctx)
+					assert.NoError(t, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	keys, err := tree.Keys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 8*200)
+}
+
+func TestLSM_ConcurrentDel(t *testing.T) {
+	tree := newTestLSM(t, smallOptions(t.TempDir()))
+	defer closeLSM(t, tree)
+	ctx := context.Background()
+
+	// only one of concurrent deletes of a key finds it
+	for round := range 100 {
+		key := fmt.Sprintf("key-%d", round%10)
+		require.NoError(t, tree.Set(ctx, key, "value"))
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		deleted := 0
+		start := make(chan struct{})
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				err := tree.Del(ctx, key)
+				if err == nil {
+					mu.Lock()
+					deleted++
+					mu.Unlock()
+					return
+				}
+				assert.ErrorIs(t, err, engine.ErrNotFound)
+			}()
+		}
+		close(start)
+		wg.Wait()
+		require.Equal(t, 1, deleted, "round %d", round)
+	}
+}
@@ -0,0 +1,103 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const manifestName = "MANIFEST"
+
+// manifest lists the tables of every level, so the tree can be restored on start.
+type manifest struct {
+	NextID uint64     `json:"next_id"`
+	Levels [][]uint64 `json:"levels"`
+}
+
+func loadManifest(dir string) (manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest{NextID: 1}, nil
+	}
+	if err != nil {
+		return manifest{}, err
+	}
+
+	var m manifest
+	if jErr := json.Unmarshal(data, &m); jErr != nil {
+		return manifest{}, jErr
+	}
+	return m, nil
+}
+
+// saveManifest replaces the manifest atomically.
+func saveManifest(dir string, m manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, manifestName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, wErr := f.Write(data); wErr != nil {
+		_ = f.Close()
+		return wErr
+	}
+	if sErr := f.Sync(); sErr != nil {
+		_ = f.Close()
+		return sErr
+	}
+	if cErr := f.Close(); cErr != nil {
+		return cErr
+	}
+	if rErr := os.Rename(tmp, filepath.Join(dir, manifestName)); rErr != nil {
+		return rErr
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+const (
+	tableExt = ".sst"
+	walExt   = ".wal"
+)
+
+func fileName(dir string, id uint64, ext string) string {
+	return filepath.Join(dir, strconv.FormatUint(id, 10)+ext)
+}
+
+// listFiles returns ids of the files with the extension in the directory.
+func listFiles(dir, ext string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ext)
+		if !ok || e.IsDir() {
+			continue
+		}
+		id, pErr := strconv.ParseUint(name, 10, 64)
+		if pErr != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,388 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// SSTable file layout:
+//
+//	data blocks  entries sorted by key, each block followed by crc32
+//	bloom block  bloom filter of all keys, followed by crc32
+//	index block  first key, offset and size of every data block and
+//	             the largest key of the table, followed by crc32
+//	footer       bloom offset, bloom size, index offset, index size, magic
+const (
+	tableMagic = 0x62636462_6c736d31 // "bcdblsm1"
+	footerSize = 5 * 8
+	crcSize    = 4
+)
+
+type blockHandle struct {
+	firstKey string
+	offset   uint64
+	size     uint64
+}
+
+type tableWriter struct {
+	f          *os.File
+	w          *bufio.Writer
+	id         uint64
+	path       string
+	blockSize  int
+	bitsPerKey int
+
+	offset  uint64
+	block   []byte
+	first   string
+	largest string
+	index   []blockHandle
+	hashes  []uint64
+}
+
+func newTableWriter(dir string, id uint64, blockSize, bitsPerKey int) (*tableWriter, error) {
+	path := fileName(dir, id, tableExt)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		f:          f,
+		w:          bufio.NewWriter(f),
+		id:         id,
+		path:       path,
+		blockSize:  blockSize,
+		bitsPerKey: bitsPerKey,
+	}, nil
+}
+
+// add appends the entry. Keys must be added in increasing order.
+func (w *tableWriter) add(key string, e entry) error {
+	if len(w.block) == 0 {
+		w.first = key
+	}
+	w.block = appendEntry(w.block, key, e)
+	w.largest = key
+	w.hashes = append(w.hashes, bloomHash(key))
+
+	if len(w.block) >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+// size returns the approximate size of the table.
+func (w *tableWriter) size() uint64 {
+	return w.offset + uint64(len(w.block))
+}
+
+func (w *tableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	handle, err := w.writeBlock(w.block)
+	if err != nil {
+		return err
+	}
+	handle.firstKey = w.first
+	w.index = append(w.index, handle)
+	w.block = w.block[:0]
+	return nil
+}
+
+func (w *tableWriter) writeBlock(data []byte) (blockHandle, error) {
+	handle := blockHandle{offset: w.offset, size: uint64(len(data))}
+	if _, err := w.w.Write(data); err != nil {
+		return blockHandle{}, err
+	}
+	if _, err := w.w.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))); err != nil {
+		return blockHandle{}, err
+	}
+	w.offset += uint64(len(data)) + crcSize
+	return handle, nil
+}
+
+// finish writes the metadata, syncs the file and closes it.
+func (w *tableWriter) finish() error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	bloom, err := w.writeBlock(newBloomFilter(w.hashes, w.bitsPerKey).encode())
+	if err != nil {
+		return err
+	}
+
+	idx := binary.AppendUvarint(nil, uint64(len(w.index)))
+	for _, h := range w.index {
+		idx = appendString(idx, h.firstKey)
+		idx = binary.AppendUvarint(idx, h.offset)
+		idx = binary.AppendUvarint(idx, h.size)
+	}
+	idx = appendString(idx, w.largest)
+	index, err := w.writeBlock(idx)
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, 0, footerSize)
+	footer = binary.LittleEndian.AppendUint64(footer, bloom.offset)
+	footer = binary.LittleEndian.AppendUint64(footer, bloom.size)
+	footer = binary.LittleEndian.AppendUint64(footer, index.offset)
+	footer = binary.LittleEndian.AppendUint64(footer, index.size)
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+	if _, wErr := w.w.Write(footer); wErr != nil {
+		return wErr
+	}
+
+	if fErr := w.w.Flush(); fErr != nil {
+		return fErr
+	}
+	if sErr := w.f.Sync(); sErr != nil {
+		return sErr
+	}
+	return w.f.Close()
+}
+
+// abort closes and removes the unfinished table.
+func (w *tableWriter) abort() {
+	_ = w.f.Close()
+	_ = os.Remove(w.path)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(data []byte) (string, int, error) {
+	l, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < l {
+		return "", 0, errCorrupted
+	}
+	return string(data[n : n+int(l)]), n + int(l), nil
+}
+
+// table is an immutable sorted file. It is reference counted,
+// so compaction can replace it while readers still use it.
+type table struct {
+	id       uint64
+	path     string
+	f        *os.File
+	size     int64
+	index    []blockHandle
+	bloom    bloomFilter
+	smallest string
+	largest  string
+
+	refs     atomic.Int32
+	obsolete atomic.Bool
+}
+
+func openTable(path string, id uint64) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := loadTable(f, path, id)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("open table %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func loadTable(f *os.File, path string, id uint64) (*table, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() < footerSize {
+		return nil, errCorrupted
+	}
+
+	footer := make([]byte, footerSize)
+	if _, rErr := f.ReadAt(footer, stat.Size()-footerSize); rErr != nil {
+		return nil, rErr
+	}
+	if binary.LittleEndian.Uint64(footer[32:]) != tableMagic {
+		return nil, errCorrupted
+	}
+
+	t := &table{id: id, path: path, f: f, size: stat.Size()}
+	bloomData, err := t.readBlock(binary.LittleEndian.Uint64(footer[0:]), binary.LittleEndian.Uint64(footer[8:]))
+	if err != nil {
+		return nil, err
+	}
+	if t.bloom, err = decodeBloomFilter(bloomData); err != nil {
+		return nil, err
+	}
+
+	indexData, err := t.readBlock(binary.LittleEndian.Uint64(footer[16:]), binary.LittleEndian.Uint64(footer[24:]))
+	if err != nil {
+		return nil, err
+	}
+	if err = t.decodeIndex(indexData); err != nil {
+		return nil, err
+	}
+
+	t.refs.Store(1)
+	return t, nil
+}
+
+func (t *table) decodeIndex(data []byte) error {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errCorrupted
+	}
+	pos := n
+	t.index = make([]blockHandle, 0, count)
+	for range count {
+		key, kn, err := readString(data[pos:])
+		if err != nil {
+			return err
+		}
+		pos += kn
+		offset, on := binary.Uvarint(data[pos:])
+		if on <= 0 {
+			return errCorrupted
+		}
+		pos += on
+		size, sn := binary.Uvarint(data[pos:])
+		if sn <= 0 {
+			return errCorrupted
+		}
+		pos += sn
+		t.index = append(t.index, blockHandle{firstKey: key, offset: offset, size: size})
+	}
+
+	largest, _, err := readString(data[pos:])
+	if err != nil {
+		return err
+	}
+	t.largest = largest
+	if len(t.index) > 0 {
+		t.smallest = t.index[0].firstKey
+	}
+	return nil
+}
+
+func (t *table) readBlock(offset, size uint64) ([]byte, error) {
+	buf := make([]byte, size+crcSize)
+	if _, err := t.f.ReadAt(buf, int64(offset)); err != nil {
+		return nil, err
+	}
+	data := buf[:size]
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(buf[size:]) {
+		return nil, errCorrupted
+	}
+	return data, nil
+}
+
+// overlaps reports whether the table has keys in the range.
+func (t *table) overlaps(smallest, largest string) bool {
+	return t.smallest <= largest && t.largest >= smallest
+}
+
+func (t *table) get(key string) (entry, bool, error) {
+	if key < t.smallest || key > t.largest || !t.bloom.mayContain(bloomHash(key)) {
+		return entry{}, false, nil
+	}
+
+	// the last block with the first key not greater than the key
+	i := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].firstKey > key
+	}) - 1
+	if i < 0 {
+		return entry{}, false, nil
+	}
+
+	data, err := t.readBlock(t.index[i].offset, t.index[i].size)
+	if err != nil {
+		return entry{}, false, err
+	}
+	for len(data) > 0 {
+		k, e, n, dErr := decodeEntry(data)
+		if dErr != nil {
+			return entry{}, false, dErr
+		}
+		if k == key {
+			return e, true, nil
+		}
+		if k > key {
+			break
+		}
+		data = data[n:]
+	}
+	return entry{}, false, nil
+}
+
+func (t *table) iter() iterator {
+	return &tableIter{table: t, block: -1}
+}
+
+func (t *table) ref() {
+	t.refs.Add(1)
+}
+
+// unref releases the table, obsolete tables are removed when unused.
+func (t *table) unref() {
+	if t.refs.Add(-1) > 0 {
+		return
+	}
+	_ = t.f.Close()
+	if t.obsolete.Load() {
+		_ = os.Remove(t.path)
+	}
+}
+
+type tableIter struct {
+	table   *table
+	block   int
+	data    []byte
+	current item
+	failure error
+}
+
+func (it *tableIter) next() bool {
+	for len(it.data) == 0 {
+		it.block++
+		if it.block >= len(it.table.index) {
+			return false
+		}
+		h := it.table.index[it.block]
+		data, err := it.table.readBlock(h.offset, h.size)
+		if err != nil {
+			it.failure = err
+			return false
+		}
+		it.data = data
+	}
+
+	key, e, n, err := decodeEntry(it.data)
+	if err != nil {
+		it.failure = err
+		return false
+	}
+	it.data = it.data[n:]
+	it.current = item{key: key, entry: e}
+	return true
+}
+
+func (it *tableIter) item() item {
+	return it.current
+}
+
+func (it *tableIter) err() error {
+	if errors.Is(it.failure, io.EOF) {
+		return errCorrupted
+	}
+	return it.failure
+}
@@ -0,0 +1,124 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestTable(t *testing.T, dir string, items []item) *table {
+	t.Helper()
+	w, err := newTableWriter(dir, 1, 64, 10)
+	require.NoError(t, err)
+	for _, i := range items {
+		require.NoError(t, w.add(i.key, i.entry))
+	}
+	require.NoError(t, w.finish())
+
+	tbl, err := openTable(w.path, w.id)
+	require.NoError(t, err)
+	t.Cleanup(tbl.unref)
+	return tbl
+}
+
+func TestTable(t *testing.T) {
+	var items []item
+	for i := range 100 {
+		e := entry{value: []byte(fmt.Sprintf("value-%d", i))}
+		if i%10 == 0 {
+			e = entry{deleted: true}
+		}
+		items = append(items, item{key: fmt.Sprintf("key-%03d", i), entry: e})
+	}
+	tbl := writeTestTable(t, t.TempDir(), items)
+
+	assert.Equal(t, "key-000", tbl.smallest)
+	assert.Equal(t, "key-099", tbl.largest)
+	assert.Greater(t, len(tbl.index), 1, "entries should be split into blocks")
+	assert.True(t, tbl.overlaps("key-050", "key-200"))
+	assert.False(t, tbl.overlaps("key-100", "key-200"))
+
+	for _, i := range items {
+		e, ok, err := tbl.get(i.key)
+		require.NoError(t, err)
+		require.True(t, ok, i.key)
+		assert.Equal(t, i.entry, e)
+	}
+	for _, key := range []string{"a", "key-0055", "key-100", "z"} {
+		_, ok, err := tbl.get(key)
+		require.NoError(t, err)
+		assert.False(t, ok, key)
+	}
+
+	it := tbl.iter()
+	var got []item
+	for it.next() {
+		got = append(got, it.item())
+	}
+	require.NoError(t, it.err())
+	assert.Equal(t, items, got)
+}
+
+func TestTable_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	tbl := writeTestTable(t, dir, []item{{key: "key", entry: entry{value: []byte("value")}}})
+
+	data, err := os.ReadFile(tbl.path)
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(tbl.path, data, 0o644))
+
+	_, _, err = tbl.get("key")
+	require.ErrorIs(t, err, errCorrupted)
+
+	require.NoError(t, os.WriteFile(tbl.path, data[:footerSize-1], 0o644))
+	_, err = openTable(tbl.path, tbl.id)
+	require.ErrorIs(t, err, errCorrupted)
+}
+
+func TestBloomFilter(t *testing.T) {
+	var hashes []uint64
+	for i := range 1000 {
+		hashes = append(hashes, bloomHash(fmt.Sprintf("key-%d", i)))
+	}
+	f, err := decodeBloomFilter(newBloomFilter(hashes, 10).encode())
+	require.NoError(t, err)
+
+	for _, h := range hashes {
+		assert.True(t, f.mayContain(h))
+	}
+	var falsePositives int
+	for i := range 1000 {
+		if f.mayContain(bloomHash(fmt.Sprintf("other-%d", i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 50)
+}
+
+func TestMergeIter(t *testing.T) {
+	newer := &sliceIter{pos: -1, items: []item{
+		{key: "a", entry: entry{value: []byte("new")}},
+		{key: "c", entry: entry{deleted: true}},
+	}}
+	older := &sliceIter{pos: -1, items: []item{
+		{key: "a", entry: entry{value: []byte("old")}},
+		{key: "b", entry: entry{value: []byte("old")}},
+		{key: "c", entry: entry{value: []byte("old")}},
+	}}
+
+	it := newMergeIter(newer, older)
+	var got []item
+	for it.next() {
+		got = append(got, it.item())
+	}
+	require.NoError(t, it.err())
+	assert.Equal(t, []item{
+		{key: "a", entry: entry{value: []byte("new")}},
+		{key: "b", entry: entry{value: []byte("old")}},
+		{key: "c", entry: entry{deleted: true}},
+	}, got)
+}
@@ -0,0 +1,104 @@
+package lsm
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/sattellite/bcdb/trace"
+)
+
+// wal is a write-ahead log of the memtable, so writes survive a crash
+// before the memtable is flushed. A record is [length][crc32][entry].
+type wal struct {
+	f    *os.File
+	w    *bufio.Writer
+	sync bool
+	buf  []byte
+	// size is the number of written bytes.
+	size int64
+}
+
+func createWAL(path string, sync bool) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{f: f, w: bufio.NewWriter(f), sync: sync}, nil
+}
+
+func (w *wal) append(ctx context.Context, key string, e entry) error {
+	w.buf = appendEntry(w.buf[:0], key, e)
+
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(w.buf)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(w.buf))
+	if _, err := w.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	w.size += int64(len(header) + len(w.buf))
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.sync {
+		_, span := trace.Start(ctx, "lsm.wal.fsync")
+		err := w.f.Sync()
+		span.SetError(err)
+		span.End()
+		return err
+	}
+	return nil
+}
+
+func (w *wal) close() error {
+	if err := w.w.Flush(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// replayWAL reads records of the log. A torn record at the end
+// of the log is a write interrupted by a crash and is ignored.
+func replayWAL(path string, fn func(key string, e entry)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header [8]byte
+	for {
+		if _, rErr := io.ReadFull(r, header[:]); rErr != nil {
+			if errors.Is(rErr, io.EOF) || errors.Is(rErr, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return rErr
+		}
+
+		data := make([]byte, binary.LittleEndian.Uint32(header[0:]))
+		if _, rErr := io.ReadFull(r, data); rErr != nil {
+			if errors.Is(rErr, io.EOF) || errors.Is(rErr, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return rErr
+		}
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:]) {
+			return nil
+		}
+
+		key, e, _, dErr := decodeEntry(data)
+		if dErr != nil {
+			return dErr
+		}
+		fn(key, e)
+	}
+}
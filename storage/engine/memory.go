@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"log/slog"
-	"time"
+	"sync"
+
+	"github.com/sattellite/bcdb/lockstat"
 )
 
 var (
 	ErrEmptyKey = errors.New("empty key")
 	ErrInternal = errors.New("internal error")
 	ErrNotFound = errors.New("not found")
+	ErrClosed   = errors.New("engine closed")
 )
 
 func NewMemory(l *slog.Logger, done chan struct{}) (*Memory, error) {
@@ -22,25 +25,24 @@ func NewMemory(l *slog.Logger, done chan struct{}) (*Memory, error) {
 		return nil, errors.New("done channel is required")
 	}
 
-	return &Memory{
+	m := &Memory{
 		done:   done,
 		store:  make(map[string]any),
 		logger: l.With("engine", "memory"),
-	}, nil
+	}
+	m.mu.Track("memory")
+	return m, nil
 }
 
 type Memory struct {
 	done   chan struct{}
+	once   sync.Once
+	mu     lockstat.RWMutex
 	store  map[string]any
 	logger *slog.Logger
 }
 
-func (m *Memory) Set(ctx context.Context, key string, value any) (err error) {
-	defer func(start time.Time) {
-		err = m.deferredLog("set", key, start, err)
-	}(time.Now())
-	m.logger.Debug("set", slog.String("key", key), slog.Any("value", value))
-
+func (m *Memory) Set(ctx context.Context, key string, value any) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -54,15 +56,13 @@ func (m *Memory) set(key string, value any) error {
 		return ErrEmptyKey
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.store[key] = value
 	return nil
 }
 
-func (m *Memory) Get(ctx context.Context, key string) (result any, err error) {
-	defer func(start time.Time) {
-		err = m.deferredLog("get", key, start, err)
-	}(time.Now())
-
+func (m *Memory) Get(ctx context.Context, key string) (any, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
@@ -76,6 +76,8 @@ func (m *Memory) get(key string) (any, error) {
 		return nil, ErrEmptyKey
 	}
 
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	value, ok := m.store[key]
 	if !ok {
 		return nil, ErrNotFound
@@ -84,11 +86,7 @@ func (m *Memory) get(key string) (any, error) {
 	return value, nil
 }
 
-func (m *Memory) Del(ctx context.Context, key string) (err error) {
-	defer func(start time.Time) {
-		err = m.deferredLog("del", key, start, err)
-	}(time.Now())
-
+func (m *Memory) Del(ctx context.Context, key string) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -102,6 +100,8 @@ func (m *Memory) del(key string) error {
 		return ErrEmptyKey
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if _, ok := m.store[key]; !ok {
 		return ErrNotFound
 	}
@@ -110,17 +110,23 @@ func (m *Memory) del(key string) error {
 	return nil
 }
 
-func (m *Memory) deferredLog(method, key string, start time.Time, err error) error {
-	if rErr := recover(); rErr != nil {
-		m.logger.Error(method, slog.String("key", key), slog.Any("error", rErr), slog.Duration("elapsed", time.Since(start)))
-		return ErrInternal
+func (m *Memory) Keys(ctx context.Context) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		return m.keys(), nil
 	}
-	if err != nil {
-		m.logger.Error(method, slog.String("key", key), slog.Any("error", err), slog.Duration("elapsed", time.Since(start)))
-		return err
+}
+
+func (m *Memory) keys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.store))
+	for key := range m.store {
+		keys = append(keys, key)
 	}
-	m.logger.Debug(method, slog.String("key", key), slog.Duration("elapsed", time.Since(start)))
-	return nil
+	return keys
 }
 
 func (m *Memory) Done() <-chan struct{} {
@@ -129,13 +135,12 @@ func (m *Memory) Done() <-chan struct{} {
 
 func (m *Memory) Close(_ context.Context) {
 	m.logger.Info("closing")
-	select {
-	case _, ok := <-m.done:
-		if ok {
-			m.done <- struct{}{}
-			close(m.done)
-		}
-	default:
+	closed := false
+	m.once.Do(func() {
+		closed = true
+		close(m.done)
+	})
+	if !closed {
 		m.logger.Warn("already closed")
 	}
 }
@@ -39,6 +39,24 @@ func TestMemory_SetGetDel(t *testing.T) {
 	assert.Nil(t, got2, "Get after Del returned non-nil value")
 }
 
+func TestMemory_Keys(t *testing.T) {
+	ctx := context.Background()
+	done := make(chan struct{})
+	defer close(done)
+	mem, _ := NewMemory(noopLogger, done)
+
+	keys, err := mem.Keys(ctx)
+	require.NoError(t, err, "Keys failed")
+	assert.Empty(t, keys, "Keys of empty storage should be empty")
+
+	require.NoError(t, mem.Set(ctx, "key1", "value1"))
+	require.NoError(t, mem.Set(ctx, "key2", "value2"))
+
+	keys, err = mem.Keys(ctx)
+	require.NoError(t, err, "Keys failed")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, keys, "Keys returned wrong keys")
+}
+
 func TestMemory_ContextCancellation(t *testing.T) {
 	done := make(chan struct{})
 	defer close(done)
@@ -59,6 +77,9 @@ func TestMemory_ContextCancellation(t *testing.T) {
 
 	err = mem.Del(ctx, key)
 	assert.Error(t, err, "Del should have failed due to context cancellation")
+
+	_, err = mem.Keys(ctx)
+	assert.Error(t, err, "Keys should have failed due to context cancellation")
 }
 
 func TestMemory_SetEmptyKey(t *testing.T) {
@@ -0,0 +1,17 @@
+package engine
+
+import "time"
+
+// Persistence describes the durable state of an engine.
+type Persistence struct {
+	// LastSave is the time of the last memtable flush or merge of data files,
+	// zero before the first one since the start.
+	LastSave time.Time
+	// LogSize is the number of bytes in the write-ahead log or in the data files.
+	LogSize int64
+}
+
+// Persister is implemented by durable engines.
+type Persister interface {
+	Persistence() Persistence
+}
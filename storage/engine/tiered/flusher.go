@@ -0,0 +1,115 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+// Failed write-back operations are retried with a delay doubling from retryMin up to retryMax.
+const (
+	retryMin = 100 * time.Millisecond
+	retryMax = 10 * time.Second
+)
+
+// enqueue records the operation as pending and queues it for the flusher.
+// It waits while the queue is full. Caller must hold the write lock.
+func (t *Tiered) enqueue(ctx context.Context, key string, value any, deleted bool) error {
+	t.pendingMu.Lock()
+	t.seq++
+	o := op{seq: t.seq, key: key, value: value, deleted: deleted}
+	prev, hadPrev := t.pending[key]
+	t.pending[key] = o
+	t.pendingMu.Unlock()
+
+	select {
+	case t.queue <- o:
+		return nil
+	default:
+	}
+
+	t.logger.Debug("write-back queue is full", slog.String("key", key))
+	select {
+	case t.queue <- o:
+		return nil
+	case <-ctx.Done():
+		t.pendingMu.Lock()
+		if t.pending[key].seq == o.seq {
+			// restore the previous operation unless it is already applied
+			if hadPrev && prev.seq > t.applied {
+				t.pending[key] = prev
+			} else {
+				delete(t.pending, key)
+			}
+		}
+		t.pendingMu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// pendingOp returns the latest queued operation of the key.
+func (t *Tiered) pendingOp(key string) (op, bool) {
+	t.pendingMu.RLock()
+	defer t.pendingMu.RUnlock()
+	o, ok := t.pending[key]
+	return o, ok
+}
+
+// flusher applies queued operations to the backend until the queue is closed and drained.
+func (t *Tiered) flusher() {
+	defer close(t.flushed)
+	// operations are applied even after the writer is gone
+	ctx := context.Background()
+	for o := range t.queue {
+		t.writeBack(ctx, o)
+
+		t.pendingMu.Lock()
+		t.applied = o.seq
+		if t.pending[o.key].seq == o.seq {
+			delete(t.pending, o.key)
+		}
+		t.pendingMu.Unlock()
+	}
+}
+
+// writeBack applies the operation to the backend. Failures are retried, so the
+// operation stays pending and later ones wait, until Close stops waiting for them.
+func (t *Tiered) writeBack(ctx context.Context, o op) {
+	delay := retryMin
+	for {
+		err := t.apply(ctx, o)
+		if err == nil {
+			t.flushCount.Add(1)
+			return
+		}
+		t.flushErrors.Add(1)
+
+		select {
+		case <-t.abort:
+			t.logger.Error("failed to write back, dropping", slog.String("key", o.key), slog.Bool("deleted", o.deleted), slog.Any("error", err))
+			return
+		default:
+		}
+		t.logger.Error("failed to write back", slog.String("key", o.key), slog.Bool("deleted", o.deleted), slog.Any("error", err), slog.Duration("retry", delay))
+		select {
+		case <-time.After(delay):
+		case <-t.abort:
+		}
+		delay = min(2*delay, retryMax)
+	}
+}
+
+// apply writes the operation to the backend.
+func (t *Tiered) apply(ctx context.Context, o op) error {
+	if !o.deleted {
+		return t.backend.Set(ctx, o.key, o.value)
+	}
+	// the key may be missing when its queued set was dropped
+	if err := t.backend.Del(ctx, o.key); !errors.Is(err, engine.ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package tiered
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru tracks keys of the cache from the most to the least recently used.
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// add marks the key as the most recently used and returns
+// the least recently used keys exceeding the capacity.
+func (l *lru) add(key string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.order.MoveToFront(e)
+		return nil
+	}
+	l.items[key] = l.order.PushFront(key)
+
+	var evicted []string
+	for l.order.Len() > l.capacity {
+		e := l.order.Back()
+		l.order.Remove(e)
+		key := e.Value.(string)
+		delete(l.items, key)
+		evicted = append(evicted, key)
+	}
+	return evicted
+}
+
+// touch marks a tracked key as the most recently used. Keys evicted
+// concurrently are not added back.
+func (l *lru) touch(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.order.MoveToFront(e)
+	}
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.order.Remove(e)
+		delete(l.items, key)
+	}
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
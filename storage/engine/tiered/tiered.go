@@ -0,0 +1,453 @@
+// Package tiered implements a storage engine that keeps a fast engine
+// as a cache in front of a slower durable engine.
+//
+// Reads are served from the cache and fall back to the backend on misses,
+// filling the cache. The cache holds a bounded number of keys, the least
+// recently used ones are evicted. In write-through mode writes go to the backend first
+// and then to the cache. In write-back mode writes go to the cache and
+// are applied to the backend asynchronously by a flusher in write order.
+package tiered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sattellite/bcdb/lockstat"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage/engine"
+	"github.com/sattellite/bcdb/trace"
+)
+
+// Engine is the storage engine used as the cache and the backend.
+type Engine interface {
+	Set(ctx context.Context, key string, value any) error
+	Get(ctx context.Context, key string) (any, error)
+	Del(ctx context.Context, key string) error
+	Keys(ctx context.Context) ([]string, error)
+
+	Done() <-chan struct{}
+	Close(ctx context.Context)
+}
+
+type Mode int
+
+const (
+	// WriteThrough writes to the backend synchronously.
+	WriteThrough Mode = iota
+	// WriteBack writes to the backend asynchronously.
+	WriteBack
+)
+
+func (m Mode) String() string {
+	switch m {
+	case WriteThrough:
+		return "write-through"
+	case WriteBack:
+		return "write-back"
+	}
+	return "unknown"
+}
+
+// ParseMode parses the name of the mode.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range []Mode{WriteThrough, WriteBack} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mode %q, expected %s or %s", s, WriteThrough, WriteBack)
+}
+
+type Options struct {
+	Mode Mode
+	// QueueSize is the number of pending write-back operations.
+	// Writers wait while the queue is full.
+	QueueSize int
+	// CacheSize is the maximum number of keys in the cache.
+	CacheSize int
+}
+
+func (o Options) withDefaults() Options {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1024
+	}
+	if o.CacheSize <= 0 {
+		o.CacheSize = 1 << 16
+	}
+	return o
+}
+
+// Stats are counters of the cache.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Cached is the number of keys in the cache.
+	Cached int
+	// Evictions is the number of keys evicted from the full cache.
+	Evictions uint64
+	// Pending is the number of keys waiting for write-back.
+	Pending int
+	// Flushed is the number of operations written back.
+	Flushed uint64
+	// FlushErrors is the number of failed write-back attempts.
+	FlushErrors uint64
+}
+
+// op is a write waiting to be applied to the backend.
+type op struct {
+	seq     uint64
+	key     string
+	value   any
+	deleted bool
+}
+
+type Tiered struct {
+	done    chan struct{}
+	opts    Options
+	logger  *slog.Logger
+	cache   Engine
+	backend Engine
+	lru     *lru
+	once    sync.Once
+
+	// mu serializes writes, so the write-back queue keeps their order.
+	mu     lockstat.Mutex
+	closed bool
+	// writes is incremented on every write, read-through doesn't fill
+	// the cache with a value read before a concurrent write.
+	writes atomic.Uint64
+
+	// pending is the latest queued operation of every key.
+	pendingMu lockstat.RWMutex
+	pending   map[string]op
+	seq       uint64
+	// applied is the sequence number of the last operation written back.
+	applied uint64
+	queue   chan op
+	flushed chan struct{}
+	// abort is closed when Close stops waiting for the write-back,
+	// failed operations are dropped instead of retried.
+	abort chan struct{}
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	flushCount  atomic.Uint64
+	flushErrors atomic.Uint64
+}
+
+func New(l *slog.Logger, done chan struct{}, cache, backend Engine, opts Options) (*Tiered, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if done == nil {
+		return nil, errors.New("done channel is required")
+	}
+	if cache == nil || backend == nil {
+		return nil, errors.New("cache and backend engines are required")
+	}
+	if opts.Mode != WriteThrough && opts.Mode != WriteBack {
+		return nil, fmt.Errorf("unknown mode %d", opts.Mode)
+	}
+
+	opts = opts.withDefaults()
+	t := &Tiered{
+		done:    done,
+		opts:    opts,
+		logger:  l.With("engine", "tiered", "mode", opts.Mode.String()),
+		cache:   cache,
+		backend: backend,
+		lru:     newLRU(opts.CacheSize),
+		pending: make(map[string]op),
+		queue:   make(chan op, opts.QueueSize),
+		flushed: make(chan struct{}),
+		abort:   make(chan struct{}),
+	}
+	t.mu.Track("tiered.writes")
+	t.pendingMu.Track("tiered.pending")
+	go t.flusher()
+	return t, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value any) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+
+	t.lock(ctx)
+	defer t.mu.Unlock()
+	if t.closed {
+		return engine.ErrClosed
+	}
+	t.writes.Add(1)
+
+	if t.opts.Mode == WriteBack {
+		if qErr := t.enqueue(ctx, key, value, false); qErr != nil {
+			return qErr
+		}
+	} else if bErr := t.backend.Set(ctx, key, value); bErr != nil {
+		return bErr
+	}
+	if cErr := t.cache.Set(ctx, key, value); cErr != nil {
+		return cErr
+	}
+	t.cached(ctx, key)
+	return nil
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (any, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return nil, engine.ErrEmptyKey
+	}
+
+	value, err := t.cache.Get(ctx, key)
+	if err == nil {
+		t.hits.Add(1)
+		t.lru.touch(key)
+		return value, nil
+	}
+	if !errors.Is(err, engine.ErrNotFound) {
+		return nil, err
+	}
+	t.misses.Add(1)
+
+	if p, ok := t.pendingOp(key); ok {
+		if p.deleted {
+			return nil, engine.ErrNotFound
+		}
+		return p.value, nil
+	}
+
+	writes := t.writes.Load()
+	value, err = t.backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	t.fill(ctx, key, value, writes)
+	return value, nil
+}
+
+// lock takes the write lock, tracing the wait.
+func (t *Tiered) lock(ctx context.Context) {
+	_, span := trace.Start(ctx, "tiered.lock")
+	t.mu.Lock()
+	span.End()
+}
+
+// fill caches the value read from the backend, unless there were writes since the read.
+func (t *Tiered) fill(ctx context.Context, key string, value any, writes uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.writes.Load() != writes {
+		return
+	}
+	if err := t.cache.Set(ctx, key, value); err != nil {
+		t.logger.Warn("failed to fill cache", slog.String("key", key), slog.Any("error", err))
+		return
+	}
+	t.cached(ctx, key)
+}
+
+// cached tracks the key written to the cache and evicts the least
+// recently used keys when the cache is full. Caller must hold the write lock.
+func (t *Tiered) cached(ctx context.Context, key string) {
+	for _, old := range t.lru.add(key) {
+		if err := t.cache.Del(ctx, old); err != nil && !errors.Is(err, engine.ErrNotFound) {
+			t.logger.Warn("failed to evict key", slog.String("key", old), slog.Any("error", err))
+			continue
+		}
+		t.evictions.Add(1)
+	}
+}
+
+func (t *Tiered) Del(ctx context.Context, key string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+
+	t.lock(ctx)
+	defer t.mu.Unlock()
+	if t.closed {
+		return engine.ErrClosed
+	}
+
+	if t.opts.Mode == WriteBack {
+		exists, eErr := t.exists(ctx, key)
+		if eErr != nil {
+			return eErr
+		}
+		if !exists {
+			return engine.ErrNotFound
+		}
+		t.writes.Add(1)
+		if qErr := t.enqueue(ctx, key, nil, true); qErr != nil {
+			return qErr
+		}
+	} else {
+		t.writes.Add(1)
+		if bErr := t.backend.Del(ctx, key); bErr != nil {
+			return bErr
+		}
+	}
+
+	t.lru.remove(key)
+	if cErr := t.cache.Del(ctx, key); cErr != nil && !errors.Is(cErr, engine.ErrNotFound) {
+		return cErr
+	}
+	return nil
+}
+
+// exists checks the key in the cache, the queue and the backend in this order.
+func (t *Tiered) exists(ctx context.Context, key string) (bool, error) {
+	_, err := t.cache.Get(ctx, key)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, engine.ErrNotFound) {
+		return false, err
+	}
+	if p, ok := t.pendingOp(key); ok {
+		return !p.deleted, nil
+	}
+	_, err = t.backend.Get(ctx, key)
+	if errors.Is(err, engine.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *Tiered) Keys(ctx context.Context) (keys []string, err error) {
+	// hold writes and removal of flushed operations,
+	// so the pending operations cover changes missing in the backend keys
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pendingMu.RLock()
+	defer t.pendingMu.RUnlock()
+
+	keys, err = t.backend.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.pending) == 0 {
+		return keys, nil
+	}
+	result := make([]string, 0, len(keys)+len(t.pending))
+	for _, key := range keys {
+		if _, ok := t.pending[key]; !ok {
+			result = append(result, key)
+		}
+	}
+	for key, p := range t.pending {
+		if !p.deleted {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+// Stats returns counters of the cache.
+func (t *Tiered) Stats() Stats {
+	t.pendingMu.RLock()
+	pending := len(t.pending)
+	t.pendingMu.RUnlock()
+	return Stats{
+		Hits:        t.hits.Load(),
+		Misses:      t.misses.Load(),
+		Cached:      t.lru.len(),
+		Evictions:   t.evictions.Load(),
+		Pending:     pending,
+		Flushed:     t.flushCount.Load(),
+		FlushErrors: t.flushErrors.Load(),
+	}
+}
+
+// Collect exposes counters of the cache and metrics of the backend.
+func (t *Tiered) Collect() []metrics.Family {
+	st := t.Stats()
+	single := func(name, help string, typ metrics.Type, v float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: typ, Samples: []metrics.Sample{{Value: v}}}
+	}
+	families := []metrics.Family{
+		single("bcdb_tiered_cache_hits_total", "Reads served by the cache.", metrics.TypeCounter, float64(st.Hits)),
+		single("bcdb_tiered_cache_misses_total", "Reads served by the backend.", metrics.TypeCounter, float64(st.Misses)),
+		single("bcdb_tiered_cache_keys", "Keys in the cache.", metrics.TypeGauge, float64(st.Cached)),
+		single("bcdb_tiered_cache_evictions_total", "Keys evicted from the full cache.", metrics.TypeCounter, float64(st.Evictions)),
+		single("bcdb_tiered_pending", "Keys waiting for write-back.", metrics.TypeGauge, float64(st.Pending)),
+		single("bcdb_tiered_flushed_total", "Operations written back.", metrics.TypeCounter, float64(st.Flushed)),
+		single("bcdb_tiered_flush_errors_total", "Failed write-back attempts.", metrics.TypeCounter, float64(st.FlushErrors)),
+	}
+	if c, ok := t.backend.(metrics.Collector); ok {
+		families = append(families, c.Collect()...)
+	}
+	return families
+}
+
+// Persistence returns the durable state of the backend.
+func (t *Tiered) Persistence() engine.Persistence {
+	if p, ok := t.backend.(engine.Persister); ok {
+		return p.Persistence()
+	}
+	return engine.Persistence{}
+}
+
+func (t *Tiered) Done() <-chan struct{} {
+	return t.done
+}
+
+// Close drains the write-back queue and closes both engines.
+// Once ctx is done, failing write-back operations are dropped instead of retried.
+func (t *Tiered) Close(ctx context.Context) {
+	t.logger.Info("closing")
+	closed := false
+	t.once.Do(func() {
+		closed = true
+
+		t.mu.Lock()
+		t.closed = true
+		close(t.queue)
+		t.mu.Unlock()
+
+		select {
+		case <-t.flushed:
+		case <-ctx.Done():
+			t.logger.Warn("waiting for write-back", slog.Int("pending", t.Stats().Pending), slog.Any("error", ctx.Err()))
+			close(t.abort)
+			<-t.flushed
+		}
+
+		for _, eng := range []Engine{t.cache, t.backend} {
+			eng.Close(ctx)
+			select {
+			case <-eng.Done():
+			case <-ctx.Done():
+				t.logger.Error("failed to close engine", slog.Any("error", ctx.Err()))
+			}
+		}
+		close(t.done)
+	})
+	if !closed {
+		t.logger.Warn("already closed")
+	}
+}
@@ -0,0 +1,314 @@
+package tiered
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// blockingEngine is a backend that waits for unblock before every write.
+type blockingEngine struct {
+	*engine.Memory
+	unblock chan struct{}
+}
+
+func (b *blockingEngine) Set(ctx context.Context, key string, value any) error {
+	<-b.unblock
+	return b.Memory.Set(ctx, key, value)
+}
+
+func (b *blockingEngine) Del(ctx context.Context, key string) error {
+	<-b.unblock
+	return b.Memory.Del(ctx, key)
+}
+
+// failingEngine is a backend that fails writes while failing is set.
+type failingEngine struct {
+	*engine.Memory
+	failing atomic.Bool
+}
+
+var errBackend = errors.New("backend is unavailable")
+
+func (f *failingEngine) Set(ctx context.Context, key string, value any) error {
+	if f.failing.Load() {
+		return errBackend
+	}
+	return f.Memory.Set(ctx, key, value)
+}
+
+func (f *failingEngine) Del(ctx context.Context, key string) error {
+	if f.failing.Load() {
+		return errBackend
+	}
+	return f.Memory.Del(ctx, key)
+}
+
+func newMemory(t *testing.T) *engine.Memory {
+	t.Helper()
+	m, err := engine.NewMemory(noopLogger, make(chan struct{}))
+	require.NoError(t, err)
+	return m
+}
+
+func newTestTiered(t *testing.T, cache, backend Engine, opts Options) *Tiered {
+	t.Helper()
+	tr, err := New(noopLogger, make(chan struct{}), cache, backend, opts)
+	require.NoError(t, err)
+	return tr
+}
+
+func closeTiered(t *testing.T, tr *Tiered) {
+	t.Helper()
+	tr.Close(context.Background())
+	select {
+	case <-tr.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine is not closed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		logger  *slog.Logger
+		done    chan struct{}
+		cache   Engine
+		backend Engine
+		opts    Options
+		wantErr bool
+	}{
+		{name: "valid", logger: noopLogger, done: make(chan struct{}), cache: newMemory(t), backend: newMemory(t)},
+		{name: "no logger", done: make(chan struct{}), cache: newMemory(t), backend: newMemory(t), wantErr: true},
+		{name: "no done", logger: noopLogger, cache: newMemory(t), backend: newMemory(t), wantErr: true},
+		{name: "no cache", logger: noopLogger, done: make(chan struct{}), backend: newMemory(t), wantErr: true},
+		{name: "no backend", logger: noopLogger, done: make(chan struct{}), cache: newMemory(t), wantErr: true},
+		{
+			name: "unknown mode", logger: noopLogger, done: make(chan struct{}),
+			cache: newMemory(t), backend: newMemory(t), opts: Options{Mode: 10}, wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := New(tt.logger, tt.done, tt.cache, tt.backend, tt.opts)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			closeTiered(t, tr)
+		})
+	}
+}
+
+func TestTiered_Modes(t *testing.T) {
+	for _, mode := range []Mode{WriteThrough, WriteBack} {
+		t.Run(mode.String(), func(t *testing.T) {
+			ctx := context.Background()
+			backend := newMemory(t)
+			tr := newTestTiered(t, newMemory(t), backend, Options{Mode: mode})
+
+			require.NoError(t, tr.Set(ctx, "key", "value"))
+			require.NoError(t, tr.Set(ctx, "other", "value"))
+			value, err := tr.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, "value", value)
+
+			require.NoError(t, tr.Del(ctx, "key"))
+			_, err = tr.Get(ctx, "key")
+			require.ErrorIs(t, err, engine.ErrNotFound)
+			require.ErrorIs(t, tr.Del(ctx, "key"), engine.ErrNotFound)
+
+			keys, err := tr.Keys(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"other"}, keys)
+
+			require.ErrorIs(t, tr.Set(ctx, "", "value"), engine.ErrEmptyKey)
+			_, err = tr.Get(ctx, "")
+			require.ErrorIs(t, err, engine.ErrEmptyKey)
+			require.ErrorIs(t, tr.Del(ctx, ""), engine.ErrEmptyKey)
+
+			// close drains the write-back queue
+			closeTiered(t, tr)
+			assert.Equal(t, 0, tr.Stats().Pending)
+			require.ErrorIs(t, tr.Set(ctx, "key", "value"), engine.ErrClosed)
+		})
+	}
+}
+
+func TestTiered_ReadThrough(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemory(t)
+	require.NoError(t, backend.Set(ctx, "key", "value"))
+	tr := newTestTiered(t, newMemory(t), backend, Options{})
+	defer closeTiered(t, tr)
+
+	for range 3 {
+		value, err := tr.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "value", value)
+	}
+	_, err := tr.Get(ctx, "missing")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+
+	stats := tr.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestTiered_Eviction(t *testing.T) {
+	ctx := context.Background()
+	cache, backend := newMemory(t), newMemory(t)
+	tr := newTestTiered(t, cache, backend, Options{CacheSize: 2})
+	defer closeTiered(t, tr)
+
+	require.NoError(t, tr.Set(ctx, "a", "1"))
+	require.NoError(t, tr.Set(ctx, "b", "2"))
+	// reading a makes b the least recently used
+	_, err := tr.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, tr.Set(ctx, "c", "3"))
+
+	keys, err := cache.Keys(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "c"}, keys)
+
+	// evicted keys are read from the backend and fill the cache again
+	value, err := tr.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+	keys, err = cache.Keys(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"b", "c"}, keys)
+
+	stats := tr.Stats()
+	assert.Equal(t, 2, stats.Cached)
+	assert.Equal(t, uint64(2), stats.Evictions)
+}
+
+func TestTiered_WriteBack(t *testing.T) {
+	ctx := context.Background()
+	backend := &blockingEngine{Memory: newMemory(t), unblock: make(chan struct{})}
+	require.NoError(t, backend.Memory.Set(ctx, "stored", "value"))
+	tr := newTestTiered(t, newMemory(t), backend, Options{Mode: WriteBack, QueueSize: 2})
+
+	// writes return before the backend applies them
+	require.NoError(t, tr.Set(ctx, "a", "1"))
+	require.NoError(t, tr.Del(ctx, "stored"))
+	_, err := backend.Memory.Get(ctx, "a")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+
+	// pending delete hides the backend value
+	_, err = tr.Get(ctx, "stored")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	keys, err := tr.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, keys)
+
+	// the queue is bounded: the flusher holds one operation, the queue two more
+	require.NoError(t, tr.Set(ctx, "b", "2"))
+	require.Eventually(t, func() bool { return len(tr.queue) == 2 }, time.Second, time.Millisecond)
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, tr.Set(timeout, "c", "3"), context.DeadlineExceeded)
+	assert.Equal(t, 3, tr.Stats().Pending)
+
+	close(backend.unblock)
+	closeTiered(t, tr)
+
+	assert.Equal(t, uint64(3), tr.Stats().Flushed)
+	value, err := backend.Memory.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+	_, err = backend.Memory.Get(ctx, "stored")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	_, err = backend.Memory.Get(ctx, "c")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+}
+
+func TestTiered_WriteBackRetry(t *testing.T) {
+	ctx := context.Background()
+	backend := &failingEngine{Memory: newMemory(t)}
+	require.NoError(t, backend.Memory.Set(ctx, "stored", "value"))
+	backend.failing.Store(true)
+	tr := newTestTiered(t, newMemory(t), backend, Options{Mode: WriteBack})
+
+	require.NoError(t, tr.Set(ctx, "a", "1"))
+	require.NoError(t, tr.Del(ctx, "stored"))
+	require.Eventually(t, func() bool { return tr.Stats().FlushErrors >= 2 }, 5*time.Second, time.Millisecond)
+
+	// failed operations stay pending
+	assert.Equal(t, 2, tr.Stats().Pending)
+	assert.Zero(t, tr.Stats().Flushed)
+	_, err := tr.Get(ctx, "stored")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+
+	// and are applied when the backend recovers
+	backend.failing.Store(false)
+	require.Eventually(t, func() bool { return tr.Stats().Pending == 0 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(2), tr.Stats().Flushed)
+	value, err := backend.Memory.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+	_, err = backend.Memory.Get(ctx, "stored")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+
+	// close gives up retrying when its context is done
+	backend.failing.Store(true)
+	require.NoError(t, tr.Set(ctx, "b", "2"))
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	tr.Close(timeout)
+	select {
+	case <-tr.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine is not closed")
+	}
+	_, err = backend.Memory.Get(ctx, "b")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+}
+
+func TestTiered_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemory(t)
+	tr := newTestTiered(t, newMemory(t), backend, Options{Mode: WriteBack, QueueSize: 16})
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				key := fmt.Sprintf("w%d-%d", w, i%10)
+				assert.NoError(t, tr.Set(ctx, key, i))
+				value, err := tr.Get(ctx, key)
+				assert.NoError(t, err)
+				assert.Equal(t, i, value)
+			}
+		}()
+	}
+	wg.Wait()
+	closeTiered(t, tr)
+
+	for w := range 8 {
+		for i := range 10 {
+			value, err := backend.Get(ctx, fmt.Sprintf("w%d-%d", w, i))
+			require.NoError(t, err)
+			assert.Equal(t, 90+i, value)
+		}
+	}
+}
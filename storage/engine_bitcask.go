@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/storage/engine/bitcask"
+)
+
+func init() {
+	Register("bitcask", bitcaskOptions, newBitcask)
+}
+
+func bitcaskOptions(cfg config.Storage) (bitcask.Options, error) {
+	if cfg.Bitcask.MergeRatio < 0 || cfg.Bitcask.MergeRatio > 1 {
+		return bitcask.Options{}, fmt.Errorf("merge ratio %v is out of range [0, 1]", cfg.Bitcask.MergeRatio)
+	}
+	return bitcask.Options{
+		Dir:           cfg.Bitcask.Dir,
+		MaxFileSize:   cfg.Bitcask.MaxFileSize,
+		MergeInterval: cfg.Bitcask.MergeInterval,
+		MergeRatio:    cfg.Bitcask.MergeRatio,
+		SyncWrites:    cfg.Bitcask.SyncWrites,
+	}, nil
+}
+
+func newBitcask(l *slog.Logger, done chan struct{}, opts bitcask.Options) (Engine, error) {
+	return bitcask.New(l, done, opts)
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"log/slog"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/storage/engine/lsm"
+)
+
+func init() {
+	Register("lsm", lsmOptions, newLSM)
+}
+
+func lsmOptions(cfg config.Storage) (lsm.Options, error) {
+	return lsm.Options{
+		Dir:                 cfg.LSM.Dir,
+		MemtableSize:        cfg.LSM.MemtableSize,
+		BlockSize:           cfg.LSM.BlockSize,
+		TableSize:           cfg.LSM.TableSize,
+		L0CompactionTrigger: cfg.LSM.L0CompactionTrigger,
+		LevelSizeBase:       cfg.LSM.LevelSizeBase,
+		LevelSizeMultiplier: cfg.LSM.LevelSizeMultiplier,
+		BloomBitsPerKey:     cfg.LSM.BloomBitsPerKey,
+		SyncWrites:          cfg.LSM.SyncWrites,
+	}, nil
+}
+
+func newLSM(l *slog.Logger, done chan struct{}, opts lsm.Options) (Engine, error) {
+	return lsm.New(l, done, opts)
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"log/slog"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+func init() {
+	Register("memory", memoryOptions, newMemory)
+}
+
+func memoryOptions(config.Storage) (struct{}, error) {
+	return struct{}{}, nil
+}
+
+func newMemory(l *slog.Logger, done chan struct{}, _ struct{}) (Engine, error) {
+	return engine.NewMemory(l, done)
+}
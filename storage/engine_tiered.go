@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/storage/engine"
+	"github.com/sattellite/bcdb/storage/engine/tiered"
+)
+
+func init() {
+	Register("tiered", tieredOptions, newTiered)
+}
+
+// tieredConfig holds the config of the backend, which is created by its own registration.
+type tieredConfig struct {
+	backend string
+	storage config.Storage
+	opts    tiered.Options
+}
+
+func tieredOptions(cfg config.Storage) (tieredConfig, error) {
+	switch cfg.Tiered.Backend {
+	case "", "memory", "tiered":
+		return tieredConfig{}, fmt.Errorf("backend must be a durable engine, got %q", cfg.Tiered.Backend)
+	}
+	mode := tiered.WriteThrough
+	if cfg.Tiered.Mode != "" {
+		var err error
+		if mode, err = tiered.ParseMode(cfg.Tiered.Mode); err != nil {
+			return tieredConfig{}, err
+		}
+	}
+	return tieredConfig{
+		backend: cfg.Tiered.Backend,
+		storage: cfg,
+		opts:    tiered.Options{Mode: mode, QueueSize: cfg.Tiered.QueueSize, CacheSize: cfg.Tiered.CacheSize},
+	}, nil
+}
+
+// newTiered uses the memory engine as the cache of the backend.
+func newTiered(l *slog.Logger, done chan struct{}, cfg tieredConfig) (Engine, error) {
+	backend, err := create(l, cfg.backend, cfg.storage)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := engine.NewMemory(l, make(chan struct{}))
+	if err != nil {
+		backend.Close(context.Background())
+		return nil, err
+	}
+	eng, err := tiered.New(l, done, cache, backend, cfg.opts)
+	if err != nil {
+		backend.Close(context.Background())
+		return nil, err
+	}
+	return eng, nil
+}
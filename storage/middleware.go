@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+// Middleware wraps the engine to add behavior to its operations.
+type Middleware func(Engine) Engine
+
+// wrapper is implemented by middlewares to reach the wrapped engine.
+type wrapper interface {
+	Unwrap() Engine
+}
+
+// Chain wraps the engine with middlewares, the first middleware is the outermost.
+func Chain(eng Engine, mws ...Middleware) Engine {
+	for i := len(mws) - 1; i >= 0; i-- {
+		eng = mws[i](eng)
+	}
+	return eng
+}
+
+type logging struct {
+	Engine
+	logger *slog.Logger
+}
+
+func (m *logging) Unwrap() Engine {
+	return m.Engine
+}
+
+// WithLogging logs every operation with its duration. Errors are logged
+// at error level, except not found keys, which are a normal outcome.
+func WithLogging(l *slog.Logger) Middleware {
+	return func(next Engine) Engine {
+		return &logging{Engine: next, logger: l}
+	}
+}
+
+func (m *logging) Set(ctx context.Context, key string, value any) error {
+	m.logger.Debug("set", slog.String("key", key), slog.Any("value", value))
+	start := time.Now()
+	err := m.Engine.Set(ctx, key, value)
+	m.log("set", key, start, err)
+	return err
+}
+
+func (m *logging) Get(ctx context.Context, key string) (any, error) {
+	start := time.Now()
+	value, err := m.Engine.Get(ctx, key)
+	m.log("get", key, start, err)
+	return value, err
+}
+
+func (m *logging) Del(ctx context.Context, key string) error {
+	start := time.Now()
+	err := m.Engine.Del(ctx, key)
+	m.log("del", key, start, err)
+	return err
+}
+
+func (m *logging) Keys(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	keys, err := m.Engine.Keys(ctx)
+	m.log("keys", "", start, err)
+	return keys, err
+}
+
+func (m *logging) log(method, key string, start time.Time, err error) {
+	if err != nil {
+		level := slog.LevelError
+		if errors.Is(err, engine.ErrNotFound) {
+			level = slog.LevelDebug
+		}
+		m.logger.Log(context.Background(), level, method, slog.String("key", key), slog.Any("error", err), slog.Duration("elapsed", time.Since(start)))
+		return
+	}
+	m.logger.Debug(method, slog.String("key", key), slog.Duration("elapsed", time.Since(start)))
+}
+
+type recovery struct {
+	Engine
+	logger *slog.Logger
+}
+
+func (m *recovery) Unwrap() Engine {
+	return m.Engine
+}
+
+// WithRecovery turns panics of the engine into engine.ErrInternal.
+func WithRecovery(l *slog.Logger) Middleware {
+	return func(next Engine) Engine {
+		return &recovery{Engine: next, logger: l}
+	}
+}
+
+func (m *recovery) Set(ctx context.Context, key string, value any) (err error) {
+	defer m.recover("set", key, &err)
+	return m.Engine.Set(ctx, key, value)
+}
+
+func (m *recovery) Get(ctx context.Context, key string) (value any, err error) {
+	defer m.recover("get", key, &err)
+	return m.Engine.Get(ctx, key)
+}
+
+func (m *recovery) Del(ctx context.Context, key string) (err error) {
+	defer m.recover("del", key, &err)
+	return m.Engine.Del(ctx, key)
+}
+
+func (m *recovery) Keys(ctx context.Context) (keys []string, err error) {
+	defer m.recover("keys", "", &err)
+	return m.Engine.Keys(ctx)
+}
+
+func (m *recovery) recover(method, key string, err *error) {
+	if rErr := recover(); rErr != nil {
+		m.logger.Error("engine panic",
+			slog.String("method", method),
+			slog.String("key", key),
+			slog.String("panic", fmt.Sprint(rErr)),
+			slog.String("stack", string(debug.Stack())))
+		*err = engine.ErrInternal
+	}
+}
+
+// PersistenceOf returns the durable state of the engine wrapped by middlewares.
+// It reports false for engines without persistence.
+func PersistenceOf(eng Engine) (engine.Persistence, bool) {
+	for {
+		if p, ok := eng.(engine.Persister); ok {
+			return p.Persistence(), true
+		}
+		w, ok := eng.(wrapper)
+		if !ok {
+			return engine.Persistence{}, false
+		}
+		eng = w.Unwrap()
+	}
+}
+
+// RegisterMetrics registers the engine and its middlewares which collect their own metrics.
+func RegisterMetrics(reg *metrics.Registry, eng Engine) {
+	for {
+		if c, ok := eng.(metrics.Collector); ok {
+			reg.Register(c)
+		}
+		w, ok := eng.(wrapper)
+		if !ok {
+			return
+		}
+		eng = w.Unwrap()
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+var ErrInjected = errors.New("injected fault")
+
+// Faults configures artificial latency and errors of engine operations for tests.
+type Faults struct {
+	// Latency is added to every operation, plus a random duration up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the probability of an operation to fail with Err, from 0 to 1.
+	ErrorRate float64
+	// Err is the injected error, ErrInjected by default.
+	Err error
+}
+
+type faults struct {
+	Engine
+	cfg Faults
+}
+
+func (m *faults) Unwrap() Engine {
+	return m.Engine
+}
+
+// WithFaults delays operations and fails a part of them.
+// Failed operations are not passed to the engine.
+func WithFaults(cfg Faults) Middleware {
+	if cfg.Err == nil {
+		cfg.Err = ErrInjected
+	}
+	return func(next Engine) Engine {
+		return &faults{Engine: next, cfg: cfg}
+	}
+}
+
+func (m *faults) Set(ctx context.Context, key string, value any) error {
+	if err := m.inject(ctx); err != nil {
+		return err
+	}
+	return m.Engine.Set(ctx, key, value)
+}
+
+func (m *faults) Get(ctx context.Context, key string) (any, error) {
+	if err := m.inject(ctx); err != nil {
+		return nil, err
+	}
+	return m.Engine.Get(ctx, key)
+}
+
+func (m *faults) Del(ctx context.Context, key string) error {
+	if err := m.inject(ctx); err != nil {
+		return err
+	}
+	return m.Engine.Del(ctx, key)
+}
+
+func (m *faults) Keys(ctx context.Context) ([]string, error) {
+	if err := m.inject(ctx); err != nil {
+		return nil, err
+	}
+	return m.Engine.Keys(ctx)
+}
+
+func (m *faults) inject(ctx context.Context) error {
+	delay := m.cfg.Latency
+	if m.cfg.Jitter > 0 {
+		delay += rand.N(m.cfg.Jitter)
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if m.cfg.ErrorRate > 0 && rand.Float64() < m.cfg.ErrorRate {
+		return m.cfg.Err
+	}
+	return nil
+}
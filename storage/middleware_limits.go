@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrReadOnly      = errors.New("read-only mode")
+	ErrKeyTooLarge   = errors.New("key is too large")
+	ErrValueTooLarge = errors.New("value is too large")
+)
+
+type readOnly struct {
+	Engine
+}
+
+func (m *readOnly) Unwrap() Engine {
+	return m.Engine
+}
+
+// WithReadOnly rejects writes with ErrReadOnly.
+func WithReadOnly() Middleware {
+	return func(next Engine) Engine {
+		return &readOnly{Engine: next}
+	}
+}
+
+func (m *readOnly) Set(context.Context, string, any) error {
+	return ErrReadOnly
+}
+
+func (m *readOnly) Del(context.Context, string) error {
+	return ErrReadOnly
+}
+
+type limits struct {
+	Engine
+	maxKey   int
+	maxValue int
+}
+
+func (m *limits) Unwrap() Engine {
+	return m.Engine
+}
+
+// WithLimits rejects keys and values larger than the limits in bytes.
+// Zero limit disables the check. Only string and []byte values are measured.
+func WithLimits(maxKeySize, maxValueSize int) Middleware {
+	return func(next Engine) Engine {
+		return &limits{Engine: next, maxKey: maxKeySize, maxValue: maxValueSize}
+	}
+}
+
+func (m *limits) Set(ctx context.Context, key string, value any) error {
+	if err := m.checkKey(key); err != nil {
+		return err
+	}
+	if m.maxValue > 0 {
+		size := -1
+		switch v := value.(type) {
+		case string:
+			size = len(v)
+		case []byte:
+			size = len(v)
+		}
+		if size > m.maxValue {
+			return fmt.Errorf("%w: %d bytes, limit %d", ErrValueTooLarge, size, m.maxValue)
+		}
+	}
+	return m.Engine.Set(ctx, key, value)
+}
+
+func (m *limits) Get(ctx context.Context, key string) (any, error) {
+	if err := m.checkKey(key); err != nil {
+		return nil, err
+	}
+	return m.Engine.Get(ctx, key)
+}
+
+func (m *limits) Del(ctx context.Context, key string) error {
+	if err := m.checkKey(key); err != nil {
+		return err
+	}
+	return m.Engine.Del(ctx, key)
+}
+
+func (m *limits) checkKey(key string) error {
+	if m.maxKey > 0 && len(key) > m.maxKey {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrKeyTooLarge, len(key), m.maxKey)
+	}
+	return nil
+}
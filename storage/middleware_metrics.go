@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+// LatencyBuckets are upper bounds of the latency histogram of operations.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// Operations are names of the measured engine operations.
+var Operations = []string{"set", "get", "del", "keys"}
+
+// OpStats are counters of an engine operation.
+type OpStats struct {
+	Calls    uint64
+	Errors   uint64
+	NotFound uint64
+	Duration time.Duration
+	// Buckets are cumulative counts of calls by LatencyBuckets,
+	// calls slower than the last bucket are counted in Calls only.
+	Buckets []uint64
+}
+
+type opCounters struct {
+	calls    atomic.Uint64
+	errors   atomic.Uint64
+	notFound atomic.Uint64
+	duration atomic.Int64
+	buckets  []atomic.Uint64
+}
+
+// Metrics collects counters of engine operations.
+type Metrics struct {
+	ops map[string]*opCounters
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{ops: make(map[string]*opCounters, len(Operations))}
+	for _, op := range Operations {
+		m.ops[op] = &opCounters{buckets: make([]atomic.Uint64, len(LatencyBuckets))}
+	}
+	return m
+}
+
+func (m *Metrics) observe(op string, start time.Time, err error) {
+	c := m.ops[op]
+	elapsed := time.Since(start)
+	c.calls.Add(1)
+	c.duration.Add(int64(elapsed))
+	switch {
+	case errors.Is(err, engine.ErrNotFound):
+		c.notFound.Add(1)
+	case err != nil:
+		c.errors.Add(1)
+	}
+	for i, bound := range LatencyBuckets {
+		if elapsed <= bound {
+			c.buckets[i].Add(1)
+		}
+	}
+}
+
+// Stats returns a snapshot of counters by operation.
+func (m *Metrics) Stats() map[string]OpStats {
+	stats := make(map[string]OpStats, len(m.ops))
+	for op, c := range m.ops {
+		s := OpStats{
+			Calls:    c.calls.Load(),
+			Errors:   c.errors.Load(),
+			NotFound: c.notFound.Load(),
+			Duration: time.Duration(c.duration.Load()),
+			Buckets:  make([]uint64, len(c.buckets)),
+		}
+		for i := range c.buckets {
+			s.Buckets[i] = c.buckets[i].Load()
+		}
+		stats[op] = s
+	}
+	return stats
+}
+
+// Collect exposes the counters and latency histograms of operations.
+func (m *Metrics) Collect() []metrics.Family {
+	bounds := make([]float64, len(LatencyBuckets))
+	for i, b := range LatencyBuckets {
+		bounds[i] = b.Seconds()
+	}
+	calls := metrics.Family{Name: "bcdb_engine_operations_total", Help: "Engine operations.", Type: metrics.TypeCounter}
+	errs := metrics.Family{Name: "bcdb_engine_errors_total", Help: "Failed engine operations.", Type: metrics.TypeCounter}
+	notFound := metrics.Family{Name: "bcdb_engine_not_found_total", Help: "Engine operations with missing keys.", Type: metrics.TypeCounter}
+	latency := metrics.Family{Name: "bcdb_engine_operation_duration_seconds", Help: "Latency of engine operations.", Type: metrics.TypeHistogram}
+
+	stats := m.Stats()
+	for _, op := range Operations {
+		st := stats[op]
+		labels := []metrics.Label{{Name: "operation", Value: op}}
+		calls.Samples = append(calls.Samples, metrics.Sample{Labels: labels, Value: float64(st.Calls)})
+		errs.Samples = append(errs.Samples, metrics.Sample{Labels: labels, Value: float64(st.Errors)})
+		notFound.Samples = append(notFound.Samples, metrics.Sample{Labels: labels, Value: float64(st.NotFound)})
+		latency.Samples = append(latency.Samples, metrics.HistogramSamples(labels, bounds, st.Buckets, st.Calls, st.Duration.Seconds())...)
+	}
+	return []metrics.Family{calls, errs, notFound, latency}
+}
+
+type measured struct {
+	Engine
+	m *Metrics
+}
+
+func (m *measured) Unwrap() Engine {
+	return m.Engine
+}
+
+// Collect exposes the metrics of the middleware when the engine is registered with RegisterMetrics.
+func (m *measured) Collect() []metrics.Family {
+	return m.m.Collect()
+}
+
+// WithMetrics counts calls, errors and latency of operations in m.
+// RegisterMetrics exposes them with metrics of the engine.
+func WithMetrics(m *Metrics) Middleware {
+	return func(next Engine) Engine {
+		return &measured{Engine: next, m: m}
+	}
+}
+
+func (m *measured) Set(ctx context.Context, key string, value any) error {
+	start := time.Now()
+	err := m.Engine.Set(ctx, key, value)
+	m.m.observe("set", start, err)
+	return err
+}
+
+func (m *measured) Get(ctx context.Context, key string) (any, error) {
+	start := time.Now()
+	value, err := m.Engine.Get(ctx, key)
+	m.m.observe("get", start, err)
+	return value, err
+}
+
+func (m *measured) Del(ctx context.Context, key string) error {
+	start := time.Now()
+	err := m.Engine.Del(ctx, key)
+	m.m.observe("del", start, err)
+	return err
+}
+
+func (m *measured) Keys(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	keys, err := m.Engine.Keys(ctx)
+	m.m.observe("keys", start, err)
+	return keys, err
+}
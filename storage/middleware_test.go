@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/storage/engine"
+	"github.com/sattellite/bcdb/storage/engine/bitcask"
+	mocks "github.com/sattellite/bcdb/storage/mocks"
+	"github.com/sattellite/bcdb/trace"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestMemory(t *testing.T) Engine {
+	t.Helper()
+	eng, err := newMemory(noopLogger, make(chan struct{}), struct{}{})
+	require.NoError(t, err)
+	return eng
+}
+
+// named appends its name to calls before and after calling the engine.
+func named(name string, calls *[]string) Middleware {
+	return func(next Engine) Engine {
+		m := &mocks.Engine{}
+		m.EXPECT().Keys(mock.Anything).RunAndReturn(func(ctx context.Context) ([]string, error) {
+			*calls = append(*calls, name)
+			keys, err := next.Keys(ctx)
+			*calls = append(*calls, name)
+			return keys, err
+		})
+		return m
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	eng := Chain(newTestMemory(t), named("a", &calls), named("b", &calls), named("c", &calls))
+	_, err := eng.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "c", "b", "a"}, calls)
+}
+
+func TestWithLogging(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	eng := WithLogging(l)(newTestMemory(t))
+	ctx := context.Background()
+
+	require.NoError(t, eng.Set(ctx, "key", "value"))
+	_, err := eng.Get(ctx, "missing")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	assert.Empty(t, buf.String(), "successful calls and missing keys are logged at debug level")
+
+	require.ErrorIs(t, eng.Del(ctx, ""), engine.ErrEmptyKey)
+	assert.Contains(t, buf.String(), "level=ERROR msg=del")
+	assert.Contains(t, buf.String(), "error=\"empty key\"")
+}
+
+func TestWithRecovery(t *testing.T) {
+	m := &mocks.Engine{}
+	m.EXPECT().Get(mock.Anything, "key").Run(func(context.Context, string) { panic("boom") })
+	eng := WithRecovery(noopLogger)(m)
+
+	value, err := eng.Get(context.Background(), "key")
+	require.ErrorIs(t, err, engine.ErrInternal)
+	assert.Nil(t, value)
+}
+
+func TestWithMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	eng := WithMetrics(metrics)(newTestMemory(t))
+	ctx := context.Background()
+
+	require.NoError(t, eng.Set(ctx, "key", "value"))
+	require.NoError(t, eng.Set(ctx, "other", "value"))
+	_, err := eng.Get(ctx, "missing")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	require.ErrorIs(t, eng.Del(ctx, ""), engine.ErrEmptyKey)
+
+	stats := metrics.Stats()
+	assert.Equal(t, uint64(2), stats["set"].Calls)
+	assert.Equal(t, uint64(1), stats["get"].NotFound)
+	assert.Equal(t, uint64(0), stats["get"].Errors)
+	assert.Equal(t, uint64(1), stats["del"].Errors)
+	assert.Equal(t, uint64(0), stats["keys"].Calls)
+	assert.Equal(t, uint64(2), stats["set"].Buckets[len(LatencyBuckets)-1])
+}
+
+func TestWithReadOnly(t *testing.T) {
+	mem := newTestMemory(t)
+	ctx := context.Background()
+	require.NoError(t, mem.Set(ctx, "key", "value"))
+	eng := WithReadOnly()(mem)
+
+	require.ErrorIs(t, eng.Set(ctx, "key", "new"), ErrReadOnly)
+	require.ErrorIs(t, eng.Del(ctx, "key"), ErrReadOnly)
+	value, err := eng.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestWithLimits(t *testing.T) {
+	eng := WithLimits(4, 8)(newTestMemory(t))
+	ctx := context.Background()
+	long := strings.Repeat("k", 5)
+
+	require.NoError(t, eng.Set(ctx, "key", "12345678"))
+	require.NoError(t, eng.Set(ctx, "num", 1234567890))
+	require.ErrorIs(t, eng.Set(ctx, long, "value"), ErrKeyTooLarge)
+	require.ErrorIs(t, eng.Set(ctx, "key", "123456789"), ErrValueTooLarge)
+	require.ErrorIs(t, eng.Set(ctx, "key", []byte("123456789")), ErrValueTooLarge)
+	_, err := eng.Get(ctx, long)
+	require.ErrorIs(t, err, ErrKeyTooLarge)
+	require.ErrorIs(t, eng.Del(ctx, long), ErrKeyTooLarge)
+}
+
+func TestWithFaults(t *testing.T) {
+	ctx := context.Background()
+
+	eng := WithFaults(Faults{ErrorRate: 1})(newTestMemory(t))
+	require.ErrorIs(t, eng.Set(ctx, "key", "value"), ErrInjected)
+	_, err := eng.Keys(ctx)
+	require.ErrorIs(t, err, ErrInjected)
+
+	eng = WithFaults(Faults{Latency: 20 * time.Millisecond})(newTestMemory(t))
+	start := time.Now()
+	require.NoError(t, eng.Set(ctx, "key", "value"))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	_, err = eng.Get(timeout, "key")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestNewEngine_Middlewares(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := NewMetrics()
+	eng, err := NewEngine(ctx, config.Storage{MaxValueSize: 4}, WithMetrics(metrics))
+	require.NoError(t, err)
+
+	require.NoError(t, eng.Set(ctx, "key", "1234"))
+	require.ErrorIs(t, eng.Set(ctx, "key", "12345"), ErrValueTooLarge)
+	// limits reject the value before it reaches the metrics
+	assert.Equal(t, uint64(1), metrics.Stats()["set"].Calls)
+
+	ro, err := NewEngine(ctx, config.Storage{ReadOnly: true})
+	require.NoError(t, err)
+	require.ErrorIs(t, ro.Set(ctx, "key", "value"), ErrReadOnly)
+}
+
+func TestPersistenceOf(t *testing.T) {
+	_, ok := PersistenceOf(Chain(newTestMemory(t), WithLogging(noopLogger)))
+	assert.False(t, ok, "memory engine is not durable")
+
+	b, err := bitcask.New(noopLogger, make(chan struct{}), bitcask.Options{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer b.Close(context.Background())
+	eng := Chain(b, WithLogging(noopLogger), WithRecovery(noopLogger), WithLimits(10, 10))
+	require.NoError(t, eng.Set(context.Background(), "key", "value"))
+
+	p, ok := PersistenceOf(eng)
+	require.True(t, ok)
+	assert.Positive(t, p.LogSize)
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	b, err := bitcask.New(noopLogger, make(chan struct{}), bitcask.Options{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer b.Close(context.Background())
+	eng := Chain(b, WithLogging(noopLogger), WithMetrics(NewMetrics()))
+	require.NoError(t, eng.Set(context.Background(), "key", "value"))
+
+	reg := metrics.NewRegistry()
+	RegisterMetrics(reg, eng)
+	var out strings.Builder
+	require.NoError(t, metrics.WriteText(&out, reg.Gather()))
+	assert.Contains(t, out.String(), `bcdb_engine_operations_total{operation="set"} 1`)
+	assert.Contains(t, out.String(), `bcdb_engine_operation_duration_seconds_count{operation="set"} 1`)
+	assert.Contains(t, out.String(), "bcdb_bitcask_keys 1\n")
+}
+
+// spanRecorder keeps exported spans.
+type spanRecorder struct {
+	spans []trace.SpanData
+}
+
+func (r *spanRecorder) Export(spans []trace.SpanData) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Close() error { return nil }
+
+func TestWithTracing(t *testing.T) {
+	b, err := bitcask.New(noopLogger, make(chan struct{}), bitcask.Options{Dir: t.TempDir(), SyncWrites: true})
+	require.NoError(t, err)
+	defer b.Close(context.Background())
+	eng := Chain(b, WithTracing())
+
+	rec := &spanRecorder{}
+	tr, err := trace.New(noopLogger, rec, trace.Options{SampleRatio: 1})
+	require.NoError(t, err)
+	ctx, root := tr.Start(context.Background(), "request")
+	require.NoError(t, eng.Set(ctx, "key", "value"))
+	_, err = eng.Get(ctx, "missing")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	root.End()
+	// untraced requests record no spans
+	require.NoError(t, eng.Set(context.Background(), "key", "value"))
+	require.NoError(t, tr.Close())
+
+	byName := make(map[string]trace.SpanData)
+	for _, s := range rec.spans {
+		byName[s.Name] = s
+	}
+	require.Len(t, byName, 5)
+	set := byName["storage.set"]
+	assert.Equal(t, byName["request"].SpanID, set.ParentID)
+	assert.Equal(t, "key", set.Attributes["key"])
+	assert.Equal(t, set.SpanID, byName["bitcask.lock"].ParentID)
+	assert.Equal(t, set.SpanID, byName["bitcask.fsync"].ParentID)
+	assert.Equal(t, engine.ErrNotFound.Error(), byName["storage.get"].Error)
+}
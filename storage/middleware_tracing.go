@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sattellite/bcdb/trace"
+)
+
+type traced struct {
+	Engine
+}
+
+func (m *traced) Unwrap() Engine {
+	return m.Engine
+}
+
+// WithTracing records a span of every operation of a traced request.
+func WithTracing() Middleware {
+	return func(next Engine) Engine {
+		return &traced{Engine: next}
+	}
+}
+
+func (m *traced) Set(ctx context.Context, key string, value any) error {
+	ctx, span := trace.Start(ctx, "storage.set", slog.String("key", key))
+	defer span.End()
+	err := m.Engine.Set(ctx, key, value)
+	span.SetError(err)
+	return err
+}
+
+func (m *traced) Get(ctx context.Context, key string) (any, error) {
+	ctx, span := trace.Start(ctx, "storage.get", slog.String("key", key))
+	defer span.End()
+	value, err := m.Engine.Get(ctx, key)
+	span.SetError(err)
+	return value, err
+}
+
+func (m *traced) Del(ctx context.Context, key string) error {
+	ctx, span := trace.Start(ctx, "storage.del", slog.String("key", key))
+	defer span.End()
+	err := m.Engine.Del(ctx, key)
+	span.SetError(err)
+	return err
+}
+
+func (m *traced) Keys(ctx context.Context) ([]string, error) {
+	ctx, span := trace.Start(ctx, "storage.keys")
+	defer span.End()
+	keys, err := m.Engine.Keys(ctx)
+	span.SetError(err)
+	return keys, err
+}
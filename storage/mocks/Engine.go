@@ -207,6 +207,64 @@ func (_c *Engine_Get_Call) RunAndReturn(run func(context.Context, string) (inter
 	return _c
 }
 
+// Keys provides a mock function with given fields: ctx
+func (_m *Engine) Keys(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Keys")
+	}
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]string, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Engine_Keys_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Keys'
+type Engine_Keys_Call struct {
+	*mock.Call
+}
+
+// Keys is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Engine_Expecter) Keys(ctx interface{}) *Engine_Keys_Call {
+	return &Engine_Keys_Call{Call: _e.mock.On("Keys", ctx)}
+}
+
+func (_c *Engine_Keys_Call) Run(run func(ctx context.Context)) *Engine_Keys_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Engine_Keys_Call) Return(_a0 []string, _a1 error) *Engine_Keys_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Engine_Keys_Call) RunAndReturn(run func(context.Context) ([]string, error)) *Engine_Keys_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Set provides a mock function with given fields: ctx, key, value
 func (_m *Engine) Set(ctx context.Context, key string, value interface{}) error {
 	ret := _m.Called(ctx, key, value)
@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+var (
+	ErrInvalidDB   = errors.New("invalid database index")
+	ErrReservedKey = errors.New("keys starting with a zero byte are reserved")
+	ErrKeyExists   = errors.New("key already exists")
+)
+
+// DefaultDatabases is the number of databases when the config doesn't set it.
+const DefaultDatabases = 16
+
+// Keys of databases other than the first physical one are stored with
+// the prefix "\x00<id>\x00", so every database keeps its keys in the same
+// engine and durable engines persist them with the database boundaries.
+// Keys of the first physical database are stored as is.
+const (
+	reservedPrefix = "\x00"
+	// mappingKey stores the mapping of databases to physical keyspaces changed by Swap.
+	mappingKey = reservedPrefix + "databases"
+)
+
+// Namespaces splits the engine into isolated numbered databases.
+type Namespaces struct {
+	eng Engine
+	// mu is held for writing by operations on several databases,
+	// so they are atomic for operations on a single database.
+	mu sync.RWMutex
+	// mapping is the physical keyspace of every database.
+	mapping []int
+	count   int
+}
+
+// NewNamespaces creates count databases over the engine
+// and restores the mapping of swapped databases.
+func NewNamespaces(ctx context.Context, eng Engine, count int) (*Namespaces, error) {
+	if eng == nil {
+		return nil, errors.New("engine is required")
+	}
+	if count <= 0 {
+		count = DefaultDatabases
+	}
+
+	n := &Namespaces{eng: eng, count: count}
+	value, err := eng.Get(ctx, mappingKey)
+	switch {
+	case errors.Is(err, engine.ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("load databases mapping: %w", err)
+	default:
+		if n.mapping, err = parseMapping(value); err != nil {
+			return nil, fmt.Errorf("load databases mapping: %w", err)
+		}
+	}
+	// keyspaces of databases removed from the config stay in the mapping,
+	// so they are not lost when the number grows back
+	for i := len(n.mapping); i < count; i++ {
+		n.mapping = append(n.mapping, i)
+	}
+	return n, nil
+}
+
+func parseMapping(value any) ([]int, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return nil, fmt.Errorf("unexpected value type %T", value)
+	}
+
+	parts := strings.Split(s, ",")
+	mapping := make([]int, len(parts))
+	seen := make(map[int]bool, len(parts))
+	for i, part := range parts {
+		id, err := strconv.Atoi(part)
+		if err != nil || id < 0 || seen[id] {
+			return nil, fmt.Errorf("invalid keyspace %q", part)
+		}
+		seen[id] = true
+		mapping[i] = id
+	}
+	return mapping, nil
+}
+
+func formatMapping(mapping []int) string {
+	parts := make([]string, len(mapping))
+	for i, id := range mapping {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Count returns the number of databases.
+func (n *Namespaces) Count() int {
+	return n.count
+}
+
+// ParseDB parses the database index and checks its range.
+func (n *Namespaces) ParseDB(s string) (int, error) {
+	db, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q", ErrInvalidDB, s)
+	}
+	if err = n.check(db); err != nil {
+		return 0, err
+	}
+	return db, nil
+}
+
+func (n *Namespaces) check(db int) error {
+	if db < 0 || db >= n.count {
+		return fmt.Errorf("%w %d, expected 0-%d", ErrInvalidDB, db, n.count-1)
+	}
+	return nil
+}
+
+// DB returns the engine of the database. Closing it doesn't close the underlying engine.
+func (n *Namespaces) DB(db int) (Engine, error) {
+	if err := n.check(db); err != nil {
+		return nil, err
+	}
+	return &namespace{n: n, db: db}, nil
+}
+
+// Size returns the number of keys in the database.
+func (n *Namespaces) Size(ctx context.Context, db int) (int, error) {
+	if err := n.check(db); err != nil {
+		return 0, err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	keys, err := n.keys(ctx, n.mapping[db])
+	return len(keys), err
+}
+
+// Flush removes all keys of the database.
+func (n *Namespaces) Flush(ctx context.Context, db int) error {
+	if err := n.check(db); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.flush(ctx, n.mapping[db])
+}
+
+// FlushAll removes all keys of all databases.
+func (n *Namespaces) FlushAll(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, id := range n.mapping {
+		if err := n.flush(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Namespaces) flush(ctx context.Context, id int) error {
+	keys, err := n.keys(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if dErr := n.eng.Del(ctx, physicalKey(id, key)); dErr != nil && !errors.Is(dErr, engine.ErrNotFound) {
+			return dErr
+		}
+	}
+	return nil
+}
+
+// Move moves the key from one database to another.
+// It fails with ErrKeyExists when the target database has the key.
+func (n *Namespaces) Move(ctx context.Context, key string, from, to int) error {
+	if err := n.check(from); err != nil {
+		return err
+	}
+	if err := n.check(to); err != nil {
+		return err
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if from == to {
+		return errors.New("source and target databases are the same")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	src, dst := physicalKey(n.mapping[from], key), physicalKey(n.mapping[to], key)
+	value, err := n.eng.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	_, err = n.eng.Get(ctx, dst)
+	if err == nil {
+		return ErrKeyExists
+	}
+	if !errors.Is(err, engine.ErrNotFound) {
+		return err
+	}
+	if sErr := n.eng.Set(ctx, dst, value); sErr != nil {
+		return sErr
+	}
+	return n.eng.Del(ctx, src)
+}
+
+// Swap exchanges the keys of two databases. Keys are not copied,
+// the databases exchange their keyspaces.
+func (n *Namespaces) Swap(ctx context.Context, a, b int) error {
+	if err := n.check(a); err != nil {
+		return err
+	}
+	if err := n.check(b); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	mapping := append([]int(nil), n.mapping...)
+	mapping[a], mapping[b] = mapping[b], mapping[a]
+	if err := n.eng.Set(ctx, mappingKey, formatMapping(mapping)); err != nil {
+		return err
+	}
+	n.mapping = mapping
+	return nil
+}
+
+// keys returns user keys of the keyspace. Caller must hold the lock.
+func (n *Namespaces) keys(ctx context.Context, id int) ([]string, error) {
+	all, err := n.eng.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefix := keyPrefix(id)
+	keys := make([]string, 0, len(all))
+	for _, key := range all {
+		if prefix == "" {
+			if !strings.HasPrefix(key, reservedPrefix) {
+				keys = append(keys, key)
+			}
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key[len(prefix):])
+		}
+	}
+	return keys, nil
+}
+
+func keyPrefix(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return reservedPrefix + strconv.Itoa(id) + reservedPrefix
+}
+
+func physicalKey(id int, key string) string {
+	return keyPrefix(id) + key
+}
+
+func checkKey(key string) error {
+	if key == "" {
+		return engine.ErrEmptyKey
+	}
+	if strings.HasPrefix(key, reservedPrefix) {
+		return ErrReservedKey
+	}
+	return nil
+}
+
+// namespace is the engine of a single database.
+type namespace struct {
+	n  *Namespaces
+	db int
+}
+
+func (ns *namespace) Set(ctx context.Context, key string, value any) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	ns.n.mu.RLock()
+	defer ns.n.mu.RUnlock()
+	return ns.n.eng.Set(ctx, ns.key(key), value)
+}
+
+func (ns *namespace) Get(ctx context.Context, key string) (any, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	ns.n.mu.RLock()
+	defer ns.n.mu.RUnlock()
+	return ns.n.eng.Get(ctx, ns.key(key))
+}
+
+func (ns *namespace) Del(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	ns.n.mu.RLock()
+	defer ns.n.mu.RUnlock()
+	return ns.n.eng.Del(ctx, ns.key(key))
+}
+
+func (ns *namespace) Keys(ctx context.Context) ([]string, error) {
+	ns.n.mu.RLock()
+	defer ns.n.mu.RUnlock()
+	return ns.n.keys(ctx, ns.n.mapping[ns.db])
+}
+
+// key returns the physical key. Caller must hold the lock.
+func (ns *namespace) key(key string) string {
+	return physicalKey(ns.n.mapping[ns.db], key)
+}
+
+func (ns *namespace) Done() <-chan struct{} {
+	return ns.n.eng.Done()
+}
+
+// Close does nothing, the engine is closed by its owner.
+func (ns *namespace) Close(context.Context) {}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+	"github.com/sattellite/bcdb/storage/engine"
+)
+
+func newTestNamespaces(t *testing.T, eng Engine, count int) *Namespaces {
+	t.Helper()
+	n, err := NewNamespaces(context.Background(), eng, count)
+	require.NoError(t, err)
+	return n
+}
+
+func testDB(t *testing.T, n *Namespaces, db int) Engine {
+	t.Helper()
+	eng, err := n.DB(db)
+	require.NoError(t, err)
+	return eng
+}
+
+func TestNamespaces_Isolation(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNamespaces(t, newTestMemory(t), 4)
+	db0, db1 := testDB(t, n, 0), testDB(t, n, 1)
+
+	require.NoError(t, db0.Set(ctx, "key", "zero"))
+	require.NoError(t, db1.Set(ctx, "key", "one"))
+	require.NoError(t, db1.Set(ctx, "other", "one"))
+
+	value, err := db0.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "zero", value)
+	value, err = db1.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "one", value)
+	_, err = db0.Get(ctx, "other")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+
+	keys, err := db0.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key"}, keys)
+	keys, err = db1.Keys(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"key", "other"}, keys)
+
+	size, err := n.Size(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	require.NoError(t, db1.Del(ctx, "key"))
+	_, err = db0.Get(ctx, "key")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, db0.Set(ctx, "\x001\x00key", "value"), ErrReservedKey)
+	require.ErrorIs(t, db1.Set(ctx, "", "value"), engine.ErrEmptyKey)
+	_, err = n.DB(4)
+	require.ErrorIs(t, err, ErrInvalidDB)
+	_, err = n.ParseDB("one")
+	require.ErrorIs(t, err, ErrInvalidDB)
+}
+
+func TestNamespaces_FlushAndMove(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNamespaces(t, newTestMemory(t), 3)
+	db0, db1, db2 := testDB(t, n, 0), testDB(t, n, 1), testDB(t, n, 2)
+	for _, db := range []Engine{db0, db1, db2} {
+		require.NoError(t, db.Set(ctx, "a", "value"))
+		require.NoError(t, db.Set(ctx, "b", "value"))
+	}
+
+	require.NoError(t, n.Flush(ctx, 1))
+	for db, want := range []int{2, 0, 2} {
+		size, err := n.Size(ctx, db)
+		require.NoError(t, err)
+		assert.Equal(t, want, size, "db %d", db)
+	}
+
+	require.NoError(t, n.Move(ctx, "a", 0, 1))
+	_, err := db0.Get(ctx, "a")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+	value, err := db1.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+	require.ErrorIs(t, n.Move(ctx, "b", 0, 2), ErrKeyExists)
+	require.ErrorIs(t, n.Move(ctx, "missing", 0, 2), engine.ErrNotFound)
+	require.ErrorIs(t, n.Move(ctx, "", 0, 2), engine.ErrEmptyKey)
+	require.ErrorIs(t, n.Move(ctx, "b", 0, 5), ErrInvalidDB)
+
+	require.NoError(t, n.FlushAll(ctx))
+	for db := range n.Count() {
+		size, sErr := n.Size(ctx, db)
+		require.NoError(t, sErr)
+		assert.Zero(t, size, "db %d", db)
+	}
+}
+
+func TestNamespaces_SwapPersists(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Storage{Engine: "bitcask", Bitcask: config.Bitcask{Dir: t.TempDir()}}
+	open := func() (Engine, context.CancelFunc) {
+		octx, cancel := context.WithCancel(ctx)
+		eng, err := NewEngine(octx, cfg)
+		require.NoError(t, err)
+		return eng, cancel
+	}
+	closeEngine := func(eng Engine, cancel context.CancelFunc) {
+		cancel()
+		select {
+		case <-eng.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("engine is not closed")
+		}
+	}
+
+	eng, cancel := open()
+	n := newTestNamespaces(t, eng, 2)
+	require.NoError(t, testDB(t, n, 0).Set(ctx, "key", "zero"))
+	require.NoError(t, testDB(t, n, 1).Set(ctx, "key", "one"))
+	require.NoError(t, n.Swap(ctx, 0, 1))
+
+	check := func(n *Namespaces) {
+		for db, want := range []string{"one", "zero"} {
+			value, err := testDB(t, n, db).Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, want, value, "db %d", db)
+		}
+		keys, err := testDB(t, n, 0).Keys(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"key"}, keys)
+	}
+	check(n)
+	closeEngine(eng, cancel)
+
+	// keys and the swap survive reopening
+	eng, cancel = open()
+	defer closeEngine(eng, cancel)
+	check(newTestNamespaces(t, eng, 2))
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+var ErrUnknownEngine = errors.New("unknown storage engine")
+
+// Factory creates the engine from its typed options.
+type Factory[O any] func(l *slog.Logger, done chan struct{}, opts O) (Engine, error)
+
+type registration func(l *slog.Logger, done chan struct{}, cfg config.Storage) (Engine, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register adds the engine under the name. options converts the storage config
+// into the typed options of the engine. It panics if the name is already taken.
+func Register[O any](name string, options func(cfg config.Storage) (O, error), factory Factory[O]) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("storage: engine %q is already registered", name))
+	}
+	registry[name] = func(l *slog.Logger, done chan struct{}, cfg config.Storage) (Engine, error) {
+		opts, err := options(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s engine options: %w", name, err)
+		}
+		return factory(l, done, opts)
+	}
+}
+
+// Engines returns sorted names of the registered engines.
+func Engines() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func create(l *slog.Logger, name string, cfg config.Storage) (Engine, error) {
+	registryMu.RLock()
+	reg, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available engines: %s", ErrUnknownEngine, name, strings.Join(Engines(), ", "))
+	}
+	return reg(l, make(chan struct{}), cfg)
+}
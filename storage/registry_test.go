@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sattellite/bcdb/config"
+)
+
+func TestEngines(t *testing.T) {
+	assert.Equal(t, []string{"bitcask", "lsm", "memory", "tiered"}, Engines())
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		Register("memory", memoryOptions, newMemory)
+	})
+}
+
+func TestNewEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Storage
+		wantErr string
+	}{
+		{name: "default", cfg: config.Storage{}},
+		{name: "memory", cfg: config.Storage{Engine: "memory"}},
+		{name: "lsm", cfg: config.Storage{Engine: "lsm", LSM: config.LSM{Dir: t.TempDir()}}},
+		{name: "bitcask", cfg: config.Storage{Engine: "bitcask", Bitcask: config.Bitcask{Dir: t.TempDir()}}},
+		{
+			name: "tiered",
+			cfg: config.Storage{
+				Engine:  "tiered",
+				Bitcask: config.Bitcask{Dir: t.TempDir()},
+				Tiered:  config.Tiered{Backend: "bitcask", Mode: "write-back"},
+			},
+		},
+		{
+			name:    "unknown",
+			cfg:     config.Storage{Engine: "rocksdb"},
+			wantErr: `unknown storage engine "rocksdb", available engines: bitcask, lsm, memory, tiered`,
+		},
+		{
+			name:    "invalid options",
+			cfg:     config.Storage{Engine: "bitcask", Bitcask: config.Bitcask{Dir: t.TempDir(), MergeRatio: 2}},
+			wantErr: "invalid bitcask engine options: merge ratio 2 is out of range [0, 1]",
+		},
+		{
+			name:    "tiered memory backend",
+			cfg:     config.Storage{Engine: "tiered", Tiered: config.Tiered{Backend: "memory"}},
+			wantErr: `invalid tiered engine options: backend must be a durable engine, got "memory"`,
+		},
+		{
+			name:    "tiered unknown mode",
+			cfg:     config.Storage{Engine: "tiered", Tiered: config.Tiered{Backend: "lsm", Mode: "lazy"}},
+			wantErr: `invalid tiered engine options: unknown mode "lazy", expected write-through or write-back`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			eng, err := NewEngine(ctx, tt.cfg)
+			if tt.wantErr != "" {
+				cancel()
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			require.NoError(t, eng.Set(ctx, "key", "value"))
+			value, err := eng.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, "value", value)
+
+			// the engine is closed with the context
+			cancel()
+			select {
+			case <-eng.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("engine is not closed")
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	type options struct{ size int }
+	var got options
+	Register("test", func(config.Storage) (options, error) {
+		return options{size: 10}, nil
+	}, func(l *slog.Logger, done chan struct{}, opts options) (Engine, error) {
+		got = opts
+		return newMemory(l, done, struct{}{})
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test")
+		registryMu.Unlock()
+	})
+
+	eng, err := create(slog.Default(), "test", config.Storage{})
+	require.NoError(t, err)
+	eng.Close(context.Background())
+	assert.Equal(t, options{size: 10}, got)
+}
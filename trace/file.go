@@ -0,0 +1,40 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// FileExporter appends spans to a file as JSON lines.
+type FileExporter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Export writes the spans, one JSON object a line.
+func (e *FileExporter) Export(spans []SpanData) error {
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
+
+func (e *FileExporter) Close() error {
+	if err := e.w.Flush(); err != nil {
+		_ = e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
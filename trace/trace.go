@@ -0,0 +1,229 @@
+// Package trace records spans of requests. A root span is started by the
+// Tracer for every request and child spans are started with Start from
+// the context passed down through the compute layer into the engines.
+// Finished spans are sent to an Exporter in batches.
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/sattellite/bcdb/metrics"
+	"github.com/sattellite/bcdb/queue"
+)
+
+// DefaultQueueSize is the number of finished spans waiting for export.
+const DefaultQueueSize = 4096
+
+// exportBatch is the maximal number of spans exported together.
+const exportBatch = 256
+
+// SpanData is a finished span.
+type SpanData struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	Duration   time.Duration  `json:"duration_ns"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Exporter writes finished spans. Export is called by a single goroutine.
+type Exporter interface {
+	Export(spans []SpanData) error
+	Close() error
+}
+
+// Options configures the tracer. SampleRatio is the share of traced
+// requests from 0 to 1. QueueSize is DefaultQueueSize when zero, spans
+// finished while the queue is full are dropped.
+type Options struct {
+	SampleRatio float64
+	QueueSize   int
+}
+
+// Tracer starts root spans and exports finished spans.
+type Tracer struct {
+	logger   *slog.Logger
+	exporter Exporter
+	ratio    float64
+	queue    *queue.Queue[SpanData]
+	once     sync.Once
+}
+
+// New starts the export of spans, Close flushes them and closes the exporter.
+func New(l *slog.Logger, exp Exporter, opts Options) (*Tracer, error) {
+	if l == nil {
+		return nil, errors.New("logger is required")
+	}
+	if exp == nil {
+		return nil, errors.New("exporter is required")
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	t := &Tracer{
+		logger:   l.With("module", "trace"),
+		exporter: exp,
+		ratio:    opts.SampleRatio,
+	}
+	t.queue = queue.New(opts.QueueSize, false, t.export)
+	return t, nil
+}
+
+// Dropped returns the number of spans dropped by the full queue.
+func (t *Tracer) Dropped() uint64 {
+	return t.queue.Dropped()
+}
+
+// Start starts the root span of a request, when the request is sampled.
+// A nil tracer starts no spans.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	if t == nil || t.ratio <= 0 || (t.ratio < 1 && rand.Float64() >= t.ratio) {
+		return ctx, nil
+	}
+	var traceID [16]byte
+	fillRandom(traceID[:])
+	s := newSpan(t, hex.EncodeToString(traceID[:]), "", name, attrs)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Close exports the queued spans and closes the exporter.
+// Spans ended after Close are dropped.
+func (t *Tracer) Close() error {
+	var err error
+	t.once.Do(func() {
+		t.queue.Close()
+		err = t.exporter.Close()
+	})
+	return err
+}
+
+func (t *Tracer) finish(d SpanData) {
+	t.queue.Send(d)
+}
+
+func (t *Tracer) export(spans <-chan SpanData) {
+	batch := make([]SpanData, 0, exportBatch)
+	for d := range spans {
+		batch = append(batch[:0], d)
+		for len(batch) < exportBatch && len(spans) > 0 {
+			batch = append(batch, <-spans)
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			t.logger.Error("failed to export spans", slog.Int("spans", len(batch)), slog.Any("error", err))
+		}
+	}
+}
+
+type spanKey struct{}
+
+// Span is an operation of a trace. Methods of a nil span do nothing,
+// so code is traced the same way whether the request is sampled or not.
+type Span struct {
+	tracer *Tracer
+
+	mu   sync.Mutex
+	data SpanData
+	done bool
+}
+
+func newSpan(t *Tracer, traceID, parentID, name string, attrs []slog.Attr) *Span {
+	var id [8]byte
+	fillRandom(id[:])
+	s := &Span{tracer: t, data: SpanData{
+		TraceID:  traceID,
+		SpanID:   hex.EncodeToString(id[:]),
+		ParentID: parentID,
+		Name:     name,
+		Start:    time.Now(),
+	}}
+	s.SetAttributes(attrs...)
+	return s
+}
+
+// Start starts a child of the span of the context. Without a span in
+// the context, the request is not traced and the returned span is nil.
+func Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := newSpan(parent.tracer, parent.data.TraceID, parent.data.SpanID, name, attrs)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// FromContext returns the current span of the context or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...slog.Attr) {
+	if s == nil || len(attrs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any, len(attrs))
+	}
+	for _, a := range attrs {
+		s.data.Attributes[a.Key] = a.Value.Resolve().Any()
+	}
+}
+
+// SetError records the error of the operation, nil errors are ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and queues it for export. Only the first call has effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.data.Duration = time.Since(s.data.Start)
+	d := s.data
+	s.mu.Unlock()
+	s.tracer.finish(d)
+}
+
+func fillRandom(b []byte) {
+	for i := 0; i < len(b); i += 8 {
+		v := rand.Uint64()
+		for j := i; j < len(b) && j < i+8; j++ {
+			b[j] = byte(v)
+			v >>= 8
+		}
+	}
+}
+
+// Collect implements metrics.Collector.
+func (t *Tracer) Collect() []metrics.Family {
+	return []metrics.Family{{
+		Name:    "bcdb_trace_dropped_spans_total",
+		Help:    "Spans dropped by the full export queue.",
+		Type:    metrics.TypeCounter,
+		Samples: []metrics.Sample{{Value: float64(t.Dropped())}},
+	}}
+}
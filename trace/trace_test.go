@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var noopLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// memoryExporter keeps exported spans.
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *memoryExporter) Export(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Close() error { return nil }
+
+func TestTracer(t *testing.T) {
+	exp := &memoryExporter{}
+	tr, err := New(noopLogger, exp, Options{SampleRatio: 1})
+	require.NoError(t, err)
+
+	ctx, root := tr.Start(context.Background(), "request", slog.String("command", "SET"))
+	childCtx, child := Start(ctx, "engine", slog.Int("size", 3))
+	assert.Same(t, child, FromContext(childCtx))
+	child.SetError(errors.New("failed"))
+	child.End()
+	child.End()
+	root.End()
+	require.NoError(t, tr.Close())
+
+	require.Len(t, exp.spans, 2)
+	c, r := exp.spans[0], exp.spans[1]
+	assert.Equal(t, "engine", c.Name)
+	assert.Equal(t, r.TraceID, c.TraceID)
+	assert.Equal(t, r.SpanID, c.ParentID)
+	assert.Empty(t, r.ParentID)
+	assert.Len(t, r.TraceID, 32)
+	assert.Len(t, r.SpanID, 16)
+	assert.Equal(t, "failed", c.Error)
+	assert.Equal(t, map[string]any{"size": int64(3)}, c.Attributes)
+	assert.Equal(t, map[string]any{"command": "SET"}, r.Attributes)
+	assert.GreaterOrEqual(t, r.Duration, c.Duration)
+}
+
+func TestTracer_NotSampled(t *testing.T) {
+	var nilTracer *Tracer
+	ctx, span := nilTracer.Start(context.Background(), "request")
+	assert.Nil(t, span)
+
+	tr, err := New(noopLogger, &memoryExporter{}, Options{SampleRatio: 0})
+	require.NoError(t, err)
+	defer tr.Close()
+	ctx, span = tr.Start(ctx, "request")
+	assert.Nil(t, span)
+
+	// children of untraced requests are nil and safe to use
+	_, child := Start(ctx, "engine")
+	assert.Nil(t, child)
+	child.SetAttributes(slog.String("key", "value"))
+	child.SetError(errors.New("failed"))
+	child.End()
+}
+
+// blockingExporter blocks exports until release is closed.
+type blockingExporter struct {
+	memoryExporter
+	release chan struct{}
+}
+
+func (e *blockingExporter) Export(spans []SpanData) error {
+	<-e.release
+	return e.memoryExporter.Export(spans)
+}
+
+func TestTracer_Dropped(t *testing.T) {
+	exp := &blockingExporter{release: make(chan struct{})}
+	tr, err := New(noopLogger, exp, Options{SampleRatio: 1, QueueSize: 1})
+	require.NoError(t, err)
+
+	for range 5 {
+		_, span := tr.Start(context.Background(), "request")
+		span.End()
+	}
+	// one span is being exported, one is queued
+	assert.GreaterOrEqual(t, tr.Dropped(), uint64(3))
+	close(exp.release)
+	require.NoError(t, tr.Close())
+	assert.Equal(t, 5, len(exp.spans)+int(tr.Dropped()))
+
+	dropped := tr.Dropped()
+	_, span := tr.Start(context.Background(), "late")
+	span.End()
+	assert.Equal(t, dropped+1, tr.Dropped(), "spans after close are dropped")
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exp, err := NewFileExporter(path)
+	require.NoError(t, err)
+	tr, err := New(noopLogger, exp, Options{SampleRatio: 1})
+	require.NoError(t, err)
+
+	ctx, root := tr.Start(context.Background(), "request")
+	_, child := Start(ctx, "engine")
+	child.End()
+	root.End()
+	require.NoError(t, tr.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		assert.Contains(t, line, "trace_id")
+		assert.Contains(t, line, "duration_ns")
+		names = append(names, line["name"].(string))
+	}
+	assert.Equal(t, []string{"engine", "request"}, names)
+}